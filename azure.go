@@ -0,0 +1,236 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const azureStorageVersion = "2020-10-02"
+
+// isAzureURL reports whether path is an Azure Blob Storage blob like
+// az://container/name.
+func isAzureURL(path string) bool {
+	return strings.HasPrefix(path, "az://")
+}
+
+// azureBlob is a blob in a container of Azure Blob Storage.
+type azureBlob struct {
+	Container string
+	Name      string
+}
+
+func parseAzureURL(raw string) (azureBlob, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return azureBlob{}, err
+	}
+	name := strings.TrimPrefix(u.Path, "/")
+	if u.Scheme != "az" || u.Host == "" || name == "" {
+		return azureBlob{}, fmt.Errorf("Azure blobs need to be given as az://container/name: %s", raw)
+	}
+	return azureBlob{Container: u.Host, Name: name}, nil
+}
+
+// azureConfig is where and as whom blobs are uploaded, signed with the
+// account key or authorized by a shared access signature.
+type azureConfig struct {
+	// Endpoint of the blob service, https://ACCOUNT.blob.core.windows.net
+	// if empty.
+	Endpoint string
+	Account  string
+	Key      string
+	SAS      string
+}
+
+// azureConfigFromEnv reads the config the way the Azure CLI does, from
+// AZURE_STORAGE_CONNECTION_STRING or else AZURE_STORAGE_ACCOUNT with
+// AZURE_STORAGE_KEY or AZURE_STORAGE_SAS_TOKEN.
+func azureConfigFromEnv() (azureConfig, error) {
+	if conn := os.Getenv("AZURE_STORAGE_CONNECTION_STRING"); conn != "" {
+		return parseAzureConnectionString(conn)
+	}
+
+	cfg := azureConfig{
+		Account: os.Getenv("AZURE_STORAGE_ACCOUNT"),
+		Key:     os.Getenv("AZURE_STORAGE_KEY"),
+		SAS:     strings.TrimPrefix(os.Getenv("AZURE_STORAGE_SAS_TOKEN"), "?"),
+	}
+	if cfg.Account == "" || (cfg.Key == "" && cfg.SAS == "") {
+		return cfg, errors.New("no Azure credentials in AZURE_STORAGE_CONNECTION_STRING or " +
+			"AZURE_STORAGE_ACCOUNT with AZURE_STORAGE_KEY or AZURE_STORAGE_SAS_TOKEN")
+	}
+	return cfg, nil
+}
+
+// parseAzureConnectionString parses a connection string of a storage
+// account like AccountName=name;AccountKey=key;EndpointSuffix=core.windows.net.
+func parseAzureConnectionString(conn string) (azureConfig, error) {
+	var cfg azureConfig
+	protocol, suffix := "https", "core.windows.net"
+	for _, part := range strings.Split(conn, ";") {
+		if strings.TrimSpace(part) == "" {
+			continue
+		}
+		i := strings.Index(part, "=")
+		if i < 0 {
+			return cfg, fmt.Errorf("invalid part of the connection string: %s", part)
+		}
+		key, value := strings.TrimSpace(part[:i]), strings.TrimSpace(part[i+1:])
+		switch strings.ToLower(key) {
+		case "accountname":
+			cfg.Account = value
+		case "accountkey":
+			cfg.Key = value
+		case "sharedaccesssignature":
+			cfg.SAS = strings.TrimPrefix(value, "?")
+		case "blobendpoint":
+			cfg.Endpoint = value
+		case "defaultendpointsprotocol":
+			protocol = value
+		case "endpointsuffix":
+			suffix = value
+		}
+	}
+
+	if cfg.Endpoint == "" {
+		if cfg.Account == "" {
+			return cfg, errors.New("the connection string has neither AccountName nor BlobEndpoint")
+		}
+		cfg.Endpoint = protocol + "://" + cfg.Account + ".blob." + suffix
+	}
+	if cfg.Key == "" && cfg.SAS == "" {
+		return cfg, errors.New("the connection string has neither AccountKey nor SharedAccessSignature")
+	}
+	if cfg.Key != "" && cfg.Account == "" {
+		return cfg, errors.New("the connection string has an AccountKey without AccountName")
+	}
+	return cfg, nil
+}
+
+// azurePut uploads body as a block blob.
+func azurePut(cfg azureConfig, blob azureBlob, body []byte, now time.Time) error {
+	endpoint := cfg.Endpoint
+	if endpoint == "" {
+		endpoint = "https://" + cfg.Account + ".blob.core.windows.net"
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return err
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/" + blob.Container + "/" + blob.Name
+	if cfg.Key == "" {
+		u.RawQuery = cfg.SAS
+	}
+
+	req, err := http.NewRequest(http.MethodPut, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("X-Ms-Blob-Type", "BlockBlob")
+	req.Header.Set("X-Ms-Date", now.UTC().Format(http.TimeFormat))
+	req.Header.Set("X-Ms-Version", azureStorageVersion)
+	if cfg.Key != "" {
+		if err := signSharedKey(req, len(body), cfg.Account, cfg.Key); err != nil {
+			return err
+		}
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		snippet, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 256))
+		return fmt.Errorf("uploading az://%s/%s failed with %s: %s", blob.Container, blob.Name, resp.Status, snippet)
+	}
+	return nil
+}
+
+// signSharedKey signs req with the base64 encoded key of the account, the
+// way the Shared Key authorization of Azure Storage expects.
+func signSharedKey(req *http.Request, length int, account, key string) error {
+	secret, err := base64.StdEncoding.DecodeString(key)
+	if err != nil {
+		return fmt.Errorf("invalid Azure storage key: %v", err)
+	}
+
+	contentLength := ""
+	if length > 0 {
+		contentLength = strconv.Itoa(length)
+	}
+
+	var msHeaders []string
+	for name := range req.Header {
+		if lower := strings.ToLower(name); strings.HasPrefix(lower, "x-ms-") {
+			msHeaders = append(msHeaders, lower)
+		}
+	}
+	sort.Strings(msHeaders)
+	var canonicalHeaders strings.Builder
+	for _, name := range msHeaders {
+		canonicalHeaders.WriteString(name + ":" + strings.TrimSpace(req.Header.Get(name)) + "\n")
+	}
+
+	resource := "/" + account + req.URL.EscapedPath()
+	query := req.URL.Query()
+	var params []string
+	for name := range query {
+		params = append(params, name)
+	}
+	sort.Strings(params)
+	for _, name := range params {
+		values := append([]string(nil), query[name]...)
+		sort.Strings(values)
+		resource += "\n" + strings.ToLower(name) + ":" + strings.Join(values, ",")
+	}
+
+	stringToSign := strings.Join([]string{
+		req.Method,
+		req.Header.Get("Content-Encoding"),
+		req.Header.Get("Content-Language"),
+		contentLength,
+		req.Header.Get("Content-MD5"),
+		req.Header.Get("Content-Type"),
+		"", // Date, x-ms-date is used instead
+		req.Header.Get("If-Modified-Since"),
+		req.Header.Get("If-Match"),
+		req.Header.Get("If-None-Match"),
+		req.Header.Get("If-Unmodified-Since"),
+		req.Header.Get("Range"),
+		canonicalHeaders.String() + resource,
+	}, "\n")
+
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(stringToSign))
+	req.Header.Set("Authorization", "SharedKey "+account+":"+base64.StdEncoding.EncodeToString(mac.Sum(nil)))
+	return nil
+}
+
+// uploadAzure uploads body to the Azure URL with the config from the
+// environment.
+func uploadAzure(rawURL string, body []byte) error {
+	blob, err := parseAzureURL(rawURL)
+	if err != nil {
+		return err
+	}
+	cfg, err := azureConfigFromEnv()
+	if err != nil {
+		return err
+	}
+	return azurePut(cfg, blob, body, time.Now())
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseAzureURL(t *testing.T) {
+	blob, err := parseAzureURL("az://exports/prometheus/goroutines.csv.gz")
+	assert.NoError(t, err)
+	assert.Equal(t, azureBlob{Container: "exports", Name: "prometheus/goroutines.csv.gz"}, blob)
+
+	for _, invalid := range []string{"az://exports", "az://exports/", "az:///name", "gs://exports/name"} {
+		_, err := parseAzureURL(invalid)
+		assert.Error(t, err, invalid)
+	}
+
+	assert.True(t, isAzureURL("az://exports/name"))
+	assert.False(t, isAzureURL("exports/name"))
+}
+
+func TestParseAzureConnectionString(t *testing.T) {
+	cfg, err := parseAzureConnectionString("DefaultEndpointsProtocol=https;AccountName=styx;AccountKey=a2V5;EndpointSuffix=core.chinacloudapi.cn")
+	assert.NoError(t, err)
+	assert.Equal(t, azureConfig{Endpoint: "https://styx.blob.core.chinacloudapi.cn", Account: "styx", Key: "a2V5"}, cfg)
+
+	cfg, err = parseAzureConnectionString("BlobEndpoint=http://127.0.0.1:10000/devstoreaccount1;SharedAccessSignature=?sv=2020-10-02&sig=abc")
+	assert.NoError(t, err)
+	assert.Equal(t, azureConfig{Endpoint: "http://127.0.0.1:10000/devstoreaccount1", SAS: "sv=2020-10-02&sig=abc"}, cfg)
+
+	for _, invalid := range []string{"AccountName=styx", "AccountKey=a2V5", "BlobEndpoint=http://localhost;AccountKey=a2V5", "AccountName"} {
+		_, err := parseAzureConnectionString(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestSignSharedKey(t *testing.T) {
+	req, _ := http.NewRequest(http.MethodPut, "https://styx.blob.core.windows.net/exports/out.csv?comp=block&blockid=AA", nil)
+	req.Header.Set("X-Ms-Date", "Tue, 15 Aug 2017 12:00:00 GMT")
+	req.Header.Set("X-Ms-Version", azureStorageVersion)
+	req.Header.Set("Content-Type", "text/csv")
+
+	// The key is base64 of "secret".
+	assert.NoError(t, signSharedKey(req, 13, "styx", "c2VjcmV0"))
+	assert.Equal(t, "SharedKey styx:I7QzHDsebBsLg5JzM2CiaRcva7+Uzata5HC8NIVd8S8=", req.Header.Get("Authorization"))
+
+	assert.Error(t, signSharedKey(req, 0, "styx", "not base64!"))
+}
+
+func TestAzurePut(t *testing.T) {
+	var method, path, query, auth, blobType string
+	var body []byte
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		method, path, query = r.Method, r.URL.Path, r.URL.RawQuery
+		auth, blobType = r.Header.Get("Authorization"), r.Header.Get("X-Ms-Blob-Type")
+		body, _ = ioutil.ReadAll(r.Body)
+		if strings.HasSuffix(r.URL.Path, "/denied.csv") {
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte("<Error><Code>AuthorizationFailure</Code></Error>"))
+		}
+	}))
+	defer ts.Close()
+
+	now := time.Date(2017, 8, 15, 12, 0, 0, 0, time.UTC)
+	cfg := azureConfig{Endpoint: ts.URL + "/devstoreaccount1", Account: "devstoreaccount1", Key: "c2VjcmV0"}
+	err := azurePut(cfg, azureBlob{Container: "exports", Name: "day 1/out.csv"}, []byte("1502749390,1\n"), now)
+	assert.NoError(t, err)
+	assert.Equal(t, http.MethodPut, method)
+	assert.Equal(t, "/devstoreaccount1/exports/day 1/out.csv", path)
+	assert.Equal(t, "BlockBlob", blobType)
+	assert.True(t, strings.HasPrefix(auth, "SharedKey devstoreaccount1:"), auth)
+	assert.Equal(t, "1502749390,1\n", string(body))
+
+	cfg = azureConfig{Endpoint: ts.URL, SAS: "sv=2020-10-02&sig=abc"}
+	err = azurePut(cfg, azureBlob{Container: "exports", Name: "denied.csv"}, nil, now)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "AuthorizationFailure")
+	assert.Equal(t, "sv=2020-10-02&sig=abc", query)
+	assert.Empty(t, auth)
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// azureMonitorResource is the resource the tokens for querying the
+// Prometheus endpoints of Azure Monitor workspaces are for.
+const azureMonitorResource = "https://prometheus.monitor.azure.com"
+
+// azureAccessToken returns an Azure AD access token for the resource with
+// the credentials found the way the Azure SDKs do: a service principal with
+// AZURE_TENANT_ID, AZURE_CLIENT_ID and AZURE_CLIENT_SECRET, a workload
+// identity of AKS with AZURE_FEDERATED_TOKEN_FILE instead of the secret, or
+// else the managed identity of the VM or App Service, the user-assigned one
+// of AZURE_CLIENT_ID if set.
+func azureAccessToken(client *http.Client, resource string, now time.Time) (accessToken, error) {
+	tenant, clientID := os.Getenv("AZURE_TENANT_ID"), os.Getenv("AZURE_CLIENT_ID")
+	if tenant != "" && clientID != "" {
+		form := url.Values{}
+		form.Set("grant_type", "client_credentials")
+		form.Set("client_id", clientID)
+		form.Set("scope", resource+"/.default")
+		switch {
+		case os.Getenv("AZURE_CLIENT_SECRET") != "":
+			form.Set("client_secret", os.Getenv("AZURE_CLIENT_SECRET"))
+			return azureClientToken(client, tenant, form, now)
+		case os.Getenv("AZURE_FEDERATED_TOKEN_FILE") != "":
+			assertion, err := readSecret(os.Getenv("AZURE_FEDERATED_TOKEN_FILE"))
+			if err != nil {
+				return accessToken{}, err
+			}
+			form.Set("client_assertion_type", "urn:ietf:params:oauth:client-assertion-type:jwt-bearer")
+			form.Set("client_assertion", assertion)
+			return azureClientToken(client, tenant, form, now)
+		}
+	}
+	return azureManagedIdentityToken(metadataClient, resource, clientID, now)
+}
+
+// azureClientToken gets a token of a service principal or workload identity
+// from the tenant with the client credentials in form. AZURE_AUTHORITY_HOST
+// overrides login.microsoftonline.com, e.g. for national clouds.
+func azureClientToken(client *http.Client, tenant string, form url.Values, now time.Time) (accessToken, error) {
+	authority := os.Getenv("AZURE_AUTHORITY_HOST")
+	if authority == "" {
+		authority = "https://login.microsoftonline.com"
+	}
+	u := strings.TrimSuffix(authority, "/") + "/" + url.PathEscape(tenant) + "/oauth2/v2.0/token"
+
+	resp, err := client.PostForm(u, form)
+	if err != nil {
+		return accessToken{}, err
+	}
+	return decodeAccessToken(resp, now)
+}
+
+// azureManagedIdentityToken gets a token of the managed identity from the
+// IDENTITY_ENDPOINT of App Service and Functions, or else from the instance
+// metadata service, AZURE_POD_IDENTITY_AUTHORITY_HOST overrides its address.
+func azureManagedIdentityToken(client *http.Client, resource, clientID string, now time.Time) (accessToken, error) {
+	query := url.Values{}
+	query.Set("resource", resource)
+	if clientID != "" {
+		query.Set("client_id", clientID)
+	}
+
+	var req *http.Request
+	var err error
+	if endpoint := os.Getenv("IDENTITY_ENDPOINT"); endpoint != "" && os.Getenv("IDENTITY_HEADER") != "" {
+		query.Set("api-version", "2019-08-01")
+		if req, err = http.NewRequest(http.MethodGet, endpoint+"?"+query.Encode(), nil); err != nil {
+			return accessToken{}, err
+		}
+		req.Header.Set("X-Identity-Header", os.Getenv("IDENTITY_HEADER"))
+	} else {
+		host := os.Getenv("AZURE_POD_IDENTITY_AUTHORITY_HOST")
+		if host == "" {
+			host = "http://169.254.169.254"
+		}
+		query.Set("api-version", "2018-02-01")
+		u := strings.TrimSuffix(host, "/") + "/metadata/identity/oauth2/token?" + query.Encode()
+		if req, err = http.NewRequest(http.MethodGet, u, nil); err != nil {
+			return accessToken{}, err
+		}
+		req.Header.Set("Metadata", "true")
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return accessToken{}, fmt.Errorf("no Azure credentials in AZURE_TENANT_ID and AZURE_CLIENT_ID with "+
+			"AZURE_CLIENT_SECRET or AZURE_FEDERATED_TOKEN_FILE, nor a managed identity: %v", err)
+	}
+	token, err := decodeAccessToken(resp, now)
+	if err != nil {
+		return accessToken{}, fmt.Errorf("the managed identity has no token: %v", err)
+	}
+	return token, nil
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAzureAccessToken(t *testing.T) {
+	var path string
+	var query, form map[string][]string
+	var header http.Header
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		path, query, form, header = r.URL.Path, r.URL.Query(), r.PostForm, r.Header
+		// Managed identities send expires_in as a string
+		w.Write([]byte(`{"access_token":"eyJ0.token","expires_in":"3599","token_type":"Bearer"}`))
+	}))
+	defer ts.Close()
+
+	now := time.Unix(1502749390, 0)
+	t.Setenv("AZURE_AUTHORITY_HOST", ts.URL)
+	t.Setenv("AZURE_POD_IDENTITY_AUTHORITY_HOST", ts.URL)
+	t.Setenv("IDENTITY_ENDPOINT", "")
+	t.Setenv("AZURE_TENANT_ID", "tenant-1")
+	t.Setenv("AZURE_CLIENT_ID", "client-1")
+	t.Setenv("AZURE_CLIENT_SECRET", "secret")
+	t.Setenv("AZURE_FEDERATED_TOKEN_FILE", "")
+
+	token, err := azureAccessToken(http.DefaultClient, azureMonitorResource, now)
+	assert.NoError(t, err)
+	assert.Equal(t, accessToken{Token: "eyJ0.token", Expires: now.Add(3599 * time.Second)}, token)
+	assert.Equal(t, "/tenant-1/oauth2/v2.0/token", path)
+	assert.Equal(t, "client_credentials", form["grant_type"][0])
+	assert.Equal(t, "secret", form["client_secret"][0])
+	assert.Equal(t, "https://prometheus.monitor.azure.com/.default", form["scope"][0])
+
+	// The workload identity of AKS
+	federated := filepath.Join(t.TempDir(), "token")
+	assert.NoError(t, ioutil.WriteFile(federated, []byte("eyJ.federated\n"), 0600))
+	t.Setenv("AZURE_CLIENT_SECRET", "")
+	t.Setenv("AZURE_FEDERATED_TOKEN_FILE", federated)
+	_, err = azureAccessToken(http.DefaultClient, azureMonitorResource, now)
+	assert.NoError(t, err)
+	assert.Equal(t, "eyJ.federated", form["client_assertion"][0])
+	assert.Empty(t, form["client_secret"])
+
+	// The user-assigned managed identity of the VM
+	t.Setenv("AZURE_TENANT_ID", "")
+	_, err = azureAccessToken(http.DefaultClient, azureMonitorResource, now)
+	assert.NoError(t, err)
+	assert.Equal(t, "/metadata/identity/oauth2/token", path)
+	assert.Equal(t, "true", header.Get("Metadata"))
+	assert.Equal(t, azureMonitorResource, query["resource"][0])
+	assert.Equal(t, "client-1", query["client_id"][0])
+
+	// App Service
+	t.Setenv("IDENTITY_ENDPOINT", ts.URL+"/msi/token")
+	t.Setenv("IDENTITY_HEADER", "header")
+	_, err = azureAccessToken(http.DefaultClient, azureMonitorResource, now)
+	assert.NoError(t, err)
+	assert.Equal(t, "/msi/token", path)
+	assert.Equal(t, "header", header.Get("X-Identity-Header"))
+	assert.Equal(t, "2019-08-01", query["api-version"][0])
+}
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/urfave/cli"
+)
+
+type batchFlags struct {
+	Only   cli.StringSlice
+	DryRun bool
+}
+
+var batchFlag batchFlags
+
+// batchExport is a named export of a manifest. Its flags are the flags of
+// the export, like the ones of a profile.
+type batchExport struct {
+	Name  string
+	Flags []profileFlag
+}
+
+// batchAliases are the keys of a manifest named like the settings of a
+// Grafana panel instead of the flags.
+var batchAliases = map[string]string{
+	"legend": "column-template",
+	"expr":   "query",
+}
+
+func batchAction(c *cli.Context) error {
+	path := c.Args().First()
+	if path == "" {
+		return errors.New(color.RedString("need a manifest with the exports to run"))
+	}
+	exports, err := readManifest(path)
+	if err != nil {
+		return errors.New(color.RedString(err.Error()))
+	}
+	exports, err = onlyExports(exports, batchFlag.Only)
+	if err != nil {
+		return errors.New(color.RedString(err.Error()))
+	}
+
+	if batchFlag.DryRun {
+		for _, export := range exports {
+			quoted := []string{"styx"}
+			for _, arg := range export.args() {
+				quoted = append(quoted, shellQuote(arg))
+			}
+			fmt.Println(strings.Join(quoted, " "))
+		}
+		return nil
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Every export runs even if one fails, like the others of a report.
+	failed := 0
+	for _, export := range exports {
+		if err := runExport(ctx, exe, export, os.Stdout, os.Stderr); err != nil {
+			fmt.Fprintln(os.Stderr, color.RedString("export %s failed: %v", export.Name, err))
+			failed++
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+	}
+	if failed > 0 {
+		return errors.New(color.RedString("%d of %d exports failed", failed, len(exports)))
+	}
+	return nil
+}
+
+// runExport runs the export as a separate process of styx, so exports
+// don't share any state, like runJob does for the daemon.
+func runExport(ctx context.Context, exe string, export batchExport, stdout, stderr io.Writer) error {
+	started := time.Now()
+	cmd := exec.CommandContext(ctx, exe, export.args()...)
+	cmd.Stdout, cmd.Stderr = stdout, stderr
+	if err := cmd.Run(); err != nil {
+		return err
+	}
+	fmt.Fprintf(stderr, "export %s: done in %s\n", export.Name, time.Since(started).Round(time.Millisecond))
+	return nil
+}
+
+// args returns the arguments of the export command running the export.
+func (e batchExport) args() []string {
+	var args []string
+	for _, flag := range e.Flags {
+		for _, value := range flag.Values {
+			args = append(args, "--"+flag.Name+"="+value)
+		}
+	}
+	return args
+}
+
+// onlyExports returns the exports with the given names, all if there are none.
+func onlyExports(exports []batchExport, names []string) ([]batchExport, error) {
+	if len(names) == 0 {
+		return exports, nil
+	}
+	byName := make(map[string]batchExport, len(exports))
+	for _, export := range exports {
+		byName[export.Name] = export
+	}
+
+	var only []batchExport
+	for _, name := range names {
+		export, ok := byName[name]
+		if !ok {
+			return nil, fmt.Errorf("there is no export %s", name)
+		}
+		only = append(only, export)
+	}
+	return only, nil
+}
+
+// readManifest reads the exports of a manifest, sorted by name. It's YAML
+// like the config file, with the exports given like profiles:
+//
+//	exports:
+//	  goroutines:
+//	    query: sum by (job) (go_goroutines)
+//	    legend: '{{.job}}'
+//	    step: 1m
+//	    format: csv
+//	    output: goroutines.csv
+//
+// Files ending in .json are JSON of the same structure instead, with
+// strings, numbers, booleans or lists of them as values.
+func readManifest(path string) ([]batchExport, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries map[string][]profileFlag
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		entries, err = parseJSONManifest(f)
+	} else {
+		entries, err = parseConfigSection(f, "exports")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+
+	var exports []batchExport
+	for name, flags := range entries {
+		export := batchExport{Name: name}
+		query := false
+		for _, flag := range flags {
+			if alias, ok := batchAliases[flag.Name]; ok {
+				flag.Name = alias
+			}
+			query = query || flag.Name == "query" || flag.Name == "queries-file"
+			export.Flags = append(export.Flags, flag)
+		}
+		if !query {
+			return nil, fmt.Errorf("%s: export %s has no query", path, name)
+		}
+		exports = append(exports, export)
+	}
+	if len(exports) == 0 {
+		return nil, fmt.Errorf("there are no exports in %s", path)
+	}
+	sort.Slice(exports, func(i, j int) bool { return exports[i].Name < exports[j].Name })
+
+	return exports, nil
+}
+
+// parseJSONManifest reads the exports of a JSON manifest like
+// {"exports": {"goroutines": {"query": "sum(go_goroutines)", "step": "1m"}}}.
+func parseJSONManifest(r io.Reader) (map[string][]profileFlag, error) {
+	var manifest struct {
+		Exports map[string]map[string]json.RawMessage `json:"exports"`
+	}
+	if err := json.NewDecoder(r).Decode(&manifest); err != nil {
+		return nil, err
+	}
+
+	entries := make(map[string][]profileFlag, len(manifest.Exports))
+	for name, settings := range manifest.Exports {
+		keys := make([]string, 0, len(settings))
+		for key := range settings {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		flags := []profileFlag{}
+		for _, key := range keys {
+			values, err := jsonValues(settings[key])
+			if err != nil {
+				return nil, fmt.Errorf("export %s: %s: %v", name, key, err)
+			}
+			flags = append(flags, profileFlag{Name: key, Values: values})
+		}
+		entries[name] = flags
+	}
+	return entries, nil
+}
+
+// jsonValues returns a scalar as a single value and a list as its values.
+func jsonValues(raw json.RawMessage) ([]string, error) {
+	var list []json.RawMessage
+	if err := json.Unmarshal(raw, &list); err != nil {
+		value, err := jsonScalar(raw)
+		if err != nil {
+			return nil, err
+		}
+		return []string{value}, nil
+	}
+
+	values := make([]string, len(list))
+	for i, item := range list {
+		value, err := jsonScalar(item)
+		if err != nil {
+			return nil, err
+		}
+		values[i] = value
+	}
+	return values, nil
+}
+
+// jsonScalar returns a string, number or boolean as the flag's value.
+func jsonScalar(raw json.RawMessage) (string, error) {
+	var s string
+	if err := json.Unmarshal(raw, &s); err == nil {
+		return s, nil
+	}
+	var n json.Number
+	if err := json.Unmarshal(raw, &n); err == nil {
+		return n.String(), nil
+	}
+	var b bool
+	if err := json.Unmarshal(raw, &b); err == nil {
+		return fmt.Sprint(b), nil
+	}
+	return "", fmt.Errorf("expected a string, number, boolean or a list of them, got %s", raw)
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/urfave/cli"
+)
+
+func TestReadManifest(t *testing.T) {
+	dir, err := ioutil.TempDir("", "styx")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "report.yaml")
+	assert.NoError(t, ioutil.WriteFile(path, []byte(`exports:
+  goroutines:
+    expr: sum by (job) (go_goroutines)
+    legend: '{{.job}}'
+    step: 1m
+    output: goroutines.csv
+  cpu:
+    query:
+      - sum(rate(node_cpu_seconds_total[5m]))
+      - sum(node_load1)
+    format: xlsx
+    output: cpu.xlsx
+`), 0644))
+
+	exports, err := readManifest(path)
+	assert.NoError(t, err)
+	assert.Len(t, exports, 2)
+	assert.Equal(t, "cpu", exports[0].Name)
+	assert.Equal(t, []string{
+		"--query=sum(rate(node_cpu_seconds_total[5m]))",
+		"--query=sum(node_load1)",
+		"--format=xlsx",
+		"--output=cpu.xlsx",
+	}, exports[0].args())
+	assert.Equal(t, []string{
+		"--query=sum by (job) (go_goroutines)",
+		"--column-template={{.job}}",
+		"--step=1m",
+		"--output=goroutines.csv",
+	}, exports[1].args())
+
+	only, err := onlyExports(exports, cli.StringSlice{"goroutines"})
+	assert.NoError(t, err)
+	assert.Equal(t, exports[1:], only)
+	_, err = onlyExports(exports, cli.StringSlice{"memory"})
+	assert.Error(t, err)
+
+	// Exports need a query.
+	assert.NoError(t, ioutil.WriteFile(path, []byte("exports:\n  empty:\n    step: 1m\n"), 0644))
+	_, err = readManifest(path)
+	assert.Error(t, err)
+}
+
+func TestReadJSONManifest(t *testing.T) {
+	dir, err := ioutil.TempDir("", "styx")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "report.json")
+	assert.NoError(t, ioutil.WriteFile(path, []byte(`{"exports": {
+		"goroutines": {"query": ["sum(go_goroutines)", "sum(go_threads)"], "points": 500, "grid": true, "output": "goroutines.csv"}
+	}}`), 0644))
+
+	exports, err := readManifest(path)
+	assert.NoError(t, err)
+	assert.Len(t, exports, 1)
+	assert.Equal(t, []string{
+		"--grid=true",
+		"--output=goroutines.csv",
+		"--points=500",
+		"--query=sum(go_goroutines)",
+		"--query=sum(go_threads)",
+	}, exports[0].args())
+
+	assert.NoError(t, ioutil.WriteFile(path, []byte(`{"exports": {"up": {"query": {"nested": true}}}}`), 0644))
+	_, err = readManifest(path)
+	assert.Error(t, err)
+}
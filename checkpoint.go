@@ -0,0 +1,147 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/go-pluto/styx/pkg/styx"
+)
+
+// checkpoint records which chunks of an export succeeded, so a rerun
+// after a failure only queries the remaining chunks. The response of
+// every finished chunk is recorded into a file next to the checkpoint.
+type checkpoint struct {
+	path string
+	// mu guards Done and the file while chunks are queried in parallel.
+	mu sync.Mutex
+
+	Query string `json:"query"`
+	Start int64  `json:"start"`
+	End   int64  `json:"end"`
+	Step  int    `json:"step"`
+	Chunk int64  `json:"chunk"`
+	// Done maps the start of finished chunks to their recorded response.
+	Done map[int64]string `json:"done"`
+}
+
+// openCheckpoint loads the checkpoint at path to resume an export of query,
+// if there is none a new checkpoint is started with the given settings.
+func openCheckpoint(path, query string, start, end time.Time, step int, chunk time.Duration) (*checkpoint, error) {
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return &checkpoint{
+			path:  path,
+			Query: query,
+			Start: start.Unix(),
+			End:   end.Unix(),
+			Step:  step,
+			Chunk: int64(chunk / time.Second),
+			Done:  make(map[int64]string),
+		}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	cp := &checkpoint{path: path}
+	if err := json.Unmarshal(data, cp); err != nil {
+		return nil, fmt.Errorf("can't read checkpoint %s: %v", path, err)
+	}
+	if cp.Query != query {
+		return nil, fmt.Errorf("checkpoint %s belongs to another query: %s", path, cp.Query)
+	}
+	if cp.Done == nil {
+		cp.Done = make(map[int64]string)
+	}
+
+	return cp, nil
+}
+
+// chunkFile returns the file the response of the chunk starting at start is recorded into.
+func (c *checkpoint) chunkFile(start time.Time) string {
+	return fmt.Sprintf("%s.%d.json", c.path, start.Unix())
+}
+
+// done marks the chunk starting at start as finished and saves the checkpoint.
+func (c *checkpoint) done(start time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.Done[start.Unix()] = c.chunkFile(start)
+
+	data, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+
+	// Write into a temporary file first, so a crash can't leave a corrupt checkpoint.
+	tmp := c.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, c.path)
+}
+
+// remove deletes the checkpoint and all recorded responses once the export succeeded.
+func (c *checkpoint) remove() error {
+	for _, file := range c.Done {
+		if err := os.Remove(file); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	if err := os.Remove(c.path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// queryChunks runs the query for every chunk, up to opts.Parallelism at
+// once, and merges the results. With a checkpoint, chunks that are done are
+// replayed from their recorded response.
+func queryChunks(host, query string, ranges []styx.TimeRange, opts styx.Options, cp *checkpoint) ([]styx.Result, error) {
+	sets := make([][]styx.Result, len(ranges))
+	err := styx.Parallel(len(ranges), opts.Parallelism, func(i int) error {
+		chunk := ranges[i]
+		chunkOpts := opts
+		chunkOpts.Parallelism = 1
+		done := false
+		if cp != nil {
+			var file string
+			cp.mu.Lock()
+			file, done = cp.Done[chunk.Start.Unix()]
+			cp.mu.Unlock()
+			if done {
+				chunkOpts.Transport = styx.ReplayTransport{Path: file}
+			} else {
+				chunkOpts.Transport = styx.RecordTransport{Path: cp.chunkFile(chunk.Start), Next: opts.Transport}
+			}
+		}
+
+		results, err := styx.Query(host, chunk.Start, chunk.End, query, chunkOpts)
+		if err != nil && err != styx.ErrNoTimeseries {
+			return err
+		}
+
+		if cp != nil && !done {
+			if err := cp.done(chunk.Start); err != nil {
+				return err
+			}
+		}
+		sets[i] = results
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	merged := styx.MergeResults(sets...)
+	if len(merged) == 0 {
+		return nil, styx.ErrNoTimeseries
+	}
+
+	return merged, nil
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-pluto/styx/pkg/styx"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQueryChunksResume(t *testing.T) {
+	dir, err := ioutil.TempDir("", "styx-checkpoint")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "export.checkpoint")
+
+	var queried []string
+	fail := "1502749260"
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		chunkStart := r.URL.Query().Get("start")
+		queried = append(queried, chunkStart)
+		if chunkStart == fail {
+			http.Error(w, "connection reset", http.StatusBadGateway)
+			return
+		}
+		fmt.Fprintf(w, `{"status":"success","data":{"resultType":"matrix","result":[{"metric":{"__name__":"up"},"values":[[%s,"1"]]}]}}`, chunkStart)
+	}))
+	defer ts.Close()
+
+	start, end := time.Unix(1502749200, 0), time.Unix(1502749379, 0)
+
+	// The second of three chunks fails
+	cp, err := openCheckpoint(path, "up", start, end, 60, time.Minute)
+	assert.NoError(t, err)
+	_, err = queryChunks(ts.URL, "up", styx.Chunks(start, end, time.Minute, 60), styx.Options{Step: 60}, cp)
+	assert.Error(t, err)
+	assert.Equal(t, []string{"1502749200", "1502749260"}, queried)
+
+	// The rerun resumes with the second chunk, even if it's started later
+	queried, fail = nil, ""
+	cp, err = openCheckpoint(path, "up", start.Add(time.Hour), end.Add(time.Hour), 1, time.Hour)
+	assert.NoError(t, err)
+	assert.Equal(t, start.Unix(), cp.Start)
+	assert.Equal(t, int64(60), cp.Chunk)
+
+	ranges := styx.Chunks(time.Unix(cp.Start, 0), time.Unix(cp.End, 0), time.Duration(cp.Chunk)*time.Second, cp.Step)
+	results, err := queryChunks(ts.URL, "up", ranges, styx.Options{Step: cp.Step}, cp)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"1502749260", "1502749320"}, queried)
+	assert.Equal(t, []int64{1502749200, 1502749260, 1502749320}, results[0].Times)
+	assert.Equal(t, []float64{1, 1, 1}, results[0].Values)
+
+	// Once the export is complete all files are gone
+	assert.NoError(t, cp.remove())
+	files, err := ioutil.ReadDir(dir)
+	assert.NoError(t, err)
+	assert.Len(t, files, 0)
+
+	// A checkpoint can't be resumed with another query
+	assert.NoError(t, cp.done(start))
+	_, err = openCheckpoint(path, "down", start, end, 60, time.Minute)
+	assert.Error(t, err)
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"errors"
+
+	"github.com/go-pluto/styx/pkg/styx"
+	"github.com/urfave/cli"
+)
+
+// clampFlags are the flags of commands clamping outliers before charting.
+type clampFlags struct {
+	Percentile float64
+	Max        float64
+}
+
+func (f *clampFlags) flags() []cli.Flag {
+	return []cli.Flag{
+		cli.Float64Flag{
+			Name:        "clamp-percentile",
+			Usage:       "Clamp values above this percentile of their timeseries, e.g. 99",
+			Destination: &f.Percentile,
+		},
+		cli.Float64Flag{
+			Name:        "clamp-max",
+			Usage:       "Clamp values above this, instead of a percentile",
+			Destination: &f.Max,
+		},
+	}
+}
+
+// clamp applies the flags to the results, see styx.Clamp.
+func (f *clampFlags) clamp(results []styx.Result) ([]styx.Result, []styx.Result, error) {
+	if f.Percentile < 0 || f.Percentile > 100 {
+		return nil, nil, errors.New("the percentile to clamp at needs to be between 0 and 100")
+	}
+	if f.Percentile > 0 && f.Max != 0 {
+		return nil, nil, errors.New("can't clamp at a percentile and a maximum at the same time")
+	}
+	clamped, outliers := styx.Clamp(results, f.Percentile, f.Max)
+	return clamped, outliers, nil
+}
@@ -0,0 +1,16 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClampFlags(t *testing.T) {
+	_, _, err := (&clampFlags{Percentile: 101}).clamp(nil)
+	assert.Error(t, err)
+	_, _, err = (&clampFlags{Percentile: 99, Max: 10}).clamp(nil)
+	assert.Error(t, err)
+	_, _, err = (&clampFlags{Percentile: 99}).clamp(nil)
+	assert.NoError(t, err)
+}
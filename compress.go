@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/fatih/color"
+)
+
+// compression returns how output to path is compressed: as --compress
+// says or else as its extension, .gz or .zst, says. It's empty if the
+// output isn't compressed.
+func (f flags) compression(path string) string {
+	switch {
+	case f.Compress != "":
+		return f.Compress
+	case isGzip(path):
+		return "gzip"
+	case isZstd(path):
+		return "zstd"
+	}
+	return ""
+}
+
+// resolveCompress returns an error if --compress isn't known, and turns the
+// deprecated --gzip into --compress gzip so nothing else looks at it.
+func (f *flags) resolveCompress() error {
+	if f.Gzip {
+		if f.Compress != "" && f.Compress != "gzip" {
+			return fmt.Errorf("--gzip can't be combined with --compress %s", f.Compress)
+		}
+		fmt.Fprintln(os.Stderr, color.YellowString("warning: --gzip is deprecated, use --compress gzip"))
+		f.Gzip, f.Compress = false, "gzip"
+	}
+	switch f.Compress {
+	case "", "gzip", "zstd":
+		return nil
+	}
+	return fmt.Errorf("unknown compression: %s", f.Compress)
+}
+
+// writeCompressed compresses everything write writes to w with the
+// compression.
+func writeCompressed(w io.Writer, compression string, write func(io.Writer) error) error {
+	if compression == "zstd" {
+		return writeZstd(w, write)
+	}
+	return writeGzip(w, write)
+}
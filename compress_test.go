@@ -0,0 +1,24 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompression(t *testing.T) {
+	assert.Equal(t, "", flags{}.compression("out.csv"))
+	assert.Equal(t, "gzip", flags{}.compression("out.csv.gz"))
+	assert.Equal(t, "zstd", flags{}.compression("s3://exports/out.csv.zst"))
+	assert.Equal(t, "zstd", flags{Compress: "zstd"}.compression("out.csv"))
+
+	f := flags{Gzip: true}
+	assert.NoError(t, f.resolveCompress())
+	assert.Equal(t, flags{Compress: "gzip"}, f)
+	assert.Equal(t, "gzip", f.compression(""))
+
+	assert.NoError(t, (&flags{Compress: "zstd"}).resolveCompress())
+	assert.NoError(t, (&flags{Gzip: true, Compress: "gzip"}).resolveCompress())
+	assert.Error(t, (&flags{Compress: "xz"}).resolveCompress())
+	assert.Error(t, (&flags{Gzip: true, Compress: "zstd"}).resolveCompress())
+}
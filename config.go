@@ -0,0 +1,224 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/urfave/cli"
+)
+
+// defaultConfig is the config file read for --profile unless --config is given.
+const defaultConfig = "~/.styx.yaml"
+
+// profileFlag is a flag set by a profile, lists set it several times.
+type profileFlag struct {
+	Name   string
+	Values []string
+}
+
+// applyProfile sets the flags of the --profile from the config file before
+// a command runs. Flags given on the command line or by their environment
+// variable win, flags the command doesn't have are skipped as profiles are
+// shared by all commands. Afterwards a --google-project sets --prometheus
+// unless the profile did.
+func applyProfile(c *cli.Context) error {
+	prometheus := c.String("prometheus")
+	if err := applyConfigProfile(c); err != nil {
+		return err
+	}
+	if c.String("prometheus") != prometheus {
+		// The profile has a Prometheus
+		return nil
+	}
+	return applyGoogleProject(c)
+}
+
+// applyGoogleProject points --prometheus at the Prometheus API of Google
+// Cloud Managed Service for Prometheus of the --google-project, unless it's
+// given as well.
+func applyGoogleProject(c *cli.Context) error {
+	project := c.String("google-project")
+	if project == "" || c.Generic("prometheus") == nil || c.IsSet("prometheus") {
+		return nil
+	}
+	return c.Set("prometheus", gmpURL(project))
+}
+
+// applyConfigProfile sets the flags of the --profile, see applyProfile.
+func applyConfigProfile(c *cli.Context) error {
+	// The profile may also be given before the command, styx --profile prod gnuplot ...
+	name, path := c.String("profile"), c.String("config")
+	if name == "" {
+		name, path = c.GlobalString("profile"), c.GlobalString("config")
+	}
+	if name == "" {
+		return nil
+	}
+	if path == "" {
+		path = defaultConfig
+	}
+	f, err := os.Open(expandHome(path))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	profiles, err := parseConfig(f)
+	if err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+	profile, ok := profiles[name]
+	if !ok {
+		return fmt.Errorf("there is no profile %s in %s", name, path)
+	}
+
+	for _, flag := range profile {
+		// Generic is nil for flags the command doesn't have.
+		if c.Generic(flag.Name) == nil || flag.Name == "profile" || flag.Name == "config" || c.IsSet(flag.Name) {
+			continue
+		}
+		for _, value := range flag.Values {
+			if err := c.Set(flag.Name, expandHome(value)); err != nil {
+				return fmt.Errorf("profile %s sets %s: %v", name, flag.Name, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// parseConfig reads the profiles of a config file like
+//
+//	profiles:
+//	  prod:
+//	    prometheus: https://prom.example.com
+//	    token-file: ~/.styx/prod-token
+//	    http-header:
+//	      - 'X-Scope-OrgID: prod'
+//
+// It's the subset of YAML needed for profiles of flags. The keys are the
+// names of the flags, a list gives a flag several times.
+func parseConfig(r io.Reader) (map[string][]profileFlag, error) {
+	return parseConfigSection(r, "profiles")
+}
+
+// parseConfigSection reads the entries of a section of the config file,
+// profiles, the jobs of the daemon or the exports of a batch manifest,
+// which are given like profiles.
+func parseConfigSection(r io.Reader, section string) (map[string][]profileFlag, error) {
+	profiles := make(map[string][]profileFlag)
+
+	var profile string
+	profileIndent, flagIndent := -1, -1
+	list, skip := false, false
+
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimRight(scanner.Text(), " \r")
+		trimmed := strings.TrimLeft(line, " ")
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		if strings.HasPrefix(trimmed, "\t") {
+			return nil, fmt.Errorf("line %d: indent with spaces, not tabs", n)
+		}
+		indent := len(line) - len(trimmed)
+
+		switch {
+		case indent == 0:
+			name := strings.TrimSuffix(trimmed, ":")
+			if !strings.HasSuffix(trimmed, ":") || name != "profiles" && name != "jobs" && name != "exports" {
+				return nil, fmt.Errorf("line %d: expected profiles:, jobs: or exports:", n)
+			}
+			profileIndent, list, skip = -1, false, name != section
+		case skip:
+			continue
+		case strings.HasPrefix(trimmed, "- ") || trimmed == "-":
+			if !list || indent < flagIndent {
+				return nil, fmt.Errorf("line %d: a list item needs a flag without a value", n)
+			}
+			value, err := configValue(strings.TrimPrefix(trimmed, "-"))
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %v", n, err)
+			}
+			flags := profiles[profile]
+			flags[len(flags)-1].Values = append(flags[len(flags)-1].Values, value)
+		case profileIndent == -1 || indent == profileIndent:
+			key, value, err := configKeyValue(trimmed)
+			if err != nil || value != "" {
+				return nil, fmt.Errorf("line %d: expected the name of a profile", n)
+			}
+			profile, profileIndent, flagIndent, list = key, indent, -1, false
+			profiles[profile] = []profileFlag{}
+		case indent > profileIndent && (flagIndent == -1 || indent == flagIndent):
+			key, value, err := configKeyValue(trimmed)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %v", n, err)
+			}
+			flagIndent = indent
+			list = value == ""
+
+			flag := profileFlag{Name: key}
+			if !list {
+				flag.Values = []string{value}
+			}
+			profiles[profile] = append(profiles[profile], flag)
+		default:
+			return nil, fmt.Errorf("line %d: unexpected indent", n)
+		}
+	}
+
+	return profiles, scanner.Err()
+}
+
+// configKeyValue splits a line like key: value, the value may be empty.
+func configKeyValue(line string) (string, string, error) {
+	i := strings.Index(line, ":")
+	if i <= 0 || (i+1 < len(line) && line[i+1] != ' ') {
+		return "", "", fmt.Errorf("expected key: value, got %s", line)
+	}
+	value, err := configValue(line[i+1:])
+	return strings.TrimSpace(line[:i]), value, err
+}
+
+// configValue returns a plain, single or double quoted scalar without a
+// trailing comment.
+func configValue(s string) (string, error) {
+	s = strings.TrimSpace(s)
+	switch {
+	case strings.HasPrefix(s, `"`):
+		end := strings.LastIndex(s, `"`)
+		if end == 0 {
+			return "", fmt.Errorf("unterminated string %s", s)
+		}
+		return strconv.Unquote(s[:end+1])
+	case strings.HasPrefix(s, "'"):
+		end := strings.LastIndex(s, "'")
+		if end == 0 {
+			return "", fmt.Errorf("unterminated string %s", s)
+		}
+		return strings.Replace(s[1:end], "''", "'", -1), nil
+	}
+
+	if i := strings.Index(s, " #"); i >= 0 {
+		s = strings.TrimSpace(s[:i])
+	}
+	return s, nil
+}
+
+// expandHome replaces a leading ~ with the home directory.
+func expandHome(path string) string {
+	if path != "~" && !strings.HasPrefix(path, "~/") {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+	return filepath.Join(home, path[1:])
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/urfave/cli"
+)
+
+const testConfig = `# clusters
+profiles:
+  prod:
+    prometheus: https://prom.example.com # the proxy
+    token-file: "/etc/styx/prod token"
+    retries: 5
+    timeout: 10m
+    format: xlsx
+    http-header:
+      - 'X-Scope-OrgID: prod'
+      - "X-Team: it's"
+  lab:
+    prometheus: http://lab:9090
+    insecure-skip-verify: true
+`
+
+func TestParseConfig(t *testing.T) {
+	profiles, err := parseConfig(strings.NewReader(testConfig))
+	assert.NoError(t, err)
+	assert.Equal(t, map[string][]profileFlag{
+		"prod": {
+			{Name: "prometheus", Values: []string{"https://prom.example.com"}},
+			{Name: "token-file", Values: []string{"/etc/styx/prod token"}},
+			{Name: "retries", Values: []string{"5"}},
+			{Name: "timeout", Values: []string{"10m"}},
+			{Name: "format", Values: []string{"xlsx"}},
+			{Name: "http-header", Values: []string{"X-Scope-OrgID: prod", "X-Team: it's"}},
+		},
+		"lab": {
+			{Name: "prometheus", Values: []string{"http://lab:9090"}},
+			{Name: "insecure-skip-verify", Values: []string{"true"}},
+		},
+	}, profiles)
+
+	// Other sections are skipped.
+	profiles, err = parseConfig(strings.NewReader("jobs:\n  cpu:\n    schedule: '@daily'\n" + testConfig))
+	assert.NoError(t, err)
+	assert.Len(t, profiles, 2)
+
+	for _, config := range []string{
+		"clusters:\n",
+		"profiles:\n  prod:\n    - a\n",
+		"profiles:\n  prod: https://prom.example.com\n",
+		"profiles:\n  prod:\n    prometheus:https://prom.example.com\n",
+		"profiles:\n  prod:\n    retries: 5\n      timeout: 10m\n",
+		"profiles:\n  prod:\n    prometheus: 'https://prom.example.com\n",
+	} {
+		_, err := parseConfig(strings.NewReader(config))
+		assert.Error(t, err, config)
+	}
+}
+
+func TestApplyProfile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "styx-config")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "styx.yaml")
+	assert.NoError(t, ioutil.WriteFile(path, []byte(testConfig), 0644))
+
+	run := func(args ...string) (queryFlags, string, error) {
+		var f queryFlags
+		var prometheus string
+		app := cli.NewApp()
+		app.Flags = append([]cli.Flag{
+			cli.StringFlag{Name: "prometheus", Value: "http://localhost:9090", Destination: &prometheus},
+		}, f.flags()...)
+		app.Before = applyProfile
+		app.Action = func(c *cli.Context) error { return nil }
+		err := app.Run(append([]string{"styx", "--config", path}, args...))
+		return f, prometheus, err
+	}
+
+	f, prometheus, err := run("--profile", "prod", "--retries", "1", "up")
+	assert.NoError(t, err)
+	assert.Equal(t, "https://prom.example.com", prometheus)
+	assert.Equal(t, "/etc/styx/prod token", f.TokenFile)
+	assert.Equal(t, 10*time.Minute, f.Timeout)
+	assert.Equal(t, cli.StringSlice{"X-Scope-OrgID: prod", "X-Team: it's"}, f.Headers)
+	// The command line wins
+	assert.Equal(t, 1, f.Retries)
+
+	f, prometheus, err = run("--profile", "lab", "up")
+	assert.NoError(t, err)
+	assert.Equal(t, "http://lab:9090", prometheus)
+	assert.True(t, f.Insecure)
+
+	_, prometheus, err = run("up")
+	assert.NoError(t, err)
+	assert.Equal(t, "http://localhost:9090", prometheus)
+
+	_, _, err = run("--profile", "staging", "up")
+	assert.Error(t, err)
+
+	_, prometheus, err = run("--google-project", "metrics-1234", "up")
+	assert.NoError(t, err)
+	assert.Equal(t, "https://monitoring.googleapis.com/v1/projects/metrics-1234/location/global/prometheus", prometheus)
+	// A profile's Prometheus wins
+	_, prometheus, err = run("--profile", "lab", "--google-project", "metrics-1234", "up")
+	assert.NoError(t, err)
+	assert.Equal(t, "http://lab:9090", prometheus)
+}
+
+func TestExpandHome(t *testing.T) {
+	home, err := os.UserHomeDir()
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join(home, ".styx.yaml"), expandHome("~/.styx.yaml"))
+	assert.Equal(t, "/etc/styx.yaml", expandHome("/etc/styx.yaml"))
+	assert.Equal(t, "~user/styx.yaml", expandHome("~user/styx.yaml"))
+}
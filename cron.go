@@ -0,0 +1,141 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cronSchedule is a schedule in the format of crontab(5), with a bit per
+// minute, hour, day of the month, month and day of the week it runs at.
+type cronSchedule struct {
+	Minute, Hour, Day, Month, Weekday uint64
+	// If both the day of the month and of the week are restricted, i.e.
+	// don't start with *, a day matching either runs, like in cron.
+	DayStar, WeekdayStar bool
+}
+
+// cronMacros are the shorthands for common schedules.
+var cronMacros = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+var (
+	cronMonths   = []string{"jan", "feb", "mar", "apr", "may", "jun", "jul", "aug", "sep", "oct", "nov", "dec"}
+	cronWeekdays = []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+)
+
+// parseCron parses a schedule of five fields, minute, hour, day of the
+// month, month and day of the week, like 30 6 * * mon-fri, or a macro like
+// @daily. Fields are lists of *, numbers and ranges, with an optional step
+// like */15, months and days of the week also by their English names.
+func parseCron(spec string) (cronSchedule, error) {
+	if macro, ok := cronMacros[strings.TrimSpace(spec)]; ok {
+		spec = macro
+	}
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return cronSchedule{}, fmt.Errorf("a schedule needs 5 fields, minute hour day month weekday: %s", spec)
+	}
+
+	var s cronSchedule
+	var err error
+	if s.Minute, err = cronField(fields[0], 0, 59, nil); err != nil {
+		return s, fmt.Errorf("invalid minute: %v", err)
+	}
+	if s.Hour, err = cronField(fields[1], 0, 23, nil); err != nil {
+		return s, fmt.Errorf("invalid hour: %v", err)
+	}
+	if s.Day, err = cronField(fields[2], 1, 31, nil); err != nil {
+		return s, fmt.Errorf("invalid day of the month: %v", err)
+	}
+	if s.Month, err = cronField(fields[3], 1, 12, cronMonths); err != nil {
+		return s, fmt.Errorf("invalid month: %v", err)
+	}
+	if s.Weekday, err = cronField(fields[4], 0, 7, cronWeekdays); err != nil {
+		return s, fmt.Errorf("invalid day of the week: %v", err)
+	}
+	// Sunday is 0 and 7.
+	if s.Weekday&(1<<7) != 0 {
+		s.Weekday |= 1
+	}
+	s.DayStar, s.WeekdayStar = strings.HasPrefix(fields[2], "*"), strings.HasPrefix(fields[4], "*")
+
+	return s, nil
+}
+
+// cronField returns the bits of the values of a field between min and max,
+// names are the names of the values from min on.
+func cronField(field string, min, max int, names []string) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		step := 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			n, err := strconv.Atoi(part[i+1:])
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("invalid step %s", part)
+			}
+			step, part = n, part[:i]
+		}
+
+		lo, hi := min, max
+		if part != "*" {
+			bounds := strings.SplitN(part, "-", 2)
+			var err error
+			if lo, err = cronValue(bounds[0], min, max, names); err != nil {
+				return 0, err
+			}
+			hi = lo
+			if len(bounds) == 2 {
+				if hi, err = cronValue(bounds[1], min, max, names); err != nil {
+					return 0, err
+				}
+			} else if step > 1 {
+				// 5/15 runs every 15 from 5 on.
+				hi = max
+			}
+			if hi < lo {
+				return 0, fmt.Errorf("invalid range %s", part)
+			}
+		}
+
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+func cronValue(s string, min, max int, names []string) (int, error) {
+	for i, name := range names {
+		if strings.EqualFold(s, name) {
+			return min + i, nil
+		}
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil || v < min || v > max {
+		return 0, fmt.Errorf("%s isn't between %d and %d", s, min, max)
+	}
+	return v, nil
+}
+
+// matches reports whether the schedule runs in the minute of t.
+func (s cronSchedule) matches(t time.Time) bool {
+	if s.Minute&(1<<uint(t.Minute())) == 0 || s.Hour&(1<<uint(t.Hour())) == 0 || s.Month&(1<<uint(t.Month())) == 0 {
+		return false
+	}
+
+	day := s.Day&(1<<uint(t.Day())) != 0
+	weekday := s.Weekday&(1<<uint(t.Weekday())) != 0
+	if s.DayStar || s.WeekdayStar {
+		return day && weekday
+	}
+	return day || weekday
+}
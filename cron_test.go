@@ -0,0 +1,40 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseCron(t *testing.T) {
+	at := func(s string) time.Time {
+		tm, err := time.Parse("2006-01-02 15:04", s)
+		assert.NoError(t, err)
+		return tm
+	}
+
+	for spec, cases := range map[string]map[string]bool{
+		"* * * * *":           {"2017-08-15 10:07": true},
+		"*/15 6 * * *":        {"2017-08-15 06:45": true, "2017-08-15 06:50": false, "2017-08-15 07:00": false},
+		"5/20 * * * *":        {"2017-08-15 06:05": true, "2017-08-15 06:45": true, "2017-08-15 06:00": false},
+		"30 6 * * mon-fri":    {"2017-08-15 06:30": true, "2017-08-19 06:30": false},
+		"0 0 * * 7":           {"2017-08-20 00:00": true, "2017-08-21 00:00": false},
+		"0 0 1,15 * *":        {"2017-08-15 00:00": true, "2017-08-16 00:00": false},
+		"0 0 1 * mon":         {"2017-08-01 00:00": true, "2017-08-14 00:00": true, "2017-08-15 00:00": false},
+		"0 0 * jan,jul-aug *": {"2017-08-15 00:00": true, "2017-09-15 00:00": false},
+		"@daily":              {"2017-08-15 00:00": true, "2017-08-15 01:00": false},
+		"@hourly":             {"2017-08-15 01:00": true, "2017-08-15 01:01": false},
+	} {
+		s, err := parseCron(spec)
+		assert.NoError(t, err, spec)
+		for tm, want := range cases {
+			assert.Equal(t, want, s.matches(at(tm)), "%s at %s", spec, tm)
+		}
+	}
+
+	for _, spec := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "* * 0 * *", "* * * 13 *", "* * * * 8", "*/0 * * * *", "5-1 * * * *", "a * * * *", "@often"} {
+		_, err := parseCron(spec)
+		assert.Error(t, err, spec)
+	}
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/go-pluto/styx/pkg/styx"
+	"github.com/urfave/cli"
+)
+
+type curlFlags struct {
+	queryFlags
+
+	Duration   time.Duration
+	Range      rangeFlags
+	Prometheus string
+	Secrets    bool
+}
+
+var curlFlag curlFlags
+
+func curlAction(c *cli.Context) error {
+	if !c.Args().Present() {
+		return errors.New(color.RedString("need a query to run"))
+	}
+
+	start, end, err := curlFlag.Range.timeRange(time.Now(), curlFlag.Duration)
+	if err != nil {
+		return errors.New(color.RedString(err.Error()))
+	}
+
+	opts, err := curlFlag.options(curlFlag.Prometheus, end.Sub(start))
+	if err != nil {
+		return err
+	}
+
+	var u *url.URL
+	if curlFlag.Backend == backendVictoriaMetrics {
+		u, err = styx.VMExportURL(curlFlag.Prometheus, start, end, c.Args().First(), opts)
+	} else if curlFlag.Instant {
+		u, err = styx.InstantURL(curlFlag.Prometheus, end, c.Args().First(), opts)
+	} else {
+		u, err = styx.QueryURL(curlFlag.Prometheus, start, end, c.Args().First(), opts)
+	}
+	if err != nil {
+		return err
+	}
+
+	args := append(curlFlag.curlProxyArgs(curlFlag.Secrets), curlFlag.curlAuthArgs(curlFlag.Prometheus, curlFlag.Secrets)...)
+	cmd := curlCommand(u, opts, curlFlag.curlTLSArgs(), args, curlFlag.Secrets)
+
+	fmt.Println(cmd)
+	return nil
+}
+
+// curlProxyArgs returns the quoted curl arguments for the proxy of the
+// flags, its password is redacted unless secrets is true.
+func (f *queryFlags) curlProxyArgs(secrets bool) []string {
+	if f.Proxy == "" {
+		return nil
+	}
+	proxy := f.Proxy
+	if u, err := url.Parse(proxy); err == nil {
+		if _, ok := u.User.Password(); ok && !secrets {
+			u.User = url.UserPassword(u.User.Username(), redacted)
+			proxy = u.String()
+		}
+	}
+	return []string{"--proxy", shellQuote(proxy)}
+}
+
+// curlAuthArgs returns the curl arguments for --auth and OAuth2. curl signs
+// requests with sigv4 itself with the credentials of the environment, the
+// tokens of Google and Azure are printed by their CLIs and those of OAuth2
+// and ICP of the host are fetched with another curl, whose secrets are
+// redacted unless secrets is true or they're read from a file.
+func (f *queryFlags) curlAuthArgs(host string, secrets bool) []string {
+	if f.OAuth2TokenURL != "" {
+		form := []string{"-d", "grant_type=client_credentials",
+			"--data-urlencode", shellQuote("client_id=" + f.OAuth2ClientID),
+			"--data-urlencode", curlSecret("client_secret", f.OAuth2Secret, f.OAuth2SecretFile, secrets)}
+		if len(f.OAuth2Scopes) > 0 {
+			form = append(form, "--data-urlencode", shellQuote("scope="+strings.Join(f.OAuth2Scopes, " ")))
+		}
+		return curlTokenArgs(form, f.OAuth2TokenURL)
+	}
+
+	switch f.Auth {
+	case authSigV4:
+		return []string{
+			"--aws-sigv4", shellQuote("aws:amz:" + f.Region + ":" + ampService),
+			"--user", `"$AWS_ACCESS_KEY_ID:$AWS_SECRET_ACCESS_KEY"`,
+			"-H", `"X-Amz-Security-Token: $AWS_SESSION_TOKEN"`,
+		}
+	case authGoogle:
+		return []string{"-H", `"Authorization: Bearer $(gcloud auth application-default print-access-token)"`}
+	case authAzure:
+		return []string{"-H", `"Authorization: Bearer $(az account get-access-token --resource ` + azureMonitorResource + ` --query accessToken -o tsv)"`}
+	case authICP:
+		form := []string{"-d", "scope=openid"}
+		if f.ICPAPIKey != "" {
+			form = append(form, "-d", "grant_type=urn:ibm:params:oauth:grant-type:apikey",
+				"--data-urlencode", curlSecret("apikey", f.ICPAPIKey, "", secrets))
+		} else {
+			form = append(form, "-d", "grant_type=password",
+				"--data-urlencode", shellQuote("username="+f.Username),
+				"--data-urlencode", curlSecret("password", f.Password, f.PasswordFile, secrets))
+		}
+		u := f.ICPURL
+		if u == "" {
+			u, _ = icpURL(host)
+		}
+		return curlTokenArgs(form, strings.TrimSuffix(u, "/")+"/idprovider/v1/auth/identitytoken")
+	}
+	return nil
+}
+
+// curlSecret returns the quoted form field name with the secret, read from
+// the file by the shell if given. Unless show is true it's redacted.
+func curlSecret(name, secret, file string, show bool) string {
+	switch {
+	case file != "":
+		return `"` + name + `=$(cat ` + shellQuote(file) + `)"`
+	case !show:
+		return shellQuote(name + "=" + redacted)
+	}
+	return shellQuote(name + "=" + secret)
+}
+
+// curlTokenArgs returns the curl arguments sending the access token that
+// another curl posting the form to tokenURL gets.
+func curlTokenArgs(form []string, tokenURL string) []string {
+	fetch := append(append([]string{"curl", "-s"}, form...), shellQuote(tokenURL), "|", "jq", "-r", ".access_token")
+	return []string{"-H", `"Authorization: Bearer $(` + strings.Join(fetch, " ") + `)"`}
+}
+
+// curlTLSArgs returns the quoted curl arguments for the TLS settings of the flags.
+func (f *queryFlags) curlTLSArgs() []string {
+	var args []string
+	if f.CACert != "" {
+		args = append(args, "--cacert", shellQuote(f.CACert))
+	}
+	if f.Insecure {
+		args = append(args, "--insecure")
+	}
+	if f.ClientCert != "" {
+		args = append(args, "--cert", shellQuote(f.ClientCert), "--key", shellQuote(f.ClientKey))
+	}
+	return args
+}
+
+// redacted replaces secrets in curl commands.
+const redacted = "REDACTED"
+
+// secretHeaders are the headers carrying credentials.
+var secretHeaders = map[string]bool{
+	"Authorization":       true,
+	"Proxy-Authorization": true,
+	"Cookie":              true,
+	"X-Api-Key":           true,
+}
+
+// curlCommand returns a curl command line requesting u the way Query does
+// with the options and the further args like the proxy's, https hosts get
+// the tlsArgs. Queries sent with POST
+// pass the parameters with --data instead. Unless secrets is true,
+// credentials in headers, cookies and the URL are redacted so the command
+// can be shared.
+func curlCommand(u *url.URL, opts styx.Options, tlsArgs, args []string, secrets bool) string {
+	var names []string
+	for name := range opts.Header {
+		if http.CanonicalHeaderKey(name) != "Accept" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	args = append([]string{"curl"}, args...)
+	args = append(args, "-H", shellQuote("Accept: "+opts.AcceptHeader()))
+	if u.Scheme == "https" {
+		args = append(args, tlsArgs...)
+	}
+	for _, name := range names {
+		for _, value := range opts.Header[name] {
+			if !secrets && secretHeaders[http.CanonicalHeaderKey(name)] {
+				value = redacted
+			}
+			args = append(args, "-H", shellQuote(name+": "+value))
+		}
+	}
+
+	if opts.Jar != nil {
+		var cookies []string
+		for _, cookie := range opts.Jar.Cookies(u) {
+			value := cookie.Value
+			if !secrets {
+				value = redacted
+			}
+			cookies = append(cookies, cookie.Name+"="+value)
+		}
+		if len(cookies) > 0 {
+			args = append(args, "-b", shellQuote(strings.Join(cookies, "; ")))
+		}
+	}
+
+	target := *u
+	if opts.QueryMethod(u) == http.MethodPost {
+		args = append(args, "--data", shellQuote(u.RawQuery))
+		target.RawQuery = ""
+	}
+
+	if _, ok := target.User.Password(); ok && !secrets {
+		target.User = url.UserPassword(target.User.Username(), redacted)
+	}
+
+	return strings.Join(append(args, shellQuote(target.String())), " ")
+}
+
+// shellQuote quotes s for POSIX shells.
+func shellQuote(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
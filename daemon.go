@@ -0,0 +1,214 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"os/signal"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"text/template"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/urfave/cli"
+)
+
+type daemonFlags struct {
+	Config string
+	Once   bool
+}
+
+var daemonFlag daemonFlags
+
+// daemonJob is an export run on a schedule. Its flags are the flags of the
+// export, like the ones of a profile.
+type daemonJob struct {
+	Name     string
+	Schedule cronSchedule
+	Output   string
+	Flags    []profileFlag
+}
+
+func daemonAction(c *cli.Context) error {
+	path := expandHome(daemonFlag.Config)
+	jobs, err := readJobs(path)
+	if err != nil {
+		return errors.New(color.RedString(err.Error()))
+	}
+	if len(jobs) == 0 {
+		return errors.New(color.RedString("there are no jobs in %s", path))
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if daemonFlag.Once {
+		var failed error
+		for _, job := range jobs {
+			if err := runJob(ctx, job, path, time.Now()); err != nil {
+				failed = err
+			}
+		}
+		return failed
+	}
+
+	log.Printf("running %d jobs of %s", len(jobs), path)
+
+	// Jobs still running when they're due again are skipped.
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	running := make(map[string]bool)
+	for {
+		next := time.Now().Truncate(time.Minute).Add(time.Minute)
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			wg.Wait()
+			return nil
+		case <-timer.C:
+		}
+
+		for _, job := range jobs {
+			if !job.Schedule.matches(next) {
+				continue
+			}
+			mu.Lock()
+			if running[job.Name] {
+				mu.Unlock()
+				log.Printf("job %s: skipped, the previous run is still running", job.Name)
+				continue
+			}
+			running[job.Name] = true
+			mu.Unlock()
+
+			wg.Add(1)
+			go func(job daemonJob) {
+				defer wg.Done()
+				runJob(ctx, job, path, next)
+				mu.Lock()
+				delete(running, job.Name)
+				mu.Unlock()
+			}(job)
+		}
+	}
+}
+
+// readJobs reads the jobs of the config file, sorted by name.
+func readJobs(path string) ([]daemonJob, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	entries, err := parseConfigSection(f, "jobs")
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+
+	var jobs []daemonJob
+	for name, flags := range entries {
+		job := daemonJob{Name: name}
+		schedule := ""
+		for _, flag := range flags {
+			switch flag.Name {
+			case "schedule":
+				schedule = strings.Join(flag.Values, " ")
+			case "output", "o":
+				job.Output = strings.Join(flag.Values, "")
+			default:
+				job.Flags = append(job.Flags, flag)
+			}
+		}
+		if schedule == "" {
+			return nil, fmt.Errorf("job %s has no schedule", name)
+		}
+		job.Schedule, err = parseCron(schedule)
+		if err != nil {
+			return nil, fmt.Errorf("job %s: %v", name, err)
+		}
+		if _, err := jobOutput(job.Output, name, time.Now()); err != nil {
+			return nil, fmt.Errorf("job %s: %v", name, err)
+		}
+		jobs = append(jobs, job)
+	}
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].Name < jobs[j].Name })
+
+	return jobs, nil
+}
+
+// args returns the arguments of the export of the job run at t, profiles
+// are looked up in config.
+func (j daemonJob) args(config string, t time.Time) ([]string, error) {
+	args := []string{"--config=" + config}
+	for _, flag := range j.Flags {
+		for _, value := range flag.Values {
+			args = append(args, "--"+flag.Name+"="+value)
+		}
+	}
+
+	if j.Output != "" {
+		output, err := jobOutput(j.Output, j.Name, t)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, "--output="+output)
+	}
+	return args, nil
+}
+
+// jobOutput returns the file a job run at t writes to. The output is a
+// template of the job's name as .Job and the time of the run as .Time,
+// e.g. cpu-{{.Time.Format "2006-01-02T15"}}.csv. Without an action the day
+// is inserted in front of the extension like --split-by-day does.
+func jobOutput(output, job string, t time.Time) (string, error) {
+	if !strings.Contains(output, "{{") {
+		if output == "" {
+			return "", nil
+		}
+		return dayFilename(output, t), nil
+	}
+
+	tmpl, err := template.New("output").Parse(output)
+	if err != nil {
+		return "", fmt.Errorf("invalid output: %v", err)
+	}
+	var buf bytes.Buffer
+	err = tmpl.Execute(&buf, struct {
+		Job  string
+		Time time.Time
+	}{job, t})
+	return buf.String(), err
+}
+
+// runJob runs the export of the job as a separate process of styx, so jobs
+// don't share any state, and logs how it went.
+func runJob(ctx context.Context, job daemonJob, config string, t time.Time) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	args, err := job.args(config, t)
+	if err != nil {
+		log.Printf("job %s: %v", job.Name, err)
+		return err
+	}
+
+	started := time.Now()
+	cmd := exec.CommandContext(ctx, exe, args...)
+	cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+	if err := cmd.Run(); err != nil {
+		log.Printf("job %s: failed after %s: %v", job.Name, time.Since(started).Round(time.Millisecond), err)
+		return fmt.Errorf("job %s failed: %v", job.Name, err)
+	}
+	log.Printf("job %s: done in %s", job.Name, time.Since(started).Round(time.Millisecond))
+	return nil
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadJobs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "styx")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "styx.yaml")
+	assert.NoError(t, ioutil.WriteFile(path, []byte(`profiles:
+  prod:
+    prometheus: https://prom.example.com
+jobs:
+  cpu:
+    schedule: '0 6 * * *'
+    profile: prod
+    last: 24h
+    query:
+      - sum(rate(node_cpu_seconds_total[5m]))
+      - sum(node_load1)
+    output: /data/cpu.csv
+  up:
+    schedule: '@hourly'
+    output: '/data/{{.Job}}-{{.Time.Format "2006-01-02T15"}}.csv'
+`), 0644))
+
+	jobs, err := readJobs(path)
+	assert.NoError(t, err)
+	assert.Len(t, jobs, 2)
+	assert.Equal(t, "cpu", jobs[0].Name)
+	assert.Equal(t, "up", jobs[1].Name)
+
+	run := time.Date(2017, 8, 15, 6, 0, 0, 0, time.UTC)
+	assert.True(t, jobs[0].Schedule.matches(run))
+	args, err := jobs[0].args(path, run)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"--config=" + path,
+		"--profile=prod",
+		"--last=24h",
+		"--query=sum(rate(node_cpu_seconds_total[5m]))",
+		"--query=sum(node_load1)",
+		"--output=/data/cpu-2017-08-15.csv",
+	}, args)
+
+	args, err = jobs[1].args(path, run)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"--config=" + path, "--output=/data/up-2017-08-15T06.csv"}, args)
+
+	for _, config := range []string{
+		"jobs:\n  cpu:\n    last: 24h\n",
+		"jobs:\n  cpu:\n    schedule: '* * *'\n",
+		"jobs:\n  cpu:\n    schedule: '@daily'\n    output: '{{.Day'\n",
+	} {
+		assert.NoError(t, ioutil.WriteFile(path, []byte(config), 0644))
+		_, err := readJobs(path)
+		assert.Error(t, err, config)
+	}
+}
@@ -0,0 +1,404 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/go-pluto/styx/pkg/styx"
+	"github.com/urfave/cli"
+)
+
+type dashboardFlags struct {
+	queryFlags
+
+	Duration   time.Duration
+	Range      rangeFlags
+	Prometheus string
+	Output     string
+	Vars       cli.StringSlice
+}
+
+var dashboardFlag dashboardFlags
+
+// grafanaDashboard is the part of a dashboard's JSON model holding queries.
+type grafanaDashboard struct {
+	Title      string         `json:"title"`
+	Panels     []grafanaPanel `json:"panels"`
+	Rows       []grafanaRow   `json:"rows"`
+	Templating struct {
+		List []grafanaVariable `json:"list"`
+	} `json:"templating"`
+}
+
+// grafanaRow is a row of dashboards from before Grafana 5.
+type grafanaRow struct {
+	Panels []grafanaPanel `json:"panels"`
+}
+
+type grafanaPanel struct {
+	Title   string          `json:"title"`
+	Targets []grafanaTarget `json:"targets"`
+	// Panels are the panels of a collapsed row.
+	Panels []grafanaPanel `json:"panels"`
+}
+
+type grafanaTarget struct {
+	Expr         string `json:"expr"`
+	LegendFormat string `json:"legendFormat"`
+	Hide         bool   `json:"hide"`
+}
+
+type grafanaVariable struct {
+	Name     string `json:"name"`
+	AllValue string `json:"allValue"`
+	Current  struct {
+		// Value is a string, or a list of strings for multi-value variables.
+		Value json.RawMessage `json:"value"`
+	} `json:"current"`
+}
+
+// dashboardPanel is a panel with queries, in the order of the dashboard.
+type dashboardPanel struct {
+	Title   string
+	Targets []grafanaTarget
+}
+
+func dashboardAction(c *cli.Context) error {
+	if !c.Args().Present() {
+		return errors.New(color.RedString("need a dashboard JSON file or URL"))
+	}
+	if dashboardFlag.Output == "" {
+		return errors.New(color.RedString("need an --output directory or .xlsx file"))
+	}
+
+	start, end, err := dashboardFlag.Range.timeRange(time.Now(), dashboardFlag.Duration)
+	if err != nil {
+		return errors.New(color.RedString(err.Error()))
+	}
+
+	opts, err := dashboardFlag.options(dashboardFlag.Prometheus, end.Sub(start))
+	if err != nil {
+		return err
+	}
+	opts.Step = opts.StepFor(end.Sub(start))
+
+	ctx, cancel := dashboardFlag.context()
+	defer cancel()
+	opts.Context = ctx
+
+	dashboard, err := readDashboard(c.Args().First(), opts)
+	if err != nil {
+		return err
+	}
+
+	vars, err := dashboardVars(dashboard, dashboardFlag.Vars)
+	if err != nil {
+		return err
+	}
+	for name, value := range rangeVars(start, end, opts.Step) {
+		vars[name] = value
+	}
+
+	var sheets []styx.Sheet
+	for _, panel := range dashboardPanels(dashboard) {
+		var results []styx.Result
+		for _, target := range panel.Targets {
+			query := expandVars(target.Expr, vars)
+			queried, err := dashboardFlag.query(dashboardFlag.Prometheus, start, end, query, &opts)
+			if err == styx.ErrNoTimeseries {
+				continue
+			}
+			if err != nil {
+				return fmt.Errorf("panel %s: %v", panel.Title, err)
+			}
+			results = append(results, legend(queried, target.LegendFormat, query)...)
+		}
+		if len(results) == 0 {
+			fmt.Fprintln(os.Stderr, color.YellowString("panel %s: no timeseries found", panel.Title))
+		}
+		sheets = append(sheets, styx.Sheet{Name: panel.Title, Results: results})
+	}
+	if len(sheets) == 0 {
+		return errors.New(color.RedString("the dashboard has no panels with Prometheus queries"))
+	}
+
+	return writeDashboard(dashboardFlag.Output, sheets)
+}
+
+// readDashboard reads the dashboard from a file or the Grafana API, either
+// the dashboard itself or the response of /api/dashboards/uid/<uid>.
+func readDashboard(src string, opts styx.Options) (grafanaDashboard, error) {
+	var dashboard grafanaDashboard
+
+	var r io.Reader
+	if strings.HasPrefix(src, "http://") || strings.HasPrefix(src, "https://") {
+		req, err := http.NewRequest(http.MethodGet, src, nil)
+		if err != nil {
+			return dashboard, err
+		}
+		req = req.WithContext(opts.Context)
+		req.Header = opts.Header.Clone()
+		req.Header.Set("Accept", "application/json")
+
+		client := opts.Client
+		if client == nil {
+			client = &http.Client{Jar: opts.Jar, Transport: opts.Transport}
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return dashboard, err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return dashboard, &styx.StatusError{StatusCode: resp.StatusCode, Status: resp.Status, URL: src}
+		}
+		r = resp.Body
+	} else {
+		f, err := os.Open(src)
+		if err != nil {
+			return dashboard, err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return dashboard, err
+	}
+
+	var wrapped struct {
+		Dashboard *grafanaDashboard `json:"dashboard"`
+	}
+	if err := json.Unmarshal(data, &wrapped); err != nil {
+		return dashboard, fmt.Errorf("can't read dashboard %s: %v", src, err)
+	}
+	if wrapped.Dashboard != nil {
+		return *wrapped.Dashboard, nil
+	}
+	if err := json.Unmarshal(data, &dashboard); err != nil {
+		return dashboard, fmt.Errorf("can't read dashboard %s: %v", src, err)
+	}
+	return dashboard, nil
+}
+
+// dashboardPanels returns the panels with queries, including the ones of
+// collapsed and old style rows. Hidden queries and ones of other
+// datasources without an expr are skipped.
+func dashboardPanels(dashboard grafanaDashboard) []dashboardPanel {
+	panels := dashboard.Panels
+	for _, row := range dashboard.Rows {
+		panels = append(panels, row.Panels...)
+	}
+
+	var found []dashboardPanel
+	var walk func([]grafanaPanel)
+	walk = func(panels []grafanaPanel) {
+		for _, panel := range panels {
+			var targets []grafanaTarget
+			for _, target := range panel.Targets {
+				if target.Expr != "" && !target.Hide {
+					targets = append(targets, target)
+				}
+			}
+			if len(targets) > 0 {
+				found = append(found, dashboardPanel{Title: panel.Title, Targets: targets})
+			}
+			walk(panel.Panels)
+		}
+	}
+	walk(panels)
+
+	return found
+}
+
+// dashboardVars returns the current values of the dashboard's variables,
+// overridden by the name=value pairs given. Multiple values are formatted
+// as regexp alternation, as Grafana does for Prometheus.
+func dashboardVars(dashboard grafanaDashboard, overrides []string) (map[string]string, error) {
+	vars := make(map[string]string)
+	for _, v := range dashboard.Templating.List {
+		var values []string
+		var value string
+		if err := json.Unmarshal(v.Current.Value, &value); err == nil {
+			values = []string{value}
+		} else if err := json.Unmarshal(v.Current.Value, &values); err != nil {
+			continue
+		}
+		vars[v.Name] = varValue(values, v.AllValue)
+	}
+
+	for _, override := range overrides {
+		name, value, err := parseKeyValue(override)
+		if err != nil {
+			return nil, err
+		}
+		vars[name] = value
+	}
+
+	return vars, nil
+}
+
+// varValue formats the values of a variable for a PromQL query.
+func varValue(values []string, allValue string) string {
+	if len(values) == 1 && values[0] == "$__all" {
+		if allValue != "" {
+			return allValue
+		}
+		return ".*"
+	}
+	if len(values) == 1 {
+		return values[0]
+	}
+
+	quoted := make([]string, len(values))
+	for i, value := range values {
+		quoted[i] = regexp.QuoteMeta(value)
+	}
+	return "(" + strings.Join(quoted, "|") + ")"
+}
+
+// varReference matches the variables in the forms $name, ${name},
+// ${name:format} and [[name]].
+var varReference = regexp.MustCompile(`\$([A-Za-z_][A-Za-z0-9_]*)|\$\{([A-Za-z_][A-Za-z0-9_]*)(:[^}]*)?\}|\[\[([A-Za-z_][A-Za-z0-9_]*)\]\]`)
+
+// expandVars replaces the variables in the forms $name, ${name},
+// ${name:format} and [[name]] in one pass, so the values aren't expanded
+// again. Unknown variables are left as they are.
+func expandVars(expr string, vars map[string]string) string {
+	return varReference.ReplaceAllStringFunc(expr, func(ref string) string {
+		m := varReference.FindStringSubmatch(ref)
+		if value, ok := vars[m[1]+m[2]+m[4]]; ok {
+			return value
+		}
+		return ref
+	})
+}
+
+// legend names the results after the panel's legend format, with labels
+// like {{instance}} filled in. Without a format unlabeled results are
+// named after their query.
+func legend(results []styx.Result, format, query string) []styx.Result {
+	if format == "" {
+		return nameUnlabeled(results, query)
+	}
+
+	placeholder := regexp.MustCompile(`\{\{\s*([a-zA-Z_][a-zA-Z0-9_]*)\s*\}\}`)
+	for i := range results {
+		labels := results[i].Labels
+		results[i].Metric = placeholder.ReplaceAllStringFunc(format, func(m string) string {
+			return labels[placeholder.FindStringSubmatch(m)[1]]
+		})
+	}
+	return results
+}
+
+// rateInterval is Grafana's $__rate_interval for the default scrape
+// interval of 15s, at least four scrapes and one more than the step.
+func rateInterval(step time.Duration) time.Duration {
+	scrape := 15 * time.Second
+	if step+scrape > 4*scrape {
+		return step + scrape
+	}
+	return 4 * scrape
+}
+
+// promDuration formats d in seconds, which PromQL accepts for any duration.
+func promDuration(d time.Duration) string {
+	return strconv.FormatInt(int64(d/time.Second), 10) + "s"
+}
+
+// writeDashboard writes the panels into sheets of an xlsx workbook, or a
+// csv per panel into the directory out.
+func writeDashboard(out string, sheets []styx.Sheet) error {
+	if strings.HasSuffix(strings.ToLower(out), ".xlsx") {
+		used := make(map[string]bool)
+		for i := range sheets {
+			sheets[i].Name = sheetName(sheets[i].Name, i, used)
+		}
+
+		f, err := os.Create(out)
+		if err != nil {
+			return err
+		}
+		if err := styx.XLSXWriter(f, sheets); err != nil {
+			f.Close()
+			return err
+		}
+		return f.Close()
+	}
+
+	if err := os.MkdirAll(out, 0755); err != nil {
+		return err
+	}
+	for i, sheet := range sheets {
+		name := fmt.Sprintf("%02d-%s.csv", i+1, slug(sheet.Name))
+		f, err := os.Create(filepath.Join(out, name))
+		if err != nil {
+			return err
+		}
+		err = styx.CSVHeaderWriter(f, sheet.Results)
+		if err == nil {
+			err = styx.CSVWriter(f, sheet.Results)
+		}
+		if err != nil {
+			f.Close()
+			return err
+		}
+		if err := f.Close(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sheetName returns a unique name Excel accepts for the i-th panel's sheet,
+// at most 31 characters and without []:*?/\.
+func sheetName(title string, i int, used map[string]bool) string {
+	name := strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`[]:*?/\`, r) {
+			return '-'
+		}
+		return r
+	}, strings.TrimSpace(title))
+	if name == "" {
+		name = fmt.Sprintf("Panel %d", i+1)
+	}
+	if runes := []rune(name); len(runes) > 31 {
+		name = string(runes[:31])
+	}
+
+	base := name
+	for n := 2; used[strings.ToLower(name)]; n++ {
+		suffix := fmt.Sprintf(" (%d)", n)
+		runes := []rune(base)
+		if len(runes)+len(suffix) > 31 {
+			runes = runes[:31-len(suffix)]
+		}
+		name = string(runes) + suffix
+	}
+	used[strings.ToLower(name)] = true
+	return name
+}
+
+var slugInvalid = regexp.MustCompile(`[^a-z0-9]+`)
+
+// slug turns a panel title into a file name, e.g. CPU Usage % into cpu-usage.
+func slug(title string) string {
+	s := strings.Trim(slugInvalid.ReplaceAllString(strings.ToLower(title), "-"), "-")
+	if s == "" {
+		return "panel"
+	}
+	return s
+}
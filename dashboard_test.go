@@ -0,0 +1,96 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/go-pluto/styx/pkg/styx"
+	"github.com/stretchr/testify/assert"
+)
+
+const testDashboard = `{
+	"templating": {"list": [
+		{"name": "job", "current": {"value": ["node", "api.v1"]}},
+		{"name": "instance", "current": {"value": "$__all"}, "allValue": "host.*"},
+		{"name": "job_name", "current": {"value": "other"}}
+	]},
+	"panels": [
+		{"title": "CPU", "targets": [{"expr": "rate(cpu{job=~\"$job\"}[5m])"}, {"expr": "hidden", "hide": true}]},
+		{"title": "Text"},
+		{"title": "Row", "type": "row", "panels": [{"title": "Memory", "targets": [{"expr": "mem"}]}]}
+	],
+	"rows": [{"panels": [{"title": "Disk", "targets": [{"expr": "disk"}]}]}]
+}`
+
+func TestDashboardPanels(t *testing.T) {
+	var dashboard grafanaDashboard
+	assert.NoError(t, json.Unmarshal([]byte(testDashboard), &dashboard))
+
+	panels := dashboardPanels(dashboard)
+	assert.Len(t, panels, 3)
+	assert.Equal(t, "CPU", panels[0].Title)
+	assert.Len(t, panels[0].Targets, 1)
+	assert.Equal(t, "Memory", panels[1].Title)
+	assert.Equal(t, "Disk", panels[2].Title)
+}
+
+func TestDashboardVars(t *testing.T) {
+	var dashboard grafanaDashboard
+	assert.NoError(t, json.Unmarshal([]byte(testDashboard), &dashboard))
+
+	vars, err := dashboardVars(dashboard, []string{"job_name=given"})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"job": `(node|api\.v1)`, "instance": "host.*", "job_name": "given"}, vars)
+
+	_, err = dashboardVars(dashboard, []string{"job"})
+	assert.Error(t, err)
+}
+
+func TestExpandVars(t *testing.T) {
+	vars := map[string]string{"job": "node", "job_name": "other", "__rate_interval": "60s"}
+
+	assert.Equal(t, `up{job="node",name="other"}`, expandVars(`up{job="$job",name="$job_name"}`, vars))
+	assert.Equal(t, `rate(up{job="node"}[60s])`, expandVars(`rate(up{job="${job}"}[$__rate_interval])`, vars))
+	assert.Equal(t, `up{job=~"node"}`, expandVars(`up{job=~"${job:regex}"}`, vars))
+	assert.Equal(t, `up{job="node"}`, expandVars(`up{job="[[job]]"}`, vars))
+	assert.Equal(t, `up{job="$unknown"}`, expandVars(`up{job="$unknown"}`, vars))
+
+	// Variables named like the start of an unknown one don't replace it.
+	vars = map[string]string{"ns": "prod", "__interval": "15s"}
+	assert.Equal(t, `up{ns="$nsfoo"}`, expandVars(`up{ns="$nsfoo"}`, vars))
+	assert.Equal(t, `up[15s] offset $__interval_ms`, expandVars(`up[$__interval] offset $__interval_ms`, vars))
+
+	// Values aren't expanded again.
+	vars = map[string]string{"a": "$b", "b": "x"}
+	assert.Equal(t, `up{a="$b",b="x"}`, expandVars(`up{a="$a",b="$b"}`, vars))
+}
+
+func TestLegend(t *testing.T) {
+	results := []styx.Result{{Metric: `up{instance="a",job="node"}`, Labels: map[string]string{"instance": "a", "job": "node"}}}
+
+	results = legend(results, "{{job}} on {{ instance }}", "up")
+	assert.Equal(t, "node on a", results[0].Metric)
+}
+
+func TestRateInterval(t *testing.T) {
+	assert.Equal(t, time.Minute, rateInterval(15*time.Second))
+	assert.Equal(t, 5*time.Minute+15*time.Second, rateInterval(5*time.Minute))
+}
+
+func TestSheetName(t *testing.T) {
+	used := make(map[string]bool)
+	assert.Equal(t, "CPU - Load", sheetName("CPU / Load", 0, used))
+	assert.Equal(t, "cpu - load (2)", sheetName("cpu - load", 1, used))
+	assert.Equal(t, "Panel 3", sheetName("", 2, used))
+
+	long := "Requests per second by status code and handler"
+	assert.Equal(t, "Requests per second by status c", sheetName(long, 3, used))
+	assert.Equal(t, "Requests per second by stat (2)", sheetName(long, 4, used))
+	assert.Equal(t, "Requests per second by stat (3)", sheetName(long, 5, used))
+}
+
+func TestSlug(t *testing.T) {
+	assert.Equal(t, "cpu-usage", slug("CPU Usage %"))
+	assert.Equal(t, "panel", slug("%"))
+}
@@ -0,0 +1,404 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/go-pluto/styx/pkg/styx"
+	"github.com/urfave/cli"
+)
+
+// discoverFlags are the flags of the commands discovering labels and
+// series, to find out what to export.
+type discoverFlags struct {
+	queryFlags
+
+	Duration   time.Duration
+	Range      rangeFlags
+	Prometheus string
+	Format     string
+	Match      cli.StringSlice
+	RuleType   string
+}
+
+var discoverFlag discoverFlags
+
+func (f *discoverFlags) flags() []cli.Flag {
+	return append([]cli.Flag{
+		cli.DurationFlag{
+			Name:        "duration,d",
+			Usage:       "The duration to look for series in",
+			Value:       time.Hour,
+			Destination: &f.Duration,
+		},
+	}, append(f.Range.flags(), f.baseFlags()...)...)
+}
+
+// baseFlags are the flags of discovery commands without a range.
+func (f *discoverFlags) baseFlags() []cli.Flag {
+	return append([]cli.Flag{
+		cli.StringFlag{
+			Name:        "prometheus",
+			Value:       "http://localhost:9090",
+			Destination: &f.Prometheus,
+		},
+		cli.StringFlag{
+			Name:        "format",
+			Usage:       "Print csv or json",
+			Value:       "csv",
+			Destination: &f.Format,
+		},
+	}, f.queryFlags.flags()...)
+}
+
+// matchFlag restricts labels and their values to the matching series.
+func (f *discoverFlags) matchFlag() cli.Flag {
+	return cli.StringSliceFlag{
+		Name:  "match",
+		Usage: "Only of the series matching this selector, e.g. '{job=\"node\"}', given again for several",
+		Value: &f.Match,
+	}
+}
+
+// setup returns the range and options of a discovery command.
+func (f *discoverFlags) setup() (time.Time, time.Time, styx.Options, error) {
+	start, end, err := f.Range.timeRange(time.Now(), f.Duration)
+	if err != nil {
+		return start, end, styx.Options{}, errors.New(color.RedString(err.Error()))
+	}
+	opts, err := f.baseOptions(end.Sub(start))
+	return start, end, opts, err
+}
+
+// baseOptions returns the options of a discovery command, commands without
+// a range pass a zero duration.
+func (f *discoverFlags) baseOptions(dur time.Duration) (styx.Options, error) {
+	if f.Format != "csv" && f.Format != "json" {
+		return styx.Options{}, errors.New(color.RedString("unknown format: %s", f.Format))
+	}
+	return f.options(f.Prometheus, dur)
+}
+
+func labelsAction(c *cli.Context) error {
+	start, end, opts, err := discoverFlag.setup()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := discoverFlag.context()
+	defer cancel()
+	opts.Context = ctx
+
+	names, err := styx.Labels(discoverFlag.Prometheus, start, end, discoverFlag.Match, opts)
+	if err != nil {
+		return err
+	}
+	return writeList(os.Stdout, discoverFlag.Format, "label", names)
+}
+
+func labelValuesAction(c *cli.Context) error {
+	if !c.Args().Present() {
+		return errors.New(color.RedString("need the name of a label"))
+	}
+	start, end, opts, err := discoverFlag.setup()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := discoverFlag.context()
+	defer cancel()
+	opts.Context = ctx
+
+	name := c.Args().First()
+	values, err := styx.LabelValues(discoverFlag.Prometheus, name, start, end, discoverFlag.Match, opts)
+	if err != nil {
+		return err
+	}
+	return writeList(os.Stdout, discoverFlag.Format, name, values)
+}
+
+func seriesAction(c *cli.Context) error {
+	if !c.Args().Present() {
+		return errors.New(color.RedString("need a selector like 'up{job=\"node\"}'"))
+	}
+	start, end, opts, err := discoverFlag.setup()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := discoverFlag.context()
+	defer cancel()
+	opts.Context = ctx
+
+	series, err := styx.Series(discoverFlag.Prometheus, start, end, c.Args(), opts)
+	if err != nil {
+		return err
+	}
+	return writeSeries(os.Stdout, discoverFlag.Format, series)
+}
+
+func metadataAction(c *cli.Context) error {
+	opts, err := discoverFlag.baseOptions(0)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := discoverFlag.context()
+	defer cancel()
+	opts.Context = ctx
+
+	metadata, err := styx.Metadata(discoverFlag.Prometheus, c.Args().First(), opts)
+	if err != nil {
+		return err
+	}
+	if len(metadata) == 0 && c.Args().Present() {
+		return fmt.Errorf("there is no metadata of %s", c.Args().First())
+	}
+	return writeMetadata(os.Stdout, discoverFlag.Format, metadata)
+}
+
+func alertsAction(c *cli.Context) error {
+	opts, err := discoverFlag.baseOptions(0)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := discoverFlag.context()
+	defer cancel()
+	opts.Context = ctx
+
+	alerts, err := styx.Alerts(discoverFlag.Prometheus, opts)
+	if err != nil {
+		return err
+	}
+	return writeAlerts(os.Stdout, discoverFlag.Format, alerts)
+}
+
+func rulesAction(c *cli.Context) error {
+	opts, err := discoverFlag.baseOptions(0)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := discoverFlag.context()
+	defer cancel()
+	opts.Context = ctx
+
+	var typ string
+	switch discoverFlag.RuleType {
+	case "", "all":
+		typ = styx.RulesAll
+	case "alerting", "alert":
+		typ = styx.RulesAlerting
+	case "recording", "record":
+		typ = styx.RulesRecording
+	default:
+		return errors.New(color.RedString("unknown type of rules: %s", discoverFlag.RuleType))
+	}
+
+	rules, err := styx.Rules(discoverFlag.Prometheus, typ, opts)
+	if err != nil {
+		return err
+	}
+	return writeRules(os.Stdout, discoverFlag.Format, rules)
+}
+
+func targetsAction(c *cli.Context) error {
+	opts, err := discoverFlag.baseOptions(0)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := discoverFlag.context()
+	defer cancel()
+	opts.Context = ctx
+
+	targets, err := styx.Targets(discoverFlag.Prometheus, opts)
+	if err != nil {
+		return err
+	}
+	return writeTargets(os.Stdout, discoverFlag.Format, targets)
+}
+
+// writeList writes the names or values as a csv column with the header,
+// or as a JSON list.
+func writeList(w io.Writer, format, header string, list []string) error {
+	if format == "json" {
+		if list == nil {
+			list = []string{}
+		}
+		return json.NewEncoder(w).Encode(list)
+	}
+
+	cw := csv.NewWriter(w)
+	cw.Write([]string{header})
+	for _, item := range list {
+		cw.Write([]string{item})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// writeSeries writes the label sets as csv with a column per label, the
+// name first, or as a JSON list of objects.
+func writeSeries(w io.Writer, format string, series []map[string]string) error {
+	if format == "json" {
+		return json.NewEncoder(w).Encode(series)
+	}
+
+	seen := make(map[string]bool)
+	var names []string
+	for _, labels := range series {
+		for name := range labels {
+			if !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if names[i] == "__name__" || names[j] == "__name__" {
+			return names[i] == "__name__"
+		}
+		return names[i] < names[j]
+	})
+
+	cw := csv.NewWriter(w)
+	cw.Write(names)
+	row := make([]string, len(names))
+	for _, labels := range series {
+		for i, name := range names {
+			row[i] = labels[name]
+		}
+		cw.Write(row)
+	}
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		return fmt.Errorf("writing the series failed: %v", err)
+	}
+	return nil
+}
+
+// writeMetadata writes the metadata as csv with a row per metric and
+// target exposing it differently, or as a JSON list of objects.
+func writeMetadata(w io.Writer, format string, metadata []styx.MetricMetadata) error {
+	if format == "json" {
+		if metadata == nil {
+			metadata = []styx.MetricMetadata{}
+		}
+		return json.NewEncoder(w).Encode(metadata)
+	}
+
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"metric", "type", "unit", "help"})
+	for _, m := range metadata {
+		cw.Write([]string{m.Metric, m.Type, m.Unit, m.Help})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// writeAlerts writes the alerts as csv with a row per alert, its labels
+// and annotations like {name="value"}, or as a JSON list of objects.
+func writeAlerts(w io.Writer, format string, alerts []styx.Alert) error {
+	if format == "json" {
+		if alerts == nil {
+			alerts = []styx.Alert{}
+		}
+		return json.NewEncoder(w).Encode(alerts)
+	}
+
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"alertname", "state", "active_at", "value", "labels", "annotations"})
+	for _, a := range alerts {
+		cw.Write([]string{a.Labels["alertname"], a.State, a.ActiveAt.Format(time.RFC3339), a.Value, formatLabels(a.Labels, "alertname"), formatLabels(a.Annotations)})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// writeRules writes the rules as csv with a row per rule, the alerts of
+// alerting rules are counted by state. JSON has the alerts themselves.
+func writeRules(w io.Writer, format string, rules []styx.Rule) error {
+	if format == "json" {
+		if rules == nil {
+			rules = []styx.Rule{}
+		}
+		return json.NewEncoder(w).Encode(rules)
+	}
+
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"group", "file", "type", "name", "query", "duration", "labels", "annotations", "state", "health", "last_error", "last_evaluation", "evaluation_time", "pending", "firing"})
+	for _, r := range rules {
+		duration := ""
+		if r.Type == "alerting" {
+			duration = r.Duration.String()
+		}
+		evaluated := ""
+		if !r.LastEvaluation.IsZero() {
+			evaluated = r.LastEvaluation.Format(time.RFC3339)
+		}
+		states := make(map[string]int)
+		for _, alert := range r.Alerts {
+			states[alert.State]++
+		}
+		cw.Write([]string{r.Group, r.File, r.Type, r.Name, r.Query, duration, formatLabels(r.Labels), formatLabels(r.Annotations),
+			r.State, r.Health, r.LastError, evaluated, r.EvaluationTime.String(), strconv.Itoa(states["pending"]), strconv.Itoa(states["firing"])})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// formatLabels formats the labels like PromQL does, {name="value",...}
+// sorted by name, without the ones to skip. No labels are empty.
+func formatLabels(labels map[string]string, skip ...string) string {
+	var names []string
+	for name := range labels {
+		names = append(names, name)
+	}
+	for _, s := range skip {
+		for i, name := range names {
+			if name == s {
+				names = append(names[:i], names[i+1:]...)
+				break
+			}
+		}
+	}
+	if len(names) == 0 {
+		return ""
+	}
+	sort.Strings(names)
+
+	pairs := make([]string, len(names))
+	for i, name := range names {
+		pairs[i] = name + "=" + strconv.Quote(labels[name])
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// writeTargets writes the targets as csv with a row per target, the other
+// labels than job and instance like {name="value"}, or as a JSON list of
+// objects.
+func writeTargets(w io.Writer, format string, targets []styx.Target) error {
+	if format == "json" {
+		if targets == nil {
+			targets = []styx.Target{}
+		}
+		return json.NewEncoder(w).Encode(targets)
+	}
+
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"job", "instance", "health", "last_scrape", "last_scrape_duration", "last_error", "scrape_url", "scrape_interval", "labels"})
+	for _, t := range targets {
+		scraped := ""
+		if !t.LastScrape.IsZero() {
+			scraped = t.LastScrape.Format(time.RFC3339)
+		}
+		cw.Write([]string{t.Labels["job"], t.Labels["instance"], t.Health, scraped, t.LastScrapeDuration.String(), t.LastError,
+			t.ScrapeURL, t.ScrapeInterval, formatLabels(t.Labels, "job", "instance")})
+	}
+	cw.Flush()
+	return cw.Error()
+}
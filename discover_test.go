@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/go-pluto/styx/pkg/styx"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteList(t *testing.T) {
+	var buf bytes.Buffer
+	assert.NoError(t, writeList(&buf, "csv", "namespace", []string{"default", "kube,system"}))
+	assert.Equal(t, "namespace\ndefault\n\"kube,system\"\n", buf.String())
+
+	buf.Reset()
+	assert.NoError(t, writeList(&buf, "json", "namespace", []string{"default"}))
+	assert.Equal(t, "[\"default\"]\n", buf.String())
+
+	buf.Reset()
+	assert.NoError(t, writeList(&buf, "json", "namespace", nil))
+	assert.Equal(t, "[]\n", buf.String())
+}
+
+func TestWriteSeries(t *testing.T) {
+	series := []map[string]string{
+		{"__name__": "up", "job": "node", "instance": "localhost:9100"},
+		{"__name__": "up", "job": "prometheus", "instance": "localhost:9090", "env": "prod"},
+	}
+
+	var buf bytes.Buffer
+	assert.NoError(t, writeSeries(&buf, "csv", series))
+	assert.Equal(t, "__name__,env,instance,job\n"+
+		"up,,localhost:9100,node\n"+
+		"up,prod,localhost:9090,prometheus\n", buf.String())
+
+	buf.Reset()
+	assert.NoError(t, writeSeries(&buf, "json", series[:1]))
+	assert.Equal(t, `[{"__name__":"up","instance":"localhost:9100","job":"node"}]`+"\n", buf.String())
+}
+
+func TestWriteMetadata(t *testing.T) {
+	metadata := []styx.MetricMetadata{
+		{Metric: "process_cpu_seconds_total", Type: "counter", Unit: "seconds", Help: "Total user and system CPU time, in seconds."},
+		{Metric: "up", Type: "gauge"},
+	}
+
+	var buf bytes.Buffer
+	assert.NoError(t, writeMetadata(&buf, "csv", metadata))
+	assert.Equal(t, "metric,type,unit,help\n"+
+		"process_cpu_seconds_total,counter,seconds,\"Total user and system CPU time, in seconds.\"\n"+
+		"up,gauge,,\n", buf.String())
+
+	buf.Reset()
+	assert.NoError(t, writeMetadata(&buf, "json", metadata[1:]))
+	assert.Equal(t, `[{"metric":"up","type":"gauge","unit":"","help":""}]`+"\n", buf.String())
+}
+
+func TestWriteAlerts(t *testing.T) {
+	alerts := []styx.Alert{{
+		Labels:      map[string]string{"alertname": "TargetDown", "job": "node", "instance": "node1:9100"},
+		Annotations: map[string]string{"summary": `node1 is "down"`},
+		State:       "firing",
+		ActiveAt:    time.Date(2017, 8, 14, 21, 10, 0, 0, time.UTC),
+		Value:       "1e+00",
+	}}
+
+	var buf bytes.Buffer
+	assert.NoError(t, writeAlerts(&buf, "csv", alerts))
+	assert.Equal(t, "alertname,state,active_at,value,labels,annotations\n"+
+		`TargetDown,firing,2017-08-14T21:10:00Z,1e+00,"{instance=""node1:9100"",job=""node""}","{summary=""node1 is \""down\""""}"`+"\n", buf.String())
+
+	buf.Reset()
+	assert.NoError(t, writeAlerts(&buf, "json", nil))
+	assert.Equal(t, "[]\n", buf.String())
+}
+
+func TestWriteRules(t *testing.T) {
+	rules := []styx.Rule{{
+		Group: "api", File: "api.yaml", Type: "recording", Name: "job:requests:rate5m", Query: "sum by (job) (rate(requests_total[5m]))",
+		Health: "ok", EvaluationTime: 2500 * time.Microsecond,
+	}, {
+		Group: "api", File: "api.yaml", Type: "alerting", Name: "HighLatency", Query: "latency > 0.2", Duration: 10 * time.Minute,
+		Labels: map[string]string{"severity": "page"}, State: "firing", Health: "ok",
+		LastEvaluation: time.Date(2017, 8, 14, 21, 20, 0, 0, time.UTC), EvaluationTime: time.Millisecond,
+		Alerts: []styx.Alert{{State: "firing"}, {State: "firing"}, {State: "pending"}},
+	}}
+
+	var buf bytes.Buffer
+	assert.NoError(t, writeRules(&buf, "csv", rules))
+	assert.Equal(t, "group,file,type,name,query,duration,labels,annotations,state,health,last_error,last_evaluation,evaluation_time,pending,firing\n"+
+		"api,api.yaml,recording,job:requests:rate5m,sum by (job) (rate(requests_total[5m])),,,,,ok,,,2.5ms,0,0\n"+
+		`api,api.yaml,alerting,HighLatency,latency > 0.2,10m0s,"{severity=""page""}",,firing,ok,,2017-08-14T21:20:00Z,1ms,1,2`+"\n", buf.String())
+}
+
+func TestFormatLabels(t *testing.T) {
+	assert.Equal(t, `{a="1",c="x\ny"}`, formatLabels(map[string]string{"c": "x\ny", "a": "1", "b": "2"}, "b"))
+	assert.Equal(t, "", formatLabels(map[string]string{"alertname": "A"}, "alertname"))
+	assert.Equal(t, "", formatLabels(nil))
+}
+
+func TestWriteTargets(t *testing.T) {
+	targets := []styx.Target{{
+		Labels:             map[string]string{"job": "node", "instance": "node1:9100", "zone": "eu"},
+		ScrapeURL:          "http://node1:9100/metrics",
+		Health:             "down",
+		LastError:          "connection refused",
+		LastScrape:         time.Date(2017, 8, 14, 21, 10, 0, 0, time.UTC),
+		LastScrapeDuration: 1500 * time.Microsecond,
+		ScrapeInterval:     "15s",
+	}, {
+		Labels: map[string]string{"job": "api", "instance": "api:8080"},
+		Health: "unknown",
+	}}
+
+	var buf bytes.Buffer
+	assert.NoError(t, writeTargets(&buf, "csv", targets))
+	assert.Equal(t, "job,instance,health,last_scrape,last_scrape_duration,last_error,scrape_url,scrape_interval,labels\n"+
+		`node,node1:9100,down,2017-08-14T21:10:00Z,1.5ms,connection refused,http://node1:9100/metrics,15s,"{zone=""eu""}"`+"\n"+
+		"api,api:8080,unknown,,0s,,,,\n", buf.String())
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/go-pluto/styx/pkg/styx"
+	"github.com/urfave/cli"
+)
+
+// downsampleFlags are the flags of commands reducing samples client-side.
+type downsampleFlags struct {
+	Spec string
+}
+
+func (f *downsampleFlags) flags() []cli.Flag {
+	return []cli.Flag{
+		cli.StringFlag{
+			Name:        "downsample",
+			Usage:       "Reduce the samples of every window to one, as window:aggregation with avg, min, max, sum or last, e.g. 1h:avg",
+			Destination: &f.Spec,
+		},
+	}
+}
+
+// window parses the window in seconds and the aggregation, a window of 0
+// means not to downsample.
+func (f *downsampleFlags) window() (int, string, error) {
+	if f.Spec == "" {
+		return 0, "", nil
+	}
+
+	parts := strings.SplitN(f.Spec, ":", 2)
+	if len(parts) != 2 {
+		return 0, "", fmt.Errorf("--downsample needs to be window:aggregation, e.g. 1h:avg: %s", f.Spec)
+	}
+	window, err := parseStep(parts[0])
+	if err != nil {
+		return 0, "", fmt.Errorf("invalid --downsample window: %v", err)
+	}
+	switch parts[1] {
+	case styx.DownsampleAvg, styx.DownsampleMin, styx.DownsampleMax, styx.DownsampleSum, styx.DownsampleLast:
+	default:
+		return 0, "", fmt.Errorf("unknown --downsample aggregation: %s", parts[1])
+	}
+	return window, parts[1], nil
+}
+
+// downsample applies the flags to the results, see styx.Downsample.
+func (f *downsampleFlags) downsample(results []styx.Result) ([]styx.Result, error) {
+	window, aggregation, err := f.window()
+	if err != nil || window == 0 {
+		return results, err
+	}
+	return styx.Downsample(results, window, aggregation)
+}
@@ -0,0 +1,23 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDownsampleFlags(t *testing.T) {
+	window, aggregation, err := (&downsampleFlags{Spec: "1h:avg"}).window()
+	assert.NoError(t, err)
+	assert.Equal(t, 3600, window)
+	assert.Equal(t, "avg", aggregation)
+
+	window, _, err = (&downsampleFlags{}).window()
+	assert.NoError(t, err)
+	assert.Equal(t, 0, window)
+
+	for _, spec := range []string{"1h", "1h:median", "0s:avg", "1.5s:max", ":sum"} {
+		_, _, err := (&downsampleFlags{Spec: spec}).window()
+		assert.Error(t, err, spec)
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/fatih/color"
+	"github.com/go-pluto/styx/pkg/styx"
+	"github.com/urfave/cli"
+)
+
+// fillFlags are the flags of commands filling missing points.
+type fillFlags struct {
+	Policy string
+}
+
+func (f *fillFlags) flags() []cli.Flag {
+	return []cli.Flag{
+		cli.StringFlag{
+			Name: "fill",
+			Usage: "Fill missing points with null (leave them empty), zero, previous (the last value), linear (interpolated) or a number like NaN, " +
+				"previous and linear may be followed by the number of the points they leave missing, e.g. linear,NaN",
+			Value:       styx.FillNull,
+			Destination: &f.Policy,
+		},
+	}
+}
+
+// fill applies the policy to the results, see styx.Fill. The number after
+// a policy, like linear,NaN, is set for the points it leaves missing.
+func (f *fillFlags) fill(results []styx.Result) ([]styx.Result, error) {
+	policy, rest := f.Policy, ""
+	if i := strings.Index(policy, ","); i >= 0 {
+		policy, rest = policy[:i], policy[i+1:]
+	}
+	results, err := styx.Fill(results, policy)
+	if err != nil || rest == "" {
+		return results, err
+	}
+	gap, err := strconv.ParseFloat(rest, 64)
+	if err != nil {
+		return nil, fmt.Errorf("the points --fill %s leaves missing need to be set to a number: %s", policy, rest)
+	}
+	return styx.FillGaps(results, gap), nil
+}
+
+// resolveFill turns the deprecated --gap into the --fill policy writing
+// it, so that only --fill fills missing points.
+func (f *flags) resolveFill() error {
+	if f.Gap == "" {
+		return nil
+	}
+	switch f.Fill.Policy {
+	case styx.FillNull:
+		f.Fill.Policy = f.Gap
+	case styx.FillPrevious, styx.FillLinear:
+		f.Fill.Policy += "," + f.Gap
+	default:
+		return fmt.Errorf("--gap can't be combined with --fill %s", f.Fill.Policy)
+	}
+	fmt.Fprintln(os.Stderr, color.YellowString("warning: --gap is deprecated, use --fill %s", f.Fill.Policy))
+	f.Gap = ""
+	return nil
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/go-pluto/styx/pkg/styx"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFillFlags(t *testing.T) {
+	res := []styx.Result{{
+		Metric: "foobar",
+		Times:  []int64{1502749390, 1502749392, 1502749394, 1502749396},
+		Values: []float64{styx.Missing, 2, styx.Missing, 4},
+	}}
+
+	filled, err := (&fillFlags{Policy: "linear,NaN"}).fill(res)
+	assert.NoError(t, err)
+	buf := bytes.NewBuffer(nil)
+	assert.NoError(t, styx.CSVWriter(buf, filled))
+	assert.Equal(t, "1502749390,NaN\n1502749392,2\n1502749394,3\n1502749396,4\n", buf.String())
+
+	_, err = (&fillFlags{Policy: "linear,n/a"}).fill(nil)
+	assert.Error(t, err)
+	_, err = (&fillFlags{Policy: "mean,0"}).fill(nil)
+	assert.Error(t, err)
+}
+
+func TestResolveFill(t *testing.T) {
+	f := flags{Gap: "0", Fill: fillFlags{Policy: styx.FillNull}}
+	assert.NoError(t, f.resolveFill())
+	assert.Equal(t, "0", f.Fill.Policy)
+	assert.Empty(t, f.Gap)
+
+	f = flags{Gap: "NaN", Fill: fillFlags{Policy: styx.FillLinear}}
+	assert.NoError(t, f.resolveFill())
+	assert.Equal(t, "linear,NaN", f.Fill.Policy)
+
+	f = flags{Gap: "NaN", Fill: fillFlags{Policy: styx.FillZero}}
+	assert.Error(t, f.resolveFill())
+}
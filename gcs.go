@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+const gcsScope = "https://www.googleapis.com/auth/devstorage.read_write"
+
+// isGCSURL reports whether path is a Google Cloud Storage object like
+// gs://bucket/name.
+func isGCSURL(path string) bool {
+	return strings.HasPrefix(path, "gs://")
+}
+
+// gcsObject is an object in a bucket of Google Cloud Storage.
+type gcsObject struct {
+	Bucket string
+	Name   string
+}
+
+func parseGCSURL(raw string) (gcsObject, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return gcsObject{}, err
+	}
+	name := strings.TrimPrefix(u.Path, "/")
+	if u.Scheme != "gs" || u.Host == "" || name == "" {
+		return gcsObject{}, fmt.Errorf("GCS objects need to be given as gs://bucket/name: %s", raw)
+	}
+	return gcsObject{Bucket: u.Host, Name: name}, nil
+}
+
+// gcsPut uploads body as the object to the JSON API at endpoint.
+func gcsPut(endpoint, token string, obj gcsObject, body []byte) error {
+	u := strings.TrimSuffix(endpoint, "/") + "/upload/storage/v1/b/" + url.PathEscape(obj.Bucket) +
+		"/o?uploadType=media&name=" + url.QueryEscape(obj.Name)
+	req, err := http.NewRequest(http.MethodPost, u, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		snippet, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 256))
+		return fmt.Errorf("uploading gs://%s/%s failed with %s: %s", obj.Bucket, obj.Name, resp.Status, snippet)
+	}
+	return nil
+}
+
+// uploadGCS uploads body to the GCS URL with the application default
+// credentials. STORAGE_EMULATOR_HOST uploads to an emulator without them.
+func uploadGCS(rawURL string, body []byte) error {
+	obj, err := parseGCSURL(rawURL)
+	if err != nil {
+		return err
+	}
+
+	if host := os.Getenv("STORAGE_EMULATOR_HOST"); host != "" {
+		if !strings.Contains(host, "://") {
+			host = "http://" + host
+		}
+		return gcsPut(host, "", obj, body)
+	}
+
+	token, err := googleToken(http.DefaultClient, gcsScope, time.Now())
+	if err != nil {
+		return err
+	}
+	return gcsPut("https://storage.googleapis.com", token, obj, body)
+}
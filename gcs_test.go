@@ -0,0 +1,51 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseGCSURL(t *testing.T) {
+	obj, err := parseGCSURL("gs://exports/prometheus/goroutines.csv.gz")
+	assert.NoError(t, err)
+	assert.Equal(t, gcsObject{Bucket: "exports", Name: "prometheus/goroutines.csv.gz"}, obj)
+
+	for _, invalid := range []string{"gs://exports", "gs://exports/", "gs:///name", "s3://exports/key"} {
+		_, err := parseGCSURL(invalid)
+		assert.Error(t, err, invalid)
+	}
+
+	assert.True(t, isGCSURL("gs://exports/name"))
+	assert.False(t, isGCSURL("exports/name"))
+}
+
+func TestGCSPut(t *testing.T) {
+	var method, path, name, auth string
+	var body []byte
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		method, path = r.Method, r.URL.Path
+		name, auth = r.URL.Query().Get("name"), r.Header.Get("Authorization")
+		body, _ = ioutil.ReadAll(r.Body)
+		if r.URL.Query().Get("name") == "denied.csv" {
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"error":{"code":403}}`))
+		}
+	}))
+	defer ts.Close()
+
+	err := gcsPut(ts.URL, "ya29.token", gcsObject{Bucket: "exports", Name: "day 1/out.csv"}, []byte("1502749390,1\n"))
+	assert.NoError(t, err)
+	assert.Equal(t, http.MethodPost, method)
+	assert.Equal(t, "/upload/storage/v1/b/exports/o", path)
+	assert.Equal(t, "day 1/out.csv", name)
+	assert.Equal(t, "Bearer ya29.token", auth)
+	assert.Equal(t, "1502749390,1\n", string(body))
+
+	err = gcsPut(ts.URL, "", gcsObject{Bucket: "exports", Name: "denied.csv"}, nil)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "403")
+}
@@ -2,31 +2,65 @@ package main
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"strings"
 	"time"
 
 	"github.com/fatih/color"
+	"github.com/go-pluto/styx/pkg/styx"
 	"github.com/urfave/cli"
 )
 
 type gnuplotFlags struct {
+	queryFlags
+
 	Duration   time.Duration
+	Range      rangeFlags
 	Prometheus string
 	Title      string
+	Clamp      clampFlags
+	Fill       fillFlags
+	Top        topFlags
 }
 
 var gnuplotFlag gnuplotFlags
 
 func gnuplotAction(c *cli.Context) error {
 	if !c.Args().Present() {
-		return fmt.Errorf(color.RedString("need a query to run"))
+		return errors.New(color.RedString("need a query to run"))
+	}
+
+	start, end, err := gnuplotFlag.Range.timeRange(time.Now(), gnuplotFlag.Duration)
+	if err != nil {
+		return errors.New(color.RedString(err.Error()))
+	}
+
+	opts, err := gnuplotFlag.options(gnuplotFlag.Prometheus, end.Sub(start))
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := gnuplotFlag.context()
+	defer cancel()
+	opts.Context = ctx
+
+	results, err := gnuplotFlag.query(gnuplotFlag.Prometheus, start, end, c.Args().First(), &opts)
+	if err != nil {
+		return err
+	}
+
+	results, err = gnuplotFlag.Top.top(results)
+	if err != nil {
+		return err
 	}
 
-	end := time.Now()
-	start := end.Add(-1 * gnuplotFlag.Duration)
+	results, err = gnuplotFlag.Fill.fill(results)
+	if err != nil {
+		return err
+	}
 
-	results, err := Query(gnuplotFlag.Prometheus, start, end, c.Args().First())
+	results, _, err = gnuplotFlag.Clamp.clamp(results)
 	if err != nil {
 		return err
 	}
@@ -44,7 +78,7 @@ func gnuplotAction(c *cli.Context) error {
 		buf.WriteString(plot)
 	}
 
-	if err := csvWriter(buf, results); err != nil {
+	if err := styx.CSVWriter(buf, results); err != nil {
 		return err
 	}
 
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+)
+
+const googleTokenURL = "https://oauth2.googleapis.com/token"
+
+// googleCredentials is a credentials file of a service account or of a
+// user logged in with gcloud auth application-default login.
+type googleCredentials struct {
+	Type string `json:"type"`
+
+	// service_account
+	ClientEmail  string `json:"client_email"`
+	PrivateKeyID string `json:"private_key_id"`
+	PrivateKey   string `json:"private_key"`
+	TokenURI     string `json:"token_uri"`
+
+	// authorized_user
+	ClientID     string `json:"client_id"`
+	ClientSecret string `json:"client_secret"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+// googleToken returns an access token for the scope with the credentials
+// found the way the Google SDKs do: the file GOOGLE_APPLICATION_CREDENTIALS,
+// the one written by gcloud auth application-default login or else the
+// service account of the instance from the metadata server. The token
+// endpoint is asked with client, the metadata server directly.
+func googleToken(client *http.Client, scope string, now time.Time) (string, error) {
+	token, err := googleAccessToken(client, scope, now)
+	return token.Token, err
+}
+
+// googleAccessToken returns the access token like googleToken, with the
+// time it expires.
+func googleAccessToken(client *http.Client, scope string, now time.Time) (accessToken, error) {
+	path := os.Getenv("GOOGLE_APPLICATION_CREDENTIALS")
+	if path == "" {
+		path = gcloudCredentialsPath()
+		if _, err := os.Stat(path); err != nil {
+			return googleMetadataToken(metadataClient, scope, now)
+		}
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return accessToken{}, err
+	}
+	var creds googleCredentials
+	if err := json.Unmarshal(data, &creds); err != nil {
+		return accessToken{}, fmt.Errorf("invalid Google credentials %s: %v", path, err)
+	}
+	return creds.token(client, scope, now)
+}
+
+// gcloudCredentialsPath returns where gcloud keeps the application default
+// credentials.
+func gcloudCredentialsPath() string {
+	if runtime.GOOS == "windows" {
+		return filepath.Join(os.Getenv("APPDATA"), "gcloud", "application_default_credentials.json")
+	}
+	home, _ := os.UserHomeDir()
+	return filepath.Join(home, ".config", "gcloud", "application_default_credentials.json")
+}
+
+// token exchanges the credentials for an access token, a service account
+// with a JWT signed by its key, a user with the refresh token.
+func (c googleCredentials) token(client *http.Client, scope string, now time.Time) (accessToken, error) {
+	form := url.Values{}
+	tokenURL := googleTokenURL
+	switch c.Type {
+	case "service_account":
+		assertion, err := c.assertion(scope, now)
+		if err != nil {
+			return accessToken{}, err
+		}
+		if c.TokenURI != "" {
+			tokenURL = c.TokenURI
+		}
+		form.Set("grant_type", "urn:ietf:params:oauth:grant-type:jwt-bearer")
+		form.Set("assertion", assertion)
+	case "authorized_user":
+		form.Set("grant_type", "refresh_token")
+		form.Set("client_id", c.ClientID)
+		form.Set("client_secret", c.ClientSecret)
+		form.Set("refresh_token", c.RefreshToken)
+	default:
+		return accessToken{}, fmt.Errorf("unsupported type of Google credentials: %q", c.Type)
+	}
+
+	resp, err := client.PostForm(tokenURL, form)
+	if err != nil {
+		return accessToken{}, err
+	}
+	return decodeAccessToken(resp, now)
+}
+
+// assertion returns the JWT of the service account asking for the scope,
+// signed with its private key.
+func (c googleCredentials) assertion(scope string, now time.Time) (string, error) {
+	block, _ := pem.Decode([]byte(c.PrivateKey))
+	if block == nil {
+		return "", errors.New("the private key of the service account isn't PEM encoded")
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		if parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes); err != nil {
+			return "", fmt.Errorf("invalid private key of the service account: %v", err)
+		}
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return "", errors.New("the private key of the service account isn't an RSA key")
+	}
+
+	aud := c.TokenURI
+	if aud == "" {
+		aud = googleTokenURL
+	}
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT", "kid": c.PrivateKeyID})
+	claims, _ := json.Marshal(map[string]interface{}{
+		"iss":   c.ClientEmail,
+		"scope": scope,
+		"aud":   aud,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+	})
+	unsigned := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+
+	hash := sha256.Sum256([]byte(unsigned))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, hash[:])
+	if err != nil {
+		return "", err
+	}
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// googleMetadataToken returns a token of the instance's service account,
+// GCE_METADATA_HOST overrides the metadata server.
+func googleMetadataToken(client *http.Client, scope string, now time.Time) (accessToken, error) {
+	host := os.Getenv("GCE_METADATA_HOST")
+	if host == "" {
+		host = "metadata.google.internal"
+	}
+	u := "http://" + host + "/computeMetadata/v1/instance/service-accounts/default/token?scopes=" + url.QueryEscape(scope)
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return accessToken{}, err
+	}
+	req.Header.Set("Metadata-Flavor", "Google")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return accessToken{}, fmt.Errorf("no Google credentials in GOOGLE_APPLICATION_CREDENTIALS, %s or the metadata server: %v",
+			gcloudCredentialsPath(), err)
+	}
+	return decodeAccessToken(resp, now)
+}
+
+// decodeAccessToken decodes the access token of an OAuth2 token response,
+// which expires expires_in seconds after now.
+func decodeAccessToken(resp *http.Response, now time.Time) (accessToken, error) {
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		snippet, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 256))
+		return accessToken{}, fmt.Errorf("getting an access token failed with %s: %s", resp.Status, strings.TrimSpace(string(snippet)))
+	}
+
+	var token struct {
+		AccessToken string      `json:"access_token"`
+		ExpiresIn   json.Number `json:"expires_in"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return accessToken{}, fmt.Errorf("invalid token response: %v", err)
+	}
+	if token.AccessToken == "" {
+		return accessToken{}, errors.New("the token response has no access_token")
+	}
+
+	t := accessToken{Token: token.AccessToken}
+	if seconds, err := token.ExpiresIn.Int64(); err == nil && seconds > 0 {
+		t.Expires = now.Add(time.Duration(seconds) * time.Second)
+	}
+	return t, nil
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGoogleCredentialsToken(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	assert.NoError(t, err)
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	assert.NoError(t, err)
+
+	var form map[string][]string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		form = r.PostForm
+		w.Write([]byte(`{"access_token":"ya29.token","expires_in":3599,"token_type":"Bearer"}`))
+	}))
+	defer ts.Close()
+
+	creds := googleCredentials{
+		Type:        "service_account",
+		ClientEmail: "styx@project.iam.gserviceaccount.com",
+		PrivateKey:  string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})),
+		TokenURI:    ts.URL,
+	}
+	now := time.Unix(1502749390, 0)
+	token, err := creds.token(http.DefaultClient, gcsScope, now)
+	assert.NoError(t, err)
+	assert.Equal(t, accessToken{Token: "ya29.token", Expires: now.Add(3599 * time.Second)}, token)
+	assert.Equal(t, "urn:ietf:params:oauth:grant-type:jwt-bearer", form["grant_type"][0])
+
+	parts := strings.Split(form["assertion"][0], ".")
+	assert.Len(t, parts, 3)
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	assert.NoError(t, err)
+	var claims map[string]interface{}
+	assert.NoError(t, json.Unmarshal(payload, &claims))
+	assert.Equal(t, "styx@project.iam.gserviceaccount.com", claims["iss"])
+	assert.Equal(t, gcsScope, claims["scope"])
+	assert.Equal(t, ts.URL, claims["aud"])
+	assert.Equal(t, float64(1502752990), claims["exp"])
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	assert.NoError(t, err)
+	hash := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	assert.NoError(t, rsa.VerifyPKCS1v15(&key.PublicKey, crypto.SHA256, hash[:], signature))
+
+	creds.PrivateKey = "no key"
+	_, err = creds.token(http.DefaultClient, gcsScope, now)
+	assert.Error(t, err)
+	_, err = googleCredentials{Type: "external_account"}.token(http.DefaultClient, gcsScope, now)
+	assert.Error(t, err)
+}
+
+func TestGoogleMetadataToken(t *testing.T) {
+	var flavor, scopes string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		flavor, scopes = r.Header.Get("Metadata-Flavor"), r.URL.Query().Get("scopes")
+		w.Write([]byte(`{"access_token":"ya29.instance"}`))
+	}))
+	defer ts.Close()
+
+	t.Setenv("GCE_METADATA_HOST", strings.TrimPrefix(ts.URL, "http://"))
+	token, err := googleMetadataToken(http.DefaultClient, gcsScope, time.Now())
+	assert.NoError(t, err)
+	assert.Equal(t, "ya29.instance", token.Token)
+	assert.True(t, token.Expires.IsZero())
+	assert.Equal(t, "Google", flavor)
+	assert.Equal(t, gcsScope, scopes)
+}
@@ -0,0 +1,23 @@
+package main
+
+import (
+	"compress/gzip"
+	"io"
+	"strings"
+)
+
+// writeGzip compresses everything write writes to w. The gzip stream is
+// closed even if write fails, so what has been written is readable.
+func writeGzip(w io.Writer, write func(io.Writer) error) error {
+	gz := gzip.NewWriter(w)
+	if err := write(gz); err != nil {
+		gz.Close()
+		return err
+	}
+	return gz.Close()
+}
+
+// isGzip reports whether path names a gzip compressed file.
+func isGzip(path string) bool {
+	return strings.HasSuffix(path, ".gz")
+}
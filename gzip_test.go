@@ -0,0 +1,59 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	"github.com/go-pluto/styx/pkg/styx"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteGzip(t *testing.T) {
+	res := []styx.Result{{
+		Metric: "foobar",
+		Times:  []int64{1502749390, 1502749391},
+		Values: []float64{1, 2},
+	}, {
+		Metric: "foobaz",
+		Times:  []int64{1502749391},
+		Values: []float64{3},
+	}}
+
+	buf := bytes.NewBuffer(nil)
+	assert.NoError(t, writeGzip(buf, func(w io.Writer) error {
+		if err := styx.CSVHeaderWriter(w, res); err != nil {
+			return err
+		}
+		return styx.CSVWriter(w, res)
+	}))
+
+	gz, err := gzip.NewReader(buf)
+	assert.NoError(t, err)
+	csv, err := ioutil.ReadAll(gz)
+	assert.NoError(t, err)
+	assert.Equal(t, "Time,foobar,foobaz\n1502749390,1,\n1502749391,2,3\n", string(csv))
+
+	// What was written before an error is still a complete stream
+	buf = bytes.NewBuffer(nil)
+	failed := errors.New("failed")
+	assert.Equal(t, failed, writeGzip(buf, func(w io.Writer) error {
+		w.Write([]byte("partial"))
+		return failed
+	}))
+
+	gz, err = gzip.NewReader(buf)
+	assert.NoError(t, err)
+	partial, err := ioutil.ReadAll(gz)
+	assert.NoError(t, err)
+	assert.Equal(t, "partial", string(partial))
+}
+
+func TestIsGzip(t *testing.T) {
+	assert.True(t, isGzip("out.csv.gz"))
+	assert.False(t, isGzip("out.csv"))
+	assert.False(t, isGzip("out.gzip"))
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// icpLogin logs in to the IAM of IBM Cloud Private at u with the API key or
+// else the username and password, returning the access token.
+func icpLogin(client *http.Client, u, username, password, apiKey string, now time.Time) (accessToken, error) {
+	form := url.Values{}
+	form.Set("scope", "openid")
+	if apiKey != "" {
+		form.Set("grant_type", "urn:ibm:params:oauth:grant-type:apikey")
+		form.Set("apikey", apiKey)
+	} else {
+		form.Set("grant_type", "password")
+		form.Set("username", username)
+		form.Set("password", password)
+	}
+
+	resp, err := client.PostForm(strings.TrimSuffix(u, "/")+"/idprovider/v1/auth/identitytoken", form)
+	if err != nil {
+		return accessToken{}, err
+	}
+	return decodeAccessToken(resp, now)
+}
+
+// icpURL returns the URL of the IAM of IBM Cloud Private running on the
+// host of Prometheus, on the management port 8443.
+func icpURL(host string) (string, error) {
+	u, err := url.Parse(host)
+	if err != nil {
+		return "", err
+	}
+	if u.Hostname() == "" {
+		return "", errors.New("--auth icp needs the --icp-url of the cluster")
+	}
+	return "https://" + net.JoinHostPort(u.Hostname(), "8443"), nil
+}
+
+// icpTransport returns the transport sending the tokens of the ICP login
+// with the requests sent with next to host. The login goes through next as
+// well, so it trusts the same certificates. Tokens are cached until they
+// expire, requests denied with 401 log in again.
+func (f *queryFlags) icpTransport(next http.RoundTripper, host string) (http.RoundTripper, error) {
+	if f.Username == "" && f.ICPAPIKey == "" {
+		return nil, errors.New("--auth icp needs a --username or the --icp-api-key")
+	}
+	u := f.ICPURL
+	if u == "" {
+		var err error
+		if u, err = icpURL(host); err != nil {
+			return nil, err
+		}
+	}
+	password, err := f.password()
+	if err != nil {
+		return nil, err
+	}
+
+	username, apiKey := f.Username, f.ICPAPIKey
+	client := &http.Client{Transport: next}
+	key := authICP + " " + u + " " + username
+	cache := sharedTokenCache(key, next, func(now time.Time) (accessToken, error) {
+		return icpLogin(client, u, username, password, apiKey, now)
+	})
+	return &bearerTransport{Next: next, Token: cache.get, Refresh: cache.reset}, nil
+}
@@ -0,0 +1,18 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestICPURL(t *testing.T) {
+	u, err := icpURL("https://mycluster.icp:8443/prometheus")
+	assert.NoError(t, err)
+	assert.Equal(t, "https://mycluster.icp:8443", u)
+	u, err = icpURL("http://10.0.0.1:9090")
+	assert.NoError(t, err)
+	assert.Equal(t, "https://10.0.0.1:8443", u)
+	_, err = icpURL("/prometheus")
+	assert.Error(t, err)
+}
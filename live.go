@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/go-pluto/styx/pkg/styx"
+	"github.com/urfave/cli"
+)
+
+const (
+	clearScreen = "\033[H\033[2J"
+	hideCursor  = "\033[?25l"
+	showCursor  = "\033[?25h"
+)
+
+type liveFlags struct {
+	queryFlags
+
+	Duration   time.Duration
+	Interval   time.Duration
+	Prometheus string
+	Thousands  string
+	Decimal    string
+	Precision  int
+}
+
+var liveFlag liveFlags
+
+func liveAction(c *cli.Context) error {
+	if !c.Args().Present() {
+		return errors.New(color.RedString("need a query to run"))
+	}
+	if liveFlag.Interval <= 0 {
+		return errors.New(color.RedString("the interval needs to be positive"))
+	}
+
+	query := c.Args().First()
+
+	ctx, cancel := liveFlag.context()
+	defer cancel()
+
+	fmt.Print(hideCursor)
+	defer fmt.Print(showCursor)
+
+	ticker := time.NewTicker(liveFlag.Interval)
+	defer ticker.Stop()
+
+	for {
+		liveRender(ctx, os.Stdout, query)
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// liveRender redraws the whole screen with the latest values of the query.
+// Errors are shown instead of the table, as the next poll might succeed.
+func liveRender(ctx context.Context, w io.Writer, query string) {
+	end := time.Now()
+	start := end.Add(-1 * liveFlag.Duration)
+
+	buf := bytes.NewBufferString(clearScreen)
+	fmt.Fprintf(buf, "%s  %s\n\n", color.CyanString(query), end.Format(time.RFC1123))
+
+	opts, err := liveFlag.options(liveFlag.Prometheus, end.Sub(start))
+	if err != nil {
+		fmt.Fprintln(buf, color.RedString(err.Error()))
+		buf.WriteTo(w)
+		return
+	}
+
+	opts.Context = ctx
+	results, err := liveFlag.query(liveFlag.Prometheus, start, end, query, &opts)
+	if err != nil {
+		fmt.Fprintln(buf, color.RedString(err.Error()))
+	} else {
+		nf := styx.NumberFormat{
+			Thousands: liveFlag.Thousands,
+			Decimal:   liveFlag.Decimal,
+			Precision: liveFlag.Precision,
+		}
+		styx.TableWriter(buf, results, nf)
+	}
+
+	buf.WriteTo(w)
+}
@@ -1,12 +1,22 @@
 package main
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"log"
 	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/template"
 	"time"
+	"unicode/utf8"
 
 	"github.com/fatih/color"
+	"github.com/go-pluto/styx/pkg/styx"
 	"github.com/urfave/cli"
 )
 
@@ -15,8 +25,9 @@ func main() {
 	app.Name = "styx"
 	app.Usage = "Export metrics from prometheus"
 
+	app.Before = applyProfile
 	app.Action = exportAction
-	app.Flags = []cli.Flag{
+	app.Flags = flagsOf([]cli.Flag{
 		cli.DurationFlag{
 			Name:        "duration,d",
 			Usage:       "The duration to get timeseries from",
@@ -33,13 +44,198 @@ func main() {
 			Value:       "http://localhost:9090",
 			Destination: &flag.Prometheus,
 		},
-	}
+		cli.StringSliceFlag{
+			Name:  "query,q",
+			Usage: "A query to run in addition to the argument, can be repeated to export several into one file",
+			Value: &flag.Queries,
+		},
+		cli.StringFlag{
+			Name:        "queries-file",
+			Usage:       "Run the queries of this file, one per line, in addition to the others",
+			Destination: &flag.QueriesFile,
+		},
+		cli.StringFlag{
+			Name:        "format,f",
+			Usage:       "The format to export: csv, tidy (one row per sample), values (a line of values per series), json, matrix (Prometheus' JSON), xlsx, parquet, tidy-parquet, html (a report with a chart), svg, png, chart and ascii-chart (to look at in the terminal), datadog, openmetrics (to backfill with promtool), npy or hash (to detect changes)",
+			Value:       "csv",
+			Destination: &flag.Format,
+		},
+		cli.StringFlag{
+			Name:        "layout",
+			Usage:       "The layout of the csv: wide (a column per series) or long (a row per sample with the metric and its labels)",
+			Value:       "wide",
+			Destination: &flag.Layout,
+		},
+		cli.BoolFlag{
+			Name:        "stream",
+			Usage:       "Write the rows of every series as soon as it's decoded, keeping memory low on long exports; needs --layout long or --label-columns",
+			Destination: &flag.Stream,
+		},
+		cli.BoolFlag{
+			Name:        "sheet-per-query",
+			Usage:       "Add a sheet with the series of every query to xlsx workbooks",
+			Destination: &flag.SheetPerQuery,
+		},
+		cli.StringFlag{
+			Name:        "title",
+			Usage:       "Give the html report or svg and png chart a title",
+			Destination: &flag.Title,
+		},
+		cli.BoolFlag{
+			Name:        "summary",
+			Usage:       "Export the count, min, max, mean, stddev and --percentiles of every series instead of its samples",
+			Destination: &flag.Summary,
+		},
+		cli.StringFlag{
+			Name:        "percentiles",
+			Usage:       "The percentiles of the --summary, separated by commas",
+			Value:       "50,95,99",
+			Destination: &flag.Percentiles,
+		},
+		cli.StringFlag{
+			Name:        "chart-size",
+			Usage:       "The size of svg and png charts in pixels, of terminal charts in characters, e.g. 120x30",
+			Destination: &flag.ChartSize,
+		},
+		cli.StringFlag{
+			Name:        "csv-special",
+			Usage:       "Write +Inf, -Inf and NaN in csv as this, e.g. '' or '1e308,-1e308,'",
+			Destination: &flag.CSVSpecial,
+		},
+		cli.StringFlag{
+			Name:        "delimiter",
+			Usage:       "Separate the fields of csv with this character, e.g. ';' or 'tab'",
+			Value:       ",",
+			Destination: &flag.Delimiter,
+		},
+		cli.StringFlag{
+			Name:        "values-separator",
+			Usage:       "The separator of the values format",
+			Value:       " ",
+			Destination: &flag.ValuesSeparator,
+		},
+		cli.StringFlag{
+			Name:        "datadog-metric",
+			Usage:       "The Datadog metric name for timeseries without a name",
+			Value:       "prometheus.query",
+			Destination: &flag.DatadogMetric,
+		},
+		cli.IntFlag{
+			Name:        "datadog-max-points",
+			Usage:       "The maximum number of points per Datadog payload",
+			Value:       styx.DatadogMaxPoints,
+			Destination: &flag.DatadogMaxPoints,
+		},
+		cli.StringSliceFlag{
+			Name:  "rename-label",
+			Usage: "Rename a label when exporting to a backend, e.g. instance=host",
+			Value: &flag.RenameLabels,
+		},
+		cli.StringSliceFlag{
+			Name:  "drop-label",
+			Usage: "Drop labels from the exported series, e.g. instance,job, can be repeated",
+			Value: &flag.DropLabels,
+		},
+		cli.StringFlag{
+			Name:        "label-columns",
+			Usage:       "Write a csv row per sample with these labels as columns, e.g. pod,namespace",
+			Destination: &flag.LabelColumns,
+		},
+		cli.StringFlag{
+			Name:        "column-template",
+			Usage:       "Name the series by a template of their labels, e.g. '{{.pod}}-{{.container}}'",
+			Destination: &flag.ColumnTemplate,
+		},
+		cli.DurationFlag{
+			Name:        "chunk",
+			Usage:       "Split the duration into queries of this length, e.g. 24h",
+			Destination: &flag.Chunk,
+		},
+		cli.DurationFlag{
+			Name:        "watch",
+			Usage:       "Keep querying new samples at this interval and append them to the output, until Ctrl-C",
+			Destination: &flag.Watch,
+		},
+		cli.StringFlag{
+			Name:        "state-file",
+			Usage:       "Record the last exported sample into this file, reruns only append the newer ones to the --output",
+			Destination: &flag.StateFile,
+		},
+		cli.StringFlag{
+			Name:        "checkpoint",
+			Usage:       "Record finished chunks into this file to resume a failed export",
+			Destination: &flag.Checkpoint,
+		},
+		cli.StringFlag{
+			Name:        "output,o",
+			Usage:       "Write the csv into a file instead of stdout, or upload it to s3://bucket/key, gs://bucket/name or az://container/name",
+			Destination: &flag.Output,
+		},
+		cli.BoolFlag{
+			Name:        "gzip",
+			Usage:       "Deprecated, use --compress gzip",
+			Destination: &flag.Gzip,
+		},
+		cli.StringFlag{
+			Name:        "compress",
+			Usage:       "Compress the output with gzip or zstd, implied by an --output ending in .gz or .zst",
+			Destination: &flag.Compress,
+		},
+		cli.BoolFlag{
+			Name:        "split-by-day",
+			Usage:       "Write one file per calendar day, requires --output",
+			Destination: &flag.SplitByDay,
+		},
+		cli.BoolFlag{
+			Name:        "grid",
+			Usage:       "Include every step of the range, even if no timeseries has a value",
+			Destination: &flag.Grid,
+		},
+		cli.StringFlag{
+			Name:        "gap",
+			Usage:       "Deprecated, use --fill with the number",
+			Destination: &flag.Gap,
+		},
+		cli.BoolFlag{
+			Name:        "rate",
+			Usage:       "Compute the per-second rate between samples, handling counter resets",
+			Destination: &flag.Rate,
+		},
+		cli.BoolFlag{
+			Name:        "delta",
+			Usage:       "Compute the difference between successive samples, the increase per step",
+			Destination: &flag.Delta,
+		},
+		cli.BoolFlag{
+			Name:        "clamp-resets",
+			Usage:       "Set negative deltas, e.g. from counter resets, to 0",
+			Destination: &flag.ClampResets,
+		},
+		cli.BoolFlag{
+			Name:        "exact",
+			Usage:       "Round the --rate only once instead of rounding the increase first, it can't restore the precision of samples beyond 2^53",
+			Destination: &flag.Exact,
+		},
+		cli.StringFlag{
+			Name:        "time-format",
+			Usage:       "The format of times in csv: unix, unix-ms, rfc3339 or a Go layout like '2006-01-02 15:04:05'",
+			Value:       "unix",
+			Destination: &flag.TimeFormat,
+		},
+		cli.StringFlag{
+			Name:        "timezone",
+			Usage:       "The timezone calendar days are computed and times formatted in",
+			Value:       "Local",
+			Destination: &flag.Timezone,
+		},
+	}, flag.Range.flags(), flag.Vars.flags(), flag.Fill.flags(), flag.Downsample.flags(), flag.Top.flags(), flag.Remote.flags(), flag.flags())
 
 	app.Commands = []cli.Command{{
 		Name:   "gnuplot",
 		Usage:  "Directly plot a graph with gnuplot",
+		Before: applyProfile,
 		Action: gnuplotAction,
-		Flags: []cli.Flag{
+		Flags: flagsOf([]cli.Flag{
 			cli.StringFlag{
 				Name:        "prometheus",
 				Value:       "http://localhost:9090",
@@ -56,12 +252,13 @@ func main() {
 				Usage:       "Give the gnuplot graph a title",
 				Destination: &gnuplotFlag.Title,
 			},
-		},
+		}, gnuplotFlag.Range.flags(), gnuplotFlag.Clamp.flags(), gnuplotFlag.Fill.flags(), gnuplotFlag.Top.flags(), gnuplotFlag.flags()),
 	}, {
 		Name:   "matplotlib",
 		Usage:  "Generate a file that uses matplotlib",
+		Before: applyProfile,
 		Action: matplotlibAction,
-		Flags: []cli.Flag{
+		Flags: flagsOf([]cli.Flag{
 			cli.StringFlag{
 				Name:        "prometheus",
 				Value:       "http://localhost:9090",
@@ -78,41 +275,909 @@ func main() {
 				Usage:       "Give the gnuplot graph a title",
 				Destination: &matplotlibFlag.Title,
 			},
+			cli.StringSliceFlag{
+				Name:  "secondary",
+				Usage: "Plot timeseries on a secondary y-axis, by index or regexp matching the metric",
+				Value: &matplotlibFlag.Secondary,
+			},
+			cli.BoolTFlag{
+				Name:        "comments",
+				Usage:       "Name the metric of every series in a comment",
+				Destination: &matplotlibFlag.Comments,
+			},
+			cli.BoolFlag{
+				Name:        "stacked",
+				Usage:       "Stack the timeseries as areas, e.g. to show a composition",
+				Destination: &matplotlibFlag.Stacked,
+			},
+			cli.BoolFlag{
+				Name:        "clamp-mark",
+				Usage:       "Mark the clamped points with a cross",
+				Destination: &matplotlibFlag.ClampMark,
+			},
+		}, matplotlibFlag.Range.flags(), matplotlibFlag.Clamp.flags(), matplotlibFlag.Fill.flags(), matplotlibFlag.Top.flags(), matplotlibFlag.flags()),
+	}, {
+		Name:   "live",
+		Usage:  "Show the latest values in the terminal, updating until Ctrl-C",
+		Before: applyProfile,
+		Action: liveAction,
+		Flags: append([]cli.Flag{
+			cli.StringFlag{
+				Name:        "prometheus",
+				Value:       "http://localhost:9090",
+				Destination: &liveFlag.Prometheus,
+			},
+			cli.DurationFlag{
+				Name:        "duration,d",
+				Usage:       "The duration to look back for the latest values",
+				Value:       5 * time.Minute,
+				Destination: &liveFlag.Duration,
+			},
+			cli.DurationFlag{
+				Name:        "interval,i",
+				Usage:       "The interval to refresh the values with",
+				Value:       5 * time.Second,
+				Destination: &liveFlag.Interval,
+			},
+			cli.StringFlag{
+				Name:        "thousands",
+				Usage:       "Separate groups of thousands with this, e.g. ','",
+				Destination: &liveFlag.Thousands,
+			},
+			cli.StringFlag{
+				Name:        "decimal",
+				Usage:       "The decimal mark to display",
+				Value:       ".",
+				Destination: &liveFlag.Decimal,
+			},
+			cli.IntFlag{
+				Name:        "precision",
+				Usage:       "The number of decimal places to display, -1 shows all",
+				Value:       -1,
+				Destination: &liveFlag.Precision,
+			},
+		}, liveFlag.flags()...),
+	}, {
+		Name:   "dashboard",
+		Usage:  "Export the queries of every panel of a Grafana dashboard, given as JSON file or URL",
+		Before: applyProfile,
+		Action: dashboardAction,
+		Flags: flagsOf([]cli.Flag{
+			cli.StringFlag{
+				Name:        "prometheus",
+				Value:       "http://localhost:9090",
+				Destination: &dashboardFlag.Prometheus,
+			},
+			cli.DurationFlag{
+				Name:        "duration,d",
+				Usage:       "The duration to get timeseries from",
+				Value:       time.Hour,
+				Destination: &dashboardFlag.Duration,
+			},
+			cli.StringFlag{
+				Name:        "output,o",
+				Usage:       "The directory to write a csv per panel to, or an .xlsx file with a sheet per panel",
+				Destination: &dashboardFlag.Output,
+			},
+			cli.StringSliceFlag{
+				Name:  "var",
+				Usage: "Set a dashboard variable, e.g. instance=node1:9100",
+				Value: &dashboardFlag.Vars,
+			},
+		}, dashboardFlag.Range.flags(), dashboardFlag.flags()),
+	}, {
+		Name:   "serve",
+		Usage:  "Serve exports over HTTP at /export?query=...&start=...&end=...&format=csv",
+		Before: applyProfile,
+		Action: serveAction,
+		Flags: append([]cli.Flag{
+			cli.StringFlag{
+				Name:        "prometheus",
+				Value:       "http://localhost:9090",
+				Destination: &serveFlag.Prometheus,
+			},
+			cli.StringFlag{
+				Name:        "listen",
+				Usage:       "The address to listen on",
+				Value:       ":8080",
+				Destination: &serveFlag.Listen,
+			},
+			cli.DurationFlag{
+				Name:        "duration,d",
+				Usage:       "The duration to get timeseries from if a request gives no start",
+				Value:       time.Hour,
+				Destination: &serveFlag.Duration,
+			},
+		}, serveFlag.flags()...),
+	}, {
+		Name:   "daemon",
+		Usage:  "Run the exports of the jobs of the config file on their cron schedules",
+		Action: daemonAction,
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name:        "config",
+				Usage:       "The config file with the jobs",
+				EnvVar:      "STYX_CONFIG",
+				Value:       defaultConfig,
+				Destination: &daemonFlag.Config,
+			},
+			cli.BoolFlag{
+				Name:        "once",
+				Usage:       "Run every job once now and exit, e.g. to try them",
+				Destination: &daemonFlag.Once,
+			},
 		},
+	}, {
+		Name:   "labels",
+		Usage:  "List the names of the labels, e.g. to find out what to export",
+		Before: applyProfile,
+		Action: labelsAction,
+		Flags:  append(discoverFlag.flags(), discoverFlag.matchFlag()),
+	}, {
+		Name:   "label-values",
+		Usage:  "List the values of a label, e.g. styx label-values namespace",
+		Before: applyProfile,
+		Action: labelValuesAction,
+		Flags:  append(discoverFlag.flags(), discoverFlag.matchFlag()),
+	}, {
+		Name:   "series",
+		Usage:  "List the label sets of the series matching selectors, e.g. styx series 'up{job=\"node\"}'",
+		Before: applyProfile,
+		Action: seriesAction,
+		Flags:  discoverFlag.flags(),
+	}, {
+		Name:   "metadata",
+		Usage:  "List the type, unit and help of all metrics or the given one, e.g. to tell counters from gauges",
+		Before: applyProfile,
+		Action: metadataAction,
+		Flags:  discoverFlag.baseFlags(),
+	}, {
+		Name:   "alerts",
+		Usage:  "List the pending and firing alerts with their labels and annotations, e.g. for a post-mortem",
+		Before: applyProfile,
+		Action: alertsAction,
+		Flags:  discoverFlag.baseFlags(),
+	}, {
+		Name:   "rules",
+		Usage:  "List the alerting and recording rules with their state, health and durations",
+		Before: applyProfile,
+		Action: rulesAction,
+		Flags: append(discoverFlag.baseFlags(), cli.StringFlag{
+			Name:        "type",
+			Usage:       "List only alerting or recording rules",
+			Destination: &discoverFlag.RuleType,
+		}),
+	}, {
+		Name:   "targets",
+		Usage:  "List the scrape targets with their health, last scrape and error",
+		Before: applyProfile,
+		Action: targetsAction,
+		Flags:  discoverFlag.baseFlags(),
+	}, {
+		Name:   "batch",
+		Usage:  "Run the named exports of a YAML or JSON manifest, e.g. the queries of a report",
+		Action: batchAction,
+		Flags: []cli.Flag{
+			cli.StringSliceFlag{
+				Name:  "only",
+				Usage: "Run only the export with this name, given again for several",
+				Value: &batchFlag.Only,
+			},
+			cli.BoolFlag{
+				Name:        "dry-run",
+				Usage:       "Print the command of every export instead of running it",
+				Destination: &batchFlag.DryRun,
+			},
+		},
+	}, {
+		Name:   "curl",
+		Usage:  "Print the curl command sending the same request, e.g. to share a failing query",
+		Before: applyProfile,
+		Action: curlAction,
+		Flags: flagsOf([]cli.Flag{
+			cli.StringFlag{
+				Name:        "prometheus",
+				Value:       "http://localhost:9090",
+				Destination: &curlFlag.Prometheus,
+			},
+			cli.DurationFlag{
+				Name:        "duration,d",
+				Usage:       "The duration to get timeseries from",
+				Value:       time.Hour,
+				Destination: &curlFlag.Duration,
+			},
+			cli.BoolFlag{
+				Name:        "secrets",
+				Usage:       "Include credentials instead of redacting them",
+				Destination: &curlFlag.Secrets,
+			},
+		}, curlFlag.Range.flags(), curlFlag.flags()),
 	}}
 
 	if err := app.Run(os.Args); err != nil {
-		log.Fatal(err)
+		if errors.Is(err, styx.ErrNoTimeseries) {
+			log.Print(color.YellowString(err.Error()))
+		} else {
+			log.Print(err)
+		}
+		os.Exit(exitCode(err))
+	}
+}
+
+// flagsOf concatenates the groups of flags of a command.
+func flagsOf(groups ...[]cli.Flag) []cli.Flag {
+	var flags []cli.Flag
+	for _, group := range groups {
+		flags = append(flags, group...)
+	}
+	return flags
+}
+
+// The exit codes tell scripts why styx failed.
+const (
+	exitError        = 1
+	exitNoTimeseries = 2
+	exitBadStatus    = 3
+	exitBadResponse  = 4
+)
+
+// exitCode returns the exit code for err.
+func exitCode(err error) int {
+	var decodeErr *styx.DecodeError
+	switch {
+	case errors.Is(err, styx.ErrNoTimeseries):
+		return exitNoTimeseries
+	case errors.Is(err, styx.ErrBadStatus):
+		return exitBadStatus
+	case errors.Is(err, styx.ErrNotMatrix), errors.Is(err, styx.ErrNotVector), errors.As(err, &decodeErr):
+		return exitBadResponse
 	}
+	return exitError
 }
 
 type flags struct {
+	queryFlags
+
 	Duration   time.Duration
+	Range      rangeFlags
 	Header     bool
 	Prometheus string
+	Output     string
+	Gzip       bool
+	Compress   string
+	SplitByDay bool
+	Timezone   string
+	TimeFormat string
+	Grid       bool
+	Gap        string
+	Fill       fillFlags
+	Downsample downsampleFlags
+	Top        topFlags
+	Vars       varFlags
+	Rate       bool
+	Exact      bool
+
+	Queries     cli.StringSlice
+	QueriesFile string
+	queryCounts []int // the number of results of every query, in order
+
+	Delta       bool
+	ClampResets bool
+
+	Format           string
+	Layout           string
+	Stream           bool
+	CSVSpecial       string
+	Delimiter        string
+	csv              styx.CSV
+	ValuesSeparator  string
+	DatadogMetric    string
+	DatadogMaxPoints int
+	Remote           remoteWriteFlags
+	RenameLabels     cli.StringSlice
+	DropLabels       cli.StringSlice
+	LabelColumns     string
+	ColumnTemplate   string
+	columnTemplate   *template.Template
+	SheetPerQuery    bool
+	Title            string
+	html             styx.HTMLReport
+	chart            styx.Chart
+	ChartSize        string
+	term             styx.TermChart
+	Summary          bool
+	Percentiles      string
+	percentiles      []float64
+
+	Chunk      time.Duration
+	Watch      time.Duration
+	StateFile  string
+	Checkpoint string
+}
+
+// labelMapping returns the mapping of a backend with the renamed and dropped labels.
+func (f flags) labelMapping(backend styx.LabelMapping) (styx.LabelMapping, error) {
+	backend.Rename = make(map[string]string)
+	for _, rename := range f.RenameLabels {
+		parts := strings.SplitN(rename, "=", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return backend, fmt.Errorf("label needs to be renamed as old=new: %s", rename)
+		}
+		backend.Rename[parts[0]] = parts[1]
+	}
+	backend.Drop = f.droppedLabels()
+
+	return backend, nil
+}
+
+// droppedLabels returns the labels given with --drop-label, which can be
+// separated by commas.
+func (f flags) droppedLabels() []string {
+	var labels []string
+	for _, drop := range f.DropLabels {
+		for _, label := range strings.Split(drop, ",") {
+			if label = strings.TrimSpace(label); label != "" {
+				labels = append(labels, label)
+			}
+		}
+	}
+	return labels
+}
+
+// queries returns the queries to run, the argument followed by the ones
+// given with --query and those in --queries-file.
+func (f flags) queries(arg string) ([]string, error) {
+	var queries []string
+	if arg != "" {
+		queries = append(queries, arg)
+	}
+	queries = append(queries, f.Queries...)
+
+	if f.QueriesFile != "" {
+		file, err := ioutil.ReadFile(f.QueriesFile)
+		if err != nil {
+			return nil, err
+		}
+		for _, line := range strings.Split(string(file), "\n") {
+			line = strings.TrimSpace(line)
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			queries = append(queries, line)
+		}
+	}
+
+	return queries, nil
+}
+
+// querySheets returns a sheet for the results of every query, the results
+// are in the order of the queries.
+func (f flags) querySheets(results []styx.Result) []styx.Sheet {
+	var sheets []styx.Sheet
+	for i, count := range f.queryCounts {
+		if count > len(results) {
+			break
+		}
+		sheets = append(sheets, styx.Sheet{Name: fmt.Sprintf("Query %d", i+1), Results: results[:count]})
+		results = results[count:]
+	}
+	return sheets
 }
 
 var flag flags
 
 func exportAction(c *cli.Context) error {
-	if !c.Args().Present() {
-		return fmt.Errorf(color.RedString("need a query to run"))
+	queries, err := flag.queries(c.Args().First())
+	if err != nil {
+		return err
+	}
+	if len(queries) == 0 {
+		return errors.New(color.RedString("need a query to run"))
 	}
 
-	end := time.Now()
-	start := end.Add(-1 * flag.Duration)
+	start, end, err := flag.Range.timeRange(time.Now(), flag.Duration)
+	if err != nil {
+		return errors.New(color.RedString(err.Error()))
+	}
 
-	results, err := Query(flag.Prometheus, start, end, c.Args().First())
+	opts, err := flag.options(flag.Prometheus, end.Sub(start))
 	if err != nil {
 		return err
 	}
+	queries, err = flag.Vars.expand(queries, rangeVars(start, end, opts.StepFor(end.Sub(start))))
+	if err != nil {
+		return errors.New(color.RedString(err.Error()))
+	}
+
+	switch flag.Format {
+	case "csv", "tidy", "values", "json", "matrix", "xlsx", "parquet", "tidy-parquet", "html", "svg", "png", "chart", "ascii-chart", "datadog", "openmetrics", "npy", "hash":
+	default:
+		return errors.New(color.RedString("unknown format: %s", flag.Format))
+	}
+	switch {
+	case flag.Layout != "wide" && flag.Layout != "long":
+		return errors.New(color.RedString("unknown layout: %s", flag.Layout))
+	case flag.Layout == "long" && flag.Format != "csv":
+		return errors.New(color.RedString("the long layout is only available for csv"))
+	case flag.Summary && (flag.Format != "csv" || flag.Layout != "wide"):
+		return errors.New(color.RedString("the --summary is only available as csv"))
+	}
+	if err := flag.resolveCompress(); err != nil {
+		return errors.New(color.RedString(err.Error()))
+	}
+	if flag.LabelColumns != "" {
+		if flag.Format != "csv" && flag.Format != "tidy" || flag.Layout != "wide" || flag.Summary {
+			return errors.New(color.RedString("--label-columns is only available for csv and tidy"))
+		}
+		for _, label := range strings.Split(flag.LabelColumns, ",") {
+			flag.csv.Labels = append(flag.csv.Labels, strings.TrimSpace(label))
+		}
+	}
+	if flag.Stream {
+		if err := flag.checkStream(); err != nil {
+			return errors.New(color.RedString(err.Error()))
+		}
+	}
+	if flag.ColumnTemplate != "" {
+		// Labels a series doesn't have are empty instead of <no value>.
+		flag.columnTemplate, err = template.New("column").Option("missingkey=zero").Parse(flag.ColumnTemplate)
+		if err != nil {
+			return errors.New(color.RedString("invalid --column-template: %v", err))
+		}
+	}
+	if flag.Summary {
+		flag.percentiles, err = parsePercentiles(flag.Percentiles)
+		if err != nil {
+			return errors.New(color.RedString(err.Error()))
+		}
+	}
+	// An empty placeholder is valid, it's only used if given explicitly.
+	if c.IsSet("csv-special") {
+		placeholders, err := styx.ParseSpecialValues(flag.CSVSpecial)
+		if err != nil {
+			return errors.New(color.RedString(err.Error()))
+		}
+		flag.csv.Special = &placeholders
+	}
+	flag.csv.Delimiter, err = parseDelimiter(flag.Delimiter)
+	if err != nil {
+		return errors.New(color.RedString(err.Error()))
+	}
+	flag.csv.Time.Layout = flag.TimeFormat
+	if !flag.csv.Time.Valid() {
+		return errors.New(color.RedString("unknown time format: %s", flag.TimeFormat))
+	}
+	flag.csv.Time.Location, err = time.LoadLocation(flag.Timezone)
+	if err != nil {
+		return errors.New(color.RedString(err.Error()))
+	}
+	flag.html = styx.HTMLReport{Title: flag.Title, Queries: queries, Location: flag.csv.Time.Location}
+	flag.chart = styx.Chart{Title: flag.Title, Location: flag.csv.Time.Location}
+	flag.term = styx.TermChart{ASCII: flag.Format == "ascii-chart", Color: flag.Output == "" && !color.NoColor, Location: flag.csv.Time.Location}
+	if columns, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil {
+		flag.term.Width = columns
+	}
+	if flag.ChartSize != "" {
+		width, height, err := parseSize(flag.ChartSize)
+		if err != nil {
+			return errors.New(color.RedString(err.Error()))
+		}
+		flag.chart.Width, flag.chart.Height = width, height
+		flag.term.Width, flag.term.Height = width, height
+	}
+
+	if flag.Checkpoint != "" && flag.Chunk <= 0 {
+		return errors.New(color.RedString("--checkpoint needs --chunk"))
+	}
+	if flag.Instant && flag.Chunk > 0 {
+		return errors.New(color.RedString("an --instant query can't be split into chunks"))
+	}
+	if flag.Coarsen > 0 && flag.Chunk > 0 {
+		return errors.New(color.RedString("--coarsen can't be combined with --chunk, choose a --chunk short enough not to time out"))
+	}
+	if flag.Backend == backendVictoriaMetrics && flag.Chunk > 0 {
+		return errors.New(color.RedString("the victoriametrics backend exports without a sample limit, it doesn't need --chunk"))
+	}
+	if flag.Rate && flag.Delta {
+		return errors.New(color.RedString("--rate and --delta can't be combined"))
+	}
+	if flag.Remote.URL != "" && (flag.Output != "" || flag.SplitByDay || flag.Watch > 0 || flag.StateFile != "" || flag.Summary) {
+		return errors.New(color.RedString("--remote-write can't be combined with --output, --split-by-day, --watch, --state-file or --summary"))
+	}
+	if _, err := flag.Remote.remoteWrite(styx.LabelMapping{}, styx.Options{}); err != nil {
+		return errors.New(color.RedString(err.Error()))
+	}
+	if flag.SplitByDay && flag.Output == "" {
+		return errors.New(color.RedString("--split-by-day needs an --output file"))
+	}
+	if flag.Checkpoint != "" && len(queries) > 1 {
+		return errors.New(color.RedString("--checkpoint only supports a single query"))
+	}
+	// Fail on unknown policies before a long export.
+	if err := flag.resolveFill(); err != nil {
+		return errors.New(color.RedString(err.Error()))
+	}
+	if _, err := flag.Fill.fill(nil); err != nil {
+		return errors.New(color.RedString(err.Error()))
+	}
+	window, _, err := flag.Downsample.window()
+	if err != nil {
+		return errors.New(color.RedString(err.Error()))
+	}
+	if window > 0 && (flag.Watch > 0 || flag.StateFile != "") {
+		return errors.New(color.RedString("--downsample can't append to an export, the last window may be incomplete"))
+	}
+	if _, err := flag.Top.top(nil); err != nil {
+		return errors.New(color.RedString(err.Error()))
+	}
+	if flag.Top.N > 0 && (flag.Watch > 0 || flag.StateFile != "") {
+		return errors.New(color.RedString("--top can't append to an export, the top series may change"))
+	}
+	if flag.Watch < 0 {
+		return errors.New(color.RedString("the watch interval needs to be positive"))
+	}
+	if flag.Watch > 0 {
+		if err := checkAppend("--watch"); err != nil {
+			return errors.New(color.RedString(err.Error()))
+		}
+	}
+	if flag.StateFile != "" {
+		if flag.Output == "" {
+			return errors.New(color.RedString("--state-file needs an --output file to append to"))
+		}
+		if err := checkAppend("--state-file"); err != nil {
+			return errors.New(color.RedString(err.Error()))
+		}
+	}
+
+	ctx, cancel := flag.context()
+	defer cancel()
+	opts.Context = ctx
+
+	if flag.Stream {
+		write := func(w io.Writer) error {
+			return streamResults(w, queries, start, end, opts)
+		}
+		if flag.Output != "" {
+			return writeFile(flag.Output, write)
+		}
+		if c := flag.compression(""); c != "" {
+			return writeCompressed(os.Stdout, c, write)
+		}
+		return write(os.Stdout)
+	}
+
+	var cp *checkpoint
+	var state *exportState
+	var results []styx.Result
+	chunk := flag.Chunk
+	if chunk > 0 || flag.Watch > 0 || flag.StateFile != "" {
+		opts.Step = opts.StepFor(end.Sub(start))
+	}
+	if flag.StateFile != "" {
+		state, err = openState(flag.StateFile, queries)
+		if err != nil {
+			return err
+		}
+
+		if state.resume {
+			// Continue after the last exported sample on the same step.
+			start, opts.Step = state.next(), state.Step
+			if !start.Before(end) {
+				return nil
+			}
+		}
+	}
+	if flag.Checkpoint != "" {
+		cp, err = openCheckpoint(flag.Checkpoint, queries[0], start, end, opts.Step, chunk)
+		if err != nil {
+			return err
+		}
+
+		// Resume with the range and resolution the export was started with.
+		start, end = time.Unix(cp.Start, 0), time.Unix(cp.End, 0)
+		opts.Step = cp.Step
+		chunk = time.Duration(cp.Chunk) * time.Second
+	}
+
+	sets, err := queryEach(queries, &opts, func(query string, opts *styx.Options) ([]styx.Result, error) {
+		if chunk > 0 {
+			return queryChunks(flag.Prometheus, query, styx.Chunks(start, end, chunk, opts.Step), *opts, cp)
+		}
+		return flag.query(flag.Prometheus, start, end, query, opts)
+	})
+	if err != nil {
+		return err
+	}
+	for i, queried := range sets {
+		if len(queries) > 1 {
+			queried = nameUnlabeled(queried, queries[i])
+		}
+		results = append(results, queried...)
+		flag.queryCounts = append(flag.queryCounts, len(queried))
+	}
+	if state != nil && state.resume {
+		// Nothing new is fine, the series may be back on the next run.
+		results = alignSeries(state.series(), results)
+	} else if len(results) == 0 {
+		return styx.ErrNoTimeseries
+	}
+
+	if flag.Rate {
+		results = styx.Rate(results, flag.Exact)
+	}
+	if flag.Delta {
+		results = styx.Delta(results, flag.ClampResets)
+	}
+
+	results, err = flag.Downsample.downsample(results)
+	if err != nil {
+		return err
+	}
+	results, err = flag.Top.top(results)
+	if err != nil {
+		return err
+	}
+
+	// Add the points missing on the grid, --fill fills them like the others.
+	if flag.Grid && window > 0 {
+		// The grid of the windows, which start at multiples of them.
+		first := start.Unix() / int64(window) * int64(window)
+		results = styx.FillGrid(results, time.Unix(first, 0), end, window, styx.Missing)
+	} else if flag.Grid {
+		results = styx.FillGrid(results, start, end, opts.StepFor(end.Sub(start)), styx.Missing)
+	}
+	results, err = flag.Fill.fill(results)
+	if err != nil {
+		return err
+	}
+
+	if flag.Remote.URL != "" {
+		mapping, err := flag.labelMapping(styx.LabelMapping{})
+		if err != nil {
+			return err
+		}
+		rw, err := flag.Remote.remoteWrite(mapping, opts)
+		if err != nil {
+			return err
+		}
+		return rw.Push(results)
+	}
+
+	if flag.SplitByDay {
+		loc, err := time.LoadLocation(flag.Timezone)
+		if err != nil {
+			return err
+		}
+
+		for _, day := range styx.SplitByDay(results, loc) {
+			if err := writeResultsFile(dayFilename(flag.Output, day.Day), day.Results); err != nil {
+				return err
+			}
+		}
+	} else if state != nil && state.resume {
+		err = appendResultsFile(flag.Output, results)
+	} else if flag.Output != "" {
+		err = writeResultsFile(flag.Output, results)
+	} else if c := flag.compression(""); c != "" {
+		err = writeCompressed(os.Stdout, c, func(w io.Writer) error {
+			return writeResults(w, results)
+		})
+	} else {
+		err = writeResults(os.Stdout, results)
+	}
+	if err != nil {
+		return err
+	}
+
+	// The export is complete, a rerun has to start from scratch.
+	if cp != nil {
+		return cp.remove()
+	}
+	if state != nil {
+		// The step may have been coarsened on timeouts.
+		state.Step = opts.Step
+		if err := state.save(results); err != nil {
+			return err
+		}
+	}
+	if flag.Watch > 0 {
+		return watch(ctx, queries, results, end, opts, state)
+	}
+	return nil
+}
+
+// nameUnlabeled names results without labels, like the ones of sum(...),
+// after their query so they can be told apart from those of other queries.
+func nameUnlabeled(results []styx.Result, query string) []styx.Result {
+	for i := range results {
+		if len(results[i].Labels) == 0 {
+			results[i].Metric = query
+		}
+	}
+	return results
+}
+
+// writeResultsFile writes the results into the file at path, compressed if
+// it ends in .gz or .zst. Paths like s3://bucket/key, gs://bucket/name or
+// az://container/name are uploaded to S3, GCS or Azure Blob Storage instead.
+func writeResultsFile(path string, results []styx.Result) error {
+	return writeFile(path, func(w io.Writer) error {
+		return writeResults(w, results)
+	})
+}
+
+// writeFile writes what write writes into the file at path like
+// writeResultsFile does.
+func writeFile(path string, write func(io.Writer) error) error {
+	if c := flag.compression(path); c != "" {
+		uncompressed := write
+		write = func(w io.Writer) error {
+			return writeCompressed(w, c, uncompressed)
+		}
+	}
+
+	if isUploadURL(path) {
+		var buf bytes.Buffer
+		if err := write(&buf); err != nil {
+			return err
+		}
+		return upload(path, buf.Bytes())
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	if err := write(f); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
+// dayFilename inserts the day in front of the extension of path,
+// out.csv becomes out-2017-08-15.csv and out.csv.gz out-2017-08-15.csv.gz.
+func dayFilename(path string, day time.Time) string {
+	ext := filepath.Ext(path)
+	if isGzip(path) || isZstd(path) {
+		ext = filepath.Ext(strings.TrimSuffix(path, ext)) + ext
+	}
+	return strings.TrimSuffix(path, ext) + "-" + day.Format("2006-01-02") + ext
+}
+
+// writeResults writes the results in the format given by --format.
+func writeResults(w io.Writer, results []styx.Result) error {
+	results, err := relabelResults(results)
+	if err != nil {
+		return err
+	}
+
+	if flag.Summary {
+		summaries, err := styx.Summarize(results, flag.percentiles)
+		if err != nil {
+			return err
+		}
+		return flag.csv.WriteSummary(w, summaries, flag.percentiles, flag.Header)
+	}
+
+	switch flag.Format {
+	case "npy":
+		return styx.NPYWriter(w, results)
+	case "parquet":
+		return styx.ParquetWriter(w, results)
+	case "tidy-parquet":
+		return styx.TidyParquetWriter(w, results)
+	case "html":
+		return flag.html.Write(w, results)
+	case "svg":
+		return flag.chart.SVG(w, results)
+	case "png":
+		return flag.chart.PNG(w, results)
+	case "chart", "ascii-chart":
+		return flag.term.Write(w, results)
+	case "hash":
+		_, err := fmt.Fprintln(w, styx.HashResults(results))
+		return err
+	case "tidy":
+		return flag.csv.WriteTidy(w, results, flag.Header)
+	case "csv":
+		if len(flag.csv.Labels) > 0 {
+			return flag.csv.WriteTidy(w, results, flag.Header)
+		}
+	case "json":
+		return styx.JSONWriter(w, results)
+	case "openmetrics":
+		return styx.OpenMetricsWriter(w, results, flag.Remote.Metric)
+	case "matrix":
+		return styx.MatrixWriter(w, results)
+	case "xlsx":
+		sheets := []styx.Sheet{{Name: "data", Results: results}}
+		if flag.SheetPerQuery {
+			sheets = append(sheets, flag.querySheets(results)...)
+		}
+		return styx.XLSXWriter(w, sheets)
+	case "values":
+		return styx.ValuesWriter(w, results, flag.ValuesSeparator, "")
+	case "datadog":
+		mapping, err := flag.labelMapping(styx.DatadogLabels)
+		if err != nil {
+			return err
+		}
+		return styx.DatadogWriter(w, results, flag.DatadogMetric, flag.DatadogMaxPoints, mapping)
+	}
+
+	if flag.Layout == "long" {
+		return flag.csv.WriteLong(w, results, flag.Header)
+	}
 
 	// Only add a line as header when the flag is true, which is the default
 	if flag.Header {
-		if err := csvHeaderWriter(os.Stdout, results); err != nil {
+		if err := flag.csv.WriteHeader(w, results); err != nil {
 			return err
 		}
 	}
 
-	return csvWriter(os.Stdout, results)
+	return flag.csv.Write(w, results)
+}
+
+// relabelResults drops the labels of --drop-label and names the series by
+// the --column-template.
+func relabelResults(results []styx.Result) ([]styx.Result, error) {
+	if labels := flag.droppedLabels(); len(labels) > 0 {
+		results = styx.DropLabels(results, labels)
+	}
+	if flag.columnTemplate != nil {
+		var err error
+		results, err = styx.NameSeries(results, flag.columnTemplate)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return results, nil
+}
+
+// parsePercentiles parses percentiles separated by commas, like 50,95,99.9.
+func parsePercentiles(s string) ([]float64, error) {
+	var percentiles []float64
+	for _, field := range strings.Split(s, ",") {
+		p, err := strconv.ParseFloat(strings.TrimSpace(field), 64)
+		if err != nil || p < 0 || p > 100 {
+			return nil, fmt.Errorf("percentiles need to be numbers between 0 and 100: %s", s)
+		}
+		percentiles = append(percentiles, p)
+	}
+	return percentiles, nil
+}
+
+// parseSize parses a size given as WIDTHxHEIGHT.
+func parseSize(s string) (int, int, error) {
+	parts := strings.SplitN(s, "x", 2)
+	if len(parts) == 2 {
+		width, err := strconv.Atoi(parts[0])
+		if err == nil {
+			height, err := strconv.Atoi(parts[1])
+			if err == nil && width > 0 && height > 0 {
+				return width, height, nil
+			}
+		}
+	}
+	return 0, 0, fmt.Errorf("the size needs to be given as WIDTHxHEIGHT, e.g. 120x30: %s", s)
+}
+
+// parseDelimiter returns the single character separating csv fields,
+// tab can also be given as \t or by name.
+func parseDelimiter(s string) (rune, error) {
+	switch s {
+	case "tab", `\t`:
+		return '\t', nil
+	}
+
+	runes := []rune(s)
+	if len(runes) != 1 || runes[0] == '"' || runes[0] == '\r' || runes[0] == '\n' || runes[0] == utf8.RuneError {
+		return 0, fmt.Errorf("the delimiter needs to be a single character other than a quote or newline: %q", s)
+	}
+	return runes[0], nil
 }
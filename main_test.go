@@ -0,0 +1,114 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-pluto/styx/pkg/styx"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQueries(t *testing.T) {
+	dir, err := ioutil.TempDir("", "styx")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "queries.txt")
+	assert.NoError(t, ioutil.WriteFile(file, []byte("# goroutines\nsum(go_goroutines)\n\n  go_threads  \n"), 0644))
+
+	f := flags{Queries: []string{"up"}, QueriesFile: file}
+	queries, err := f.queries("go_info")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"go_info", "up", "sum(go_goroutines)", "go_threads"}, queries)
+
+	queries, err = flags{}.queries("")
+	assert.NoError(t, err)
+	assert.Empty(t, queries)
+
+	_, err = flags{QueriesFile: filepath.Join(dir, "missing.txt")}.queries("")
+	assert.Error(t, err)
+}
+
+func TestNameUnlabeled(t *testing.T) {
+	results := nameUnlabeled([]styx.Result{
+		{Metric: "{}", Labels: map[string]string{}},
+		{Metric: "up", Labels: map[string]string{"__name__": "up"}},
+	}, "sum(up)")
+	assert.Equal(t, "sum(up)", results[0].Metric)
+	assert.Equal(t, "up", results[1].Metric)
+}
+
+func TestDayFilename(t *testing.T) {
+	day := time.Date(2017, 8, 15, 0, 0, 0, 0, time.UTC)
+	assert.Equal(t, "out-2017-08-15.csv", dayFilename("out.csv", day))
+	assert.Equal(t, "/tmp/out-2017-08-15", dayFilename("/tmp/out", day))
+	assert.Equal(t, "a.b/out-2017-08-15.csv", dayFilename("a.b/out.csv", day))
+	assert.Equal(t, "out-2017-08-15.csv.gz", dayFilename("out.csv.gz", day))
+	assert.Equal(t, "out-2017-08-15.gz", dayFilename("out.gz", day))
+}
+
+func TestQuerySheets(t *testing.T) {
+	results := []styx.Result{{Metric: "a"}, {Metric: "b"}, {Metric: "c"}}
+
+	sheets := flags{queryCounts: []int{2, 0, 1}}.querySheets(results)
+	assert.Equal(t, []styx.Sheet{
+		{Name: "Query 1", Results: results[:2]},
+		{Name: "Query 2", Results: []styx.Result{}},
+		{Name: "Query 3", Results: results[2:]},
+	}, sheets)
+}
+
+func TestParseDelimiter(t *testing.T) {
+	for s, want := range map[string]rune{",": ',', ";": ';', "tab": '\t', `\t`: '\t', "\t": '\t', "|": '|'} {
+		d, err := parseDelimiter(s)
+		assert.NoError(t, err, s)
+		assert.Equal(t, want, d, s)
+	}
+
+	for _, s := range []string{"", ";;", `"`, "\n"} {
+		_, err := parseDelimiter(s)
+		assert.Error(t, err, s)
+	}
+}
+
+func TestParsePercentiles(t *testing.T) {
+	percentiles, err := parsePercentiles("50, 95,99.9")
+	assert.NoError(t, err)
+	assert.Equal(t, []float64{50, 95, 99.9}, percentiles)
+
+	for _, s := range []string{"", "95,", "p95", "101", "-1"} {
+		_, err := parsePercentiles(s)
+		assert.Error(t, err, s)
+	}
+}
+
+func TestParseSize(t *testing.T) {
+	width, height, err := parseSize("120x30")
+	assert.NoError(t, err)
+	assert.Equal(t, 120, width)
+	assert.Equal(t, 30, height)
+
+	for _, s := range []string{"", "120", "x30", "0x30", "120x-1", "axb"} {
+		_, _, err := parseSize(s)
+		assert.Error(t, err, s)
+	}
+}
+
+func TestExitCode(t *testing.T) {
+	assert.Equal(t, exitError, exitCode(errors.New("failed")))
+	assert.Equal(t, exitNoTimeseries, exitCode(styx.ErrNoTimeseries))
+	assert.Equal(t, exitBadStatus, exitCode(&styx.StatusError{StatusCode: 502}))
+	assert.Equal(t, exitBadStatus, exitCode(&styx.APIError{Type: "bad_data"}))
+	assert.Equal(t, exitBadResponse, exitCode(fmt.Errorf("%w: vector", styx.ErrNotMatrix)))
+	assert.Equal(t, exitBadResponse, exitCode(&styx.DecodeError{Err: errors.New("unexpected EOF")}))
+}
+
+func TestDroppedLabels(t *testing.T) {
+	f := flags{DropLabels: []string{"instance, job", "pod", ""}}
+	assert.Equal(t, []string{"instance", "job", "pod"}, f.droppedLabels())
+}
@@ -2,48 +2,115 @@ package main
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"os"
+	"regexp"
+	"strconv"
 	"time"
 
 	"github.com/fatih/color"
+	"github.com/go-pluto/styx/pkg/styx"
 	"github.com/urfave/cli"
 )
 
 type matplotlibFlags struct {
+	queryFlags
+
 	Duration   time.Duration
+	Range      rangeFlags
 	Prometheus string
 	Title      string
+	Secondary  cli.StringSlice
+	Comments   bool
+	Stacked    bool
+	Clamp      clampFlags
+	Fill       fillFlags
+	Top        topFlags
+	ClampMark  bool
 }
 
 var matplotlibFlag matplotlibFlags
 
 func matplotlibAction(c *cli.Context) error {
 	if !c.Args().Present() {
-		return fmt.Errorf(color.RedString("need a query to run"))
+		return errors.New(color.RedString("need a query to run"))
 	}
 
-	end := time.Now()
-	start := end.Add(-1 * matplotlibFlag.Duration)
+	start, end, err := matplotlibFlag.Range.timeRange(time.Now(), matplotlibFlag.Duration)
+	if err != nil {
+		return errors.New(color.RedString(err.Error()))
+	}
 
-	results, err := Query(matplotlibFlag.Prometheus, start, end, c.Args().First())
+	opts, err := matplotlibFlag.options(matplotlibFlag.Prometheus, end.Sub(start))
 	if err != nil {
 		return err
 	}
 
-	header := "import matplotlib.pyplot as plot\n\n"
-	buf := bytes.NewBufferString(header)
+	ctx, cancel := matplotlibFlag.context()
+	defer cancel()
+	opts.Context = ctx
+
+	results, err := matplotlibFlag.query(matplotlibFlag.Prometheus, start, end, c.Args().First(), &opts)
+	if err != nil {
+		return err
+	}
+
+	results, err = matplotlibFlag.Top.top(results)
+	if err != nil {
+		return err
+	}
+
+	results, err = matplotlibFlag.Fill.fill(results)
+	if err != nil {
+		return err
+	}
 
-	if err := matplotlibWriter(buf, results); err != nil {
+	results, outliers, err := matplotlibFlag.Clamp.clamp(results)
+	if err != nil {
 		return err
 	}
+	if matplotlibFlag.ClampMark && (matplotlibFlag.Stacked || len(matplotlibFlag.Secondary) > 0) {
+		return errors.New(color.RedString("clamped points can only be marked on simple plots"))
+	}
 
-	if err := matplotlibLegendWriter(buf, results); err != nil {
+	secondary, err := secondaryAxis(results, matplotlibFlag.Secondary)
+	if err != nil {
 		return err
 	}
 
-	footer := "plot.grid(True)\n" +
-		fmt.Sprintf("plot.title('%s')\n", c.Args().First()) +
+	header := "import matplotlib.pyplot as plot\n\n"
+	buf := bytes.NewBufferString(header)
+
+	if matplotlibFlag.Stacked {
+		if len(matplotlibFlag.Secondary) > 0 {
+			return errors.New(color.RedString("stacked plots can't have a secondary axis"))
+		}
+
+		// Stacking only makes sense with a value for every step.
+		results = styx.FillGrid(results, start, end, opts.StepFor(end.Sub(start)), 0)
+		if err := styx.MatplotlibStackWriter(buf, results, matplotlibFlag.Comments); err != nil {
+			return err
+		}
+		buf.WriteString("plot.grid(True)\n")
+	} else if len(matplotlibFlag.Secondary) > 0 {
+		if err := styx.MatplotlibDualAxisWriter(buf, results, secondary, matplotlibFlag.Comments); err != nil {
+			return err
+		}
+		buf.WriteString("ax.grid(True)\n")
+	} else {
+		if err := styx.MatplotlibPlotWriter(buf, results, matplotlibFlag.Comments); err != nil {
+			return err
+		}
+		if matplotlibFlag.ClampMark {
+			if err := styx.MatplotlibMarkWriter(buf, results, outliers); err != nil {
+				return err
+			}
+		}
+		buf.WriteString("plot.grid(True)\n")
+	}
+
+	footer := fmt.Sprintf("plot.title('%s')\n", c.Args().First()) +
 		"plot.show()\n"
 
 	buf.WriteString(footer)
@@ -52,6 +119,34 @@ func matplotlibAction(c *cli.Context) error {
 	return err
 }
 
+// secondaryAxis returns which results to plot on the secondary y-axis.
+// A selector is either the index of a result or a regexp matching its metric.
+func secondaryAxis(results []styx.Result, selectors []string) ([]bool, error) {
+	secondary := make([]bool, len(results))
+
+	for _, selector := range selectors {
+		if index, err := strconv.Atoi(selector); err == nil {
+			if index < 0 || index >= len(results) {
+				return nil, fmt.Errorf("there is no timeseries with index %d for the secondary axis", index)
+			}
+			secondary[index] = true
+			continue
+		}
+
+		re, err := regexp.Compile(selector)
+		if err != nil {
+			return nil, err
+		}
+		for i, result := range results {
+			if re.MatchString(result.Metric) {
+				secondary[i] = true
+			}
+		}
+	}
+
+	return secondary, nil
+}
+
 //import matplotlib.pyplot as plt
 //
 //t = [1502573433, ...]
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/go-pluto/styx/pkg/styx"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSecondaryAxis(t *testing.T) {
+	res := []styx.Result{
+		{Metric: `http_requests_total{code="200"}`},
+		{Metric: `http_request_duration_seconds{quantile="0.99"}`},
+		{Metric: `http_request_duration_seconds{quantile="0.5"}`},
+	}
+
+	secondary, err := secondaryAxis(res, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []bool{false, false, false}, secondary)
+
+	secondary, err = secondaryAxis(res, []string{"0"})
+	assert.NoError(t, err)
+	assert.Equal(t, []bool{true, false, false}, secondary)
+
+	secondary, err = secondaryAxis(res, []string{"^http_request_duration"})
+	assert.NoError(t, err)
+	assert.Equal(t, []bool{false, true, true}, secondary)
+
+	secondary, err = secondaryAxis(res, []string{"0", `quantile="0.5"`})
+	assert.NoError(t, err)
+	assert.Equal(t, []bool{true, false, true}, secondary)
+
+	_, err = secondaryAxis(res, []string{"3"})
+	assert.Error(t, err)
+
+	_, err = secondaryAxis(res, []string{"("})
+	assert.Error(t, err)
+}
@@ -0,0 +1,212 @@
+package styx
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sort"
+	"time"
+)
+
+// Alert is an alert pending or firing in Prometheus.
+type Alert struct {
+	Labels      map[string]string `json:"labels"`
+	Annotations map[string]string `json:"annotations"`
+	State       string            `json:"state"`
+	ActiveAt    time.Time         `json:"activeAt"`
+	Value       string            `json:"value"`
+}
+
+// Rule is an alerting or recording rule of a rule group.
+type Rule struct {
+	Group string `json:"group"`
+	File  string `json:"file"`
+	// Type is alerting or recording.
+	Type  string `json:"type"`
+	Name  string `json:"name"`
+	Query string `json:"query"`
+	// Duration is how long alerting rules have to be pending to fire.
+	Duration       time.Duration     `json:"duration"`
+	Labels         map[string]string `json:"labels"`
+	Annotations    map[string]string `json:"annotations"`
+	State          string            `json:"state"`
+	Health         string            `json:"health"`
+	LastError      string            `json:"lastError"`
+	LastEvaluation time.Time         `json:"lastEvaluation"`
+	// EvaluationTime is how long the last evaluation took.
+	EvaluationTime time.Duration `json:"evaluationTime"`
+	Alerts         []Alert       `json:"alerts"`
+}
+
+// The types of rules to get with Rules.
+const (
+	RulesAll       = ""
+	RulesAlerting  = "alert"
+	RulesRecording = "record"
+)
+
+// Alerts returns the alerts that are pending or firing, sorted by name
+// and labels. Enforced labels only keep the alerts having them, as the
+// endpoint can't be restricted to series.
+func Alerts(host string, opts Options) (alerts []Alert, err error) {
+	ctx, span := opts.span("styx.Alerts")
+	span.SetAttribute("styx.host", host)
+	defer func() {
+		if err != nil {
+			span.RecordError(err)
+		}
+		span.SetAttribute("styx.results", len(alerts))
+		span.End()
+	}()
+
+	u, err := apiURL(host, "alerts", url.Values{}, opts)
+	if err != nil {
+		return nil, err
+	}
+	var resp struct {
+		Data struct {
+			Alerts []Alert `json:"alerts"`
+		} `json:"data"`
+	}
+	if _, err := fetch(ctx, host, u, "", opts, &resp); err != nil {
+		return nil, err
+	}
+
+	for _, alert := range resp.Data.Alerts {
+		if hasLabels(alert.Labels, opts.EnforceLabels) {
+			alerts = append(alerts, alert)
+		}
+	}
+	sortAlerts(alerts)
+	return alerts, nil
+}
+
+// Rules returns the rules of all rule groups in their order, only the
+// alerting or recording ones if typ is RulesAlerting or RulesRecording.
+func Rules(host, typ string, opts Options) (rules []Rule, err error) {
+	ctx, span := opts.span("styx.Rules")
+	span.SetAttribute("styx.host", host)
+	defer func() {
+		if err != nil {
+			span.RecordError(err)
+		}
+		span.SetAttribute("styx.results", len(rules))
+		span.End()
+	}()
+
+	params := url.Values{}
+	switch typ {
+	case RulesAll:
+	case RulesAlerting, RulesRecording:
+		params.Set("type", typ)
+	default:
+		return nil, fmt.Errorf("unknown type of rules: %s", typ)
+	}
+	u, err := apiURL(host, "rules", params, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var resp struct {
+		Data struct {
+			Groups []struct {
+				Name  string    `json:"name"`
+				File  string    `json:"file"`
+				Rules []apiRule `json:"rules"`
+			} `json:"groups"`
+		} `json:"data"`
+	}
+	if _, err := fetch(ctx, host, u, "", opts, &resp); err != nil {
+		return nil, err
+	}
+
+	for _, group := range resp.Data.Groups {
+		for _, r := range group.Rules {
+			// Older versions ignore the type parameter.
+			if typ != RulesAll && !(typ == RulesAlerting && r.Type == "alerting" || typ == RulesRecording && r.Type == "recording") {
+				continue
+			}
+			rule := Rule{
+				Group:          group.Name,
+				File:           group.File,
+				Type:           r.Type,
+				Name:           r.Name,
+				Query:          r.Query,
+				Duration:       seconds(r.Duration),
+				Labels:         r.Labels,
+				Annotations:    r.Annotations,
+				State:          r.State,
+				Health:         r.Health,
+				LastError:      r.LastError,
+				LastEvaluation: r.LastEvaluation,
+				EvaluationTime: seconds(r.EvaluationTime),
+			}
+			for _, alert := range r.Alerts {
+				if hasLabels(alert.Labels, opts.EnforceLabels) {
+					rule.Alerts = append(rule.Alerts, alert)
+				}
+			}
+			sortAlerts(rule.Alerts)
+			rules = append(rules, rule)
+		}
+	}
+	return rules, nil
+}
+
+// apiRule is a rule as the API returns it, with durations in seconds.
+type apiRule struct {
+	Type           string            `json:"type"`
+	Name           string            `json:"name"`
+	Query          string            `json:"query"`
+	Duration       float64           `json:"duration"`
+	Labels         map[string]string `json:"labels"`
+	Annotations    map[string]string `json:"annotations"`
+	State          string            `json:"state"`
+	Health         string            `json:"health"`
+	LastError      string            `json:"lastError"`
+	LastEvaluation time.Time         `json:"lastEvaluation"`
+	EvaluationTime float64           `json:"evaluationTime"`
+	Alerts         []Alert           `json:"alerts"`
+}
+
+// MarshalJSON encodes the durations in seconds, like the API does.
+func (r Rule) MarshalJSON() ([]byte, error) {
+	type rule Rule
+	return json.Marshal(struct {
+		rule
+		Duration       float64 `json:"duration"`
+		EvaluationTime float64 `json:"evaluationTime"`
+	}{rule(r), r.Duration.Seconds(), r.EvaluationTime.Seconds()})
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
+
+// hasLabels reports whether labels have all the labels of want.
+func hasLabels(labels, want map[string]string) bool {
+	for name, value := range want {
+		if labels[name] != value {
+			return false
+		}
+	}
+	return true
+}
+
+func sortAlerts(alerts []Alert) {
+	sort.SliceStable(alerts, func(i, j int) bool {
+		return metricName(alertLabels(alerts[i])) < metricName(alertLabels(alerts[j]))
+	})
+}
+
+// alertLabels returns the labels of the alert with its name as __name__,
+// to sort alerts by name first.
+func alertLabels(alert Alert) map[string]string {
+	labels := make(map[string]string, len(alert.Labels)+1)
+	for name, value := range alert.Labels {
+		labels[name] = value
+	}
+	labels["__name__"] = alert.Labels["alertname"]
+	delete(labels, "alertname")
+	return labels
+}
@@ -0,0 +1,80 @@
+package styx
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const alertsJSON = `{"status":"success","data":{"alerts":[
+	{"labels":{"alertname":"TargetDown","job":"node","namespace":"b"},"annotations":{"summary":"node is down"},"state":"firing","activeAt":"2017-08-14T21:10:00Z","value":"1e+00"},
+	{"labels":{"alertname":"HighLatency","job":"api","namespace":"a"},"annotations":{},"state":"pending","activeAt":"2017-08-14T21:15:30.5Z","value":"2.5e-01"}
+]}}`
+
+const rulesJSON = `{"status":"success","data":{"groups":[{"name":"api","file":"/etc/prometheus/api.yaml","interval":60,"rules":[
+	{"type":"recording","name":"job:requests:rate5m","query":"sum by (job) (rate(requests_total[5m]))","labels":{},"health":"ok","lastError":"","lastEvaluation":"2017-08-14T21:20:00Z","evaluationTime":0.0025},
+	{"type":"alerting","name":"HighLatency","query":"latency > 0.2","duration":600,"labels":{"severity":"page"},"annotations":{"summary":"slow"},
+	 "alerts":[{"labels":{"alertname":"HighLatency","job":"api","namespace":"a"},"state":"pending","activeAt":"2017-08-14T21:15:30.5Z","value":"2.5e-01"}],
+	 "health":"ok","state":"pending","lastEvaluation":"2017-08-14T21:20:00Z","evaluationTime":0.001}
+]}]}}`
+
+func TestAlerts(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/api/v1/alerts", r.URL.Path)
+		fmt.Fprint(w, alertsJSON)
+	}))
+	defer ts.Close()
+
+	alerts, err := Alerts(ts.URL, Options{})
+	assert.NoError(t, err)
+	assert.Len(t, alerts, 2)
+	assert.Equal(t, "HighLatency", alerts[0].Labels["alertname"])
+	assert.Equal(t, "pending", alerts[0].State)
+	assert.Equal(t, time.Date(2017, 8, 14, 21, 15, 30, 500000000, time.UTC), alerts[0].ActiveAt)
+	assert.Equal(t, "node is down", alerts[1].Annotations["summary"])
+
+	alerts, err = Alerts(ts.URL, Options{EnforceLabels: map[string]string{"namespace": "b"}})
+	assert.NoError(t, err)
+	assert.Len(t, alerts, 1)
+	assert.Equal(t, "TargetDown", alerts[0].Labels["alertname"])
+}
+
+func TestRules(t *testing.T) {
+	var typ string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/api/v1/rules", r.URL.Path)
+		typ = r.URL.Query().Get("type")
+		fmt.Fprint(w, rulesJSON)
+	}))
+	defer ts.Close()
+
+	rules, err := Rules(ts.URL, RulesAll, Options{})
+	assert.NoError(t, err)
+	assert.Len(t, rules, 2)
+	assert.Equal(t, "", typ)
+	assert.Equal(t, "api", rules[0].Group)
+	assert.Equal(t, "recording", rules[0].Type)
+	assert.Equal(t, 2500*time.Microsecond, rules[0].EvaluationTime)
+	assert.Equal(t, 10*time.Minute, rules[1].Duration)
+	assert.Len(t, rules[1].Alerts, 1)
+
+	// Servers ignoring the type still only return the rules of the type.
+	rules, err = Rules(ts.URL, RulesAlerting, Options{})
+	assert.NoError(t, err)
+	assert.Equal(t, "alert", typ)
+	assert.Len(t, rules, 1)
+	assert.Equal(t, "HighLatency", rules[0].Name)
+
+	data, err := json.Marshal(rules[0])
+	assert.NoError(t, err)
+	assert.Contains(t, string(data), `"duration":600`)
+	assert.Contains(t, string(data), `"evaluationTime":0.001`)
+
+	_, err = Rules(ts.URL, "silenced", Options{})
+	assert.Error(t, err)
+}
@@ -0,0 +1,358 @@
+package styx
+
+import (
+	"fmt"
+	"html"
+	"image/color"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Chart renders the results as a line chart with a legend, as SVG or PNG
+// image, so a picture of the data needs no plotting tools.
+type Chart struct {
+	Title string
+	// Location is the time zone of the time axis, UTC if it's not set.
+	Location *time.Location
+	// Width and Height are the size of the plot with its axes in pixels,
+	// the title and legend are added to it. Defaults to 960x400.
+	Width  int
+	Height int
+}
+
+// SVG writes the chart as SVG image.
+func (c Chart) SVG(w io.Writer, results []Result) error {
+	ch, err := c.chart(results)
+	if err != nil {
+		return err
+	}
+	return ch.writeSVG(w, false)
+}
+
+func (c Chart) chart(results []Result) (*chart, error) {
+	width, height := c.Width, c.Height
+	if width <= 0 {
+		width = chartWidth
+	}
+	if height <= 0 {
+		height = chartHeight
+	}
+	return newChart(results, c.Title, c.Location, width, height, true)
+}
+
+// The default size of a chart and the room for the axis labels.
+const (
+	chartWidth  = 960
+	chartHeight = 400
+	chartLeft   = 70
+	chartRight  = 20
+	chartTop    = 20
+	chartBottom = 40
+	chartTitle  = 30
+	chartLegend = 18
+)
+
+// chartColors are the colors of the series, repeating after ten of them.
+var chartColors = []color.RGBA{
+	{0x4e, 0x79, 0xa7, 0xff}, {0xf2, 0x8e, 0x2b, 0xff}, {0xe1, 0x57, 0x59, 0xff}, {0x76, 0xb7, 0xb2, 0xff}, {0x59, 0xa1, 0x4f, 0xff},
+	{0xed, 0xc9, 0x48, 0xff}, {0xb0, 0x7a, 0xa1, 0xff}, {0xff, 0x9d, 0xa7, 0xff}, {0x9c, 0x75, 0x5f, 0xff}, {0xba, 0xb0, 0xac, 0xff},
+}
+
+// chart is the layout of a line chart, in pixels from the top left.
+type chart struct {
+	title  string
+	legend bool
+	// width and height are the size of the whole image.
+	width  int
+	height int
+	// left, right, top and bottom enclose the plot area.
+	left   float64
+	right  float64
+	top    float64
+	bottom float64
+
+	// columns are the results on their times in order, x the positions of
+	// the times.
+	columns Columns
+	times   []float64
+	x       []float64
+	xTicks  []chartTick
+	yTicks  []chartTick
+	series  []chartSeries
+}
+
+type chartTick struct {
+	Pos   float64
+	Label string
+}
+
+type chartPoint struct {
+	X float64
+	Y float64
+}
+
+type chartSeries struct {
+	Name  string
+	Color color.RGBA
+	// Lines are the parts of the series between gaps.
+	Lines [][]chartPoint
+}
+
+// newChart lays out the results in a plot of width and height. Special
+// float values and missing points are gaps in the lines.
+func newChart(results []Result, title string, loc *time.Location, width, height int, legend bool) (*chart, error) {
+	if loc == nil {
+		loc = time.UTC
+	}
+
+	c := &chart{
+		title:  title,
+		legend: legend,
+		width:  width,
+		height: height,
+		left:   chartLeft,
+		right:  float64(width - chartRight),
+		top:    chartTop,
+		bottom: float64(height - chartBottom),
+	}
+	if title != "" {
+		c.top += chartTitle
+		c.bottom += chartTitle
+		c.height += chartTitle
+	}
+	if legend {
+		c.height += len(results)*chartLegend + 10
+	}
+
+	var values [][]float64
+	var minY, maxY float64
+	c.columns, c.times, values, minY, maxY = chartValues(results)
+
+	yTicks, minY, maxY := niceTicks(minY, maxY, 5)
+	minX, maxX := 0.0, 1.0
+	if len(c.times) > 0 {
+		minX, maxX = c.times[0], c.times[len(c.times)-1]
+	}
+	if minX == maxX {
+		minX, maxX = minX-30, maxX+30
+	}
+
+	x := func(t float64) float64 {
+		return round2(c.left + (t-minX)/(maxX-minX)*(c.right-c.left))
+	}
+	y := func(v float64) float64 {
+		return round2(c.top + (maxY-v)/(maxY-minY)*(c.bottom-c.top))
+	}
+
+	for _, t := range c.times {
+		c.x = append(c.x, x(t))
+	}
+	for _, v := range yTicks {
+		c.yTicks = append(c.yTicks, chartTick{Pos: y(v), Label: strconv.FormatFloat(v, 'g', 6, 64)})
+	}
+	for _, tick := range timeTicks(minX, maxX, 6, loc) {
+		c.xTicks = append(c.xTicks, chartTick{Pos: x(tick.Pos), Label: tick.Label})
+	}
+
+	for i, result := range results {
+		s := chartSeries{Name: result.Metric, Color: chartColors[i%len(chartColors)]}
+		var line []chartPoint
+		for j, v := range values[i] {
+			if math.IsNaN(v) {
+				if line != nil {
+					s.Lines = append(s.Lines, line)
+					line = nil
+				}
+				continue
+			}
+			line = append(line, chartPoint{X: c.x[j], Y: y(v)})
+		}
+		if line != nil {
+			s.Lines = append(s.Lines, line)
+		}
+		c.series = append(c.series, s)
+	}
+
+	return c, nil
+}
+
+// chartValues returns the results lined up on their times, the times, the
+// values of every result at them and the range of the values. Special float
+// values and missing points are NaN.
+func chartValues(results []Result) (Columns, []float64, [][]float64, float64, float64) {
+	columns := NewColumns(results)
+	times := make([]float64, len(columns.Times))
+	for i, ts := range columns.Times {
+		times[i] = float64(ts)
+	}
+
+	minY, maxY := math.Inf(1), math.Inf(-1)
+	values := make([][]float64, len(results))
+	for i, series := range columns.Series {
+		values[i] = make([]float64, len(times))
+		for j, v := range series.Values {
+			if math.IsInf(v, 0) {
+				v = math.NaN()
+			}
+			values[i][j] = v
+			if !math.IsNaN(v) {
+				minY = math.Min(minY, v)
+				maxY = math.Max(maxY, v)
+			}
+		}
+	}
+	if math.IsInf(minY, 0) {
+		minY, maxY = 0, 1
+	}
+
+	return columns, times, values, minY, maxY
+}
+
+// writeSVG writes the chart as SVG. Interactive charts have ids for the
+// script of the html report and a hidden cursor line.
+func (c *chart) writeSVG(w io.Writer, interactive bool) error {
+	var b strings.Builder
+	id := ""
+	if interactive {
+		id = ` id="chart"`
+	}
+	fmt.Fprintf(&b, `<svg%s xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" font-family="sans-serif" font-size="12">`+"\n",
+		id, c.width, c.height, c.width, c.height)
+	fmt.Fprintf(&b, `<rect width="%d" height="%d" fill="#fff"/>`+"\n", c.width, c.height)
+	if c.title != "" {
+		fmt.Fprintf(&b, `<text x="%d" y="%d" font-size="16" text-anchor="middle" fill="#333">%s</text>`+"\n", c.width/2, chartTop+10, html.EscapeString(c.title))
+	}
+
+	for _, tick := range c.yTicks {
+		fmt.Fprintf(&b, `<line x1="%g" x2="%g" y1="%g" y2="%g" stroke="#e5e5e5"/>`+"\n", c.left, c.right, tick.Pos, tick.Pos)
+		fmt.Fprintf(&b, `<text x="%g" dx="-6" y="%g" dy="4" text-anchor="end" fill="#333">%s</text>`+"\n", c.left, tick.Pos, html.EscapeString(tick.Label))
+	}
+	for _, tick := range c.xTicks {
+		fmt.Fprintf(&b, `<line x1="%g" x2="%g" y1="%g" y2="%g" stroke="#999"/>`+"\n", tick.Pos, tick.Pos, c.bottom, c.bottom+5)
+		fmt.Fprintf(&b, `<text x="%g" y="%g" dy="18" text-anchor="middle" fill="#333">%s</text>`+"\n", tick.Pos, c.bottom, html.EscapeString(tick.Label))
+	}
+	fmt.Fprintf(&b, `<line x1="%g" x2="%g" y1="%g" y2="%g" stroke="#999"/>`+"\n", c.left, c.right, c.bottom, c.bottom)
+
+	for i, s := range c.series {
+		var d strings.Builder
+		for _, line := range s.Lines {
+			for j, p := range line {
+				if j == 0 {
+					d.WriteByte('M')
+				} else {
+					d.WriteByte('L')
+				}
+				fmt.Fprintf(&d, "%g,%g", p.X, p.Y)
+			}
+		}
+		fmt.Fprintf(&b, `<path id="series-%d" fill="none" stroke-width="1.5" stroke="%s" d="%s"/>`+"\n", i, hexColor(s.Color), d.String())
+	}
+	if interactive {
+		fmt.Fprintf(&b, `<line id="cursor" stroke="#999" y1="%g" y2="%g" visibility="hidden"/>`+"\n", c.top, c.bottom)
+	}
+
+	if c.legend {
+		for i, s := range c.series {
+			y := c.legendY(i)
+			fmt.Fprintf(&b, `<rect x="%g" y="%g" width="12" height="8" fill="%s"/>`+"\n", c.left, y-8, hexColor(s.Color))
+			fmt.Fprintf(&b, `<text x="%g" y="%g" fill="#333">%s</text>`+"\n", c.left+18, y, html.EscapeString(s.Name))
+		}
+	}
+
+	b.WriteString("</svg>\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// legendY returns the baseline of the i-th entry of the legend.
+func (c *chart) legendY(i int) float64 {
+	return c.bottom + chartBottom + float64(i*chartLegend) + 4
+}
+
+func hexColor(c color.RGBA) string {
+	return fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+}
+
+func round2(f float64) float64 {
+	return math.Round(f*100) / 100
+}
+
+// niceTicks returns about n ticks at round steps covering min to max,
+// with the range extended to the outer ticks.
+func niceTicks(min, max float64, n int) ([]float64, float64, float64) {
+	if n < 1 {
+		n = 1
+	}
+	if min == max {
+		min, max = min-1, max+1
+	}
+
+	raw := (max - min) / float64(n)
+	magnitude := math.Pow(10, math.Floor(math.Log10(raw)))
+	step := magnitude * 10
+	for _, m := range []float64{1, 2, 2.5, 5} {
+		if raw <= m*magnitude {
+			step = m * magnitude
+			break
+		}
+	}
+
+	lo := math.Floor(min/step) * step
+	hi := math.Ceil(max/step) * step
+	var ticks []float64
+	for v := lo; v <= hi+step/2; v += step {
+		// Avoid ticks like 0.6000000000000001.
+		tick, _ := strconv.ParseFloat(strconv.FormatFloat(v, 'g', 12, 64), 64)
+		ticks = append(ticks, tick)
+	}
+	return ticks, lo, hi
+}
+
+// timeSteps are the steps the time axis can have ticks at.
+var timeSteps = []time.Duration{
+	time.Second, 5 * time.Second, 15 * time.Second, 30 * time.Second,
+	time.Minute, 2 * time.Minute, 5 * time.Minute, 10 * time.Minute, 15 * time.Minute, 30 * time.Minute,
+	time.Hour, 3 * time.Hour, 6 * time.Hour, 12 * time.Hour,
+	24 * time.Hour, 7 * 24 * time.Hour, 30 * 24 * time.Hour,
+}
+
+// timeTicks returns ticks at the smallest step with at most n of them
+// between the unix times min and max, labeled in loc.
+func timeTicks(min, max float64, n int, loc *time.Location) []chartTick {
+	span := time.Duration((max - min) * float64(time.Second))
+	step := timeSteps[len(timeSteps)-1]
+	for _, s := range timeSteps {
+		if span.Seconds()/s.Seconds() <= float64(n) {
+			step = s
+			break
+		}
+	}
+
+	layout := "15:04:05"
+	switch {
+	case step >= 24*time.Hour:
+		layout = "2006-01-02"
+	case span >= 24*time.Hour:
+		layout = "01-02 15:04"
+	case step >= time.Minute:
+		layout = "15:04"
+	}
+
+	// Start at a multiple of the step in the time zone, like 00:00 local.
+	first := time.Unix(int64(math.Ceil(min)), 0).In(loc)
+	_, offset := first.Zone()
+	secs := int64(step / time.Second)
+	local := first.Unix() + int64(offset)
+	if rem := local % secs; rem != 0 {
+		first = first.Add(time.Duration(secs-rem) * time.Second)
+	}
+
+	var ticks []chartTick
+	for t := first; float64(t.Unix()) <= max; t = t.Add(step) {
+		ticks = append(ticks, chartTick{Pos: float64(t.Unix()), Label: t.Format(layout)})
+	}
+	return ticks
+}
@@ -0,0 +1,71 @@
+package styx
+
+import (
+	"bytes"
+	"image/color"
+	"image/png"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var chartResults = []Result{
+	{Metric: `up{job="<a>"}`, Times: []int64{1502749200, 1502749215, 1502749230, 1502749245}, Values: []float64{0, math.NaN(), 1, 1}},
+	{Metric: "sum(up)", Times: []int64{1502749200}, Values: []float64{2}},
+}
+
+func TestChartSVG(t *testing.T) {
+	buf := &bytes.Buffer{}
+	assert.NoError(t, Chart{Title: "Availability"}.SVG(buf, chartResults))
+	svg := buf.String()
+
+	assert.True(t, strings.HasPrefix(svg, `<svg xmlns="http://www.w3.org/2000/svg" width="960" height="476"`))
+	assert.Contains(t, svg, ">Availability</text>")
+	assert.Contains(t, svg, `d="M70,390M650,220L940,220"`)
+	assert.Contains(t, svg, `>up{job=&#34;&lt;a&gt;&#34;}</text>`)
+	assert.NotContains(t, svg, `id="cursor"`)
+}
+
+func TestChartPNG(t *testing.T) {
+	buf := &bytes.Buffer{}
+	assert.NoError(t, Chart{Width: 400, Height: 200}.PNG(buf, chartResults))
+
+	img, err := png.Decode(buf)
+	assert.NoError(t, err)
+	assert.Equal(t, 400, img.Bounds().Dx())
+	assert.Equal(t, 200+2*chartLegend+10, img.Bounds().Dy())
+
+	// The line of up at 1 from 1502749230 on, and its entry in the legend
+	assert.Equal(t, color.RGBAModel.Convert(chartColors[0]), color.RGBAModel.Convert(img.At(300, 90)))
+	assert.Equal(t, color.RGBAModel.Convert(chartColors[1]), color.RGBAModel.Convert(img.At(75, 218)))
+}
+
+func TestNiceTicks(t *testing.T) {
+	ticks, min, max := niceTicks(0.1, 0.93, 5)
+	assert.Equal(t, []float64{0, 0.2, 0.4, 0.6, 0.8, 1}, ticks)
+	assert.Equal(t, 0.0, min)
+	assert.Equal(t, 1.0, max)
+
+	ticks, _, _ = niceTicks(5, 5, 5)
+	assert.Equal(t, []float64{4, 4.5, 5, 5.5, 6}, ticks)
+}
+
+func TestTimeTicks(t *testing.T) {
+	// 2017-08-14 22:20:00 to 2017-08-15 04:00:00 UTC
+	ticks := timeTicks(1502749200, 1502769600, 6, time.UTC)
+	var labels []string
+	for _, tick := range ticks {
+		labels = append(labels, tick.Label)
+	}
+	assert.Equal(t, []string{"23:00", "00:00", "01:00", "02:00", "03:00", "04:00"}, labels)
+
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	assert.NoError(t, err)
+	// 00:21 to 00:50 in Berlin, at steps of 5 minutes
+	ticks = timeTicks(1502749260, 1502751000, 6, berlin)
+	assert.Equal(t, "00:25", ticks[0].Label)
+	assert.Len(t, ticks, 6)
+}
@@ -0,0 +1,64 @@
+package styx
+
+import (
+	"time"
+)
+
+// TimeRange is a range of time from Start to End.
+type TimeRange struct {
+	Start time.Time
+	End   time.Time
+}
+
+// Chunks splits the range into consecutive chunks of at most size. The size
+// is rounded up to a multiple of step, so all chunks share the same grid of
+// timestamps, and chunks don't overlap.
+func Chunks(start, end time.Time, size time.Duration, step int) []TimeRange {
+	stepDur := time.Duration(step) * time.Second
+	if stepDur <= 0 {
+		stepDur = time.Second
+	}
+	if rem := size % stepDur; rem != 0 {
+		size += stepDur - rem
+	}
+	if size <= 0 {
+		return []TimeRange{{Start: start, End: end}}
+	}
+
+	var ranges []TimeRange
+	for s := start; !s.After(end); s = s.Add(size) {
+		e := s.Add(size - stepDur)
+		if e.After(end) {
+			e = end
+		}
+		ranges = append(ranges, TimeRange{Start: s, End: e})
+	}
+
+	return ranges
+}
+
+// MergeResults merges the results of several queries, the values of results
+// of the same series are combined. Results keep the order they appear in.
+func MergeResults(sets ...[]Result) []Result {
+	var merged []Result
+	index := make(map[string]int)
+
+	for _, results := range sets {
+		for _, result := range results {
+			id := SeriesID(result)
+			i, ok := index[id]
+			if !ok {
+				i = len(merged)
+				index[id] = i
+				merged = append(merged, Result{
+					Metric: result.Metric,
+					Labels: result.Labels,
+				})
+			}
+
+			merged[i].merge(result)
+		}
+	}
+
+	return merged
+}
@@ -0,0 +1,80 @@
+package styx
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChunks(t *testing.T) {
+	start := time.Unix(1502749200, 0)
+
+	// The range fits into a single chunk
+	assert.Equal(t, []TimeRange{
+		{Start: start, End: start.Add(time.Hour)},
+	}, Chunks(start, start.Add(time.Hour), 2*time.Hour, 60))
+
+	// Chunks don't overlap and the last one is cut at the end
+	assert.Equal(t, []TimeRange{
+		{Start: start, End: start.Add(time.Hour - time.Minute)},
+		{Start: start.Add(time.Hour), End: start.Add(2*time.Hour - time.Minute)},
+		{Start: start.Add(2 * time.Hour), End: start.Add(150 * time.Minute)},
+	}, Chunks(start, start.Add(150*time.Minute), time.Hour, 60))
+
+	// The chunk size is rounded up to a multiple of the step
+	assert.Equal(t, []TimeRange{
+		{Start: start, End: start.Add(40 * time.Second)},
+		{Start: start.Add(50 * time.Second), End: start.Add(90 * time.Second)},
+		{Start: start.Add(100 * time.Second), End: start.Add(100 * time.Second)},
+	}, Chunks(start, start.Add(100*time.Second), 45*time.Second, 10))
+}
+
+func TestMergeResults(t *testing.T) {
+	assert.Len(t, MergeResults(), 0)
+
+	merged := MergeResults([]Result{{
+		Metric: "foobar",
+		Times:  []int64{1502749390},
+		Values: []float64{0},
+	}}, nil, []Result{{
+		Metric: "foobaz",
+		Times:  []int64{1502749391},
+		Values: []float64{5},
+	}, {
+		Metric: "foobar",
+		Times:  []int64{1502749391},
+		Values: []float64{1},
+	}})
+
+	assert.Equal(t, []Result{{
+		Metric: "foobar",
+		Times:  []int64{1502749390, 1502749391},
+		Values: []float64{0, 1},
+	}, {
+		Metric: "foobaz",
+		Times:  []int64{1502749391},
+		Values: []float64{5},
+	}}, merged)
+
+	// Series are identified by their labels, not by the metric
+	merged = MergeResults([]Result{{
+		Metric: `up{a="x",b="y"}`,
+		Labels: map[string]string{"a": "x", "b": "y"},
+		Times:  []int64{1502749390},
+		Values: []float64{1},
+	}}, []Result{{
+		Metric: `up{a="x",b="y"}`,
+		Labels: map[string]string{"b": "y", "a": "x"},
+		Times:  []int64{1502749391},
+		Values: []float64{1},
+	}, {
+		Metric: `up{a="x",b="y"}`,
+		Labels: map[string]string{"a": `x",b="y`},
+		Times:  []int64{1502749391},
+		Values: []float64{0},
+	}})
+	assert.Len(t, merged, 2)
+	assert.Equal(t, []int64{1502749390, 1502749391}, merged[0].Times)
+	assert.Equal(t, []float64{1, 1}, merged[0].Values)
+}
@@ -0,0 +1,54 @@
+package styx
+
+import (
+	"math"
+	"sort"
+)
+
+// Clamp returns copies of the results where values above the threshold of
+// their series are set to the threshold, so a single spike doesn't dominate
+// the scale of a chart. The threshold is max if it isn't 0, otherwise the
+// percentile of the series' values by nearest rank, if that isn't 0.
+// The points that were clamped are returned with their original values
+// as outliers, e.g. to mark them.
+func Clamp(results []Result, percentile, max float64) (clamped []Result, outliers []Result) {
+	clamped = make([]Result, len(results))
+	outliers = make([]Result, len(results))
+
+	for i, result := range results {
+		var sorted []float64
+		for _, v := range result.Values {
+			if !math.IsNaN(v) && !math.IsInf(v, 0) {
+				sorted = append(sorted, v)
+			}
+		}
+
+		threshold := math.Inf(1)
+		if max != 0 {
+			threshold = max
+		} else if percentile > 0 && len(sorted) > 0 {
+			sort.Float64s(sorted)
+			rank := int(math.Ceil(percentile / 100 * float64(len(sorted))))
+			if rank < 1 {
+				rank = 1
+			}
+			threshold = sorted[rank-1]
+		}
+
+		values := make([]float64, len(result.Values))
+		marked := Result{Metric: result.Metric, Labels: result.Labels}
+		for j, v := range result.Values {
+			if v > threshold {
+				values[j] = threshold
+				marked.Add(result.Times[j], v)
+				continue
+			}
+			values[j] = v
+		}
+
+		clamped[i] = Result{Metric: result.Metric, Labels: result.Labels, Times: result.Times[:len(values):len(values)], Values: values}
+		outliers[i] = marked
+	}
+
+	return clamped, outliers
+}
@@ -0,0 +1,43 @@
+package styx
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClamp(t *testing.T) {
+	res := []Result{{
+		Metric: "latency",
+		Times:  []int64{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12},
+		Values: []float64{
+			1, 2, 3, 4, 5,
+			6, 7, 8, 9,
+			1000, // outlier
+			Missing,
+			math.NaN(),
+		},
+	}}
+
+	// Nothing to clamp at
+	clamped, outliers := Clamp(res, 0, 0)
+	assert.Equal(t, formatted(res[0].Values), formatted(clamped[0].Values))
+	assert.Len(t, outliers[0].Values, 0)
+
+	// The 90th percentile of the 10 numbers is 9
+	clamped, outliers = Clamp(res, 90, 0)
+	assert.Equal(t, []string{"1", "2", "3", "4", "5", "6", "7", "8", "9", "9", "", "NaN"}, formatted(clamped[0].Values))
+	assert.Equal(t, res[0].Times, clamped[0].Times)
+	assert.Equal(t, []int64{10}, outliers[0].Times)
+	assert.Equal(t, []float64{1000}, outliers[0].Values)
+
+	// The original results aren't modified
+	assert.Equal(t, 1000.0, res[0].Values[9])
+
+	clamped, outliers = Clamp(res, 0, 7.5)
+	assert.Equal(t, 7.0, clamped[0].Values[6])
+	assert.Equal(t, 7.5, clamped[0].Values[7])
+	assert.Equal(t, []int64{8, 9, 10}, outliers[0].Times)
+	assert.Equal(t, []float64{8, 9, 1000}, outliers[0].Values)
+}
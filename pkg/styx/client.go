@@ -0,0 +1,109 @@
+package styx
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// Client queries a single Prometheus with the same settings for every query.
+type Client struct {
+	// BaseURL is the address of Prometheus, e.g. http://localhost:9090,
+	// it may have a path like the one of a Grafana datasource proxy.
+	BaseURL string
+	// TLSConfig is used for https, e.g. to trust a private CA.
+	TLSConfig *tls.Config
+	// BearerToken is sent in the Authorization header if it's set.
+	BearerToken string
+	// Username and Password are sent as basic auth if Username is set.
+	Username string
+	Password string
+	// OrgID is the tenant of Cortex or Mimir, sent as X-Scope-OrgID.
+	OrgID string
+	// Timeout limits every request, zero means no timeout.
+	Timeout time.Duration
+	// Timeouts limit connecting and waiting for responses.
+	Timeouts Timeouts
+	// Proxy all requests are sent through, if it's nil the ones of
+	// HTTP_PROXY, HTTPS_PROXY and NO_PROXY are used.
+	Proxy *url.URL
+	// Options are used for all queries, the fields above take precedence.
+	Options Options
+
+	// mu guards the transport shared by all queries, it's created again
+	// only if the TLS config, timeouts or proxy change.
+	mu        sync.Mutex
+	transport *http.Transport
+	tlsConfig *tls.Config
+	timeouts  Timeouts
+	proxy     *url.URL
+}
+
+// NewClient returns a client for the Prometheus at baseURL.
+func NewClient(baseURL string) *Client {
+	return &Client{BaseURL: baseURL}
+}
+
+// QueryRange runs a range query between start and end, see Query.
+// Canceling ctx cancels the requests and the waits between retries.
+func (c *Client) QueryRange(ctx context.Context, start, end time.Time, query string) ([]Result, error) {
+	return Query(c.BaseURL, start, end, query, c.options(ctx))
+}
+
+// QueryInstant runs an instant query evaluated at the given time, see QueryInstant.
+func (c *Client) QueryInstant(ctx context.Context, at time.Time, query string) ([]Result, error) {
+	return QueryInstant(c.BaseURL, at, query, c.options(ctx))
+}
+
+// options returns the client's Options with ctx, auth, TLS and timeout applied.
+func (c *Client) options(ctx context.Context) Options {
+	opts := c.Options
+	opts.Context = ctx
+
+	opts.Header = make(http.Header)
+	for name, values := range c.Options.Header {
+		opts.Header[name] = append([]string(nil), values...)
+	}
+	if c.OrgID != "" {
+		opts.Header.Set("X-Scope-OrgID", c.OrgID)
+	}
+	if c.BearerToken != "" {
+		opts.Header.Set("Authorization", "Bearer "+c.BearerToken)
+	} else if c.Username != "" {
+		auth := base64.StdEncoding.EncodeToString([]byte(c.Username + ":" + c.Password))
+		opts.Header.Set("Authorization", "Basic "+auth)
+	}
+
+	if opts.Client == nil {
+		if opts.Transport == nil || c.TLSConfig != nil {
+			opts.Transport = c.sharedTransport()
+		}
+		if c.Timeout != 0 {
+			opts.Client = &http.Client{Jar: opts.Jar, Transport: opts.Transport, Timeout: c.Timeout}
+		}
+	}
+
+	return opts
+}
+
+// sharedTransport returns the transport of all queries of the client, so
+// they reuse their connections.
+func (c *Client) sharedTransport() *http.Transport {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.transport == nil || c.tlsConfig != c.TLSConfig || c.timeouts != c.Timeouts || c.proxy != c.Proxy {
+		if c.transport != nil {
+			c.transport.CloseIdleConnections()
+		}
+		c.transport = NewTransport(c.TLSConfig, c.Timeouts)
+		if c.Proxy != nil {
+			c.transport.Proxy = http.ProxyURL(c.Proxy)
+		}
+		c.tlsConfig, c.timeouts, c.proxy = c.TLSConfig, c.Timeouts, c.Proxy
+	}
+	return c.transport
+}
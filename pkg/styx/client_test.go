@@ -0,0 +1,156 @@
+package styx
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClientQueryRange(t *testing.T) {
+	var auth, org, tenant string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth = r.Header.Get("Authorization")
+		org = r.Header.Get("X-Grafana-Org-Id")
+		tenant = r.Header.Get("X-Scope-OrgID")
+		http.ServeFile(w, r, "testdata/query_range.json")
+	}))
+	defer ts.Close()
+
+	c := NewClient(ts.URL)
+	c.BearerToken = "token"
+	c.OrgID = "team-a"
+	c.Options.Header = http.Header{"X-Grafana-Org-Id": {"2"}}
+
+	results, err := c.QueryRange(context.Background(), time.Now().Add(-time.Hour), time.Now(), "go_goroutines")
+	assert.NoError(t, err)
+	assert.Len(t, results, 2)
+	assert.Equal(t, "Bearer token", auth)
+	assert.Equal(t, "2", org)
+	assert.Equal(t, "team-a", tenant)
+
+	c.BearerToken = ""
+	c.Username, c.Password = "user", "secret"
+	_, err = c.QueryRange(context.Background(), time.Now().Add(-time.Hour), time.Now(), "go_goroutines")
+	assert.NoError(t, err)
+	assert.Equal(t, "Basic dXNlcjpzZWNyZXQ=", auth)
+
+	// The options' header isn't changed
+	assert.Equal(t, http.Header{"X-Grafana-Org-Id": {"2"}}, c.Options.Header)
+}
+
+func TestClientTLS(t *testing.T) {
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeFile(w, r, "testdata/query_range.json")
+	}))
+	defer ts.Close()
+
+	c := NewClient(ts.URL)
+	_, err := c.QueryRange(context.Background(), time.Now().Add(-time.Hour), time.Now(), "go_goroutines")
+	assert.Error(t, err)
+
+	c.TLSConfig = ts.Client().Transport.(*http.Transport).TLSClientConfig
+	results, err := c.QueryRange(context.Background(), time.Now().Add(-time.Hour), time.Now(), "go_goroutines")
+	assert.NoError(t, err)
+	assert.Len(t, results, 2)
+}
+
+func TestClientTimeout(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(100 * time.Millisecond)
+		http.ServeFile(w, r, "testdata/query_range.json")
+	}))
+	defer ts.Close()
+
+	c := NewClient(ts.URL)
+	c.Timeout = 10 * time.Millisecond
+	_, err := c.QueryRange(context.Background(), time.Now().Add(-time.Hour), time.Now(), "go_goroutines")
+	assert.Error(t, err)
+}
+
+func TestClientCancel(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(100 * time.Millisecond)
+		http.ServeFile(w, r, "testdata/query_range.json")
+	}))
+	defer ts.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	_, err := NewClient(ts.URL).QueryRange(ctx, time.Now().Add(-time.Hour), time.Now(), "go_goroutines")
+	assert.Error(t, err)
+	assert.Equal(t, context.DeadlineExceeded, ctx.Err())
+}
+
+func TestClientReusesConnections(t *testing.T) {
+	var mu sync.Mutex
+	conns := make(map[string]bool)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		conns[r.RemoteAddr] = true
+		mu.Unlock()
+		http.ServeFile(w, r, "testdata/query_range.json")
+	}))
+	defer ts.Close()
+
+	c := NewClient(ts.URL)
+	c.Timeouts = Timeouts{Connect: time.Second, ResponseHeader: time.Second}
+	for i := 0; i < 5; i++ {
+		_, err := c.QueryRange(context.Background(), time.Now().Add(-time.Hour), time.Now(), "go_goroutines")
+		assert.NoError(t, err)
+	}
+	assert.Len(t, conns, 1)
+}
+
+func TestClientResponseHeaderTimeout(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+		http.ServeFile(w, r, "testdata/query_range.json")
+	}))
+	defer ts.Close()
+
+	c := NewClient(ts.URL)
+	c.Timeouts.ResponseHeader = 20 * time.Millisecond
+	_, err := c.QueryRange(context.Background(), time.Now().Add(-time.Hour), time.Now(), "go_goroutines")
+	assert.Error(t, err)
+
+	c.Timeouts.ResponseHeader = 0
+	_, err = c.QueryRange(context.Background(), time.Now().Add(-time.Hour), time.Now(), "go_goroutines")
+	assert.NoError(t, err)
+}
+
+func TestClientProxy(t *testing.T) {
+	var host, auth string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host = r.URL.Host
+		auth = r.Header.Get("Proxy-Authorization")
+		http.ServeFile(w, r, "testdata/query_range.json")
+	}))
+	defer proxy.Close()
+
+	c := NewClient("http://prometheus.invalid:9090")
+	c.Proxy, _ = url.Parse(proxy.URL)
+	c.Proxy.User = url.UserPassword("user", "secret")
+	results, err := c.QueryRange(context.Background(), time.Now().Add(-time.Hour), time.Now(), "go_goroutines")
+	assert.NoError(t, err)
+	assert.Len(t, results, 2)
+	assert.Equal(t, "prometheus.invalid:9090", host)
+	assert.Equal(t, "Basic dXNlcjpzZWNyZXQ=", auth)
+}
+
+func TestParseProxy(t *testing.T) {
+	u, err := ParseProxy("socks5://jump:1080")
+	assert.NoError(t, err)
+	assert.Equal(t, "jump:1080", u.Host)
+
+	for _, invalid := range []string{"proxy:3128", "ftp://proxy", "http://", "http://proxy:3128/%zz"} {
+		_, err := ParseProxy(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
@@ -0,0 +1,119 @@
+package styx
+
+import (
+	"math"
+	"sort"
+)
+
+// missingBits is the NaN marking points a series has no sample at. It's
+// the payload Prometheus uses for stale markers, NaN values returned by a
+// query have another one.
+const missingBits = 0x7ff0000000000002
+
+// Missing is the value of points without a sample, like the gaps FillGaps
+// leaves in results and the points of Columns a series has no sample at.
+var Missing = math.Float64frombits(missingBits)
+
+// IsMissing reports whether v marks a missing sample, unlike other NaNs.
+func IsMissing(v float64) bool {
+	return math.Float64bits(v) == missingBits
+}
+
+// Add adds a sample at the unix timestamp t, keeping the samples sorted by
+// time. A sample at a time the result already has replaces its value.
+func (r *Result) Add(t int64, v float64) {
+	n := len(r.Times)
+	if n == 0 || r.Times[n-1] < t {
+		r.Times = append(r.Times, t)
+		r.Values = append(r.Values, v)
+		return
+	}
+
+	i := sort.Search(n, func(i int) bool { return r.Times[i] >= t })
+	if r.Times[i] == t {
+		r.Values[i] = v
+		return
+	}
+	r.Times = append(r.Times, 0)
+	r.Values = append(r.Values, 0)
+	copy(r.Times[i+1:], r.Times[i:])
+	copy(r.Values[i+1:], r.Values[i:])
+	r.Times[i], r.Values[i] = t, v
+}
+
+// At returns the value at the unix timestamp t and whether the result has
+// a point there, which may be Missing.
+func (r Result) At(t int64) (float64, bool) {
+	i := sort.Search(len(r.Times), func(i int) bool { return r.Times[i] >= t })
+	if i == len(r.Times) || r.Times[i] != t {
+		return Missing, false
+	}
+	return r.Values[i], true
+}
+
+// merge adds the samples of other, whose values replace the ones at the
+// same times.
+func (r *Result) merge(other Result) {
+	for j, t := range other.Times {
+		r.Add(t, other.Values[j])
+	}
+}
+
+// formatValue formats a value like Prometheus does, missing values are
+// empty.
+func formatValue(v float64) string {
+	return RawSpecialValues.format(v)
+}
+
+// sortedTimes returns the sorted and deduplicated times of all results.
+func sortedTimes(results []Result) []int64 {
+	var times []int64
+	for _, result := range results {
+		times = append(times, result.Times...)
+	}
+	sort.Slice(times, func(i, j int) bool { return times[i] < times[j] })
+
+	deduped := times[:0]
+	for i, t := range times {
+		if i == 0 || t != times[i-1] {
+			deduped = append(deduped, t)
+		}
+	}
+	return deduped
+}
+
+// Columns hold results on a shared time index: the sorted timestamps of all
+// of them and a value at every timestamp for every series, Missing where a
+// series has no sample. Writers with a column per series and computations
+// across series line the results up with them.
+type Columns struct {
+	Times  []int64
+	Series []Column
+}
+
+// Column is a series of Columns, with a value at every timestamp.
+type Column struct {
+	Metric string
+	Labels map[string]string
+	Values []float64
+}
+
+// NewColumns lines the results up on the times of all of them.
+func NewColumns(results []Result) Columns {
+	c := Columns{Times: sortedTimes(results), Series: make([]Column, len(results))}
+	for i, result := range results {
+		values := make([]float64, len(c.Times))
+		// Both times are sorted, so the samples are found in one pass.
+		k := 0
+		for j, t := range c.Times {
+			if k < len(result.Times) && result.Times[k] == t {
+				values[j] = result.Values[k]
+				k++
+				continue
+			}
+			values[j] = Missing
+		}
+		c.Series[i] = Column{Metric: result.Metric, Labels: result.Labels, Values: values}
+	}
+	return c
+}
@@ -0,0 +1,64 @@
+package styx
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// formatted returns the values formatted like Prometheus does, which unlike
+// the floats can be compared with NaN values.
+func formatted(values []float64) []string {
+	strs := make([]string, len(values))
+	for i, v := range values {
+		strs[i] = formatValue(v)
+	}
+	return strs
+}
+
+func TestResultAdd(t *testing.T) {
+	var r Result
+	r.Add(10, 1)
+	r.Add(30, 3)
+	r.Add(20, 2)
+	r.Add(5, 0)
+	r.Add(20, 4)
+	assert.Equal(t, []int64{5, 10, 20, 30}, r.Times)
+	assert.Equal(t, []float64{0, 1, 4, 3}, r.Values)
+
+	v, ok := r.At(20)
+	assert.True(t, ok)
+	assert.Equal(t, 4.0, v)
+	v, ok = r.At(15)
+	assert.False(t, ok)
+	assert.True(t, IsMissing(v))
+
+	r.merge(Result{Times: []int64{1, 30}, Values: []float64{-1, math.NaN()}})
+	assert.Equal(t, []int64{1, 5, 10, 20, 30}, r.Times)
+	assert.Equal(t, []string{"-1", "0", "1", "4", "NaN"}, formatted(r.Values))
+}
+
+func TestNewColumns(t *testing.T) {
+	results := []Result{
+		{Metric: `up{job="a"}`, Labels: map[string]string{"job": "a"}, Times: []int64{9, 10, 11}, Values: []float64{2, 1, Missing}},
+		{Metric: `up{job="b"}`, Labels: map[string]string{"job": "b"}, Times: []int64{11, 100}, Values: []float64{math.NaN(), math.Inf(1)}},
+	}
+
+	c := NewColumns(results)
+	assert.Equal(t, []int64{9, 10, 11, 100}, c.Times)
+	assert.Len(t, c.Series, 2)
+	assert.Equal(t, `up{job="a"}`, c.Series[0].Metric)
+	assert.Equal(t, "b", c.Series[1].Labels["job"])
+
+	a := c.Series[0].Values
+	assert.Equal(t, []float64{2, 1}, a[:2])
+	assert.True(t, IsMissing(a[2]))
+	assert.True(t, IsMissing(a[3]))
+
+	b := c.Series[1].Values
+	assert.True(t, IsMissing(b[0]))
+	assert.True(t, math.IsNaN(b[2]))
+	assert.False(t, IsMissing(b[2]))
+	assert.True(t, math.IsInf(b[3], 1))
+}
@@ -0,0 +1,93 @@
+package styx
+
+import (
+	"encoding/json"
+	"io"
+	"math"
+	"sort"
+)
+
+// DatadogMaxPoints is the default number of points per payload,
+// keeping payloads well below the size limit of Datadog's intake API.
+const DatadogMaxPoints = 10000
+
+// DatadogLabels are the characters Datadog doesn't allow in tags.
+var DatadogLabels = LabelMapping{Invalid: " ,", Replacement: "_"}
+
+// datadogPayload is the body of Datadog's v1 metrics intake API.
+type datadogPayload struct {
+	Series []datadogSeries `json:"series"`
+}
+
+type datadogSeries struct {
+	Metric string       `json:"metric"`
+	Points [][2]float64 `json:"points"`
+	Type   string       `json:"type"`
+	Tags   []string     `json:"tags,omitempty"`
+}
+
+// DatadogWriter writes one payload per line with at most maxPoints points,
+// splitting series across payloads if necessary. Results without a metric
+// name, like the result of sum(), are submitted as name. The labels become
+// tags using the mapping and points that can't be represented in JSON are skipped.
+func DatadogWriter(w io.Writer, results []Result, name string, maxPoints int, mapping LabelMapping) error {
+	if maxPoints <= 0 {
+		maxPoints = DatadogMaxPoints
+	}
+
+	enc := json.NewEncoder(w)
+	payload := datadogPayload{}
+	points := 0
+
+	for _, result := range results {
+		series := datadogSeriesOf(result, name, mapping)
+
+		for len(series.Points) > 0 {
+			if points == maxPoints {
+				if err := enc.Encode(payload); err != nil {
+					return err
+				}
+				payload = datadogPayload{}
+				points = 0
+			}
+
+			n := len(series.Points)
+			if n > maxPoints-points {
+				n = maxPoints - points
+			}
+
+			chunk := series
+			chunk.Points = series.Points[:n]
+			series.Points = series.Points[n:]
+
+			payload.Series = append(payload.Series, chunk)
+			points += n
+		}
+	}
+
+	if points == 0 {
+		return nil
+	}
+	return enc.Encode(payload)
+}
+
+func datadogSeriesOf(result Result, name string, mapping LabelMapping) datadogSeries {
+	series := datadogSeries{Metric: name, Type: "gauge"}
+	if metric, ok := result.Labels["__name__"]; ok {
+		series.Metric = metric
+	}
+
+	for key, value := range mapping.apply(result.Labels) {
+		series.Tags = append(series.Tags, key+":"+value)
+	}
+	sort.Strings(series.Tags)
+
+	for j, time := range result.Times {
+		// Datadog has no special values, like missing ones they're left out.
+		if v := result.Values[j]; !math.IsInf(v, 0) && !math.IsNaN(v) {
+			series.Points = append(series.Points, [2]float64{float64(time), v})
+		}
+	}
+
+	return series
+}
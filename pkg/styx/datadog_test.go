@@ -0,0 +1,48 @@
+package styx
+
+import (
+	"bytes"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDatadogWriter(t *testing.T) {
+	// No results
+	buf := bytes.NewBuffer(nil)
+	assert.NoError(t, DatadogWriter(buf, nil, "styx", 0, DatadogLabels))
+	assert.Equal(t, "", buf.String())
+
+	res := []Result{{
+		Metric: `go_goroutines{job="prometheus"}`,
+		Labels: map[string]string{"__name__": "go_goroutines", "job": "prometheus", "instance": "localhost:9090"},
+		Times:  []int64{1502749390, 1502749391, 1502749392, 1502749393},
+		Values: []float64{41, 42.5, math.NaN(), Missing},
+	}, {
+		Metric: "{}",
+		Times:  []int64{1502749390},
+		Values: []float64{7},
+	}}
+
+	expected := `{"series":[` +
+		`{"metric":"go_goroutines","points":[[1502749390,41],[1502749391,42.5]],"type":"gauge","tags":["instance:localhost:9090","job:prometheus"]},` +
+		`{"metric":"styx","points":[[1502749390,7]],"type":"gauge"}]}` + "\n"
+	buf = bytes.NewBuffer(nil)
+	assert.NoError(t, DatadogWriter(buf, res, "styx", 0, DatadogLabels))
+	assert.Equal(t, expected, buf.String())
+
+	// Series are split across payloads
+	expected = `{"series":[{"metric":"go_goroutines","points":[[1502749390,41],[1502749391,42.5]],"type":"gauge","tags":["instance:localhost:9090","job:prometheus"]}]}` + "\n" +
+		`{"series":[{"metric":"styx","points":[[1502749390,7]],"type":"gauge"}]}` + "\n"
+	buf = bytes.NewBuffer(nil)
+	assert.NoError(t, DatadogWriter(buf, res, "styx", 2, DatadogLabels))
+	assert.Equal(t, expected, buf.String())
+
+	expected = `{"series":[{"metric":"go_goroutines","points":[[1502749390,41]],"type":"gauge","tags":["instance:localhost:9090","job:prometheus"]}]}` + "\n" +
+		`{"series":[{"metric":"go_goroutines","points":[[1502749391,42.5]],"type":"gauge","tags":["instance:localhost:9090","job:prometheus"]}]}` + "\n" +
+		`{"series":[{"metric":"styx","points":[[1502749390,7]],"type":"gauge"}]}` + "\n"
+	buf = bytes.NewBuffer(nil)
+	assert.NoError(t, DatadogWriter(buf, res, "styx", 1, DatadogLabels))
+	assert.Equal(t, expected, buf.String())
+}
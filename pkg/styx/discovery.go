@@ -0,0 +1,203 @@
+package styx
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"time"
+)
+
+// Labels returns the sorted names of the labels of the series between
+// start and end, only of the series matching one of the selectors if any
+// are given, e.g. {job="node"}.
+func Labels(host string, start, end time.Time, matchers []string, opts Options) (names []string, err error) {
+	ctx, span := opts.span("styx.Labels")
+	span.SetAttribute("styx.host", host)
+	defer func() {
+		if err != nil {
+			span.RecordError(err)
+		}
+		span.SetAttribute("styx.results", len(names))
+		span.End()
+	}()
+
+	params, err := seriesParams(start, end, matchers, opts)
+	if err != nil {
+		return nil, err
+	}
+	u, err := apiURL(host, "labels", params, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var resp struct {
+		Data []string `json:"data"`
+	}
+	if _, err := fetch(ctx, host, u, "", opts, &resp); err != nil {
+		return nil, err
+	}
+	sort.Strings(resp.Data)
+	return resp.Data, nil
+}
+
+// LabelValues returns the sorted values of the label name of the series
+// between start and end, only of the series matching one of the selectors
+// if any are given.
+func LabelValues(host, name string, start, end time.Time, matchers []string, opts Options) (values []string, err error) {
+	ctx, span := opts.span("styx.LabelValues")
+	span.SetAttribute("styx.host", host)
+	span.SetAttribute("styx.label", name)
+	defer func() {
+		if err != nil {
+			span.RecordError(err)
+		}
+		span.SetAttribute("styx.results", len(values))
+		span.End()
+	}()
+
+	if !labelNameRE.MatchString(name) {
+		return nil, fmt.Errorf("invalid label name: %s", name)
+	}
+	params, err := seriesParams(start, end, matchers, opts)
+	if err != nil {
+		return nil, err
+	}
+	u, err := apiURL(host, "label/"+name+"/values", params, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var resp struct {
+		Data []string `json:"data"`
+	}
+	if _, err := fetch(ctx, host, u, "", opts, &resp); err != nil {
+		return nil, err
+	}
+	sort.Strings(resp.Data)
+	return resp.Data, nil
+}
+
+// Series returns the label sets of the series matching any of the selectors
+// between start and end, sorted by their names. No series matching is
+// ErrNoTimeseries.
+func Series(host string, start, end time.Time, matchers []string, opts Options) (series []map[string]string, err error) {
+	ctx, span := opts.span("styx.Series")
+	span.SetAttribute("styx.host", host)
+	defer func() {
+		if err != nil {
+			span.RecordError(err)
+		}
+		span.SetAttribute("styx.results", len(series))
+		span.End()
+	}()
+
+	if len(matchers) == 0 {
+		return nil, fmt.Errorf("series need at least one selector to match")
+	}
+	params, err := seriesParams(start, end, matchers, opts)
+	if err != nil {
+		return nil, err
+	}
+	u, err := apiURL(host, "series", params, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var resp struct {
+		Data []map[string]string `json:"data"`
+	}
+	if _, err := fetch(ctx, host, u, "", opts, &resp); err != nil {
+		return nil, err
+	}
+	if len(resp.Data) == 0 {
+		return nil, ErrNoTimeseries
+	}
+	sort.Slice(resp.Data, func(i, j int) bool {
+		return metricName(resp.Data[i]) < metricName(resp.Data[j])
+	})
+	return resp.Data, nil
+}
+
+// seriesParams returns the parameters of the metadata endpoints taking a
+// range and selectors, with the enforced labels injected into the
+// selectors. Without selectors the enforced labels are the only one, so
+// no other series are found.
+func seriesParams(start, end time.Time, matchers []string, opts Options) (url.Values, error) {
+	params := url.Values{}
+	if !start.IsZero() {
+		params.Set("start", fmt.Sprintf("%d", start.Unix()))
+	}
+	if !end.IsZero() {
+		params.Set("end", fmt.Sprintf("%d", end.Unix()))
+	}
+
+	if len(matchers) == 0 && len(opts.EnforceLabels) > 0 {
+		matchers = []string{"{}"}
+	}
+	for _, matcher := range matchers {
+		injected, err := injectMatchers(matcher, opts.EnforceLabels)
+		if err != nil {
+			return nil, fmt.Errorf("can't enforce labels: %v", err)
+		}
+		params.Add("match[]", injected)
+	}
+	return params, nil
+}
+
+// MetricMetadata is the type, unit and help of a metric as its targets
+// expose them.
+type MetricMetadata struct {
+	Metric string `json:"metric"`
+	Type   string `json:"type"`
+	Unit   string `json:"unit"`
+	Help   string `json:"help"`
+}
+
+// Metadata returns the metadata of the metric, of all metrics if it's
+// empty, sorted by metric. Targets exposing a metric differently give it
+// several entries.
+func Metadata(host, metric string, opts Options) (metadata []MetricMetadata, err error) {
+	ctx, span := opts.span("styx.Metadata")
+	span.SetAttribute("styx.host", host)
+	defer func() {
+		if err != nil {
+			span.RecordError(err)
+		}
+		span.SetAttribute("styx.results", len(metadata))
+		span.End()
+	}()
+
+	params := url.Values{}
+	if metric != "" {
+		params.Set("metric", metric)
+	}
+	u, err := apiURL(host, "metadata", params, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var resp struct {
+		Data map[string][]MetricMetadata `json:"data"`
+	}
+	if _, err := fetch(ctx, host, u, "", opts, &resp); err != nil {
+		return nil, err
+	}
+
+	for name, entries := range resp.Data {
+		for _, entry := range entries {
+			entry.Metric = name
+			metadata = append(metadata, entry)
+		}
+	}
+	sort.SliceStable(metadata, func(i, j int) bool {
+		a, b := metadata[i], metadata[j]
+		if a.Metric != b.Metric {
+			return a.Metric < b.Metric
+		}
+		if a.Type != b.Type {
+			return a.Type < b.Type
+		}
+		return a.Help < b.Help
+	})
+	return metadata, nil
+}
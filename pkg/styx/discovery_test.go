@@ -0,0 +1,100 @@
+package styx
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLabels(t *testing.T) {
+	var path string
+	var params url.Values
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path, params = r.URL.Path, r.URL.Query()
+		fmt.Fprint(w, `{"status":"success","data":["job","__name__","instance"]}`)
+	}))
+	defer ts.Close()
+
+	start, end := time.Unix(1500000000, 0), time.Unix(1500003600, 0)
+	names, err := Labels(ts.URL, start, end, nil, Options{})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"__name__", "instance", "job"}, names)
+	assert.Equal(t, "/api/v1/labels", path)
+	assert.Equal(t, "1500000000", params.Get("start"))
+	assert.Equal(t, "1500003600", params.Get("end"))
+	assert.Empty(t, params["match[]"])
+
+	// Enforced labels restrict the series even without selectors.
+	_, err = Labels(ts.URL, start, end, nil, Options{EnforceLabels: map[string]string{"namespace": "a"}})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{`{namespace="a"}`}, params["match[]"])
+
+	values, err := LabelValues(ts.URL, "job", start, end, []string{`up`, `{job=~"n.*"}`}, Options{})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"__name__", "instance", "job"}, values)
+	assert.Equal(t, "/api/v1/label/job/values", path)
+	assert.Equal(t, []string{`up`, `{job=~"n.*"}`}, params["match[]"])
+
+	_, err = LabelValues(ts.URL, "job/../x", start, end, nil, Options{})
+	assert.Error(t, err)
+}
+
+func TestSeries(t *testing.T) {
+	var params url.Values
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		params = r.URL.Query()
+		if params.Get("match[]") == "none" {
+			fmt.Fprint(w, `{"status":"success","data":[]}`)
+			return
+		}
+		fmt.Fprint(w, `{"status":"success","data":[`+
+			`{"__name__":"up","job":"node","instance":"localhost:9100"},`+
+			`{"__name__":"up","job":"prometheus","instance":"localhost:9090"}]}`)
+	}))
+	defer ts.Close()
+
+	series, err := Series(ts.URL, time.Time{}, time.Time{}, []string{`up{job=~".+"}`}, Options{EnforceLabels: map[string]string{"namespace": "a"}})
+	assert.NoError(t, err)
+	assert.Equal(t, []map[string]string{
+		{"__name__": "up", "job": "prometheus", "instance": "localhost:9090"},
+		{"__name__": "up", "job": "node", "instance": "localhost:9100"},
+	}, series)
+	assert.Equal(t, `up{job=~".+",namespace="a"}`, params.Get("match[]"))
+	assert.Empty(t, params.Get("start"))
+
+	_, err = Series(ts.URL, time.Time{}, time.Time{}, []string{"none"}, Options{})
+	assert.Equal(t, ErrNoTimeseries, err)
+	_, err = Series(ts.URL, time.Time{}, time.Time{}, nil, Options{})
+	assert.Error(t, err)
+}
+
+func TestMetadata(t *testing.T) {
+	var params url.Values
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		params = r.URL.Query()
+		fmt.Fprint(w, `{"status":"success","data":{`+
+			`"up":[{"type":"gauge","help":"Up or not.","unit":""}],`+
+			`"http_requests_total":[{"type":"counter","help":"Requests.","unit":""},{"type":"counter","help":"All requests.","unit":""}],`+
+			`"process_cpu_seconds":[{"type":"counter","help":"CPU time.","unit":"seconds"}]}}`)
+	}))
+	defer ts.Close()
+
+	metadata, err := Metadata(ts.URL, "", Options{})
+	assert.NoError(t, err)
+	assert.Equal(t, []MetricMetadata{
+		{Metric: "http_requests_total", Type: "counter", Help: "All requests."},
+		{Metric: "http_requests_total", Type: "counter", Help: "Requests."},
+		{Metric: "process_cpu_seconds", Type: "counter", Unit: "seconds", Help: "CPU time."},
+		{Metric: "up", Type: "gauge", Help: "Up or not."},
+	}, metadata)
+	assert.Empty(t, params.Get("metric"))
+
+	_, err = Metadata(ts.URL, "up", Options{})
+	assert.NoError(t, err)
+	assert.Equal(t, "up", params.Get("metric"))
+}
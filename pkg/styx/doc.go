@@ -0,0 +1,10 @@
+// Package styx queries Prometheus and writes the results in the formats
+// the styx command exports, like CSV, JSON or gnuplot and matplotlib data.
+//
+//	c := styx.NewClient("http://localhost:9090")
+//	results, err := c.QueryRange(context.Background(), time.Now().Add(-time.Hour), time.Now(), "sum(go_goroutines)")
+//	if err != nil {
+//		return err
+//	}
+//	return styx.CSVWriter(os.Stdout, results)
+package styx
@@ -0,0 +1,99 @@
+package styx
+
+import (
+	"fmt"
+	"math"
+)
+
+// The aggregations of Downsample.
+const (
+	DownsampleAvg  = "avg"
+	DownsampleMin  = "min"
+	DownsampleMax  = "max"
+	DownsampleSum  = "sum"
+	DownsampleLast = "last"
+)
+
+// Downsample returns copies of the results with the samples of every window
+// of window seconds reduced to a single one by the aggregation, at the
+// start of the window. Windows are aligned to the Unix epoch, so results
+// downsampled separately line up. Special float values take part like in
+// PromQL, e.g. a NaN makes the average NaN, last keeps them as they are.
+func Downsample(results []Result, window int, aggregation string) ([]Result, error) {
+	if window <= 0 {
+		return nil, fmt.Errorf("the window needs to be positive: %d", window)
+	}
+	switch aggregation {
+	case DownsampleAvg, DownsampleMin, DownsampleMax, DownsampleSum, DownsampleLast:
+	default:
+		return nil, fmt.Errorf("unknown aggregation: %s", aggregation)
+	}
+
+	downsampled := make([]Result, len(results))
+	for i, result := range results {
+		downsampled[i] = Result{Metric: result.Metric, Labels: result.Labels}
+
+		var times []int64
+		var values []float64
+		for j, v := range result.Values {
+			if !IsMissing(v) {
+				times = append(times, result.Times[j])
+				values = append(values, v)
+			}
+		}
+		// The times are sorted, so the samples of a window are next to each
+		// other.
+		for j := 0; j < len(times); {
+			start := times[j] - mod(times[j], int64(window))
+			k := j + 1
+			for k < len(times) && times[k]-mod(times[k], int64(window)) == start {
+				k++
+			}
+			downsampled[i].Add(start, aggregate(values[j:k], aggregation))
+			j = k
+		}
+	}
+
+	return downsampled, nil
+}
+
+// aggregate reduces the values of a window, sorted by time.
+func aggregate(values []float64, aggregation string) float64 {
+	if aggregation == DownsampleLast {
+		return values[len(values)-1]
+	}
+
+	var agg float64
+	for j, v := range values {
+		switch {
+		case j == 0:
+			agg = v
+		case aggregation == DownsampleMin:
+			// Like min_over_time a NaN is only kept without other values.
+			if v < agg || math.IsNaN(agg) {
+				agg = v
+			}
+		case aggregation == DownsampleMax:
+			if v > agg || math.IsNaN(agg) {
+				agg = v
+			}
+		default:
+			agg += v
+		}
+	}
+	if aggregation == DownsampleAvg {
+		agg /= float64(len(values))
+	}
+
+	return agg
+}
+
+// mod returns the non-negative remainder of a divided by b, also for
+// timestamps before the epoch.
+func mod(a, b int64) int64 {
+	m := a % b
+	if m < 0 {
+		m += b
+	}
+	return m
+}
@@ -0,0 +1,44 @@
+package styx
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDownsample(t *testing.T) {
+	res := []Result{{
+		Metric: "foobar",
+		Labels: map[string]string{"job": "a"},
+		Times:  []int64{3540, 3570, 3600, 3630, 3660, 7230},
+		Values: []float64{1, 5, 4, 2, Missing, math.NaN()},
+	}}
+
+	for aggregation, expected := range map[string][]string{
+		DownsampleAvg:  {"3", "3", "NaN"},
+		DownsampleMin:  {"1", "2", "NaN"},
+		DownsampleMax:  {"5", "4", "NaN"},
+		DownsampleSum:  {"6", "6", "NaN"},
+		DownsampleLast: {"5", "2", "NaN"},
+	} {
+		downsampled, err := Downsample(res, 3600, aggregation)
+		assert.NoError(t, err, aggregation)
+		assert.Len(t, downsampled, 1)
+		assert.Equal(t, "foobar", downsampled[0].Metric)
+		assert.Equal(t, map[string]string{"job": "a"}, downsampled[0].Labels)
+		assert.Equal(t, []int64{0, 3600, 7200}, downsampled[0].Times, aggregation)
+		assert.Equal(t, expected, formatted(downsampled[0].Values), aggregation)
+	}
+
+	// min and max ignore NaN next to other values.
+	res[0].Add(7260, 3)
+	downsampled, err := Downsample(res, 3600, DownsampleMax)
+	assert.NoError(t, err)
+	assert.Equal(t, 3.0, downsampled[0].Values[2])
+
+	_, err = Downsample(res, 0, DownsampleAvg)
+	assert.Error(t, err)
+	_, err = Downsample(res, 60, "median")
+	assert.Error(t, err)
+}
@@ -0,0 +1,78 @@
+package styx
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+)
+
+// ReplayTransport answers every request with a recorded response from a file
+// instead of talking to Prometheus, making queries reproducible offline.
+// Responses recorded gzip encoded are replayed as such.
+type ReplayTransport struct {
+	Path string
+}
+
+func (t ReplayTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	body, err := ioutil.ReadFile(t.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	header := http.Header{"Content-Type": []string{"application/json"}}
+	if bytes.HasPrefix(body, gzipMagic) {
+		header.Set("Content-Encoding", "gzip")
+	}
+
+	return &http.Response{
+		Status:        "200 OK",
+		StatusCode:    http.StatusOK,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          ioutil.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}, nil
+}
+
+// gzipMagic starts gzip streams, JSON can't start with it.
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// RecordTransport writes the body of every successful response into a file,
+// so it can be replayed later with ReplayTransport. Bodies are recorded as
+// they're received, i.e. compressed if the response is.
+type RecordTransport struct {
+	Path string
+	Next http.RoundTripper
+}
+
+func (t RecordTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	next := t.Next
+	if next == nil {
+		next = http.DefaultTransport
+	}
+
+	resp, err := next.RoundTrip(req)
+	if err != nil || resp.StatusCode != http.StatusOK {
+		return resp, err
+	}
+	defer resp.Body.Close()
+
+	f, err := os.Create(t.Path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	body, err := ioutil.ReadAll(io.TeeReader(resp.Body, f))
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	return resp, nil
+}
@@ -0,0 +1,100 @@
+package styx
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// NumberFormat controls how values are displayed in the table writer.
+// It's display only and independent of the locale, the csv stays raw.
+type NumberFormat struct {
+	// Thousands separates groups of three digits, empty disables grouping.
+	Thousands string
+	// Decimal is the decimal mark, defaults to a dot.
+	Decimal string
+	// Precision is the number of decimal places, negative keeps all of them.
+	Precision int
+}
+
+// RawFormat displays values exactly as Prometheus formats them.
+var RawFormat = NumberFormat{Precision: -1}
+
+func (f NumberFormat) format(v float64) string {
+	if f.Thousands == "" && (f.Decimal == "" || f.Decimal == ".") && f.Precision < 0 ||
+		math.IsInf(v, 0) || math.IsNaN(v) {
+		return formatValue(v)
+	}
+
+	s := strconv.FormatFloat(math.Abs(v), 'f', f.Precision, 64)
+	intPart, fracPart := s, ""
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		intPart, fracPart = s[:i], s[i+1:]
+	}
+
+	if f.Thousands != "" {
+		var groups []string
+		for len(intPart) > 3 {
+			groups = append([]string{intPart[len(intPart)-3:]}, groups...)
+			intPart = intPart[:len(intPart)-3]
+		}
+		intPart = strings.Join(append([]string{intPart}, groups...), f.Thousands)
+	}
+
+	out := intPart
+	if fracPart != "" {
+		decimal := f.Decimal
+		if decimal == "" {
+			decimal = "."
+		}
+		out += decimal + fracPart
+	}
+	// Don't display values rounding to zero as -0
+	if v < 0 && s != strconv.FormatFloat(0, 'f', f.Precision, 64) {
+		out = "-" + out
+	}
+
+	return out
+}
+
+// TimeFormat controls how the times of samples are written in csv.
+type TimeFormat struct {
+	// Layout is unix for seconds as Prometheus returns them, unix-ms for
+	// milliseconds, rfc3339 or a layout of the time package. Empty is unix.
+	Layout string
+	// Location is the timezone times with a layout are in, UTC if it's nil.
+	Location *time.Location
+}
+
+// Valid tells if the layout is known or formats times.
+func (f TimeFormat) Valid() bool {
+	switch strings.ToLower(f.Layout) {
+	case "", "unix", "unix-ms", "rfc3339":
+		return true
+	}
+	// A layout without any element of a time would write itself.
+	return time.Unix(0, 0).Format(f.Layout) != f.Layout
+}
+
+func (f TimeFormat) format(ts int64) string {
+	layout := strings.ToLower(f.Layout)
+	if layout == "" || layout == "unix" {
+		return strconv.FormatInt(ts, 10)
+	}
+	if layout == "unix-ms" {
+		return strconv.FormatInt(ts*1000, 10)
+	}
+
+	t := time.Unix(ts, 0)
+	if f.Location != nil {
+		t = t.In(f.Location)
+	} else {
+		t = t.UTC()
+	}
+
+	if layout == "rfc3339" {
+		return t.Format(time.RFC3339Nano)
+	}
+	return t.Format(f.Layout)
+}
@@ -0,0 +1,55 @@
+package styx
+
+import (
+	"bytes"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNumberFormat(t *testing.T) {
+	// Raw values are formatted like Prometheus does
+	assert.Equal(t, "1234567.891", RawFormat.format(1234567.891))
+	assert.Equal(t, "NaN", RawFormat.format(math.NaN()))
+	assert.Equal(t, "", RawFormat.format(Missing))
+
+	f := NumberFormat{Thousands: ",", Precision: -1}
+	assert.Equal(t, "0", f.format(0))
+	assert.Equal(t, "999", f.format(999))
+	assert.Equal(t, "1,000", f.format(1000))
+	assert.Equal(t, "1,234,567.891", f.format(1234567.891))
+	assert.Equal(t, "-1,234,567", f.format(-1234567))
+	assert.Equal(t, "+Inf", f.format(math.Inf(1)))
+	assert.Equal(t, "NaN", f.format(math.NaN()))
+
+	f = NumberFormat{Thousands: ".", Decimal: ",", Precision: 2}
+	assert.Equal(t, "1.234.567,89", f.format(1234567.891))
+	assert.Equal(t, "100,00", f.format(100))
+	assert.Equal(t, "0,00", f.format(-0.001))
+
+	f = NumberFormat{Thousands: " ", Precision: 0}
+	assert.Equal(t, "1 234 568", f.format(1234567.891))
+}
+
+func TestTimeFormat(t *testing.T) {
+	assert.Equal(t, "1502749390", TimeFormat{}.format(1502749390))
+	assert.Equal(t, "1502749390", TimeFormat{Layout: "unix"}.format(1502749390))
+	assert.Equal(t, "1502749390000", TimeFormat{Layout: "unix-ms"}.format(1502749390))
+	assert.Equal(t, "2017-08-14T22:23:10Z", TimeFormat{Layout: "rfc3339"}.format(1502749390))
+
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	assert.NoError(t, err)
+	assert.Equal(t, "2017-08-15T00:23:10+02:00", TimeFormat{Layout: "rfc3339", Location: berlin}.format(1502749390))
+	assert.Equal(t, "15.08.2017 00:23", TimeFormat{Layout: "02.01.2006 15:04", Location: berlin}.format(1502749390))
+
+	assert.True(t, TimeFormat{Layout: "2006-01-02"}.Valid())
+	assert.True(t, TimeFormat{Layout: "unix-ms"}.Valid())
+	assert.False(t, TimeFormat{Layout: "iso"}.Valid())
+
+	buf := bytes.NewBuffer(nil)
+	results := []Result{{Metric: "up", Times: []int64{1502749390}, Values: []float64{1}}}
+	assert.NoError(t, CSV{Time: TimeFormat{Layout: "rfc3339"}}.Write(buf, results))
+	assert.Equal(t, "2017-08-14T22:23:10Z,1\n", buf.String())
+}
@@ -0,0 +1,29 @@
+package styx
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+)
+
+// HashResults returns a SHA-256 hash of the results, which only changes if
+// the series or their samples change. It's independent of the order of the
+// results and of map iteration, so it can be compared between runs.
+func HashResults(results []Result) string {
+	sorted := make([]Result, len(results))
+	copy(sorted, results)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return SeriesID(sorted[i]) < SeriesID(sorted[j])
+	})
+
+	h := sha256.New()
+	for _, result := range sorted {
+		fmt.Fprintf(h, "%q\n", result.Metric)
+		for j, time := range result.Times {
+			fmt.Fprintf(h, "%d %q\n", time, formatValue(result.Values[j]))
+		}
+	}
+
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,36 @@
+package styx
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHashResults(t *testing.T) {
+	res := []Result{{
+		Metric: `up{job="prometheus"}`,
+		Times:  []int64{1502749390, 1502749391, 1502749392, 1502749393},
+		Values: []float64{1, 1, 0, 1},
+	}, {
+		Metric: `up{job="node"}`,
+		Times:  []int64{1502749390, 1502749391},
+		Values: []float64{1, 0},
+	}}
+
+	// The same across runs, regardless of map iteration
+	hash := HashResults(res)
+	assert.Equal(t, "b74122d9a3aa486be38a28327a5b4a87486b33de17cc9ba0428226bf463262dd", hash)
+	for i := 0; i < 10; i++ {
+		assert.Equal(t, hash, HashResults(res))
+	}
+
+	// Independent of the order of the results
+	assert.Equal(t, hash, HashResults([]Result{res[1], res[0]}))
+	assert.Equal(t, `up{job="prometheus"}`, res[0].Metric)
+
+	// Any change of series or samples changes the hash
+	changed := []Result{res[0], {Metric: `up{job="node"}`, Times: []int64{1502749390, 1502749391}, Values: []float64{1, 1}}}
+	assert.NotEqual(t, hash, HashResults(changed))
+	assert.NotEqual(t, hash, HashResults(res[:1]))
+	assert.NotEqual(t, HashResults(nil), HashResults([]Result{{Metric: "{}"}}))
+}
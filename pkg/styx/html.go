@@ -0,0 +1,184 @@
+package styx
+
+import (
+	"bytes"
+	"html/template"
+	"io"
+	"math"
+	"time"
+)
+
+// HTMLReport writes the results as a single self-contained HTML page with
+// a line chart, to share without any tools. The chart is drawn as SVG and a
+// small inline script shows the values under the cursor and toggles series
+// by clicking their legend entry, nothing is loaded from elsewhere.
+type HTMLReport struct {
+	Title string
+	// Queries are shown below the title.
+	Queries []string
+	// Location is the time zone of the axis and values, UTC if it's not set.
+	Location *time.Location
+}
+
+// htmlData is what the script needs to show the values under the cursor.
+type htmlData struct {
+	// Times are the unix times in milliseconds, x their position.
+	Times []int64     `json:"times"`
+	X     []float64   `json:"x"`
+	Names []string    `json:"names"`
+	Text  [][]*string `json:"text"`
+	// Zone is the IANA name of the time zone, empty for the browser's.
+	Zone string `json:"zone"`
+}
+
+type htmlSeries struct {
+	Name  string
+	Color string
+}
+
+// Write writes the report of the results. Special float values and missing
+// points are gaps in the lines, the hover shows the special values.
+func (r HTMLReport) Write(w io.Writer, results []Result) error {
+	loc := r.Location
+	if loc == nil {
+		loc = time.UTC
+	}
+
+	c, err := newChart(results, "", loc, chartWidth, chartHeight, false)
+	if err != nil {
+		return err
+	}
+	var svg bytes.Buffer
+	if err := c.writeSVG(&svg, true); err != nil {
+		return err
+	}
+
+	data := htmlData{X: c.x, Zone: loc.String()}
+	if loc == time.Local {
+		// The browser's time zone, which isn't known by the name Local.
+		data.Zone = ""
+	}
+	for _, t := range c.times {
+		data.Times = append(data.Times, int64(math.Round(t*1000)))
+	}
+
+	var series []htmlSeries
+	for i, result := range results {
+		text := make([]*string, len(c.times))
+		for j, v := range c.columns.Series[i].Values {
+			if !IsMissing(v) {
+				value := formatValue(v)
+				text[j] = &value
+			}
+		}
+		data.Names = append(data.Names, result.Metric)
+		data.Text = append(data.Text, text)
+		series = append(series, htmlSeries{Name: result.Metric, Color: hexColor(c.series[i].Color)})
+	}
+
+	title := r.Title
+	if title == "" {
+		title = "styx"
+	}
+
+	return htmlTemplate.Execute(w, map[string]interface{}{
+		"Title":   title,
+		"Queries": r.Queries,
+		"Chart":   template.HTML(svg.String()),
+		"Series":  series,
+		"Data":    data,
+	})
+}
+
+var htmlTemplate = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>
+body { font-family: -apple-system, "Segoe UI", Helvetica, Arial, sans-serif; margin: 2em; color: #333; }
+h1 { font-size: 1.4em; }
+pre { background: #f5f5f5; padding: .5em; white-space: pre-wrap; }
+#legend { list-style: none; padding: 0; }
+#legend li { cursor: pointer; margin: .2em 0; }
+#legend li.hidden { opacity: .35; }
+#legend span { display: inline-block; width: 1em; height: .6em; margin-right: .5em; }
+#tooltip { position: absolute; display: none; background: rgba(255,255,255,.95); border: 1px solid #ccc; padding: .4em; pointer-events: none; font-size: 12px; }
+</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+{{range .Queries}}<pre>{{.}}</pre>
+{{end}}<div style="position: relative">
+{{.Chart}}<div id="tooltip"></div>
+</div>
+<ul id="legend">
+{{- range $i, $s := .Series}}
+<li data-series="{{$i}}"><span style="background: {{$s.Color}}"></span>{{$s.Name}}</li>
+{{- end}}
+</ul>
+<script>
+(function() {
+  var data = {{.Data}};
+  var chart = document.getElementById("chart");
+  var cursor = document.getElementById("cursor");
+  var tooltip = document.getElementById("tooltip");
+  var hidden = {};
+
+  document.querySelectorAll("#legend li").forEach(function(li) {
+    li.addEventListener("click", function() {
+      var i = li.getAttribute("data-series");
+      hidden[i] = !hidden[i];
+      li.classList.toggle("hidden", hidden[i]);
+      document.getElementById("series-" + i).style.display = hidden[i] ? "none" : "";
+    });
+  });
+
+  chart.addEventListener("mousemove", function(e) {
+    if (!data.x || data.x.length === 0) {
+      return;
+    }
+    var rect = chart.getBoundingClientRect();
+    var mx = (e.clientX - rect.left) * chart.viewBox.baseVal.width / rect.width;
+    var nearest = 0;
+    for (var j = 1; j < data.x.length; j++) {
+      if (Math.abs(data.x[j] - mx) < Math.abs(data.x[nearest] - mx)) {
+        nearest = j;
+      }
+    }
+
+    cursor.setAttribute("x1", data.x[nearest]);
+    cursor.setAttribute("x2", data.x[nearest]);
+    cursor.setAttribute("visibility", "visible");
+
+    var lines = [new Date(data.times[nearest]).toLocaleString(undefined, data.zone ? {timeZone: data.zone} : {})];
+    for (var i = 0; i < data.names.length; i++) {
+      var text = data.text[i][nearest];
+      if (hidden[i] || text === null) {
+        continue;
+      }
+      lines.push(data.names[i] + ": " + text);
+    }
+    tooltip.textContent = "";
+    lines.forEach(function(line, k) {
+      var div = document.createElement("div");
+      div.textContent = line;
+      if (k === 0) {
+        div.style.fontWeight = "bold";
+      }
+      tooltip.appendChild(div);
+    });
+    tooltip.style.display = "block";
+    tooltip.style.left = (e.clientX - rect.left + 15) + "px";
+    tooltip.style.top = (e.clientY - rect.top + 15) + "px";
+  });
+
+  chart.addEventListener("mouseleave", function() {
+    cursor.setAttribute("visibility", "hidden");
+    tooltip.style.display = "none";
+  });
+})();
+</script>
+</body>
+</html>
+`))
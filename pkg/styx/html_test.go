@@ -0,0 +1,33 @@
+package styx
+
+import (
+	"bytes"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHTMLReport(t *testing.T) {
+	results := []Result{
+		{Metric: `up{job="<script>"}`, Times: []int64{1502749200, 1502749215, 1502749230, 1502749245}, Values: []float64{0, math.Inf(1), 1, 1}},
+		{Metric: "sum(up)", Times: []int64{1502749200}, Values: []float64{2}},
+	}
+
+	buf := &bytes.Buffer{}
+	report := HTMLReport{Title: "Availability", Queries: []string{"up", "sum(up)"}}
+	assert.NoError(t, report.Write(buf, results))
+	html := buf.String()
+
+	assert.Contains(t, html, "<title>Availability</title>")
+	assert.Contains(t, html, "<pre>sum(up)</pre>")
+	// Metrics are escaped in the legend and the data of the script
+	assert.NotContains(t, html, "<script>\"")
+	assert.Contains(t, html, `up{job=&#34;&lt;script&gt;&#34;}`)
+	// The +Inf is a gap in the line, but shown on hover
+	assert.Contains(t, html, `d="M70,360M650,190L940,190"`)
+	assert.Contains(t, html, `"text":[["0","+Inf","1","1"],["2",null,null,null]]`)
+	assert.Contains(t, html, `"zone":"UTC"`)
+	assert.Equal(t, 1, strings.Count(html, "<script>"))
+}
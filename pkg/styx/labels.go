@@ -0,0 +1,125 @@
+package styx
+
+import (
+	"bytes"
+	"sort"
+	"strings"
+	"text/template"
+)
+
+// labelKeys returns the sorted union of the label names of all results,
+// including __name__ for results having a metric name.
+func labelKeys(results []Result) []string {
+	keysMap := make(map[string]bool)
+	for _, result := range results {
+		for key := range result.Labels {
+			keysMap[key] = true
+		}
+	}
+
+	var keys []string
+	for key := range keysMap {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+// LabelMapping translates the labels of results into the tags of export
+// backends, so each export writer doesn't have to do it on its own.
+type LabelMapping struct {
+	// Rename maps label names to the tag names used instead.
+	Rename map[string]string
+	// Drop lists the labels not to export, by their original name.
+	Drop []string
+	// Invalid holds the characters the backend doesn't allow in tags,
+	// they are replaced with Replacement.
+	Invalid     string
+	Replacement string
+}
+
+// apply returns the renamed and sanitized tags of labels without the metric name.
+func (m LabelMapping) apply(labels map[string]string) map[string]string {
+	tags := make(map[string]string, len(labels))
+
+	for key, value := range labels {
+		if key == "__name__" || m.dropped(key) {
+			continue
+		}
+		if rename, ok := m.Rename[key]; ok {
+			key = rename
+		}
+		tags[m.sanitize(key)] = m.sanitize(value)
+	}
+
+	return tags
+}
+
+func (m LabelMapping) dropped(key string) bool {
+	for _, drop := range m.Drop {
+		if drop == key {
+			return true
+		}
+	}
+	return false
+}
+
+// sanitize replaces all invalid characters of s.
+func (m LabelMapping) sanitize(s string) string {
+	if m.Invalid == "" || !strings.ContainsAny(s, m.Invalid) {
+		return s
+	}
+
+	var buf bytes.Buffer
+	for _, r := range s {
+		if strings.ContainsRune(m.Invalid, r) {
+			buf.WriteString(m.Replacement)
+			continue
+		}
+		buf.WriteRune(r)
+	}
+	return buf.String()
+}
+
+// DropLabels returns copies of the results without the labels, named by
+// the remaining ones like Prometheus names series. Results that had none
+// of the labels keep their name.
+func DropLabels(results []Result, drop []string) []Result {
+	m := LabelMapping{Drop: drop}
+	dropped := make([]Result, len(results))
+	for i, result := range results {
+		dropped[i] = result
+		labels := make(map[string]string, len(result.Labels))
+		for key, value := range result.Labels {
+			if !m.dropped(key) {
+				labels[key] = value
+			}
+		}
+		if len(labels) != len(result.Labels) {
+			dropped[i].Metric, dropped[i].Labels = metricName(labels), labels
+		}
+	}
+	return dropped
+}
+
+// NameSeries returns copies of the results named by executing the template
+// with their labels, e.g. {{.pod}}-{{.container}} to get readable column
+// names. Results without labels keep their name. Parse the template with
+// missingkey=zero for labels a result lacks to be empty.
+func NameSeries(results []Result, tmpl *template.Template) ([]Result, error) {
+	named := make([]Result, len(results))
+	for i, result := range results {
+		named[i] = result
+		if len(result.Labels) == 0 {
+			continue
+		}
+
+		var buf bytes.Buffer
+		if err := tmpl.Execute(&buf, result.Labels); err != nil {
+			return nil, err
+		}
+		named[i].Metric = buf.String()
+	}
+	return named, nil
+}
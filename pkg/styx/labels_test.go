@@ -0,0 +1,101 @@
+package styx
+
+import (
+	"testing"
+	"text/template"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLabelKeys(t *testing.T) {
+	assert.Len(t, labelKeys(nil), 0)
+
+	res := []Result{{
+		Labels: map[string]string{"__name__": "up", "job": "prometheus", "instance": "localhost:9090"},
+	}, {
+		Labels: map[string]string{"job": "node", "mode": "idle"},
+	}, {
+		Labels: nil,
+	}}
+	assert.Equal(t, []string{"__name__", "instance", "job", "mode"}, labelKeys(res))
+}
+
+func TestLabelMappingSanitize(t *testing.T) {
+	m := LabelMapping{}
+	assert.Equal(t, "foo bar.baz", m.sanitize("foo bar.baz"))
+
+	m = LabelMapping{Invalid: " .", Replacement: "_"}
+	assert.Equal(t, "foo_bar_baz", m.sanitize("foo bar.baz"))
+	assert.Equal(t, "localhost:9090", m.sanitize("localhost:9090"))
+	assert.Equal(t, "__", m.sanitize(" ."))
+
+	// Without replacement invalid characters are removed
+	m = LabelMapping{Invalid: " .,"}
+	assert.Equal(t, "foobarbaz", m.sanitize("foo bar.baz,"))
+
+	assert.Equal(t, "a_b_c", DatadogLabels.sanitize("a b,c"))
+}
+
+func TestLabelMappingApply(t *testing.T) {
+	labels := map[string]string{
+		"__name__": "go_goroutines",
+		"instance": "host.example.com:9090",
+		"job":      "prometheus",
+		"pod name": "web-1",
+	}
+
+	m := LabelMapping{}
+	assert.Equal(t, map[string]string{
+		"instance": "host.example.com:9090",
+		"job":      "prometheus",
+		"pod name": "web-1",
+	}, m.apply(labels))
+
+	m = LabelMapping{
+		Rename:      map[string]string{"instance": "host"},
+		Drop:        []string{"job"},
+		Invalid:     " .",
+		Replacement: "_",
+	}
+	assert.Equal(t, map[string]string{
+		"host":     "host_example_com:9090",
+		"pod_name": "web-1",
+	}, m.apply(labels))
+
+	// The input is left untouched
+	assert.Len(t, labels, 4)
+	assert.Len(t, m.apply(nil), 0)
+}
+
+func TestDropLabels(t *testing.T) {
+	res := []Result{
+		{Metric: `up{instance="a",job="node"}`, Labels: map[string]string{"__name__": "up", "instance": "a", "job": "node"}},
+		{Metric: `{pod="p"}`, Labels: map[string]string{"pod": "p"}},
+		{Metric: "sum(up)", Labels: map[string]string{}},
+	}
+
+	dropped := DropLabels(res, []string{"instance", "job"})
+	assert.Equal(t, "up", dropped[0].Metric)
+	assert.Equal(t, map[string]string{"__name__": "up"}, dropped[0].Labels)
+	assert.Equal(t, `{pod="p"}`, dropped[1].Metric)
+	assert.Equal(t, "sum(up)", dropped[2].Metric)
+
+	// The input is left untouched
+	assert.Len(t, res[0].Labels, 3)
+}
+
+func TestNameSeries(t *testing.T) {
+	res := []Result{
+		{Metric: `{container="c",pod="p"}`, Labels: map[string]string{"container": "c", "pod": "p"}},
+		{Metric: `{pod="q"}`, Labels: map[string]string{"pod": "q"}},
+		{Metric: "sum(up)", Labels: map[string]string{}},
+	}
+
+	tmpl := template.Must(template.New("").Option("missingkey=zero").Parse("{{.pod}}-{{.container}}"))
+	named, err := NameSeries(res, tmpl)
+	assert.NoError(t, err)
+	assert.Equal(t, "p-c", named[0].Metric)
+	assert.Equal(t, "q-", named[1].Metric)
+	assert.Equal(t, "sum(up)", named[2].Metric)
+	assert.Equal(t, `{container="c",pod="p"}`, res[0].Metric)
+}
@@ -0,0 +1,81 @@
+package styx
+
+import (
+	"encoding/json"
+	"io"
+	"math"
+	"strconv"
+)
+
+// MatrixWriter writes the results as the matrix of a Prometheus response,
+// every series keeps its labels next to its [timestamp, value] pairs.
+// The series stay in query order and their values are sorted by time.
+func MatrixWriter(w io.Writer, results []Result) error {
+	var resp promResponse
+	resp.Status = "success"
+	resp.Data.ResultType = "matrix"
+	resp.Data.Result = []promSeries{}
+
+	for _, result := range results {
+		metric := result.Labels
+		if metric == nil {
+			metric = map[string]string{}
+		}
+
+		values := make([][]interface{}, 0, len(result.Times))
+		for j, time := range result.Times {
+			if IsMissing(result.Values[j]) {
+				continue
+			}
+			values = append(values, []interface{}{time, formatValue(result.Values[j])})
+		}
+
+		resp.Data.Result = append(resp.Data.Result, promSeries{Metric: metric, Values: values})
+	}
+
+	return json.NewEncoder(w).Encode(resp)
+}
+
+// jsonSeries is a result in the json format.
+type jsonSeries struct {
+	Metric string            `json:"metric"`
+	Labels map[string]string `json:"labels"`
+	Values []jsonSample      `json:"values"`
+}
+
+type jsonSample struct {
+	Time int64 `json:"time"`
+	// Value is a number, but a string for NaN and infinities which JSON lacks.
+	Value interface{} `json:"value"`
+}
+
+// JSONWriter writes the results as an array of series with their metric,
+// labels and samples sorted by time, which is easy to process with jq.
+func JSONWriter(w io.Writer, results []Result) error {
+	series := make([]jsonSeries, 0, len(results))
+
+	for _, result := range results {
+		labels := result.Labels
+		if labels == nil {
+			labels = map[string]string{}
+		}
+
+		samples := make([]jsonSample, 0, len(result.Times))
+		for j, time := range result.Times {
+			v := result.Values[j]
+			if IsMissing(v) {
+				continue
+			}
+
+			sample := jsonSample{Time: time, Value: formatValue(v)}
+			if !math.IsNaN(v) && !math.IsInf(v, 0) {
+				sample.Value = json.Number(strconv.FormatFloat(v, 'g', -1, 64))
+			}
+			samples = append(samples, sample)
+		}
+
+		series = append(series, jsonSeries{Metric: result.Metric, Labels: labels, Values: samples})
+	}
+
+	return json.NewEncoder(w).Encode(series)
+}
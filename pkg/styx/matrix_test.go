@@ -0,0 +1,77 @@
+package styx
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMatrixWriter(t *testing.T) {
+	// No results
+	buf := bytes.NewBuffer(nil)
+	assert.NoError(t, MatrixWriter(buf, nil))
+	assert.Equal(t, `{"status":"success","data":{"resultType":"matrix","result":[]}}`+"\n", buf.String())
+
+	res := []Result{{
+		Metric: `up{job="prometheus"}`,
+		Labels: map[string]string{"job": "prometheus", "__name__": "up"},
+		Times:  []int64{999999999, 1502749390, 1502749391},
+		Values: []float64{0, math.NaN(), 1},
+	}, {
+		Metric: "{}",
+		Times:  []int64{1502749390},
+		Values: []float64{2},
+	}}
+	expected := `{"status":"success","data":{"resultType":"matrix","result":[` +
+		`{"metric":{"__name__":"up","job":"prometheus"},"values":[[999999999,"0"],[1502749390,"NaN"],[1502749391,"1"]]},` +
+		`{"metric":{},"values":[[1502749390,"2"]]}]}}` + "\n"
+	buf = bytes.NewBuffer(nil)
+	assert.NoError(t, MatrixWriter(buf, res))
+	assert.Equal(t, expected, buf.String())
+}
+
+func TestMatrixWriterRoundTrip(t *testing.T) {
+	opts := Options{Transport: ReplayTransport{Path: "testdata/query_range.json"}}
+	results, err := Query("http://localhost:9090", time.Unix(1502749000, 0), time.Unix(1502752600, 0), "go_goroutines", opts)
+	assert.NoError(t, err)
+
+	buf := bytes.NewBuffer(nil)
+	assert.NoError(t, MatrixWriter(buf, results))
+
+	// The series and samples are the ones of the original response.
+	var got, want promResponse
+	assert.NoError(t, json.Unmarshal(buf.Bytes(), &got))
+	fixture, err := ioutil.ReadFile("testdata/query_range.json")
+	assert.NoError(t, err)
+	assert.NoError(t, json.Unmarshal(fixture, &want))
+	assert.Equal(t, want.Data.Result, got.Data.Result)
+}
+
+func TestJSONWriter(t *testing.T) {
+	// No results
+	buf := bytes.NewBuffer(nil)
+	assert.NoError(t, JSONWriter(buf, nil))
+	assert.Equal(t, "[]\n", buf.String())
+
+	res := []Result{{
+		Metric: `up{job="prometheus"}`,
+		Labels: map[string]string{"job": "prometheus", "__name__": "up"},
+		Times:  []int64{999999999, 1502749390, 1502749391, 1502749392},
+		Values: []float64{0.5, math.NaN(), math.Inf(1), Missing},
+	}, {
+		Metric: "{}",
+		Times:  []int64{1502749390},
+		Values: []float64{1e3},
+	}}
+	expected := `[{"metric":"up{job=\"prometheus\"}","labels":{"__name__":"up","job":"prometheus"},"values":[` +
+		`{"time":999999999,"value":0.5},{"time":1502749390,"value":"NaN"},{"time":1502749391,"value":"+Inf"}]},` +
+		`{"metric":"{}","labels":{},"values":[{"time":1502749390,"value":1000}]}]` + "\n"
+	buf = bytes.NewBuffer(nil)
+	assert.NoError(t, JSONWriter(buf, res))
+	assert.Equal(t, expected, buf.String())
+}
@@ -0,0 +1,50 @@
+package styx
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+)
+
+// NPYWriter writes the results as NumPy .npy file holding a float64 matrix
+// with the time in the first column and one column per result, like the csv.
+// Special float tokens become IEEE infinities and NaN, missing points NaN.
+func NPYWriter(w io.Writer, results []Result) error {
+	columns := NewColumns(results)
+	times := columns.Times
+
+	data := make([]float64, 0, len(times)*(len(results)+1))
+	for j, time := range times {
+		data = append(data, float64(time))
+
+		for _, series := range columns.Series {
+			v := series.Values[j]
+			if IsMissing(v) {
+				v = math.NaN()
+			}
+			data = append(data, v)
+		}
+	}
+
+	header := fmt.Sprintf("{'descr': '<f8', 'fortran_order': False, 'shape': (%d, %d), }", len(times), len(results)+1)
+
+	// The data has to start 64 byte aligned, after magic, version and header length.
+	preamble := 6 + 2 + 2
+	padding := 64 - (preamble+len(header)+1)%64
+	if padding == 64 {
+		padding = 0
+	}
+	header += strings.Repeat(" ", padding) + "\n"
+
+	buf := bytes.NewBufferString("\x93NUMPY\x01\x00")
+	binary.Write(buf, binary.LittleEndian, uint16(len(header)))
+	buf.WriteString(header)
+	if _, err := buf.WriteTo(w); err != nil {
+		return err
+	}
+
+	return binary.Write(w, binary.LittleEndian, data)
+}
@@ -0,0 +1,77 @@
+package styx
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// metricNameRe matches valid metric names.
+var metricNameRe = regexp.MustCompile(`^[a-zA-Z_:][a-zA-Z0-9_:]*$`)
+
+// OpenMetricsWriter writes the results in the OpenMetrics text format with
+// a timestamp on every sample, which promtool tsdb create-blocks-from
+// openmetrics backfills into a Prometheus TSDB. Results without a valid
+// metric name, like the result of sum(), are written as name. Series of the
+// same metric are written together as the format requires, their samples
+// in order of time.
+func OpenMetricsWriter(w io.Writer, results []Result, name string) error {
+	if !metricNameRe.MatchString(name) {
+		return fmt.Errorf("invalid metric name: %s", name)
+	}
+
+	names := make([]string, len(results))
+	order := make([]int, len(results))
+	for i, result := range results {
+		names[i] = result.Labels["__name__"]
+		if !metricNameRe.MatchString(names[i]) {
+			names[i] = name
+		}
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool { return names[order[a]] < names[order[b]] })
+
+	bw := bufio.NewWriter(w)
+	family := ""
+	for _, i := range order {
+		if names[i] != family {
+			family = names[i]
+			fmt.Fprintf(bw, "# TYPE %s unknown\n", family)
+		}
+
+		series := names[i] + openMetricsLabels(results[i].Labels)
+		for j, time := range results[i].Times {
+			if v := results[i].Values[j]; !IsMissing(v) {
+				fmt.Fprintf(bw, "%s %s %d\n", series, formatValue(v), time)
+			}
+		}
+	}
+	bw.WriteString("# EOF\n")
+
+	return bw.Flush()
+}
+
+// openMetricsLabels returns the labels without the metric name sorted by
+// name, like {a="b",c="d"}, or nothing if there are none.
+func openMetricsLabels(labels map[string]string) string {
+	var keys []string
+	for key, value := range labels {
+		if key != "__name__" && value != "" {
+			keys = append(keys, key)
+		}
+	}
+	if len(keys) == 0 {
+		return ""
+	}
+	sort.Strings(keys)
+
+	escaper := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	pairs := make([]string, len(keys))
+	for i, key := range keys {
+		pairs[i] = key + `="` + escaper.Replace(labels[key]) + `"`
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
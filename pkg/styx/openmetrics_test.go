@@ -0,0 +1,45 @@
+package styx
+
+import (
+	"bytes"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOpenMetricsWriter(t *testing.T) {
+	// No results
+	buf := bytes.NewBuffer(nil)
+	assert.NoError(t, OpenMetricsWriter(buf, nil, "query_result"))
+	assert.Equal(t, "# EOF\n", buf.String())
+
+	res := []Result{{
+		Metric: `up{job="node"}`,
+		Labels: map[string]string{"__name__": "up", "job": "node", "path": "C:\\a \"b\"\n"},
+		Times:  []int64{998, 1502749390, 1502749391},
+		Values: []float64{0, 1, Missing},
+	}, {
+		Metric: "sum(go_goroutines)",
+		Labels: map[string]string{},
+		Times:  []int64{1502749390},
+		Values: []float64{math.Inf(1)},
+	}, {
+		Metric: `up{job="prometheus"}`,
+		Labels: map[string]string{"__name__": "up", "job": "prometheus"},
+		Times:  []int64{1502749390},
+		Values: []float64{math.NaN()},
+	}}
+	expected := "# TYPE query_result unknown\n" +
+		"query_result +Inf 1502749390\n" +
+		"# TYPE up unknown\n" +
+		`up{job="node",path="C:\\a \"b\"\n"} 0 998` + "\n" +
+		`up{job="node",path="C:\\a \"b\"\n"} 1 1502749390` + "\n" +
+		`up{job="prometheus"} NaN 1502749390` + "\n" +
+		"# EOF\n"
+	buf = bytes.NewBuffer(nil)
+	assert.NoError(t, OpenMetricsWriter(buf, res, "query_result"))
+	assert.Equal(t, expected, buf.String())
+
+	assert.Error(t, OpenMetricsWriter(buf, res, "query result"))
+}
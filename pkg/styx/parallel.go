@@ -0,0 +1,55 @@
+package styx
+
+import "sync"
+
+// Parallel calls fn with every index from 0 to n-1, at most parallelism
+// calls at once, or one after another if parallelism is below two. Callers
+// keep the order deterministic by storing results at their index. Once a
+// call fails no further calls are started, the error of the lowest failing
+// index is returned.
+func Parallel(n, parallelism int, fn func(i int) error) error {
+	if parallelism < 1 {
+		parallelism = 1
+	}
+	if parallelism > n {
+		parallelism = n
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	next, failed := 0, -1
+	errs := make([]error, n)
+	for w := 0; w < parallelism; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				mu.Lock()
+				i := next
+				if i >= n || failed >= 0 {
+					mu.Unlock()
+					return
+				}
+				next++
+				mu.Unlock()
+
+				if err := fn(i); err != nil {
+					mu.Lock()
+					errs[i] = err
+					if failed < 0 || i < failed {
+						failed = i
+					}
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
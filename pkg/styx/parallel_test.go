@@ -0,0 +1,45 @@
+package styx
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParallel(t *testing.T) {
+	var running, most int32
+	out := make([]int, 10)
+	err := Parallel(len(out), 3, func(i int) error {
+		n := atomic.AddInt32(&running, 1)
+		defer atomic.AddInt32(&running, -1)
+		for {
+			m := atomic.LoadInt32(&most)
+			if n <= m || atomic.CompareAndSwapInt32(&most, m, n) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+		out[i] = i * i
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []int{0, 1, 4, 9, 16, 25, 36, 49, 64, 81}, out)
+	assert.True(t, most > 1 && most <= 3, "ran %d at once", most)
+
+	// The error of the first failing index wins and no calls start after it.
+	var calls int32
+	err = Parallel(100, 1, func(i int) error {
+		atomic.AddInt32(&calls, 1)
+		if i >= 2 {
+			return errors.New(string(rune('a' + i)))
+		}
+		return nil
+	})
+	assert.EqualError(t, err, "c")
+	assert.Equal(t, int32(3), calls)
+
+	assert.NoError(t, Parallel(0, 4, func(int) error { return errors.New("called") }))
+}
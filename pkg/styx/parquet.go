@@ -0,0 +1,369 @@
+package styx
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"io"
+	"math"
+)
+
+// The parts of the Parquet format used, see parquet.thrift.
+const (
+	parquetMagic = "PAR1"
+
+	parquetInt64     = 2
+	parquetDouble    = 5
+	parquetByteArray = 6
+
+	parquetRequired = 0
+	parquetOptional = 1
+
+	parquetUTF8            = 0
+	parquetTimestampMillis = 9
+
+	parquetPlain = 0
+	parquetRLE   = 3
+
+	parquetGzip     = 2
+	parquetDataPage = 0
+)
+
+// ParquetWriter writes the results as Apache Parquet file with the time in
+// the first column and one column per result, named after its metric, like
+// the csv. Times are timestamps in milliseconds and values doubles, special
+// float tokens become IEEE infinities and NaN, missing points are null.
+func ParquetWriter(w io.Writer, results []Result) error {
+	series := NewColumns(results)
+
+	columns := []*parquetColumn{{name: "Time", typ: parquetInt64, converted: parquetTimestampMillis}}
+	for _, result := range results {
+		columns = append(columns, &parquetColumn{name: result.Metric, typ: parquetDouble, converted: -1, optional: true})
+	}
+
+	for j, time := range series.Times {
+		columns[0].addTime(time)
+		for i, s := range series.Series {
+			if IsMissing(s.Values[j]) {
+				columns[i+1].addNull()
+				continue
+			}
+			columns[i+1].addDouble(s.Values[j])
+		}
+	}
+
+	return writeParquet(w, len(series.Times), columns)
+}
+
+// TidyParquetWriter writes one row per sample with the time, a column per
+// label and the value, like TidyCSVWriter. Labels a result doesn't have are
+// null.
+func TidyParquetWriter(w io.Writer, results []Result) error {
+	keys := labelKeys(results)
+
+	columns := []*parquetColumn{{name: "Time", typ: parquetInt64, converted: parquetTimestampMillis}}
+	for _, key := range keys {
+		columns = append(columns, &parquetColumn{name: key, typ: parquetByteArray, converted: parquetUTF8, optional: true})
+	}
+	value := &parquetColumn{name: "Value", typ: parquetDouble, converted: -1}
+	columns = append(columns, value)
+
+	rows := 0
+	for _, time := range sortedTimes(results) {
+		for _, result := range results {
+			v, ok := result.At(time)
+			if !ok {
+				continue
+			}
+
+			columns[0].addTime(time)
+			for i, key := range keys {
+				label, ok := result.Labels[key]
+				if !ok {
+					columns[i+1].addNull()
+					continue
+				}
+				columns[i+1].addString(label)
+			}
+			if IsMissing(v) {
+				v = math.NaN()
+			}
+			value.addDouble(v)
+			rows++
+		}
+	}
+
+	return writeParquet(w, rows, columns)
+}
+
+// parquetColumn collects the values of a column in the plain encoding.
+type parquetColumn struct {
+	name      string
+	typ       int32
+	converted int32 // -1 if there is no converted type
+	optional  bool
+
+	// present tells which rows of optional columns aren't null.
+	present []bool
+	data    bytes.Buffer
+}
+
+func (c *parquetColumn) addNull() {
+	c.present = append(c.present, false)
+}
+
+func (c *parquetColumn) add() {
+	if c.optional {
+		c.present = append(c.present, true)
+	}
+}
+
+// addTime adds a unix timestamp in seconds as milliseconds.
+func (c *parquetColumn) addTime(time int64) {
+	c.add()
+	binary.Write(&c.data, binary.LittleEndian, time*1000)
+}
+
+func (c *parquetColumn) addDouble(v float64) {
+	c.add()
+	binary.Write(&c.data, binary.LittleEndian, math.Float64bits(v))
+}
+
+func (c *parquetColumn) addString(s string) {
+	c.add()
+	binary.Write(&c.data, binary.LittleEndian, uint32(len(s)))
+	c.data.WriteString(s)
+}
+
+// page returns the values of a data page, preceded by the definition levels
+// of optional columns. Null values aren't stored, only their level of 0.
+func (c *parquetColumn) page() []byte {
+	if !c.optional {
+		return c.data.Bytes()
+	}
+
+	// The levels are encoded as runs of the RLE/bit-packing hybrid, with
+	// a bit width of 1 a run's value fits into a byte.
+	var levels bytes.Buffer
+	for i := 0; i < len(c.present); {
+		j := i
+		for j < len(c.present) && c.present[j] == c.present[i] {
+			j++
+		}
+		putUvarint(&levels, uint64(j-i)<<1)
+		if c.present[i] {
+			levels.WriteByte(1)
+		} else {
+			levels.WriteByte(0)
+		}
+		i = j
+	}
+
+	var page bytes.Buffer
+	binary.Write(&page, binary.LittleEndian, uint32(levels.Len()))
+	levels.WriteTo(&page)
+	page.Write(c.data.Bytes())
+	return page.Bytes()
+}
+
+// writeParquet writes a file with a single row group, every column is a
+// single gzip compressed data page.
+func writeParquet(w io.Writer, rows int, columns []*parquetColumn) error {
+	bw := bufio.NewWriter(w)
+	bw.WriteString(parquetMagic)
+
+	type chunk struct {
+		offset       int64
+		uncompressed int64
+		compressed   int64
+	}
+	chunks := make([]chunk, len(columns))
+	offset := int64(len(parquetMagic))
+
+	for i, column := range columns {
+		page := column.page()
+
+		var compressed bytes.Buffer
+		zw := gzip.NewWriter(&compressed)
+		zw.Write(page)
+		if err := zw.Close(); err != nil {
+			return err
+		}
+
+		var header thriftWriter
+		header.i32(1, parquetDataPage)
+		header.i32(2, int32(len(page)))
+		header.i32(3, int32(compressed.Len()))
+		header.begin(5)
+		header.i32(1, int32(rows))
+		header.i32(2, parquetPlain)
+		header.i32(3, parquetRLE)
+		header.i32(4, parquetRLE)
+		header.end()
+		header.end()
+
+		chunks[i] = chunk{
+			offset:       offset,
+			uncompressed: int64(header.Len() + len(page)),
+			compressed:   int64(header.Len() + compressed.Len()),
+		}
+		offset += chunks[i].compressed
+
+		header.WriteTo(bw)
+		compressed.WriteTo(bw)
+	}
+
+	var meta thriftWriter
+	meta.i32(1, 1)
+
+	meta.list(2, thriftStruct, len(columns)+1)
+	meta.begin(0)
+	meta.str(4, "schema")
+	meta.i32(5, int32(len(columns)))
+	meta.end()
+	for _, column := range columns {
+		meta.begin(0)
+		meta.i32(1, column.typ)
+		if column.optional {
+			meta.i32(3, parquetOptional)
+		} else {
+			meta.i32(3, parquetRequired)
+		}
+		meta.str(4, column.name)
+		if column.converted >= 0 {
+			meta.i32(6, column.converted)
+		}
+		meta.end()
+	}
+
+	meta.i64(3, int64(rows))
+
+	var total int64
+	for _, chunk := range chunks {
+		total += chunk.uncompressed
+	}
+	meta.list(4, thriftStruct, 1)
+	meta.begin(0)
+	meta.list(1, thriftStruct, len(columns))
+	for i, column := range columns {
+		meta.begin(0)
+		meta.i64(2, chunks[i].offset)
+		meta.begin(3)
+		meta.i32(1, column.typ)
+		meta.list(2, thriftI32, 2)
+		meta.listI32(parquetPlain)
+		meta.listI32(parquetRLE)
+		meta.list(3, thriftBinary, 1)
+		meta.listString(column.name)
+		meta.i32(4, parquetGzip)
+		meta.i64(5, int64(rows))
+		meta.i64(6, chunks[i].uncompressed)
+		meta.i64(7, chunks[i].compressed)
+		meta.i64(9, chunks[i].offset)
+		meta.end()
+		meta.end()
+	}
+	meta.i64(2, total)
+	meta.i64(3, int64(rows))
+	meta.end()
+
+	meta.str(6, "styx")
+	meta.end()
+
+	// The footer is the metadata followed by its length.
+	length := uint32(meta.Len())
+	meta.WriteTo(bw)
+	binary.Write(bw, binary.LittleEndian, length)
+	bw.WriteString(parquetMagic)
+	return bw.Flush()
+}
+
+// The types of the Thrift compact protocol.
+const (
+	thriftI32    = 5
+	thriftI64    = 6
+	thriftBinary = 8
+	thriftList   = 9
+	thriftStruct = 12
+)
+
+// thriftWriter encodes a struct in the Thrift compact protocol, which
+// Parquet uses for its metadata. Fields have to be written in order.
+type thriftWriter struct {
+	bytes.Buffer
+	last  int16
+	stack []int16
+}
+
+func (t *thriftWriter) field(id int16, typ byte) {
+	if delta := id - t.last; delta > 0 && delta <= 15 {
+		t.WriteByte(byte(delta)<<4 | typ)
+	} else {
+		t.WriteByte(typ)
+		putZigzag(&t.Buffer, int64(id))
+	}
+	t.last = id
+}
+
+func (t *thriftWriter) i32(id int16, v int32) {
+	t.field(id, thriftI32)
+	putZigzag(&t.Buffer, int64(v))
+}
+
+func (t *thriftWriter) i64(id int16, v int64) {
+	t.field(id, thriftI64)
+	putZigzag(&t.Buffer, v)
+}
+
+func (t *thriftWriter) str(id int16, s string) {
+	t.field(id, thriftBinary)
+	t.listString(s)
+}
+
+// list writes the header of a list of n elements of typ, which follow.
+func (t *thriftWriter) list(id int16, typ byte, n int) {
+	t.field(id, thriftList)
+	if n < 15 {
+		t.WriteByte(byte(n)<<4 | typ)
+		return
+	}
+	t.WriteByte(0xf0 | typ)
+	putUvarint(&t.Buffer, uint64(n))
+}
+
+func (t *thriftWriter) listI32(v int32) {
+	putZigzag(&t.Buffer, int64(v))
+}
+
+func (t *thriftWriter) listString(s string) {
+	putUvarint(&t.Buffer, uint64(len(s)))
+	t.WriteString(s)
+}
+
+// begin starts a struct in the field id, or as element of a list if id is 0.
+func (t *thriftWriter) begin(id int16) {
+	if id != 0 {
+		t.field(id, thriftStruct)
+	}
+	t.stack = append(t.stack, t.last)
+	t.last = 0
+}
+
+// end ends the struct begun last, or the outermost struct.
+func (t *thriftWriter) end() {
+	t.WriteByte(0)
+	if len(t.stack) > 0 {
+		t.last = t.stack[len(t.stack)-1]
+		t.stack = t.stack[:len(t.stack)-1]
+	}
+}
+
+func putUvarint(buf *bytes.Buffer, v uint64) {
+	var b [binary.MaxVarintLen64]byte
+	buf.Write(b[:binary.PutUvarint(b[:], v)])
+}
+
+func putZigzag(buf *bytes.Buffer, v int64) {
+	putUvarint(buf, uint64(v<<1^v>>63))
+}
@@ -0,0 +1,143 @@
+package styx
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"io/ioutil"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// thriftRead decodes a struct of the Thrift compact protocol into a map of
+// field ids to int64, []byte, lists and maps of nested structs.
+func thriftRead(r *bytes.Reader) map[int16]interface{} {
+	fields := make(map[int16]interface{})
+	var last int16
+	for {
+		b, _ := r.ReadByte()
+		if b == 0 {
+			return fields
+		}
+		typ := b & 0x0f
+		if delta := int16(b >> 4); delta != 0 {
+			last += delta
+		} else {
+			id, _ := binary.ReadVarint(r)
+			last = int16(id)
+		}
+		fields[last] = thriftValue(r, typ)
+	}
+}
+
+func thriftValue(r *bytes.Reader, typ byte) interface{} {
+	switch typ {
+	case thriftI32, thriftI64:
+		v, _ := binary.ReadVarint(r)
+		return v
+	case thriftBinary:
+		n, _ := binary.ReadUvarint(r)
+		b := make([]byte, n)
+		r.Read(b)
+		return b
+	case thriftList:
+		b, _ := r.ReadByte()
+		n := uint64(b >> 4)
+		if n == 15 {
+			n, _ = binary.ReadUvarint(r)
+		}
+		list := make([]interface{}, n)
+		for i := range list {
+			list[i] = thriftValue(r, b&0x0f)
+		}
+		return list
+	case thriftStruct:
+		return thriftRead(r)
+	}
+	panic("unexpected thrift type")
+}
+
+// parquetRead returns the metadata of a Parquet file and the uncompressed
+// pages of its columns.
+func parquetRead(t *testing.T, data []byte) (map[int16]interface{}, [][]byte) {
+	assert.Equal(t, parquetMagic, string(data[:4]))
+	assert.Equal(t, parquetMagic, string(data[len(data)-4:]))
+	length := binary.LittleEndian.Uint32(data[len(data)-8:])
+	meta := thriftRead(bytes.NewReader(data[len(data)-8-int(length) : len(data)-8]))
+
+	var pages [][]byte
+	group := meta[4].([]interface{})[0].(map[int16]interface{})
+	for _, c := range group[1].([]interface{}) {
+		column := c.(map[int16]interface{})[3].(map[int16]interface{})
+		r := bytes.NewReader(data[column[9].(int64):])
+		header := thriftRead(r)
+		compressed := make([]byte, header[3].(int64))
+		r.Read(compressed)
+
+		zr, err := gzip.NewReader(bytes.NewReader(compressed))
+		assert.NoError(t, err)
+		page, err := ioutil.ReadAll(zr)
+		assert.NoError(t, err)
+		assert.Equal(t, header[2].(int64), int64(len(page)))
+		pages = append(pages, page)
+	}
+	return meta, pages
+}
+
+func TestParquetWriter(t *testing.T) {
+	results := []Result{
+		{Metric: `up{job="a"}`, Times: []int64{1502749200, 1502749215}, Values: []float64{1, math.Inf(1)}},
+		{Metric: `up{job="b"}`, Times: []int64{1502749215}, Values: []float64{0.5}},
+	}
+
+	buf := &bytes.Buffer{}
+	assert.NoError(t, ParquetWriter(buf, results))
+	meta, pages := parquetRead(t, buf.Bytes())
+
+	assert.Equal(t, int64(2), meta[3])
+	schema := meta[2].([]interface{})
+	assert.Len(t, schema, 4)
+	assert.Equal(t, int64(3), schema[0].(map[int16]interface{})[5])
+	var names []string
+	for _, element := range schema[1:] {
+		names = append(names, string(element.(map[int16]interface{})[4].([]byte)))
+	}
+	assert.Equal(t, []string{"Time", `up{job="a"}`, `up{job="b"}`}, names)
+	assert.Equal(t, int64(parquetTimestampMillis), schema[1].(map[int16]interface{})[6])
+
+	// The required time column has only the plain values
+	assert.Equal(t, 16, len(pages[0]))
+	assert.Equal(t, int64(1502749200000), int64(binary.LittleEndian.Uint64(pages[0])))
+	assert.Equal(t, int64(1502749215000), int64(binary.LittleEndian.Uint64(pages[0][8:])))
+
+	// Optional columns are preceded by the runs of definition levels
+	assert.Equal(t, []byte{2, 0, 0, 0, 4, 1}, pages[1][:6])
+	assert.True(t, math.IsInf(math.Float64frombits(binary.LittleEndian.Uint64(pages[1][14:])), 1))
+	assert.Equal(t, []byte{4, 0, 0, 0, 2, 0, 2, 1}, pages[2][:8])
+	assert.Equal(t, 0.5, math.Float64frombits(binary.LittleEndian.Uint64(pages[2][8:])))
+}
+
+func TestTidyParquetWriter(t *testing.T) {
+	results := []Result{
+		{Metric: `up{job="a"}`, Labels: map[string]string{"job": "a"}, Times: []int64{1502749200}, Values: []float64{1}},
+		{Metric: `up{instance="b"}`, Labels: map[string]string{"instance": "b"}, Times: []int64{1502749200}, Values: []float64{0}},
+	}
+
+	buf := &bytes.Buffer{}
+	assert.NoError(t, TidyParquetWriter(buf, results))
+	meta, pages := parquetRead(t, buf.Bytes())
+
+	assert.Equal(t, int64(2), meta[3])
+	var names []string
+	for _, element := range meta[2].([]interface{})[1:] {
+		names = append(names, string(element.(map[int16]interface{})[4].([]byte)))
+	}
+	assert.Equal(t, []string{"Time", "instance", "job", "Value"}, names)
+
+	// A run of one null, then one b
+	assert.Equal(t, []byte{4, 0, 0, 0, 2, 0, 2, 1, 1, 0, 0, 0, 'b'}, pages[1])
+	assert.Equal(t, []byte{4, 0, 0, 0, 2, 1, 2, 0, 1, 0, 0, 0, 'a'}, pages[2])
+	assert.Equal(t, 16, len(pages[3]))
+}
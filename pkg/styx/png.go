@@ -0,0 +1,171 @@
+package styx
+
+import (
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"math"
+)
+
+// PNG writes the chart as PNG image. The labels use a built-in bitmap
+// font of the printable ASCII characters, others are shown as ?.
+func (c Chart) PNG(w io.Writer, results []Result) error {
+	ch, err := c.chart(results)
+	if err != nil {
+		return err
+	}
+	return png.Encode(w, ch.image())
+}
+
+var (
+	pngText = color.RGBA{0x33, 0x33, 0x33, 0xff}
+	pngGrid = color.RGBA{0xe5, 0xe5, 0xe5, 0xff}
+	pngAxis = color.RGBA{0x99, 0x99, 0x99, 0xff}
+)
+
+// image draws the chart like writeSVG does.
+func (c *chart) image() *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, c.width, c.height))
+	for i := range img.Pix {
+		img.Pix[i] = 0xff
+	}
+
+	if c.title != "" {
+		drawText(img, c.title, float64(c.width)/2, chartTop+10, 0.5, 2, pngText)
+	}
+
+	left, right, bottom := int(c.left), int(c.right), int(math.Round(c.bottom))
+	for _, tick := range c.yTicks {
+		y := int(math.Round(tick.Pos))
+		for x := left; x <= right; x++ {
+			img.SetRGBA(x, y, pngGrid)
+		}
+		drawText(img, tick.Label, c.left-6, tick.Pos+4, 1, 1, pngText)
+	}
+	for _, tick := range c.xTicks {
+		x := int(math.Round(tick.Pos))
+		for y := bottom; y <= bottom+5; y++ {
+			img.SetRGBA(x, y, pngAxis)
+		}
+		drawText(img, tick.Label, tick.Pos, c.bottom+18, 0.5, 1, pngText)
+	}
+	for x := left; x <= right; x++ {
+		img.SetRGBA(x, bottom, pngAxis)
+	}
+
+	for _, s := range c.series {
+		for _, line := range s.Lines {
+			if len(line) == 1 {
+				drawDot(img, line[0], s.Color)
+			}
+			for j := 1; j < len(line); j++ {
+				drawLine(img, line[j-1], line[j], s.Color)
+			}
+		}
+	}
+
+	if c.legend {
+		for i, s := range c.series {
+			y := int(c.legendY(i))
+			for dy := -8; dy < 0; dy++ {
+				for dx := 0; dx < 12; dx++ {
+					img.SetRGBA(left+dx, y+dy, s.Color)
+				}
+			}
+			drawText(img, s.Name, c.left+18, float64(y), 0, 1, pngText)
+		}
+	}
+
+	return img
+}
+
+// blend draws col at x, y with the opacity alpha over what's there.
+func blend(img *image.RGBA, x, y int, col color.RGBA, alpha float64) {
+	if !(image.Point{x, y}.In(img.Rect)) || alpha <= 0 {
+		return
+	}
+	if alpha > 1 {
+		alpha = 1
+	}
+	bg := img.RGBAAt(x, y)
+	mix := func(a, b uint8) uint8 {
+		return uint8(math.Round(float64(a)*(1-alpha) + float64(b)*alpha))
+	}
+	img.SetRGBA(x, y, color.RGBA{mix(bg.R, col.R), mix(bg.G, col.G), mix(bg.B, col.B), 0xff})
+}
+
+// drawLine draws an antialiased line about 1.5 pixels wide, by covering
+// the pixels across the line by their distance to its center.
+func drawLine(img *image.RGBA, a, b chartPoint, col color.RGBA) {
+	const half = 0.75
+
+	dx, dy := b.X-a.X, b.Y-a.Y
+	steep := math.Abs(dy) > math.Abs(dx)
+	if steep {
+		a.X, a.Y, b.X, b.Y = a.Y, a.X, b.Y, b.X
+		dx, dy = dy, dx
+	}
+	if a.X > b.X {
+		a, b = b, a
+		dx, dy = -dx, -dy
+	}
+	if dx == 0 {
+		drawDot(img, a, col)
+		return
+	}
+
+	gradient := dy / dx
+	// The width of the line across the major axis.
+	width := half * math.Sqrt(1+gradient*gradient)
+	for x := int(math.Round(a.X)); x <= int(math.Round(b.X)); x++ {
+		center := a.Y + gradient*(float64(x)-a.X)
+		for y := int(math.Floor(center - width - 1)); y <= int(math.Ceil(center+width+1)); y++ {
+			coverage := width + 0.5 - math.Abs(float64(y)-center)
+			if steep {
+				blend(img, y, x, col, coverage)
+			} else {
+				blend(img, x, y, col, coverage)
+			}
+		}
+	}
+}
+
+// drawDot draws a single point, which has no line to be seen on.
+func drawDot(img *image.RGBA, p chartPoint, col color.RGBA) {
+	x, y := int(math.Round(p.X)), int(math.Round(p.Y))
+	for dy := -1; dy <= 1; dy++ {
+		for dx := -1; dx <= 1; dx++ {
+			blend(img, x+dx, y+dy, col, 1)
+		}
+	}
+}
+
+// drawText draws s with its baseline at y, aligned to x by anchor, 0 for
+// the start, 0.5 for the middle and 1 for the end, and scaled by scale.
+func drawText(img *image.RGBA, s string, x, y, anchor float64, scale int, col color.RGBA) {
+	runes := []rune(s)
+	width := float64((len(runes)*(fontWidth+1) - 1) * scale)
+	left := int(math.Round(x - width*anchor))
+	top := int(math.Round(y)) - fontHeight*scale
+
+	for i, r := range runes {
+		glyph, ok := font[r]
+		if !ok {
+			glyph = font['?']
+		}
+		for row, line := range glyph {
+			for column := 0; column < fontWidth; column++ {
+				if line[column] != '#' {
+					continue
+				}
+				for sy := 0; sy < scale; sy++ {
+					for sx := 0; sx < scale; sx++ {
+						px := left + (i*(fontWidth+1)+column)*scale + sx
+						blend(img, px, top+row*scale+sy, col, 1)
+					}
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,840 @@
+package styx
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type promResponse struct {
+	Status string `json:"status"`
+	Data   struct {
+		ResultType string       `json:"resultType"`
+		Result     []promSeries `json:"result"`
+	} `json:"data"`
+}
+
+// promSeries is a series of a matrix, values are pairs of timestamp and value.
+// Series of a vector have a single value instead.
+type promSeries struct {
+	Metric map[string]string `json:"metric"`
+	Values [][]interface{}   `json:"values"`
+	Value  []interface{}     `json:"value,omitempty"`
+}
+
+// ErrNoTimeseries is returned if a query didn't match any timeseries.
+var ErrNoTimeseries = errors.New("no timeseries found")
+
+// ErrBadStatus is wrapped by the errors of responses other than 200 OK,
+// see StatusError and APIError for the details.
+var ErrBadStatus = errors.New("unexpected status")
+
+// ErrNotMatrix is wrapped by the error of a range query returning another
+// result type, e.g. a vector for a query unsupported by the backend.
+var ErrNotMatrix = errors.New("result type isn't of type matrix")
+
+// ErrNotVector is wrapped by the error of an instant query returning
+// neither a vector nor a scalar.
+var ErrNotVector = errors.New("result type isn't of type vector or scalar")
+
+// StatusError is returned for responses other than 200 OK whose body isn't
+// an error of the Prometheus API, e.g. of a proxy in front of it.
+type StatusError struct {
+	StatusCode int
+	Status     string
+	URL        string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("didn't return 200 OK but %s: %s", e.Status, e.URL)
+}
+
+// Unwrap returns ErrBadStatus, so errors.Is can tell bad statuses apart.
+func (e *StatusError) Unwrap() error {
+	return ErrBadStatus
+}
+
+// APIError is an error reported by the Prometheus API in the response body.
+type APIError struct {
+	StatusCode int      `json:"-"`
+	Type       string   `json:"errorType"`
+	Message    string   `json:"error"`
+	Warnings   []string `json:"warnings"`
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Type, e.Message)
+}
+
+// Unwrap returns ErrBadStatus, as the API reports errors with a status
+// other than 200 OK, or rarely with 200 OK and a status of error.
+func (e *APIError) Unwrap() error {
+	return ErrBadStatus
+}
+
+// Timeout reports whether the query timed out on the server.
+func (e *APIError) Timeout() bool {
+	return e.Type == "timeout"
+}
+
+// Warning is a warning the API returned along with the result, e.g. of
+// Thanos or Cortex answering with a partial response.
+type Warning struct {
+	Host    string
+	Query   string
+	Message string
+}
+
+func (w Warning) String() string {
+	if w.Query == "" {
+		return fmt.Sprintf("%s: %s", w.Host, w.Message)
+	}
+	return fmt.Sprintf("%s for %s: %s", w.Host, w.Query, w.Message)
+}
+
+// apiStatus is the part of every response of the API telling whether it
+// succeeded, and the warnings of it.
+type apiStatus struct {
+	Status   string   `json:"status"`
+	Type     string   `json:"errorType"`
+	Message  string   `json:"error"`
+	Warnings []string `json:"warnings"`
+}
+
+// check returns an APIError with the warnings if the status is error, or
+// else passes the warnings to the options' OnWarning.
+func (s apiStatus) check(statusCode int, host, query string, opts Options) error {
+	if s.Status == "error" {
+		return &APIError{StatusCode: statusCode, Type: s.Type, Message: s.Message, Warnings: s.Warnings}
+	}
+	if opts.OnWarning != nil {
+		for _, message := range s.Warnings {
+			opts.OnWarning(Warning{Host: host, Query: query, Message: message})
+		}
+	}
+	return nil
+}
+
+// maxSnippet bounds the part of the body included in a DecodeError.
+const maxSnippet = 256
+
+// DecodeError is returned if the response of a query can't be decoded.
+type DecodeError struct {
+	Host  string
+	Query string
+	// Snippet is the start of the body, at most maxSnippet bytes.
+	Snippet string
+	Err     error
+}
+
+func (e *DecodeError) Error() string {
+	return fmt.Sprintf("can't decode response of %s for %s: %v: %q", e.Host, e.Query, e.Err, e.Snippet)
+}
+
+// snippetWriter keeps the first max bytes written to it.
+type snippetWriter struct {
+	buf bytes.Buffer
+	max int
+}
+
+func (w *snippetWriter) Write(p []byte) (int, error) {
+	if rest := w.max - w.buf.Len(); rest > 0 {
+		if len(p) > rest {
+			w.buf.Write(p[:rest])
+		} else {
+			w.buf.Write(p)
+		}
+	}
+	return len(p), nil
+}
+
+// Options are the optional settings Query uses for its requests.
+type Options struct {
+	// Header is sent with every request, e.g. X-Grafana-Org-Id.
+	Header http.Header
+	// Jar supplies the cookies of every request, e.g. a Grafana session.
+	Jar http.CookieJar
+	// Transport makes the requests, defaults to http.DefaultTransport.
+	Transport http.RoundTripper
+	// Client is used for all requests if set, Jar and Transport are ignored then.
+	Client *http.Client
+	// Tracer creates a span for every query, defaults to a no-op tracer.
+	Tracer Tracer
+	// Step is the resolution in seconds, by default it's based on the duration.
+	Step int
+	// Dialect adapts the requests to backends deviating from Prometheus' API.
+	Dialect Dialect
+	// Retries is how often a request answered with 429 or 5xx, or failing
+	// on a reset connection or timeout, is retried.
+	Retries int
+	// RetryBackoff is the wait before the first retry, it doubles with
+	// every further one. Defaults to a second.
+	RetryBackoff time.Duration
+	// OnRetry is called before every retry with the wait and the status
+	// or error that failed the request, e.g. to tell why a query stalls.
+	OnRetry func(wait time.Duration, reason string)
+	// Context cancels the requests and the waits between retries.
+	Context context.Context
+	// EnforceLabels are added as matchers to every selector of a query,
+	// e.g. namespace to restrict the query to a tenant.
+	EnforceLabels map[string]string
+	// APIVersion is the version segment of the API's path, defaults to v1.
+	APIVersion string
+	// APIPrefix is the part of the API's path ahead of the version,
+	// defaults to /api. Loki's API with the same queries and responses
+	// is at /loki/api.
+	APIPrefix string
+	// Range is queried up to now if neither start nor end are given,
+	// defaults to an hour.
+	Range time.Duration
+	// Accept is the preferred response format, defaults to application/json.
+	// Only JSON can be decoded, other formats are an error if they're served.
+	Accept string
+	// Parallelism is how many chunks of a range too long for a single
+	// query are queried at once, defaults to one after another.
+	Parallelism int
+	// OnWarning is called with every warning of a successful response,
+	// which are dropped if it's nil. Chunks queried in parallel call it
+	// concurrently.
+	OnWarning func(Warning)
+	// Method is GET or POST, the latter sends the parameters of queries
+	// form encoded in the body. By default queries whose URL is longer
+	// than MaxURLLength are sent with POST, others with GET.
+	Method string
+}
+
+// MaxURLLength is the longest URL of a query sent with GET by default,
+// proxies tend to reject longer ones.
+const MaxURLLength = 4096
+
+// QueryMethod returns the method to send the query of u with.
+func (o Options) QueryMethod(u *url.URL) string {
+	switch strings.ToUpper(o.Method) {
+	case http.MethodGet:
+		return http.MethodGet
+	case http.MethodPost:
+		return http.MethodPost
+	}
+	if len(u.String()) > MaxURLLength {
+		return http.MethodPost
+	}
+	return http.MethodGet
+}
+
+// DefaultAccept is the response format requested unless another is set.
+const DefaultAccept = "application/json"
+
+// AcceptHeader returns the Accept header to send, one set in Header wins.
+func (o Options) AcceptHeader() string {
+	if accept := o.Header.Get("Accept"); accept != "" {
+		return accept
+	}
+	if o.Accept != "" {
+		return o.Accept
+	}
+	return DefaultAccept
+}
+
+// Dialect adapts the requests to Prometheus compatible backends with quirks.
+type Dialect struct {
+	// QueryParam, StartParam, EndParam and StepParam rename the parameters
+	// of the range query API, empty ones keep the standard name.
+	QueryParam string
+	StartParam string
+	EndParam   string
+	StepParam  string
+	// Params are sent in addition with every query.
+	Params url.Values
+}
+
+func (d Dialect) param(name, standard string) string {
+	if name == "" {
+		return standard
+	}
+	return name
+}
+
+// DefaultAPIVersion is the version of the API queried unless another is set.
+const DefaultAPIVersion = "v1"
+
+// DefaultAPIPrefix is the path of the API queried unless another is set.
+const DefaultAPIPrefix = "/api"
+
+// DefaultRange is the duration queried if neither start nor end are given.
+const DefaultRange = time.Hour
+
+// window fills in a zero start or end, a zero end becomes now and a zero
+// start lies the range before the end.
+func (o Options) window(start, end, now time.Time) (time.Time, time.Time) {
+	if end.IsZero() {
+		end = now
+	}
+	if start.IsZero() {
+		r := o.Range
+		if r <= 0 {
+			r = DefaultRange
+		}
+		start = end.Add(-r)
+	}
+	return start, end
+}
+
+// StepFor returns the step in seconds used for querying a range of dur.
+func (o Options) StepFor(dur time.Duration) int {
+	if o.Step > 0 {
+		return o.Step
+	}
+	return steps(dur)
+}
+
+// Result is a single timeseries with its samples sorted by unix timestamp,
+// Times and Values are of the same length. Missing values are points
+// without a sample, like the gaps FillGaps adds.
+type Result struct {
+	Metric string
+	Labels map[string]string
+	Times  []int64
+	Values []float64
+}
+
+// SeriesID identifies the series of a result by its labels sorted by name,
+// so it doesn't depend on the order the labels were returned in. Unlike
+// the metric it's unambiguous even if label values contain quotes or
+// commas. Results without labels are identified by their metric.
+func SeriesID(result Result) string {
+	if result.Labels == nil {
+		return result.Metric
+	}
+
+	names := make([]string, 0, len(result.Labels))
+	for name := range result.Labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var id strings.Builder
+	for _, name := range names {
+		id.WriteString(name)
+		id.WriteByte(0xff)
+		id.WriteString(result.Labels[name])
+		id.WriteByte(0xff)
+	}
+	return id.String()
+}
+
+// MaxPoints is the most points Prometheus returns per series of a range query.
+const MaxPoints = 11000
+
+// Query runs a range query from start to end, a zero start or end is
+// filled in by the Options' Range up to now. Ranges with more than
+// MaxPoints steps are queried in chunks whose results are merged.
+func Query(host string, start time.Time, end time.Time, query string, opts Options) ([]Result, error) {
+	start, end = opts.window(start, end, time.Now())
+	opts.Step = opts.StepFor(end.Sub(start))
+
+	if int(end.Sub(start).Seconds())/opts.Step+1 <= MaxPoints {
+		return queryRange(host, start, end, query, opts)
+	}
+
+	chunks := Chunks(start, end, time.Duration(MaxPoints*opts.Step)*time.Second, opts.Step)
+	sets := make([][]Result, len(chunks))
+	err := Parallel(len(chunks), opts.Parallelism, func(i int) error {
+		results, err := queryRange(host, chunks[i].Start, chunks[i].End, query, opts)
+		if err != nil && err != ErrNoTimeseries {
+			return err
+		}
+		sets[i] = results
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	results := MergeResults(sets...)
+	if len(results) == 0 {
+		return nil, ErrNoTimeseries
+	}
+	return results, nil
+}
+
+// queryRange runs a single range query with the step of opts.
+func queryRange(host string, start time.Time, end time.Time, query string, opts Options) (results []Result, err error) {
+	step := opts.Step
+
+	ctx, span := opts.span("styx.Query")
+	span.SetAttribute("styx.host", host)
+	span.SetAttribute("styx.query", query)
+	span.SetAttribute("styx.step", step)
+	defer func() {
+		if err != nil {
+			span.RecordError(err)
+		}
+		span.SetAttribute("styx.results", len(results))
+		span.End()
+	}()
+
+	u, err := QueryURL(host, start, end, query, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	// Backends merging several sources may return a series more than once,
+	// its samples are merged into one result instead of duplicate columns.
+	index := make(map[string]int)
+
+	_, err = fetchStream(ctx, host, opts.QueryMethod(u), u, query, opts, func(body io.Reader, status *apiStatus) error {
+		return decodeMatrix(body, status, func(r Result) error {
+			id := SeriesID(r)
+			if i, ok := index[id]; ok {
+				results[i].merge(r)
+				return nil
+			}
+			index[id] = len(results)
+			results = append(results, r)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(results) == 0 {
+		return nil, ErrNoTimeseries
+	}
+
+	return results, nil
+}
+
+// QueryInstant evaluates the query at a single time, a zero time is now.
+// Every series of a vector becomes a result with one value, a scalar
+// becomes a result named scalar.
+func QueryInstant(host string, at time.Time, query string, opts Options) (results []Result, err error) {
+	if at.IsZero() {
+		at = time.Now()
+	}
+
+	ctx, span := opts.span("styx.QueryInstant")
+	span.SetAttribute("styx.host", host)
+	span.SetAttribute("styx.query", query)
+	defer func() {
+		if err != nil {
+			span.RecordError(err)
+		}
+		span.SetAttribute("styx.results", len(results))
+		span.End()
+	}()
+
+	u, err := InstantURL(host, at, query, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var resp promInstantResponse
+	snippet, err := fetchStream(ctx, host, opts.QueryMethod(u), u, query, opts, decodeJSON(&resp))
+	if err != nil {
+		return nil, err
+	}
+	decodeErr := func(err error) error {
+		return &DecodeError{Host: host, Query: query, Snippet: snippet, Err: err}
+	}
+
+	switch resp.Data.ResultType {
+	case "vector":
+		var vector []promSeries
+		if err := json.Unmarshal(resp.Data.Result, &vector); err != nil {
+			return nil, decodeErr(err)
+		}
+		if len(vector) == 0 {
+			return nil, ErrNoTimeseries
+		}
+
+		index := make(map[string]int)
+		for _, res := range vector {
+			timestamp, value, err := sample(res.Value)
+			if err != nil {
+				return nil, decodeErr(err)
+			}
+
+			labels := res.Metric
+			if labels == nil {
+				labels = map[string]string{}
+			}
+			r := Result{Metric: metricName(labels), Labels: labels, Times: []int64{timestamp}, Values: []float64{value}}
+
+			id := SeriesID(r)
+			if i, ok := index[id]; ok {
+				results[i].Add(timestamp, value)
+				continue
+			}
+			index[id] = len(results)
+			results = append(results, r)
+		}
+	case "scalar":
+		var scalar []interface{}
+		if err := json.Unmarshal(resp.Data.Result, &scalar); err != nil {
+			return nil, decodeErr(err)
+		}
+		timestamp, value, err := sample(scalar)
+		if err != nil {
+			return nil, decodeErr(err)
+		}
+		results = []Result{{Metric: "scalar", Labels: map[string]string{}, Times: []int64{timestamp}, Values: []float64{value}}}
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrNotVector, resp.Data.ResultType)
+	}
+
+	return results, nil
+}
+
+// promInstantResponse is the response of an instant query, whose result
+// depends on its type.
+type promInstantResponse struct {
+	Status string `json:"status"`
+	Data   struct {
+		ResultType string          `json:"resultType"`
+		Result     json.RawMessage `json:"result"`
+	} `json:"data"`
+}
+
+// span starts a span of the Options' tracer in the Options' context.
+func (o Options) span(name string) (context.Context, Span) {
+	tracer := o.Tracer
+	if tracer == nil {
+		tracer = noopTracer{}
+	}
+
+	ctx := o.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	return tracer.Start(ctx, name)
+}
+
+// fetch requests u and decodes the JSON response into v. It returns the
+// start of the body to report errors decoding its contents.
+func fetch(ctx context.Context, host string, u *url.URL, query string, opts Options, v interface{}) (string, error) {
+	return fetchStream(ctx, host, http.MethodGet, u, query, opts, decodeJSON(v))
+}
+
+// decodeJSON returns a decode func of fetchStream decoding the response
+// into v unless its status is error.
+func decodeJSON(v interface{}) func(io.Reader, *apiStatus) error {
+	return func(body io.Reader, status *apiStatus) error {
+		var raw json.RawMessage
+		if err := json.NewDecoder(body).Decode(&raw); err != nil {
+			return decodeErr{err}
+		}
+		if err := json.Unmarshal(raw, status); err != nil {
+			return decodeErr{err}
+		}
+		if status.Status == "error" {
+			return nil
+		}
+		if err := json.Unmarshal(raw, v); err != nil {
+			return decodeErr{err}
+		}
+		return nil
+	}
+}
+
+// decompress returns the body of the response, decompressed if it's gzip
+// encoded.
+func decompress(response *http.Response) (io.Reader, error) {
+	if !strings.EqualFold(response.Header.Get("Content-Encoding"), "gzip") {
+		return response.Body, nil
+	}
+	return gzip.NewReader(response.Body)
+}
+
+// decodeErr marks the errors of a body that can't be decoded, unlike the
+// ones of whatever the decoded contents are passed on to.
+type decodeErr struct {
+	error
+}
+
+// fetchStream requests u and passes the body to decode as it's read, which
+// fills in the status of the response. Errors of decode marked as
+// decodeErr are returned as DecodeError, a status of error as APIError.
+// With POST the parameters of u are sent form encoded in the body.
+func fetchStream(ctx context.Context, host, method string, u *url.URL, query string, opts Options, decode func(io.Reader, *apiStatus) error) (string, error) {
+	req, err := newRequest(method, u)
+	if err != nil {
+		return "", err
+	}
+	for name, values := range opts.Header {
+		for _, value := range values {
+			req.Header.Add(name, value)
+		}
+	}
+	req.Header.Set("Accept", opts.AcceptHeader())
+	// Matrices compress very well. Asking for gzip explicitly instead of
+	// leaving it to http.Transport works with any transport, the response
+	// is decompressed below. A header given in the options wins, e.g.
+	// identity to turn it off.
+	if req.Header.Get("Accept-Encoding") == "" {
+		req.Header.Set("Accept-Encoding", "gzip")
+	}
+
+	client := opts.Client
+	if client == nil {
+		client = &http.Client{Jar: opts.Jar, Transport: opts.Transport}
+	}
+
+	response, err := doRetrying(ctx, client, req, opts.Retries, opts.RetryBackoff, opts.OnRetry)
+	if err != nil {
+		return "", err
+	}
+	defer response.Body.Close()
+
+	raw, err := decompress(response)
+	if err != nil {
+		return "", &DecodeError{Host: host, Query: query, Err: err}
+	}
+
+	if response.StatusCode != 200 {
+		var apiErr APIError
+		if json.NewDecoder(io.LimitReader(raw, 64*1024)).Decode(&apiErr) == nil && apiErr.Type != "" {
+			apiErr.StatusCode = response.StatusCode
+			return "", &apiErr
+		}
+		return "", &StatusError{StatusCode: response.StatusCode, Status: response.Status, URL: u.String()}
+	}
+
+	if contentType := response.Header.Get("Content-Type"); strings.Contains(contentType, "protobuf") {
+		return "", fmt.Errorf("returned %s which can't be decoded, only JSON can: %s", contentType, u.String())
+	}
+
+	// Auth proxies tend to answer with a login page and 200 OK,
+	// which would otherwise fail with a cryptic JSON syntax error.
+	body := bufio.NewReader(raw)
+	if looksLikeHTML(response.Header.Get("Content-Type"), body) {
+		return "", fmt.Errorf("returned HTML instead of JSON, the endpoint may require authentication: %s", u.String())
+	}
+
+	snippet := &snippetWriter{max: maxSnippet}
+	var status apiStatus
+	if err := decode(io.TeeReader(body, snippet), &status); err != nil {
+		var de decodeErr
+		if errors.As(err, &de) {
+			return "", &DecodeError{Host: host, Query: query, Snippet: snippet.buf.String(), Err: de.error}
+		}
+		return "", err
+	}
+	if err := status.check(response.StatusCode, host, query, opts); err != nil {
+		return "", err
+	}
+
+	return snippet.buf.String(), nil
+}
+
+// newRequest returns a request of u, with POST its parameters are moved
+// into the body.
+func newRequest(method string, u *url.URL) (*http.Request, error) {
+	if method != http.MethodPost {
+		return http.NewRequest(method, u.String(), nil)
+	}
+
+	target := *u
+	target.RawQuery = ""
+	req, err := http.NewRequest(method, target.String(), strings.NewReader(u.RawQuery))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return req, nil
+}
+
+// sample returns the timestamp rounded to seconds and the value of a
+// [timestamp, "value"] pair.
+func sample(vals []interface{}) (int64, float64, error) {
+	if len(vals) != 2 {
+		return 0, 0, fmt.Errorf("sample needs a timestamp and a value: %v", vals)
+	}
+	timestamp, ok := vals[0].(float64)
+	if !ok {
+		return 0, 0, fmt.Errorf("timestamp isn't a number: %v", vals[0])
+	}
+	s, ok := vals[1].(string)
+	if !ok {
+		return 0, 0, fmt.Errorf("value isn't a string: %v", vals[1])
+	}
+	value, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("value isn't a number: %s", s)
+	}
+	return int64(math.Round(timestamp)), value, nil
+}
+
+// QueryURL returns the URL of the range query for the options' dialect,
+// with the enforced labels injected into the query.
+func QueryURL(host string, start, end time.Time, query string, opts Options) (*url.URL, error) {
+	start, end = opts.window(start, end, time.Now())
+
+	query, err := injectMatchers(query, opts.EnforceLabels)
+	if err != nil {
+		return nil, fmt.Errorf("can't enforce labels: %v", err)
+	}
+
+	d := opts.Dialect
+	return apiURL(host, "query_range", url.Values{
+		d.param(d.QueryParam, "query"): []string{query},
+		d.param(d.StartParam, "start"): []string{fmt.Sprintf("%d", start.Unix())},
+		d.param(d.EndParam, "end"):     []string{fmt.Sprintf("%d", end.Unix())},
+		d.param(d.StepParam, "step"):   []string{fmt.Sprintf("%d", opts.StepFor(end.Sub(start)))},
+	}, opts)
+}
+
+// InstantURL returns the URL of the instant query for the options' dialect,
+// with the enforced labels injected into the query.
+func InstantURL(host string, at time.Time, query string, opts Options) (*url.URL, error) {
+	query, err := injectMatchers(query, opts.EnforceLabels)
+	if err != nil {
+		return nil, fmt.Errorf("can't enforce labels: %v", err)
+	}
+
+	d := opts.Dialect
+	return apiURL(host, "query", url.Values{
+		d.param(d.QueryParam, "query"): []string{query},
+		"time":                         []string{fmt.Sprintf("%d", at.Unix())},
+	}, opts)
+}
+
+// apiURL returns the URL of the API endpoint with the params and the
+// additional ones of the options' dialect.
+func apiURL(host, endpoint string, params url.Values, opts Options) (*url.URL, error) {
+	u, err := url.Parse(host)
+	if err != nil {
+		return nil, err
+	}
+	version := opts.APIVersion
+	if version == "" {
+		version = DefaultAPIVersion
+	}
+	prefix := opts.APIPrefix
+	if prefix == "" {
+		prefix = DefaultAPIPrefix
+	}
+	// Keep the path of the host, e.g. of a proxy in front of Prometheus.
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/" + strings.Trim(prefix, "/") + "/" + version + "/" + endpoint
+	q := u.Query()
+	for name, values := range opts.Dialect.Params {
+		for _, value := range values {
+			q.Add(name, value)
+		}
+	}
+	for name, values := range params {
+		q[name] = values
+	}
+	u.RawQuery = q.Encode()
+
+	return u, nil
+}
+
+// QueryCoarsening runs the query and retries it with twice the step each
+// time it times out on the server, up to retries times, as a coarser
+// resolution is cheaper to evaluate. It returns the step that was used.
+func QueryCoarsening(host string, start, end time.Time, query string, opts Options, retries int) ([]Result, int, error) {
+	start, end = opts.window(start, end, time.Now())
+	opts.Step = opts.StepFor(end.Sub(start))
+
+	for i := 0; ; i++ {
+		results, err := Query(host, start, end, query, opts)
+		var apiErr *APIError
+		if errors.As(err, &apiErr) && apiErr.Timeout() && i < retries {
+			opts.Step *= 2
+			continue
+		}
+		return results, opts.Step, err
+	}
+}
+
+// looksLikeHTML checks the Content-Type and the first non-whitespace byte
+// of the body to tell whether the response is an HTML page.
+func looksLikeHTML(contentType string, body *bufio.Reader) bool {
+	if strings.HasPrefix(contentType, "text/html") {
+		return true
+	}
+
+	// Peek returns whatever is buffered on short bodies, the error can be ignored.
+	peek, _ := body.Peek(512)
+	peek = bytes.TrimLeft(peek, " \t\r\n")
+
+	return len(peek) > 0 && peek[0] == '<'
+}
+
+func steps(dur time.Duration) int {
+	if dur < 15*time.Minute {
+		return 1
+	}
+	if dur < 30*time.Minute {
+		return 3
+	}
+	return int(dur.Minutes() / 4.2)
+}
+
+// PointSteps returns the step to get the given number of points across dur.
+func PointSteps(dur time.Duration, points int) int {
+	step := int(math.Ceil(dur.Seconds() / float64(points)))
+	if step < 1 {
+		return 1
+	}
+	return step
+}
+
+// niceSteps are the steps in seconds MaxPointsStep rounds up to, like Grafana.
+var niceSteps = []int{1, 2, 5, 10, 15, 30, 60, 2 * 60, 5 * 60, 10 * 60, 15 * 60, 30 * 60,
+	3600, 2 * 3600, 3 * 3600, 6 * 3600, 12 * 3600, 24 * 3600, 7 * 24 * 3600}
+
+// MaxPointsStep returns the step to get at most maxPoints points across dur.
+// Like Grafana's interval it's rounded up to a step like 15s, 1m or 5m, so
+// the timestamps of different ranges line up.
+func MaxPointsStep(dur time.Duration, maxPoints int) int {
+	step := PointSteps(dur, maxPoints)
+	for _, nice := range niceSteps {
+		if nice >= step {
+			return nice
+		}
+	}
+	// Beyond a week full days are nice enough.
+	day := 24 * 3600
+	return (step + day - 1) / day * day
+}
+
+func metricName(metric map[string]string) string {
+	if len(metric) == 0 {
+		return "{}"
+	}
+
+	out := ""
+	var inner []string
+	for key, value := range metric {
+		if key == "__name__" {
+			out = value
+			continue
+		}
+		inner = append(inner, fmt.Sprintf(`%s="%s"`, key, value))
+	}
+
+	if len(inner) == 0 {
+		return out
+	}
+
+	sort.Slice(inner, func(i, j int) bool {
+		return inner[i] < inner[j]
+	})
+
+	return out + "{" + strings.Join(inner, ",") + "}"
+}
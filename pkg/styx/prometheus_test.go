@@ -0,0 +1,672 @@
+package styx
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSteps(t *testing.T) {
+	assert.Equal(t, 1, steps(time.Minute))
+	assert.Equal(t, 1, steps(5*time.Minute))
+	assert.Equal(t, 3, steps(15*time.Minute))
+	assert.Equal(t, 7, steps(30*time.Minute))
+	assert.Equal(t, 14, steps(time.Hour))
+	assert.Equal(t, 28, steps(2*time.Hour))
+	assert.Equal(t, 85, steps(6*time.Hour))
+	assert.Equal(t, 171, steps(12*time.Hour))
+	assert.Equal(t, 342, steps(24*time.Hour))
+	assert.Equal(t, 685, steps(48*time.Hour))
+	assert.Equal(t, 2400, steps(168*time.Hour))
+}
+
+func TestPointSteps(t *testing.T) {
+	assert.Equal(t, 1, PointSteps(time.Minute, 100))
+	assert.Equal(t, 1, PointSteps(100*time.Second, 100))
+	assert.Equal(t, 2, PointSteps(101*time.Second, 100))
+	assert.Equal(t, 36, PointSteps(time.Hour, 100))
+	assert.Equal(t, 60, PointSteps(time.Hour, 60))
+	assert.Equal(t, 864, PointSteps(24*time.Hour, 100))
+	assert.Equal(t, 6048, PointSteps(168*time.Hour, 100))
+	assert.Equal(t, 3600, PointSteps(time.Hour, 1))
+}
+
+func TestMaxPointsStep(t *testing.T) {
+	assert.Equal(t, 1, MaxPointsStep(time.Minute, 100))
+	assert.Equal(t, 2, MaxPointsStep(101*time.Second, 100))
+	assert.Equal(t, 60, MaxPointsStep(time.Hour, 100))
+	assert.Equal(t, 60, MaxPointsStep(time.Hour, 60))
+	assert.Equal(t, 15*60, MaxPointsStep(24*time.Hour, 100))
+	assert.Equal(t, 3600, MaxPointsStep(time.Hour, 1))
+	assert.Equal(t, 13*24*3600, MaxPointsStep(365*24*time.Hour, 30))
+}
+
+func TestOptionsStep(t *testing.T) {
+	assert.Equal(t, 14, Options{}.StepFor(time.Hour))
+	assert.Equal(t, 36, Options{Step: 36}.StepFor(time.Hour))
+}
+
+func TestOptionsWindow(t *testing.T) {
+	now := time.Unix(1502749390, 0)
+	start, end := time.Unix(1502740000, 0), time.Unix(1502745000, 0)
+
+	// Given ones are kept
+	s, e := Options{}.window(start, end, now)
+	assert.Equal(t, start, s)
+	assert.Equal(t, end, e)
+
+	// The last hour by default
+	s, e = Options{}.window(time.Time{}, time.Time{}, now)
+	assert.Equal(t, now.Add(-time.Hour), s)
+	assert.Equal(t, now, e)
+
+	s, e = Options{Range: 6 * time.Hour}.window(time.Time{}, time.Time{}, now)
+	assert.Equal(t, now.Add(-6*time.Hour), s)
+	assert.Equal(t, now, e)
+
+	// Only the end is missing
+	s, e = Options{Range: 6 * time.Hour}.window(start, time.Time{}, now)
+	assert.Equal(t, start, s)
+	assert.Equal(t, now, e)
+
+	// Only the start is missing
+	s, e = Options{}.window(time.Time{}, end, now)
+	assert.Equal(t, end.Add(-time.Hour), s)
+	assert.Equal(t, end, e)
+}
+
+func TestMetricName(t *testing.T) {
+	metric := make(map[string]string)
+	assert.Equal(t, `{}`, metricName(metric))
+
+	metric["__name__"] = "go_goroutines"
+	assert.Equal(t, `go_goroutines`, metricName(metric))
+
+	metric["job"] = "prometheus"
+	assert.Equal(t, `go_goroutines{job="prometheus"}`, metricName(metric))
+
+	metric["instance"] = "localhost:9090"
+	assert.Equal(t, `go_goroutines{instance="localhost:9090",job="prometheus"}`, metricName(metric))
+}
+
+func TestSeriesID(t *testing.T) {
+	a := Result{Metric: "up", Labels: map[string]string{"__name__": "up", "job": "node", "instance": "a"}}
+	b := Result{Metric: "up", Labels: map[string]string{"instance": "a", "__name__": "up", "job": "node"}}
+	assert.Equal(t, SeriesID(a), SeriesID(b))
+
+	// Label values that render to the same metric are still different series
+	c := Result{Labels: map[string]string{"a": `x",b="y`}}
+	d := Result{Labels: map[string]string{"a": "x", "b": "y"}}
+	assert.Equal(t, metricName(c.Labels), metricName(d.Labels))
+	assert.NotEqual(t, SeriesID(c), SeriesID(d))
+
+	// Without labels the metric identifies a result
+	assert.Equal(t, "foobar", SeriesID(Result{Metric: "foobar"}))
+}
+
+func TestQueryDuplicateSeries(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"status":"success","data":{"resultType":"matrix","result":[`+
+			`{"metric":{"__name__":"up","job":"node","instance":"a"},"values":[[1502749390,"1"]]},`+
+			`{"metric":{"instance":"b","__name__":"up","job":"node"},"values":[[1502749390,"0"]]},`+
+			`{"metric":{"job":"node","instance":"a","__name__":"up"},"values":[[1502749391,"1"]]}]}}`)
+	}))
+	defer ts.Close()
+
+	results, err := Query(ts.URL, time.Now().Add(-time.Hour), time.Now(), "up", Options{})
+	assert.NoError(t, err)
+	assert.Equal(t, []Result{{
+		Metric: `up{instance="a",job="node"}`,
+		Labels: map[string]string{"__name__": "up", "instance": "a", "job": "node"},
+		Times:  []int64{1502749390, 1502749391},
+		Values: []float64{1, 1},
+	}, {
+		Metric: `up{instance="b",job="node"}`,
+		Labels: map[string]string{"__name__": "up", "instance": "b", "job": "node"},
+		Times:  []int64{1502749390},
+		Values: []float64{0},
+	}}, results)
+}
+
+func TestQueryHTMLResponse(t *testing.T) {
+	login := "\n<!DOCTYPE html>\n<html><body>Please sign in</body></html>"
+
+	// Proxy sending a proper Content-Type
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		fmt.Fprint(w, login)
+	}))
+	defer ts.Close()
+
+	_, err := Query(ts.URL, time.Now().Add(-time.Hour), time.Now(), "up", Options{})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "may require authentication")
+
+	// Proxy claiming to send JSON
+	ts2 := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, login)
+	}))
+	defer ts2.Close()
+
+	_, err = Query(ts2.URL, time.Now().Add(-time.Hour), time.Now(), "up", Options{})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "may require authentication")
+}
+
+func TestQueryAccept(t *testing.T) {
+	var accept, contentType string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		accept = r.Header.Get("Accept")
+		w.Header().Set("Content-Type", contentType)
+		fmt.Fprint(w, `{"status":"success","data":{"resultType":"matrix","result":[]}}`)
+	}))
+	defer ts.Close()
+
+	// JSON is asked for explicitly by default
+	contentType = "application/json"
+	_, err := Query(ts.URL, time.Now().Add(-time.Hour), time.Now(), "up", Options{})
+	assert.Equal(t, ErrNoTimeseries, err)
+	assert.Equal(t, "application/json", accept)
+
+	// Servers falling back to JSON are decoded
+	_, err = Query(ts.URL, time.Now().Add(-time.Hour), time.Now(), "up", Options{Accept: "application/x-protobuf, application/json;q=0.5"})
+	assert.Equal(t, ErrNoTimeseries, err)
+	assert.Equal(t, "application/x-protobuf, application/json;q=0.5", accept)
+
+	// A header set explicitly wins
+	_, err = Query(ts.URL, time.Now().Add(-time.Hour), time.Now(), "up", Options{
+		Header: http.Header{"Accept": []string{"*/*"}},
+		Accept: "application/x-protobuf",
+	})
+	assert.Equal(t, ErrNoTimeseries, err)
+	assert.Equal(t, "*/*", accept)
+
+	// Protobuf can't be decoded
+	contentType = "application/x-protobuf"
+	_, err = Query(ts.URL, time.Now().Add(-time.Hour), time.Now(), "up", Options{Accept: "application/x-protobuf"})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "application/x-protobuf")
+}
+
+func TestQueryURL(t *testing.T) {
+	start, end := time.Unix(1502745790, 0), time.Unix(1502749390, 0)
+
+	u, err := QueryURL("http://localhost:9090", start, end, "up", Options{})
+	assert.NoError(t, err)
+	assert.Equal(t, "/api/v1/query_range", u.Path)
+
+	u, err = QueryURL("http://localhost:9090", start, end, "up", Options{APIVersion: "v2"})
+	assert.NoError(t, err)
+	assert.Equal(t, "/api/v2/query_range", u.Path)
+
+	u, err = QueryURL("http://loki:3100", start, end, `sum(rate({app="api"} |= "error" [5m]))`, Options{APIPrefix: "/loki/api"})
+	assert.NoError(t, err)
+	assert.Equal(t, "/loki/api/v1/query_range", u.Path)
+
+	// The path of a proxy is kept
+	u, err = QueryURL("https://grafana.example.com/api/datasources/proxy/1/", start, end, "up", Options{})
+	assert.NoError(t, err)
+	assert.Equal(t, "/api/datasources/proxy/1/api/v1/query_range", u.Path)
+}
+
+func TestQueryInstant(t *testing.T) {
+	var path string
+	var params url.Values
+	var body string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path, params = r.URL.Path, r.URL.Query()
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, body)
+	}))
+	defer ts.Close()
+
+	at := time.Unix(1502749390, 0)
+
+	body = `{"status":"success","data":{"resultType":"vector","result":[` +
+		`{"metric":{"__name__":"up","job":"node"},"value":[1502749390,"1"]},` +
+		`{"metric":{"__name__":"up","job":"prometheus"},"value":[1502749390,"0"]}]}}`
+	results, err := QueryInstant(ts.URL, at, "up", Options{})
+	assert.NoError(t, err)
+	assert.Equal(t, "/api/v1/query", path)
+	assert.Equal(t, url.Values{"query": []string{"up"}, "time": []string{"1502749390"}}, params)
+	assert.Equal(t, []Result{{
+		Metric: `up{job="node"}`,
+		Labels: map[string]string{"__name__": "up", "job": "node"},
+		Times:  []int64{1502749390},
+		Values: []float64{1},
+	}, {
+		Metric: `up{job="prometheus"}`,
+		Labels: map[string]string{"__name__": "up", "job": "prometheus"},
+		Times:  []int64{1502749390},
+		Values: []float64{0},
+	}}, results)
+
+	// The snapshot renders like any other result
+	buf := bytes.NewBuffer(nil)
+	assert.NoError(t, CSVWriter(buf, results))
+	assert.Equal(t, "1502749390,1,0\n", buf.String())
+
+	body = `{"status":"success","data":{"resultType":"scalar","result":[1502749390,"42"]}}`
+	results, err = QueryInstant(ts.URL, at, "scalar(up)", Options{})
+	assert.NoError(t, err)
+	assert.Equal(t, []Result{{Metric: "scalar", Labels: map[string]string{}, Times: []int64{1502749390}, Values: []float64{42}}}, results)
+
+	body = `{"status":"success","data":{"resultType":"vector","result":[]}}`
+	_, err = QueryInstant(ts.URL, at, "up", Options{})
+	assert.Equal(t, ErrNoTimeseries, err)
+
+	body = `{"status":"success","data":{"resultType":"string","result":[1502749390,"foo"]}}`
+	_, err = QueryInstant(ts.URL, at, `"foo"`, Options{})
+	assert.Error(t, err)
+
+	body = `{"status":"success","data":{"resultType":"vector","result":[{"metric":{},"value":[1502749390]}]}}`
+	_, err = QueryInstant(ts.URL, at, "up", Options{})
+	assert.IsType(t, &DecodeError{}, err)
+}
+
+func TestQueryReplay(t *testing.T) {
+	opts := Options{Transport: ReplayTransport{Path: "testdata/query_range.json"}}
+
+	results, err := Query("http://prometheus.invalid", time.Now().Add(-time.Hour), time.Now(), "go_goroutines", opts)
+	assert.NoError(t, err)
+	assert.Equal(t, []Result{{
+		Metric: `go_goroutines{instance="localhost:9090",job="prometheus"}`,
+		Labels: map[string]string{"__name__": "go_goroutines", "instance": "localhost:9090", "job": "prometheus"},
+		Times:  []int64{1502749390, 1502749391},
+		Values: []float64{41, 42},
+	}, {
+		Metric: `go_goroutines{instance="localhost:9100",job="node"}`,
+		Labels: map[string]string{"__name__": "go_goroutines", "instance": "localhost:9100", "job": "node"},
+		Times:  []int64{1502749391},
+		Values: []float64{7},
+	}}, results)
+
+	_, err = Query("http://prometheus.invalid", time.Now().Add(-time.Hour), time.Now(), "up",
+		Options{Transport: ReplayTransport{Path: "testdata/missing.json"}})
+	assert.Error(t, err)
+}
+
+func TestQueryRecord(t *testing.T) {
+	recorded, err := ioutil.ReadFile("testdata/query_range.json")
+	assert.NoError(t, err)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(recorded)
+	}))
+	defer ts.Close()
+
+	f, err := ioutil.TempFile("", "styx-record")
+	assert.NoError(t, err)
+	f.Close()
+	defer os.Remove(f.Name())
+
+	live, err := Query(ts.URL, time.Now().Add(-time.Hour), time.Now(), "go_goroutines",
+		Options{Transport: RecordTransport{Path: f.Name()}})
+	assert.NoError(t, err)
+
+	replayed, err := Query(ts.URL, time.Now().Add(-time.Hour), time.Now(), "go_goroutines",
+		Options{Transport: ReplayTransport{Path: f.Name()}})
+	assert.NoError(t, err)
+	assert.Equal(t, live, replayed)
+}
+
+func TestQueryClient(t *testing.T) {
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeFile(w, r, "testdata/query_range.json")
+	}))
+	ts.Config.ErrorLog = log.New(ioutil.Discard, "", 0)
+	ts.StartTLS()
+	defer ts.Close()
+
+	// The default client doesn't trust the test server's certificate
+	_, err := Query(ts.URL, time.Now().Add(-time.Hour), time.Now(), "go_goroutines", Options{})
+	assert.Error(t, err)
+
+	results, err := Query(ts.URL, time.Now().Add(-time.Hour), time.Now(), "go_goroutines", Options{Client: ts.Client()})
+	assert.NoError(t, err)
+	assert.Len(t, results, 2)
+}
+
+func TestQueryDialect(t *testing.T) {
+	var params url.Values
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		params = r.URL.Query()
+		http.ServeFile(w, r, "testdata/query_range.json")
+	}))
+	defer ts.Close()
+
+	start, end := time.Unix(1502745790, 0), time.Unix(1502749390, 0)
+
+	// The standard names by default
+	_, err := Query(ts.URL, start, end, "up", Options{})
+	assert.NoError(t, err)
+	assert.Equal(t, url.Values{
+		"query": {"up"},
+		"start": {"1502745790"},
+		"end":   {"1502749390"},
+		"step":  {"14"},
+	}, params)
+
+	opts := Options{Dialect: Dialect{
+		QueryParam: "expr",
+		StepParam:  "resolution",
+		Params:     url.Values{"dedup": {"true"}},
+	}}
+	_, err = Query(ts.URL, start, end, "up", opts)
+	assert.NoError(t, err)
+	assert.Equal(t, url.Values{
+		"expr":       {"up"},
+		"start":      {"1502745790"},
+		"end":        {"1502749390"},
+		"resolution": {"14"},
+		"dedup":      {"true"},
+	}, params)
+}
+
+func TestQueryErrors(t *testing.T) {
+	var status int
+	var body string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+		fmt.Fprint(w, body)
+	}))
+	defer ts.Close()
+
+	start, end := time.Unix(1502745790, 0), time.Unix(1502749390, 0)
+
+	status, body = http.StatusBadGateway, "bad gateway"
+	_, err := Query(ts.URL, start, end, "up", Options{})
+	assert.True(t, errors.Is(err, ErrBadStatus))
+	var statusErr *StatusError
+	assert.True(t, errors.As(err, &statusErr))
+	assert.Equal(t, http.StatusBadGateway, statusErr.StatusCode)
+
+	status, body = http.StatusBadRequest, `{"status":"error","errorType":"bad_data","error":"parse error"}`
+	_, err = Query(ts.URL, start, end, "up(", Options{})
+	assert.True(t, errors.Is(err, ErrBadStatus))
+
+	status, body = http.StatusOK, `{"status":"success","data":{"resultType":"vector","result":[]}}`
+	_, err = Query(ts.URL, start, end, "up", Options{})
+	assert.True(t, errors.Is(err, ErrNotMatrix))
+	assert.EqualError(t, err, "result type isn't of type matrix: vector")
+
+	status, body = http.StatusOK, `{"status":"success","data":{"resultType":"matrix","result":[]}}`
+	_, err = QueryInstant(ts.URL, end, "up", Options{})
+	assert.True(t, errors.Is(err, ErrNotVector))
+}
+
+func TestQueryCoarsening(t *testing.T) {
+	var requested []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		step := r.URL.Query().Get("step")
+		requested = append(requested, step)
+		if step != "56" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			fmt.Fprint(w, `{"status":"error","errorType":"timeout","error":"query timed out in expression evaluation"}`)
+			return
+		}
+		http.ServeFile(w, r, "testdata/query_range.json")
+	}))
+	defer ts.Close()
+
+	start, end := time.Unix(1502745790, 0), time.Unix(1502749390, 0)
+
+	// Without retries the typed timeout error is returned
+	_, err := Query(ts.URL, start, end, "up", Options{})
+	assert.Equal(t, &APIError{
+		StatusCode: http.StatusServiceUnavailable,
+		Type:       "timeout",
+		Message:    "query timed out in expression evaluation",
+	}, err)
+	assert.True(t, err.(*APIError).Timeout())
+
+	requested = nil
+	_, step, err := QueryCoarsening(ts.URL, start, end, "up", Options{}, 1)
+	assert.Error(t, err)
+	assert.Equal(t, 28, step)
+	assert.Equal(t, []string{"14", "28"}, requested)
+
+	requested = nil
+	results, step, err := QueryCoarsening(ts.URL, start, end, "up", Options{}, 5)
+	assert.NoError(t, err)
+	assert.Len(t, results, 2)
+	assert.Equal(t, 56, step)
+	assert.Equal(t, []string{"14", "28", "56"}, requested)
+
+	// Other errors aren't retried
+	ts.Close()
+	_, step, err = QueryCoarsening(ts.URL, start, end, "up", Options{}, 5)
+	assert.Error(t, err)
+	assert.Equal(t, 14, step)
+}
+
+func TestQueryDecodeError(t *testing.T) {
+	var body string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, body)
+	}))
+	defer ts.Close()
+
+	start, end := time.Now().Add(-time.Hour), time.Now()
+
+	body = `{"status":"success","data":{"resultType":"matrix","result":[` + strings.Repeat(" ", 1000) + `!`
+	_, err := Query(ts.URL, start, end, "up", Options{})
+	decodeErr, ok := err.(*DecodeError)
+	assert.True(t, ok)
+	assert.Equal(t, ts.URL, decodeErr.Host)
+	assert.Equal(t, "up", decodeErr.Query)
+	assert.Len(t, decodeErr.Snippet, maxSnippet)
+	assert.True(t, strings.HasPrefix(body, decodeErr.Snippet))
+	assert.Contains(t, err.Error(), "for up")
+
+	// Samples of the wrong shape don't panic
+	body = `{"status":"success","data":{"resultType":"matrix","result":[{"metric":{},"values":[["1502749390","1"]]}]}}`
+	_, err = Query(ts.URL, start, end, "up", Options{})
+	_, ok = err.(*DecodeError)
+	assert.True(t, ok)
+
+	body = `{"status":"success","data":{"resultType":"matrix","result":[{"metric":{},"values":[[1502749390]]}]}}`
+	_, err = Query(ts.URL, start, end, "up", Options{})
+	_, ok = err.(*DecodeError)
+	assert.True(t, ok)
+}
+
+func TestQueryMaxPoints(t *testing.T) {
+	var ranges [][2]int64
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start, _ := strconv.ParseInt(r.URL.Query().Get("start"), 10, 64)
+		end, _ := strconv.ParseInt(r.URL.Query().Get("end"), 10, 64)
+		step, _ := strconv.ParseInt(r.URL.Query().Get("step"), 10, 64)
+		if (end-start)/step+1 > MaxPoints {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `{"status":"error","errorType":"bad_data","error":"exceeded maximum resolution of 11,000 points per timeseries"}`)
+			return
+		}
+		ranges = append(ranges, [2]int64{start, end})
+		fmt.Fprintf(w, `{"status":"success","data":{"resultType":"matrix","result":[{"metric":{"__name__":"up"},"values":[[%d,"1"],[%d,"1"]]}]}}`, start, end)
+	}))
+	defer ts.Close()
+
+	// 30 days at a step of 30s are 86401 points
+	start := time.Unix(1500000000, 0)
+	end := start.Add(30 * 24 * time.Hour)
+	results, err := Query(ts.URL, start, end, "up", Options{Step: 30})
+	assert.NoError(t, err)
+	assert.Len(t, ranges, 8)
+	assert.Equal(t, start.Unix(), ranges[0][0])
+	assert.Equal(t, end.Unix(), ranges[7][1])
+	for i := 1; i < len(ranges); i++ {
+		assert.Equal(t, ranges[i-1][1]+30, ranges[i][0])
+	}
+
+	assert.Len(t, results, 1)
+	assert.Len(t, results[0].Values, 16)
+}
+
+func TestQueryParallelism(t *testing.T) {
+	var mu sync.Mutex
+	var running, most int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		running++
+		if running > most {
+			most = running
+		}
+		mu.Unlock()
+		time.Sleep(20 * time.Millisecond)
+		mu.Lock()
+		running--
+		mu.Unlock()
+
+		// Every chunk returns its own series, so the order is visible.
+		start := r.URL.Query().Get("start")
+		fmt.Fprintf(w, `{"status":"success","data":{"resultType":"matrix","result":[{"metric":{"chunk":"%s"},"values":[[%s,"1"]]}]}}`, start, start)
+	}))
+	defer ts.Close()
+
+	start := time.Unix(1500000000, 0)
+	end := start.Add(30 * 24 * time.Hour)
+	results, err := Query(ts.URL, start, end, "up", Options{Step: 30, Parallelism: 3})
+	assert.NoError(t, err)
+	assert.True(t, most > 1 && most <= 3, "ran %d at once", most)
+	assert.Len(t, results, 8)
+	for i := 1; i < len(results); i++ {
+		assert.True(t, results[i-1].Labels["chunk"] < results[i].Labels["chunk"])
+	}
+}
+
+func TestQueryGzip(t *testing.T) {
+	var encoding string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		encoding = r.Header.Get("Accept-Encoding")
+		body, _ := ioutil.ReadFile("testdata/query_range.json")
+		if encoding == "gzip" {
+			w.Header().Set("Content-Encoding", "gzip")
+			zw := gzip.NewWriter(w)
+			zw.Write(body)
+			zw.Close()
+			return
+		}
+		w.Write(body)
+	}))
+	defer ts.Close()
+
+	f, err := ioutil.TempFile("", "styx-gzip")
+	assert.NoError(t, err)
+	f.Close()
+	defer os.Remove(f.Name())
+
+	// Custom transports get compressed responses too, they're recorded
+	// compressed and replayed.
+	live, err := Query(ts.URL, time.Now().Add(-time.Hour), time.Now(), "go_goroutines",
+		Options{Transport: RecordTransport{Path: f.Name()}})
+	assert.NoError(t, err)
+	assert.Equal(t, "gzip", encoding)
+	assert.Len(t, live, 2)
+
+	recorded, err := ioutil.ReadFile(f.Name())
+	assert.NoError(t, err)
+	assert.True(t, bytes.HasPrefix(recorded, gzipMagic))
+
+	replayed, err := Query(ts.URL, time.Now().Add(-time.Hour), time.Now(), "go_goroutines",
+		Options{Transport: ReplayTransport{Path: f.Name()}})
+	assert.NoError(t, err)
+	assert.Equal(t, live, replayed)
+
+	// A header of the options turns it off.
+	plain, err := Query(ts.URL, time.Now().Add(-time.Hour), time.Now(), "go_goroutines",
+		Options{Header: http.Header{"Accept-Encoding": {"identity"}}})
+	assert.NoError(t, err)
+	assert.Equal(t, "identity", encoding)
+	assert.Equal(t, live, plain)
+}
+
+func TestQueryWarnings(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Query().Get("query") {
+		case "error":
+			fmt.Fprint(w, `{"status":"error","errorType":"execution","error":"query processing would load too many samples","warnings":["partial"]}`)
+		default:
+			fmt.Fprint(w, `{"status":"success","warnings":["store gateway unavailable"],"data":{"resultType":"matrix","result":[`+
+				`{"metric":{"job":"a"},"values":[[1502749390,"1"]]}]}}`)
+		}
+	}))
+	defer ts.Close()
+
+	start, end := time.Unix(1502745790, 0), time.Unix(1502749390, 0)
+	var warnings []Warning
+	opts := Options{OnWarning: func(w Warning) { warnings = append(warnings, w) }}
+
+	results, err := Query(ts.URL, start, end, "up", opts)
+	assert.NoError(t, err)
+	assert.Len(t, results, 1)
+	assert.Equal(t, []Warning{{Host: ts.URL, Query: "up", Message: "store gateway unavailable"}}, warnings)
+	assert.Equal(t, ts.URL+" for up: store gateway unavailable", warnings[0].String())
+
+	// Errors with 200 OK are errors nonetheless, with their warnings.
+	want := &APIError{
+		StatusCode: http.StatusOK,
+		Type:       "execution",
+		Message:    "query processing would load too many samples",
+		Warnings:   []string{"partial"},
+	}
+	_, err = Query(ts.URL, start, end, "error", opts)
+	assert.Equal(t, want, err)
+	assert.True(t, errors.Is(err, ErrBadStatus))
+	_, err = QueryInstant(ts.URL, end, "error", opts)
+	assert.Equal(t, want, err)
+	err = QueryStream(ts.URL, start, end, "error", opts, func(Result) error { return nil })
+	assert.Equal(t, want, err)
+	assert.Len(t, warnings, 1)
+}
+
+func TestQueryMethod(t *testing.T) {
+	var methods, queries []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.NoError(t, r.ParseForm())
+		if r.Method == http.MethodPost {
+			assert.Equal(t, "application/x-www-form-urlencoded", r.Header.Get("Content-Type"))
+			assert.Empty(t, r.URL.RawQuery)
+		}
+		methods = append(methods, r.Method)
+		queries = append(queries, r.Form.Get("query"))
+		http.ServeFile(w, r, "testdata/query_range.json")
+	}))
+	defer ts.Close()
+
+	start, end := time.Unix(1502745790, 0), time.Unix(1502749390, 0)
+	long := `up{instance=~"` + strings.Repeat("node-1234.example.com:9100|", 200) + `"}`
+
+	for _, opts := range []Options{{}, {Method: "get"}, {Method: "POST"}} {
+		_, err := Query(ts.URL, start, end, "up", opts)
+		assert.NoError(t, err)
+		_, err = Query(ts.URL, start, end, long, opts)
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, []string{"GET", "POST", "GET", "GET", "POST", "POST"}, methods)
+	assert.Equal(t, []string{"up", long, "up", long, "up", long}, queries)
+
+	// The matrix isn't a vector, but it was asked for with POST.
+	methods = nil
+	_, err := QueryInstant(ts.URL, end, long, Options{})
+	assert.Error(t, err)
+	assert.Equal(t, []string{"POST"}, methods)
+}
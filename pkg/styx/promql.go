@@ -0,0 +1,310 @@
+package styx
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// labelNameRE matches valid label names.
+var labelNameRE = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// promqlAggregations are the aggregation operators, which are followed by
+// their parameters or a by or without clause. Elsewhere they're metric
+// names, like all keywords PromQL allows as such.
+var promqlAggregations = map[string]bool{
+	"sum": true, "min": true, "max": true, "avg": true, "group": true,
+	"stddev": true, "stdvar": true, "count": true, "count_values": true,
+	"bottomk": true, "topk": true, "quantile": true,
+	"limitk": true, "limit_ratio": true,
+}
+
+// promqlGroupings are the clauses of aggregations, following them or their
+// parameters with a list of label names.
+var promqlGroupings = map[string]bool{
+	"by": true, "without": true,
+}
+
+// promqlInfixes are the keywords following an operand, a binary operator
+// or offset.
+var promqlInfixes = map[string]bool{
+	"and": true, "or": true, "unless": true, "atan2": true, "offset": true,
+}
+
+// promqlModifiers are the keywords of binary operators that are never
+// metric names, the ones but bool followed by a list of label names.
+var promqlModifiers = map[string]bool{
+	"bool": true, "on": true, "ignoring": true, "group_left": true, "group_right": true,
+}
+
+// promqlNumbers are the identifiers that are numbers.
+var promqlNumbers = map[string]bool{
+	"inf": true, "nan": true,
+}
+
+// injectMatchers adds an equality matcher for every label in matchers to
+// every vector selector of query, e.g. to restrict it to a tenant with
+// namespace="a". Selectors already matching the label keep their matcher,
+// both have to match then. Queries that can't be tokenized are an error,
+// rather than risking a selector being left out.
+func injectMatchers(query string, matchers map[string]string) (string, error) {
+	if len(matchers) == 0 {
+		return query, nil
+	}
+
+	var names []string
+	for name := range matchers {
+		if !labelNameRE.MatchString(name) {
+			return "", fmt.Errorf("invalid label name: %s", name)
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var injected []string
+	for _, name := range names {
+		injected = append(injected, name+"="+strconv.Quote(matchers[name]))
+	}
+	inject := strings.Join(injected, ",")
+
+	var out strings.Builder
+	parens := 0
+	// Whether the last token ended an operand, and the last keyword or
+	// punctuation, tell keywords from metric names.
+	operand, prev := false, ""
+
+	for i := 0; i < len(query); {
+		c := query[i]
+
+		switch {
+		case isSpace(c):
+			out.WriteByte(c)
+			i++
+			continue
+
+		case c == '#':
+			end := strings.IndexByte(query[i:], '\n')
+			if end < 0 {
+				end = len(query) - i
+			}
+			out.WriteString(query[i : i+end])
+			i += end
+			continue
+
+		case c == '"' || c == '\'' || c == '`':
+			end, err := scanString(query, i)
+			if err != nil {
+				return "", err
+			}
+			out.WriteString(query[i:end])
+			i = end
+			operand, prev = true, ""
+
+		case isDigit(c) || c == '.' && i+1 < len(query) && isDigit(query[i+1]):
+			end := scanNumber(query, i)
+			out.WriteString(query[i:end])
+			i = end
+			operand, prev = true, ""
+
+		case c == '[':
+			// Ranges and subqueries only hold durations.
+			end := strings.IndexByte(query[i:], ']')
+			if end < 0 {
+				return "", fmt.Errorf("unclosed [ at position %d", i)
+			}
+			out.WriteString(query[i : i+end+1])
+			i += end + 1
+			operand, prev = true, ""
+
+		case c == '{':
+			end, err := scanBraces(query, i)
+			if err != nil {
+				return "", err
+			}
+			out.WriteString(injectBraces(query[i:end], inject))
+			i = end
+			operand, prev = true, ""
+
+		case isIdentStart(c):
+			end := i
+			for end < len(query) && isIdent(query[end]) {
+				end++
+			}
+			ident := query[i:end]
+			out.WriteString(ident)
+			i = end
+
+			next := skipSpaces(query, i)
+			keyword := strings.ToLower(ident)
+			followedBy := func(c byte) bool { return next < len(query) && query[next] == c }
+			switch {
+			case promqlNumbers[keyword]:
+				operand, prev = true, ""
+				continue
+			case promqlModifiers[keyword],
+				promqlGroupings[keyword] && followedBy('(') && (promqlAggregations[prev] || prev == ")"):
+				if keyword != "bool" && followedBy('(') {
+					list := strings.IndexByte(query[next:], ')')
+					if list < 0 {
+						return "", fmt.Errorf("unclosed label list of %s", ident)
+					}
+					out.WriteString(query[i : next+list+1])
+					i = next + list + 1
+				}
+				// The clause ends the aggregation if following its parameters.
+				operand, prev = promqlGroupings[keyword] && prev == ")", keyword
+				continue
+			case promqlAggregations[keyword] && (followedBy('(') || promqlGroupings[strings.ToLower(identAt(query, next))]),
+				promqlInfixes[keyword] && operand:
+				operand, prev = false, keyword
+				continue
+			case followedBy('('):
+				// A function call
+				operand, prev = false, ""
+				continue
+			case followedBy('{'):
+				end, err := scanBraces(query, next)
+				if err != nil {
+					return "", err
+				}
+				out.WriteString(query[i:next])
+				out.WriteString(injectBraces(query[next:end], inject))
+				i = end
+			default:
+				out.WriteString("{" + inject + "}")
+			}
+			operand, prev = true, ""
+
+		case c == '(':
+			parens++
+			out.WriteByte(c)
+			i++
+			operand, prev = false, "("
+
+		case c == ')':
+			parens--
+			if parens < 0 {
+				return "", fmt.Errorf("unexpected ) at position %d", i)
+			}
+			out.WriteByte(c)
+			i++
+			operand, prev = true, ")"
+
+		case strings.IndexByte("+-*/%^=!<>~@:,", c) >= 0:
+			out.WriteByte(c)
+			i++
+			operand, prev = false, string(c)
+
+		default:
+			return "", fmt.Errorf("unexpected character %q at position %d", c, i)
+		}
+	}
+
+	if parens != 0 {
+		return "", fmt.Errorf("unclosed ( in query")
+	}
+
+	return out.String(), nil
+}
+
+// injectBraces adds the matchers to the label matchers in braces.
+func injectBraces(braces, inject string) string {
+	inner := strings.TrimSpace(braces[1 : len(braces)-1])
+	inner = strings.TrimSpace(strings.TrimSuffix(inner, ","))
+	if inner == "" {
+		return "{" + inject + "}"
+	}
+	return "{" + inner + "," + inject + "}"
+}
+
+// scanString returns the position after the string literal starting at i.
+func scanString(query string, i int) (int, error) {
+	quote := query[i]
+	for j := i + 1; j < len(query); j++ {
+		switch query[j] {
+		case '\\':
+			// Raw strings have no escapes.
+			if quote != '`' {
+				j++
+			}
+		case quote:
+			return j + 1, nil
+		}
+	}
+	return 0, fmt.Errorf("unterminated string at position %d", i)
+}
+
+// scanBraces returns the position after the label matchers starting at i.
+func scanBraces(query string, i int) (int, error) {
+	for j := i + 1; j < len(query); j++ {
+		switch c := query[j]; {
+		case c == '}':
+			return j + 1, nil
+		case c == '"' || c == '\'' || c == '`':
+			end, err := scanString(query, j)
+			if err != nil {
+				return 0, err
+			}
+			j = end - 1
+		case c == '{':
+			return 0, fmt.Errorf("unexpected { at position %d", j)
+		}
+	}
+	return 0, fmt.Errorf("unclosed { at position %d", i)
+}
+
+// scanNumber returns the position after the number or duration at i,
+// e.g. 1.5, 1e-3, 0x1f or 1h30m.
+func scanNumber(query string, i int) int {
+	j := i
+	for j < len(query) {
+		c := query[j]
+		if isIdent(c) && c != ':' || c == '.' {
+			j++
+			continue
+		}
+		if (c == '+' || c == '-') && (query[j-1] == 'e' || query[j-1] == 'E') && !strings.HasPrefix(strings.ToLower(query[i:j]), "0x") {
+			j++
+			continue
+		}
+		break
+	}
+	return j
+}
+
+// identAt returns the identifier at i, empty if there's none.
+func identAt(query string, i int) string {
+	if i >= len(query) || !isIdentStart(query[i]) {
+		return ""
+	}
+	end := i
+	for end < len(query) && isIdent(query[end]) {
+		end++
+	}
+	return query[i:end]
+}
+
+func skipSpaces(query string, i int) int {
+	for i < len(query) && isSpace(query[i]) {
+		i++
+	}
+	return i
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r'
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isIdentStart(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '_' || c == ':'
+}
+
+func isIdent(c byte) bool {
+	return isIdentStart(c) || isDigit(c)
+}
@@ -0,0 +1,188 @@
+package styx
+
+import (
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInjectMatchers(t *testing.T) {
+	tenant := map[string]string{"namespace": "teamA"}
+
+	for query, expected := range map[string]string{
+		`up`:                            `up{namespace="teamA"}`,
+		`up{}`:                          `up{namespace="teamA"}`,
+		`up{job="node"}`:                `up{job="node",namespace="teamA"}`,
+		`up {job="node",}`:              `up {job="node",namespace="teamA"}`,
+		`{__name__="up"}`:               `{__name__="up",namespace="teamA"}`,
+		`job:http_requests:5m`:          `job:http_requests:5m{namespace="teamA"}`,
+		`rate(http_requests_total[5m])`: `rate(http_requests_total{namespace="teamA"}[5m])`,
+		`sum by (job) (rate(http_requests_total{code=~"5.."}[5m] offset 1h))`: `sum by (job) (rate(http_requests_total{code=~"5..",namespace="teamA"}[5m] offset 1h))`,
+		`sum(rate(x[5m])) without (instance)`:                                 `sum(rate(x{namespace="teamA"}[5m])) without (instance)`,
+		`a / on(job) group_left(team) b`:                                      `a{namespace="teamA"} / on(job) group_left(team) b{namespace="teamA"}`,
+		`a > bool 1e-3 and b unless c or d`:                                   `a{namespace="teamA"} > bool 1e-3 and b{namespace="teamA"} unless c{namespace="teamA"} or d{namespace="teamA"}`,
+		`topk(5, x) * 0x1F + Inf - NaN`:                                       `topk(5, x{namespace="teamA"}) * 0x1F + Inf - NaN`,
+		`max_over_time(deriv(x[1h:5m])[1d:])`:                                 `max_over_time(deriv(x{namespace="teamA"}[1h:5m])[1d:])`,
+		`label_replace(up, "dst", "$1", "src", "(.*)")`:                       `label_replace(up{namespace="teamA"}, "dst", "$1", "src", "(.*)")`,
+		`x{path="a}b,\"c"} @ start()`:                                         `x{path="a}b,\"c",namespace="teamA"} @ start()`,
+		"up # a comment naming foo\n+ down":                                   "up{namespace=\"teamA\"} # a comment naming foo\n+ down{namespace=\"teamA\"}",
+		`vector(1)`:                                                           `vector(1)`,
+		`sum`:                                                                 `sum{namespace="teamA"}`,
+		`or`:                                                                  `or{namespace="teamA"}`,
+		`sum(count) by (by)`:                                                  `sum(count{namespace="teamA"}) by (by)`,
+		`and and or offset 5m`:                                                `and{namespace="teamA"} and or{namespace="teamA"} offset 5m`,
+		`count(up) by (job) or on(job) group_right() by`:                      `count(up{namespace="teamA"}) by (job) or on(job) group_right() by{namespace="teamA"}`,
+	} {
+		injected, err := injectMatchers(query, tenant)
+		assert.NoError(t, err, query)
+		assert.Equal(t, expected, injected, query)
+	}
+
+	// Matchers are injected in order of their label
+	injected, err := injectMatchers(`up`, map[string]string{"b": `x"y`, "a": "z"})
+	assert.NoError(t, err)
+	assert.Equal(t, `up{a="z",b="x\"y"}`, injected)
+
+	// Nothing to inject
+	injected, err = injectMatchers(`up`, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, `up`, injected)
+
+	// Queries that can't be rewritten safely
+	for _, query := range []string{
+		`up{job="node"`,
+		`up{job="node}`,
+		`rate(up[5m]`,
+		`rate(up[5m)`,
+		`sum(up))`,
+		`up; down`,
+		`sum by (job up`,
+	} {
+		_, err := injectMatchers(query, tenant)
+		assert.Error(t, err, query)
+	}
+
+	_, err = injectMatchers(`up`, map[string]string{"name-space": "a"})
+	assert.Error(t, err)
+}
+
+// promqlGen generates random queries with the query the matchers are
+// expected to be injected into, knowing where its selectors are.
+type promqlGen struct {
+	rnd    *rand.Rand
+	inject string
+}
+
+// metric returns a metric name, keywords included as PromQL allows them
+// as metric names outside of their own positions.
+func (g promqlGen) metric() string {
+	names := []string{"up", "http_requests_total", "job:rate:5m", "_x1",
+		"sum", "count", "group", "topk", "by", "without", "and", "or", "unless", "offset", "start", "end"}
+	return names[g.rnd.Intn(len(names))]
+}
+
+func (g promqlGen) pick(options ...string) string {
+	return options[g.rnd.Intn(len(options))]
+}
+
+// selector returns a vector selector, optionally with a modifier, and how
+// it looks with the matchers.
+func (g promqlGen) selector() (string, string) {
+	var query, expected string
+	switch g.rnd.Intn(4) {
+	case 0:
+		name := g.metric()
+		query, expected = name, name+"{"+g.inject+"}"
+	case 1:
+		name := g.metric()
+		query, expected = name+"{}", name+"{"+g.inject+"}"
+	case 2:
+		name, space := g.metric(), g.pick("", " ")
+		matchers := g.pick(`job="node"`, `path=~"a}b,\"c"`, "code!~`5..`", `job='x'`)
+		query, expected = name+space+"{"+matchers+"}", name+space+"{"+matchers+","+g.inject+"}"
+	default:
+		query, expected = `{__name__="up"}`, `{__name__="up",`+g.inject+`}`
+	}
+	if g.rnd.Intn(4) == 0 {
+		modifier := g.pick(" offset 5m", " offset -1h30m", " @ 1609746000", " @ start()", " @ end()")
+		query, expected = query+modifier, expected+modifier
+	}
+	return query, expected
+}
+
+// expr returns a random query of at most depth levels and how it looks
+// with the matchers.
+func (g promqlGen) expr(depth int) (string, string) {
+	if depth <= 0 {
+		if g.rnd.Intn(4) == 0 {
+			n := g.pick("1", "0.5", "1e-3", "Inf", "NaN", "0x1F")
+			return n, n
+		}
+		return g.selector()
+	}
+
+	switch g.rnd.Intn(8) {
+	case 0:
+		q, e := g.selector()
+		fn := g.pick("rate", "increase", "max_over_time")
+		return fn + "(" + q + "[5m])", fn + "(" + e + "[5m])"
+	case 1:
+		q, e := g.expr(depth - 1)
+		fn := g.pick("abs", "sort", "vector", "timestamp")
+		return fn + "(" + q + ")", fn + "(" + e + ")"
+	case 2:
+		q, e := g.expr(depth - 1)
+		agg := g.pick("sum", "count", "max", "group", "stddev")
+		switch g.rnd.Intn(3) {
+		case 0:
+			return agg + "(" + q + ")", agg + "(" + e + ")"
+		case 1:
+			clause := g.pick(" by (job) ", " without (instance, by) ", " by() ")
+			return agg + clause + "(" + q + ")", agg + clause + "(" + e + ")"
+		default:
+			clause := g.pick(" by (job)", " without (instance)")
+			return agg + "(" + q + ")" + clause, agg + "(" + e + ")" + clause
+		}
+	case 3:
+		q, e := g.expr(depth - 1)
+		agg := g.pick("topk(5, ", "quantile(0.9, ", `count_values("value", `)
+		return agg + q + ")", agg + e + ")"
+	case 4:
+		q, e := g.expr(depth - 1)
+		args := `, "dst", "$1", "src", "(.*)")`
+		return "label_replace(" + q + args, "label_replace(" + e + args
+	case 5:
+		q, e := g.expr(depth - 1)
+		return "(" + q + ")", "(" + e + ")"
+	case 6:
+		q, e := g.expr(depth - 1)
+		sub := g.pick("[1h:5m]", "[1d:]")
+		return "max_over_time((" + q + ")" + sub + ")", "max_over_time((" + e + ")" + sub + ")"
+	}
+
+	lq, le := g.expr(depth - 1)
+	rq, re := g.expr(depth - 1)
+	op := g.pick("+", "-", "*", "/", "%", "^", "==", "!=", ">", "<", ">=", "<=", "and", "or", "unless", "atan2")
+	if strings.ContainsAny(op, "=<>") && g.rnd.Intn(2) == 0 {
+		op += " bool"
+	}
+	if g.rnd.Intn(3) == 0 {
+		op += g.pick(" on(job)", " ignoring(instance)", " on(job) group_left(team)", " on(job) group_right()")
+	}
+	return lq + " " + op + " " + rq, le + " " + op + " " + re
+}
+
+// TestInjectMatchersGenerated checks that every selector of random
+// queries gets the matchers, and that nothing else is changed.
+func TestInjectMatchersGenerated(t *testing.T) {
+	g := promqlGen{rnd: rand.New(rand.NewSource(1)), inject: `namespace="teamA"`}
+	for i := 0; i < 20000; i++ {
+		query, expected := g.expr(g.rnd.Intn(5))
+		injected, err := injectMatchers(query, map[string]string{"namespace": "teamA"})
+		if !assert.NoError(t, err, "%s", query) || !assert.Equal(t, expected, injected, "%s", query) {
+			return
+		}
+	}
+}
@@ -0,0 +1,284 @@
+package styx
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// RemoteWriteMaxSamples is the default number of samples per request, the
+// same as Prometheus' max_samples_per_send.
+const RemoteWriteMaxSamples = 2000
+
+// RemoteWrite pushes results to an endpoint of Prometheus' remote write
+// protocol, like Prometheus, Mimir, Thanos Receive or VictoriaMetrics, e.g.
+// to backfill another server with the results of a query.
+type RemoteWrite struct {
+	// URL is the endpoint, e.g. http://localhost:9090/api/v1/write.
+	URL string
+	// Header is sent with every request, e.g. Authorization or X-Scope-OrgID.
+	Header http.Header
+	// Client sends the requests, defaults to http.DefaultClient.
+	Client *http.Client
+	// Name is the metric name of results without one, like the result of sum().
+	Name string
+	// Labels renames and drops labels before pushing.
+	Labels LabelMapping
+	// MaxSamples is the number of samples per request, defaults to
+	// RemoteWriteMaxSamples. Series are split across requests if necessary.
+	MaxSamples int
+	// Retries, RetryBackoff and OnRetry retry failed requests like Options do.
+	Retries      int
+	RetryBackoff time.Duration
+	OnRetry      func(wait time.Duration, reason string)
+	// Context cancels the requests.
+	Context context.Context
+}
+
+// remoteSeries is a TimeSeries of the remote write protocol.
+type remoteSeries struct {
+	Labels  [][2]string
+	Samples []remoteSample
+}
+
+type remoteSample struct {
+	Value     float64
+	Timestamp int64
+}
+
+// Push writes the samples of the results in requests of at most MaxSamples
+// samples. Special float values are pushed as such, missing points are
+// skipped.
+func (rw RemoteWrite) Push(results []Result) error {
+	for _, series := range rw.requests(results) {
+		if err := rw.send(encodeWriteRequest(series)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// requests returns the series of every request.
+func (rw RemoteWrite) requests(results []Result) [][]remoteSeries {
+	max := rw.MaxSamples
+	if max <= 0 {
+		max = RemoteWriteMaxSamples
+	}
+
+	var requests [][]remoteSeries
+	var request []remoteSeries
+	samples := 0
+	for _, result := range results {
+		series := rw.series(result)
+
+		for len(series.Samples) > 0 {
+			if samples == max {
+				requests = append(requests, request)
+				request, samples = nil, 0
+			}
+
+			n := len(series.Samples)
+			if n > max-samples {
+				n = max - samples
+			}
+			request = append(request, remoteSeries{Labels: series.Labels, Samples: series.Samples[:n]})
+			series.Samples = series.Samples[n:]
+			samples += n
+		}
+	}
+	if samples > 0 {
+		requests = append(requests, request)
+	}
+
+	return requests
+}
+
+// series returns the labels sorted by name, as the protocol requires, and
+// the samples in order of time.
+func (rw RemoteWrite) series(result Result) remoteSeries {
+	name := result.Labels["__name__"]
+	if name == "" {
+		name = rw.Name
+	}
+	labels := [][2]string{{"__name__", name}}
+	for key, value := range rw.Labels.apply(result.Labels) {
+		if value != "" {
+			labels = append(labels, [2]string{key, value})
+		}
+	}
+	sort.Slice(labels, func(i, j int) bool { return labels[i][0] < labels[j][0] })
+
+	var series remoteSeries
+	series.Labels = labels
+	for j, time := range result.Times {
+		if v := result.Values[j]; !IsMissing(v) {
+			series.Samples = append(series.Samples, remoteSample{Value: v, Timestamp: time * 1000})
+		}
+	}
+	return series
+}
+
+// send posts a snappy compressed WriteRequest.
+func (rw RemoteWrite) send(body []byte) error {
+	ctx := rw.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	client := rw.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	req, err := http.NewRequest(http.MethodPost, rw.URL, bytes.NewReader(snappyEncode(body)))
+	if err != nil {
+		return err
+	}
+	for name, values := range rw.Header {
+		req.Header[name] = values
+	}
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("Content-Encoding", "snappy")
+	req.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+
+	resp, err := doRetrying(ctx, client, req, rw.Retries, rw.RetryBackoff, rw.OnRetry)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		snippet, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 256))
+		return fmt.Errorf("remote write to %s failed with %s: %s", rw.URL, resp.Status, bytes.TrimSpace(snippet))
+	}
+	return nil
+}
+
+// encodeWriteRequest encodes the series as WriteRequest protobuf message:
+//
+//	message WriteRequest { repeated TimeSeries timeseries = 1; }
+//	message TimeSeries { repeated Label labels = 1; repeated Sample samples = 2; }
+//	message Label { string name = 1; string value = 2; }
+//	message Sample { double value = 1; int64 timestamp = 2; }
+func encodeWriteRequest(series []remoteSeries) []byte {
+	var req, ts, msg bytes.Buffer
+	for _, s := range series {
+		ts.Reset()
+		for _, label := range s.Labels {
+			msg.Reset()
+			protoString(&msg, 1, label[0])
+			protoString(&msg, 2, label[1])
+			protoBytes(&ts, 1, msg.Bytes())
+		}
+		for _, sample := range s.Samples {
+			msg.Reset()
+			var b [8]byte
+			binary.LittleEndian.PutUint64(b[:], math.Float64bits(sample.Value))
+			putUvarint(&msg, 1<<3|1)
+			msg.Write(b[:])
+			putUvarint(&msg, 2<<3|0)
+			putUvarint(&msg, uint64(sample.Timestamp))
+			protoBytes(&ts, 2, msg.Bytes())
+		}
+		protoBytes(&req, 1, ts.Bytes())
+	}
+	return req.Bytes()
+}
+
+// protoBytes writes a length-delimited field.
+func protoBytes(buf *bytes.Buffer, field int, b []byte) {
+	putUvarint(buf, uint64(field)<<3|2)
+	putUvarint(buf, uint64(len(b)))
+	buf.Write(b)
+}
+
+func protoString(buf *bytes.Buffer, field int, s string) {
+	protoBytes(buf, field, []byte(s))
+}
+
+// snappyBlock is the size of the blocks snappyEncode looks for matches in,
+// so offsets always fit into two bytes.
+const snappyBlock = 1 << 16
+
+// snappyEncode compresses src in the snappy block format remote write
+// requires. It greedily replaces repeats of 4 or more bytes, like the labels
+// of consecutive series, with copies, which is far from the compression of
+// the reference implementation but cheap.
+func snappyEncode(src []byte) []byte {
+	var buf bytes.Buffer
+	putUvarint(&buf, uint64(len(src)))
+
+	for len(src) > 0 {
+		block := src
+		if len(block) > snappyBlock {
+			block = block[:snappyBlock]
+		}
+		src = src[len(block):]
+
+		// table holds the position+1 of the last 4 bytes with a hash.
+		var table [1 << 14]int32
+		literal := 0
+		for i := 0; i+4 <= len(block); {
+			v := binary.LittleEndian.Uint32(block[i:])
+			h := (v * 0x1e35a7bd) >> 18
+			candidate := int(table[h]) - 1
+			table[h] = int32(i + 1)
+			if candidate < 0 || binary.LittleEndian.Uint32(block[candidate:]) != v {
+				i++
+				continue
+			}
+
+			n := 4
+			for i+n < len(block) && block[candidate+n] == block[i+n] {
+				n++
+			}
+			snappyLiteral(&buf, block[literal:i])
+			snappyCopy(&buf, i-candidate, n)
+			i += n
+			literal = i
+		}
+		snappyLiteral(&buf, block[literal:])
+	}
+
+	return buf.Bytes()
+}
+
+func snappyLiteral(buf *bytes.Buffer, lit []byte) {
+	if len(lit) == 0 {
+		return
+	}
+	n := len(lit) - 1
+	switch {
+	case n < 60:
+		buf.WriteByte(byte(n) << 2)
+	case n < 1<<8:
+		buf.WriteByte(60 << 2)
+		buf.WriteByte(byte(n))
+	default:
+		// Blocks are at most 64 KiB, so two bytes always suffice.
+		buf.WriteByte(61 << 2)
+		buf.WriteByte(byte(n))
+		buf.WriteByte(byte(n >> 8))
+	}
+	buf.Write(lit)
+}
+
+// snappyCopy writes copies with a two byte offset of at most 64 bytes each.
+func snappyCopy(buf *bytes.Buffer, offset, length int) {
+	for length > 0 {
+		n := length
+		if n > 64 {
+			n = 64
+		}
+		buf.WriteByte(byte(n-1)<<2 | 2)
+		buf.WriteByte(byte(offset))
+		buf.WriteByte(byte(offset >> 8))
+		length -= n
+	}
+}
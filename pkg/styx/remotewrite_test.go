@@ -0,0 +1,164 @@
+package styx
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io/ioutil"
+	"math"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// snappyDecode decodes the snappy block format, to check snappyEncode.
+func snappyDecode(src []byte) ([]byte, error) {
+	n, read := binary.Uvarint(src)
+	if read <= 0 {
+		return nil, errors.New("invalid length")
+	}
+	src = src[read:]
+
+	var dst []byte
+	for len(src) > 0 {
+		tag := src[0]
+		switch tag & 3 {
+		case 0:
+			length := int(tag>>2) + 1
+			src = src[1:]
+			switch tag >> 2 {
+			case 60:
+				length, src = int(src[0])+1, src[1:]
+			case 61:
+				length, src = int(src[0])+int(src[1])<<8+1, src[2:]
+			}
+			if length > len(src) {
+				return nil, errors.New("literal beyond the input")
+			}
+			dst, src = append(dst, src[:length]...), src[length:]
+		case 2:
+			length, offset := int(tag>>2)+1, int(src[1])|int(src[2])<<8
+			src = src[3:]
+			if offset == 0 || offset > len(dst) {
+				return nil, errors.New("invalid offset")
+			}
+			for i := 0; i < length; i++ {
+				dst = append(dst, dst[len(dst)-offset])
+			}
+		default:
+			return nil, errors.New("unexpected tag")
+		}
+	}
+	if uint64(len(dst)) != n {
+		return nil, errors.New("wrong length")
+	}
+	return dst, nil
+}
+
+func TestSnappyEncode(t *testing.T) {
+	random := make([]byte, 100000)
+	rand.New(rand.NewSource(1)).Read(random)
+
+	for _, src := range [][]byte{
+		nil,
+		[]byte("abc"),
+		bytes.Repeat([]byte("up{job=\"node\"} "), 10000),
+		random,
+		append(bytes.Repeat([]byte{0}, 70000), random[:300]...),
+	} {
+		encoded := snappyEncode(src)
+		decoded, err := snappyDecode(encoded)
+		assert.NoError(t, err)
+		assert.Equal(t, len(src), len(decoded))
+		assert.True(t, bytes.Equal(src, decoded))
+	}
+
+	// Repeats are compressed.
+	assert.True(t, len(snappyEncode(bytes.Repeat([]byte("up{job=\"node\"} "), 10000))) < 10000)
+}
+
+func TestEncodeWriteRequest(t *testing.T) {
+	req := encodeWriteRequest([]remoteSeries{{
+		Labels:  [][2]string{{"__name__", "up"}},
+		Samples: []remoteSample{{Value: 1, Timestamp: 1000}},
+	}})
+	assert.Equal(t, []byte{
+		0x0a, 0x1e, // timeseries
+		0x0a, 0x0e, 0x0a, 0x08, '_', '_', 'n', 'a', 'm', 'e', '_', '_', 0x12, 0x02, 'u', 'p', // label
+		0x12, 0x0c, 0x09, 0, 0, 0, 0, 0, 0, 0xf0, 0x3f, 0x10, 0xe8, 0x07, // sample
+	}, req)
+}
+
+func TestRemoteWrite(t *testing.T) {
+	var bodies [][]byte
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "snappy", r.Header.Get("Content-Encoding"))
+		assert.Equal(t, "application/x-protobuf", r.Header.Get("Content-Type"))
+		assert.Equal(t, "tenant", r.Header.Get("X-Scope-OrgID"))
+		body, _ := ioutil.ReadAll(r.Body)
+		decoded, err := snappyDecode(body)
+		assert.NoError(t, err)
+		bodies = append(bodies, decoded)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer ts.Close()
+
+	results := []Result{{
+		Metric: `up{job="node"}`,
+		Labels: map[string]string{"__name__": "up", "job": "node", "instance": "a"},
+		Times:  []int64{1, 2, 3},
+		Values: []float64{1, Missing, math.NaN()},
+	}, {
+		Metric: "sum(up)",
+		Labels: map[string]string{},
+		Times:  []int64{1},
+		Values: []float64{2},
+	}}
+	rw := RemoteWrite{
+		URL:        ts.URL,
+		Header:     http.Header{"X-Scope-Orgid": {"tenant"}},
+		Name:       "styx",
+		Labels:     LabelMapping{Drop: []string{"instance"}},
+		MaxSamples: 2,
+	}
+
+	requests := rw.requests(results)
+	assert.Len(t, requests, 2)
+	assert.Equal(t, [][2]string{{"__name__", "up"}, {"job", "node"}}, requests[0][0].Labels)
+	assert.Equal(t, int64(3000), requests[0][0].Samples[1].Timestamp)
+	assert.Equal(t, [][2]string{{"__name__", "styx"}}, requests[1][0].Labels)
+
+	assert.NoError(t, rw.Push(results))
+	assert.Equal(t, [][]byte{encodeWriteRequest(requests[0]), encodeWriteRequest(requests[1])}, bodies)
+
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "out of order sample", http.StatusBadRequest)
+	}))
+	defer failing.Close()
+	rw.URL = failing.URL
+	err := rw.Push(results)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "out of order sample")
+}
+
+func TestRemoteWriteRetries(t *testing.T) {
+	var bodies []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		bodies = append(bodies, string(body))
+		if len(bodies) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer ts.Close()
+
+	rw := RemoteWrite{URL: ts.URL, Retries: 1, RetryBackoff: time.Millisecond}
+	assert.NoError(t, rw.Push([]Result{{Metric: "up", Labels: map[string]string{"__name__": "up"}, Times: []int64{1}, Values: []float64{1}}}))
+	assert.Len(t, bodies, 2)
+	assert.NotEmpty(t, bodies[1])
+	assert.Equal(t, bodies[0], bodies[1])
+}
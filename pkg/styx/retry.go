@@ -0,0 +1,126 @@
+package styx
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// retryBackoff is the wait before retrying a failed request for the first
+// time if Options don't set one, it doubles with every further retry.
+var retryBackoff = time.Second
+
+// maxRetryAfter is the longest wait a Retry-After header is obeyed for,
+// a server asking for more fails the request instead of stalling it.
+var maxRetryAfter = 5 * time.Minute
+
+// retryable reports whether a request answered with code may succeed later.
+func retryable(code int) bool {
+	return code == http.StatusTooManyRequests || code >= 500
+}
+
+// transient reports whether a request failing with err may succeed later,
+// like on a reset connection, unlike e.g. on an invalid certificate.
+func transient(err error) bool {
+	var netErr net.Error
+	return errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		(errors.As(err, &netErr) && netErr.Timeout())
+}
+
+// doRetrying sends req and retries it up to retries times as long as the
+// response has a retryable status or the connection failed transiently.
+// On 429 and 503 it waits as long as Retry-After asks for, up to
+// maxRetryAfter, otherwise it backs off exponentially starting at backoff.
+// onRetry, if not nil, is told every wait and why. The last response or
+// error is returned as is, waiting stops early once ctx is done.
+func doRetrying(ctx context.Context, client *http.Client, req *http.Request, retries int, backoff time.Duration, onRetry func(time.Duration, string)) (*http.Response, error) {
+	if backoff <= 0 {
+		backoff = retryBackoff
+	}
+
+	for i := 0; ; i++ {
+		if i > 0 && req.GetBody != nil {
+			// The body was read by the previous attempt.
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req.Body = body
+		}
+		response, err := client.Do(req.WithContext(ctx))
+		if err != nil {
+			if i >= retries || ctx.Err() != nil || !transient(err) {
+				return nil, err
+			}
+		} else if i >= retries || !retryable(response.StatusCode) {
+			return response, nil
+		}
+
+		wait := backoff
+		backoff *= 2
+		if response != nil {
+			code := response.StatusCode
+			if code == http.StatusTooManyRequests || code == http.StatusServiceUnavailable {
+				if after, ok := retryAfter(response.Header.Get("Retry-After"), time.Now()); ok {
+					if after > maxRetryAfter {
+						return response, nil
+					}
+					wait = after
+				}
+			}
+
+			// Drain the body so the connection can be reused for the retry.
+			io.Copy(ioutil.Discard, io.LimitReader(response.Body, 64*1024))
+			response.Body.Close()
+		}
+
+		if onRetry != nil && err != nil {
+			onRetry(wait, err.Error())
+		} else if onRetry != nil {
+			onRetry(wait, response.Status)
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// retryAfter parses the Retry-After header, given either in seconds or as
+// an HTTP date, into the duration to wait from now.
+func retryAfter(value string, now time.Time) (time.Duration, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, false
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+
+	date, err := http.ParseTime(value)
+	if err != nil {
+		return 0, false
+	}
+	if wait := date.Sub(now); wait > 0 {
+		return wait, true
+	}
+	return 0, true
+}
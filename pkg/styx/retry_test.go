@@ -0,0 +1,142 @@
+package styx
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRetryAfter(t *testing.T) {
+	now := time.Date(2017, 8, 15, 12, 0, 0, 0, time.UTC)
+
+	wait, ok := retryAfter("120", now)
+	assert.True(t, ok)
+	assert.Equal(t, 2*time.Minute, wait)
+
+	wait, ok = retryAfter("Tue, 15 Aug 2017 12:00:30 GMT", now)
+	assert.True(t, ok)
+	assert.Equal(t, 30*time.Second, wait)
+
+	// A date in the past allows to retry right away
+	wait, ok = retryAfter("Tue, 15 Aug 2017 11:00:00 GMT", now)
+	assert.True(t, ok)
+	assert.Equal(t, time.Duration(0), wait)
+
+	for _, invalid := range []string{"", "-1", "soon", "1.5"} {
+		_, ok = retryAfter(invalid, now)
+		assert.False(t, ok, invalid)
+	}
+}
+
+func TestQueryRetries(t *testing.T) {
+	defer func(backoff time.Duration) { retryBackoff = backoff }(retryBackoff)
+	retryBackoff = time.Millisecond
+
+	var codes []int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(codes) > 0 {
+			code := codes[0]
+			codes = codes[1:]
+			if code == http.StatusTooManyRequests {
+				w.Header().Set("Retry-After", "0")
+			}
+			w.WriteHeader(code)
+			return
+		}
+		http.ServeFile(w, r, "testdata/query_range.json")
+	}))
+	defer ts.Close()
+
+	start, end := time.Unix(1502745790, 0), time.Unix(1502749390, 0)
+
+	codes = []int{http.StatusTooManyRequests, http.StatusBadGateway}
+	var retried []string
+	onRetry := func(wait time.Duration, reason string) { retried = append(retried, reason) }
+	results, err := Query(ts.URL, start, end, "up", Options{Retries: 2, OnRetry: onRetry})
+	assert.NoError(t, err)
+	assert.Len(t, results, 2)
+	assert.Equal(t, []string{"429 Too Many Requests", "502 Bad Gateway"}, retried)
+
+	// Out of retries the last response is returned
+	codes = []int{http.StatusTooManyRequests, http.StatusTooManyRequests}
+	_, err = Query(ts.URL, start, end, "up", Options{Retries: 1})
+	assert.EqualError(t, err, "didn't return 200 OK but 429 Too Many Requests: "+ts.URL+"/api/v1/query_range?end=1502749390&query=up&start=1502745790&step=14")
+
+	// Client errors aren't retried
+	codes = []int{http.StatusBadRequest}
+	_, err = Query(ts.URL, start, end, "up", Options{Retries: 2})
+	assert.Error(t, err)
+	assert.Len(t, codes, 0)
+}
+
+func TestQueryRetryAfterContext(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "60")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer ts.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	begin := time.Now()
+	_, err := Query(ts.URL, time.Unix(1502745790, 0), time.Unix(1502749390, 0), "up", Options{Retries: 1, Context: ctx})
+	assert.Equal(t, context.DeadlineExceeded, err)
+	assert.True(t, time.Since(begin) < time.Minute)
+}
+
+func TestQueryRetryAfterTooLong(t *testing.T) {
+	requests := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("Retry-After", "86400")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer ts.Close()
+
+	// Waiting a day isn't retrying, the request fails right away.
+	begin := time.Now()
+	_, err := Query(ts.URL, time.Unix(1502745790, 0), time.Unix(1502749390, 0), "up", Options{Retries: 2})
+	assert.True(t, errors.Is(err, ErrBadStatus))
+	assert.Equal(t, 1, requests)
+	assert.True(t, time.Since(begin) < time.Minute)
+}
+
+func TestQueryRetriesConnection(t *testing.T) {
+	resets := 2
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if resets > 0 {
+			resets--
+			// Close the connection without a response, like a crashed proxy
+			conn, _, _ := w.(http.Hijacker).Hijack()
+			conn.Close()
+			return
+		}
+		http.ServeFile(w, r, "testdata/query_range.json")
+	}))
+	defer ts.Close()
+
+	start, end := time.Unix(1502745790, 0), time.Unix(1502749390, 0)
+	// The transport retries reused connections on its own.
+	transport := &http.Transport{DisableKeepAlives: true}
+
+	begin := time.Now()
+	results, err := Query(ts.URL, start, end, "up", Options{Retries: 2, RetryBackoff: 10 * time.Millisecond, Transport: transport})
+	assert.NoError(t, err)
+	assert.Len(t, results, 2)
+	// Waited 10ms and 20ms, not the default of seconds
+	assert.True(t, time.Since(begin) >= 30*time.Millisecond)
+	assert.True(t, time.Since(begin) < time.Second)
+
+	resets = 2
+	_, err = Query(ts.URL, start, end, "up", Options{Retries: 1, RetryBackoff: time.Millisecond, Transport: transport})
+	assert.Error(t, err)
+
+	// Errors that won't go away aren't retried
+	assert.False(t, transient(errors.New("x509: certificate signed by unknown authority")))
+}
@@ -0,0 +1,68 @@
+package styx
+
+import (
+	"sort"
+	"time"
+)
+
+// DayResults are the results of a single calendar day.
+type DayResults struct {
+	Day     time.Time
+	Results []Result
+}
+
+// SplitByDay partitions the values of all results by calendar day in loc.
+// Every day contains all results so the columns line up across files,
+// a sample exactly at midnight belongs to the day starting at that moment.
+func SplitByDay(results []Result, loc *time.Location) []DayResults {
+	days := make(map[time.Time][]Result)
+
+	for i, result := range results {
+		for j, timestamp := range result.Times {
+			t := time.Unix(timestamp, 0).In(loc)
+			day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc)
+
+			if _, ok := days[day]; !ok {
+				dayRes := make([]Result, len(results))
+				for k, r := range results {
+					dayRes[k] = Result{Metric: r.Metric, Labels: r.Labels}
+				}
+				days[day] = dayRes
+			}
+			days[day][i].Add(timestamp, result.Values[j])
+		}
+	}
+
+	var out []DayResults
+	for day, res := range days {
+		out = append(out, DayResults{Day: day, Results: res})
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].Day.Before(out[j].Day)
+	})
+
+	return out
+}
+
+// Slice returns copies of the results holding only the samples in the
+// window from start up to, but excluding, end. Like days the windows are
+// half-open, so slicing adjacent windows doesn't duplicate a sample.
+func Slice(results []Result, start, end time.Time) []Result {
+	sliced := make([]Result, len(results))
+	for i, result := range results {
+		// The times are sorted, so the window is a part of them.
+		from := sort.Search(len(result.Times), func(j int) bool { return result.Times[j] >= start.Unix() })
+		to := sort.Search(len(result.Times), func(j int) bool { return result.Times[j] >= end.Unix() })
+		if to < from {
+			to = from
+		}
+		sliced[i] = Result{
+			Metric: result.Metric,
+			Labels: result.Labels,
+			Times:  append([]int64(nil), result.Times[from:to]...),
+			Values: append([]float64(nil), result.Values[from:to]...),
+		}
+	}
+
+	return sliced
+}
@@ -0,0 +1,77 @@
+package styx
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSplitByDay(t *testing.T) {
+	// No results
+	days := SplitByDay(nil, time.UTC)
+	assert.Len(t, days, 0)
+
+	// 2017-08-15 23:59:59, 2017-08-16 00:00:00 and 2017-08-16 00:00:01 UTC
+	res := []Result{{
+		Metric: "foobar",
+		Times:  []int64{1502841599, 1502841600, 1502841601},
+		Values: []float64{1, 2, 3},
+	}, {
+		Metric: "foobaz",
+		Times:  []int64{1502841601},
+		Values: []float64{4},
+	}}
+
+	days = SplitByDay(res, time.UTC)
+	assert.Len(t, days, 2)
+
+	assert.Equal(t, time.Date(2017, 8, 15, 0, 0, 0, 0, time.UTC), days[0].Day)
+	assert.Equal(t, []Result{
+		{Metric: "foobar", Times: []int64{1502841599}, Values: []float64{1}},
+		{Metric: "foobaz"},
+	}, days[0].Results)
+
+	// The sample exactly at midnight starts the new day
+	assert.Equal(t, time.Date(2017, 8, 16, 0, 0, 0, 0, time.UTC), days[1].Day)
+	assert.Equal(t, []Result{
+		{Metric: "foobar", Times: []int64{1502841600, 1502841601}, Values: []float64{2, 3}},
+		{Metric: "foobaz", Times: []int64{1502841601}, Values: []float64{4}},
+	}, days[1].Results)
+
+	// Days follow the given timezone, UTC+2 moves every sample to the 16th
+	days = SplitByDay(res, time.FixedZone("CEST", 2*60*60))
+	assert.Len(t, days, 1)
+	assert.Equal(t, 16, days[0].Day.Day())
+}
+
+func TestSlice(t *testing.T) {
+	// No results
+	sliced := Slice(nil, time.Unix(0, 0), time.Unix(10, 0))
+	assert.Len(t, sliced, 0)
+
+	res := []Result{{
+		Metric: "foobar",
+		Times:  []int64{1502749389, 1502749390, 1502749391, 1502749392},
+		Values: []float64{1, 2, 3, 4},
+	}, {
+		Metric: "foobaz",
+		Times:  []int64{1502749389},
+		Values: []float64{5},
+	}}
+
+	// The start is included, the end isn't
+	sliced = Slice(res, time.Unix(1502749390, 0), time.Unix(1502749392, 0))
+	assert.Equal(t, []Result{
+		{Metric: "foobar", Times: []int64{1502749390, 1502749391}, Values: []float64{2, 3}},
+		{Metric: "foobaz"},
+	}, sliced)
+
+	// Adjacent windows share no sample
+	before := Slice(res, time.Unix(0, 0), time.Unix(1502749390, 0))
+	assert.Equal(t, []int64{1502749389}, before[0].Times)
+	assert.Equal(t, []float64{1}, before[0].Values)
+
+	// The results aren't modified
+	assert.Len(t, res[0].Values, 4)
+}
@@ -0,0 +1,249 @@
+package styx
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+)
+
+// QueryStream runs a range query like Query, but passes every series to fn
+// as soon as its samples are decoded instead of collecting the results, so
+// only a single series is in memory at a time. Ranges with more than
+// MaxPoints steps are queried in chunks whose series are passed one chunk
+// after another, i.e. a series is passed once per chunk. Series returned
+// twice by a backend aren't merged either. Errors of fn stop the query and
+// are returned as they are.
+func QueryStream(host string, start, end time.Time, query string, opts Options, fn func(Result) error) error {
+	start, end = opts.window(start, end, time.Now())
+	opts.Step = opts.StepFor(end.Sub(start))
+
+	found := false
+	for _, chunk := range Chunks(start, end, time.Duration(MaxPoints*opts.Step)*time.Second, opts.Step) {
+		err := streamRange(host, chunk.Start, chunk.End, query, opts, func(r Result) error {
+			found = true
+			return fn(r)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if !found {
+		return ErrNoTimeseries
+	}
+	return nil
+}
+
+// streamRange runs a single range query with the step of opts, passing its
+// series to fn.
+func streamRange(host string, start, end time.Time, query string, opts Options, fn func(Result) error) (err error) {
+	ctx, span := opts.span("styx.QueryStream")
+	span.SetAttribute("styx.host", host)
+	span.SetAttribute("styx.query", query)
+	span.SetAttribute("styx.step", opts.Step)
+	series := 0
+	defer func() {
+		if err != nil {
+			span.RecordError(err)
+		}
+		span.SetAttribute("styx.results", series)
+		span.End()
+	}()
+
+	u, err := QueryURL(host, start, end, query, opts)
+	if err != nil {
+		return err
+	}
+
+	_, err = fetchStream(ctx, host, opts.QueryMethod(u), u, query, opts, func(body io.Reader, status *apiStatus) error {
+		return decodeMatrix(body, status, func(r Result) error {
+			series++
+			return fn(r)
+		})
+	})
+	return err
+}
+
+// decodeMatrix decodes the response of a range query series by series and
+// passes each to fn, and its status and warnings into status. Prometheus
+// writes the result type ahead of the result, a result of another type is
+// skipped and ErrNotMatrix returned unless the status is error.
+func decodeMatrix(r io.Reader, status *apiStatus, fn func(Result) error) error {
+	dec := json.NewDecoder(r)
+	if err := expectDelim(dec, '{'); err != nil {
+		return err
+	}
+
+	resultType := ""
+	for dec.More() {
+		key, err := objectKey(dec)
+		if err != nil {
+			return err
+		}
+		var field interface{}
+		switch key {
+		case "status":
+			field = &status.Status
+		case "errorType":
+			field = &status.Type
+		case "error":
+			field = &status.Message
+		case "warnings":
+			field = &status.Warnings
+		}
+		if field != nil {
+			if err := dec.Decode(field); err != nil {
+				return decodeErr{err}
+			}
+			continue
+		}
+		if key != "data" {
+			if err := skipValue(dec); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if err := expectDelim(dec, '{'); err != nil {
+			return err
+		}
+		for dec.More() {
+			key, err := objectKey(dec)
+			if err != nil {
+				return err
+			}
+			switch {
+			case key == "resultType":
+				if err := dec.Decode(&resultType); err != nil {
+					return decodeErr{err}
+				}
+			case key == "result" && (resultType == "" || resultType == "matrix"):
+				if err := decodeSeriesList(dec, fn); err != nil {
+					return err
+				}
+			default:
+				if err := skipValue(dec); err != nil {
+					return err
+				}
+			}
+		}
+		if err := expectDelim(dec, '}'); err != nil {
+			return err
+		}
+	}
+	if err := expectDelim(dec, '}'); err != nil {
+		return err
+	}
+
+	if resultType != "matrix" && status.Status != "error" {
+		return fmt.Errorf("%w: %s", ErrNotMatrix, resultType)
+	}
+	return nil
+}
+
+// decodeSeriesList decodes the series of a matrix, passing each to fn.
+func decodeSeriesList(dec *json.Decoder, fn func(Result) error) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return decodeErr{err}
+	}
+	if tok == nil {
+		return nil
+	}
+	if tok != json.Delim('[') {
+		return decodeErr{fmt.Errorf("result isn't a list: %v", tok)}
+	}
+
+	for dec.More() {
+		r, err := decodeSeries(dec)
+		if err != nil {
+			return err
+		}
+		if err := fn(r); err != nil {
+			return err
+		}
+	}
+	return expectDelim(dec, ']')
+}
+
+// decodeSeries decodes a series of a matrix with its labels and values.
+func decodeSeries(dec *json.Decoder) (Result, error) {
+	var r Result
+	if err := expectDelim(dec, '{'); err != nil {
+		return r, err
+	}
+	for dec.More() {
+		key, err := objectKey(dec)
+		if err != nil {
+			return r, err
+		}
+		switch key {
+		case "metric":
+			if err := dec.Decode(&r.Labels); err != nil {
+				return r, decodeErr{err}
+			}
+		case "values":
+			if err := expectDelim(dec, '['); err != nil {
+				return r, err
+			}
+			var pair []interface{}
+			for dec.More() {
+				if err := dec.Decode(&pair); err != nil {
+					return r, decodeErr{err}
+				}
+				timestamp, value, err := sample(pair)
+				if err != nil {
+					return r, decodeErr{err}
+				}
+				r.Add(timestamp, value)
+			}
+			if err := expectDelim(dec, ']'); err != nil {
+				return r, err
+			}
+		default:
+			if err := skipValue(dec); err != nil {
+				return r, err
+			}
+		}
+	}
+	if err := expectDelim(dec, '}'); err != nil {
+		return r, err
+	}
+
+	if r.Labels == nil {
+		r.Labels = map[string]string{}
+	}
+	r.Metric = metricName(r.Labels)
+	return r, nil
+}
+
+func expectDelim(dec *json.Decoder, delim json.Delim) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return decodeErr{err}
+	}
+	if tok != delim {
+		return decodeErr{fmt.Errorf("expected %v but got %v", delim, tok)}
+	}
+	return nil
+}
+
+func objectKey(dec *json.Decoder) (string, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return "", decodeErr{err}
+	}
+	key, ok := tok.(string)
+	if !ok {
+		return "", decodeErr{fmt.Errorf("expected a key but got %v", tok)}
+	}
+	return key, nil
+}
+
+func skipValue(dec *json.Decoder) error {
+	var skip json.RawMessage
+	if err := dec.Decode(&skip); err != nil {
+		return decodeErr{err}
+	}
+	return nil
+}
@@ -0,0 +1,104 @@
+package styx
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDecodeMatrix(t *testing.T) {
+	body := `{"status":"success","warnings":["partial"],"data":{"resultType":"matrix","result":[
+		{"metric":{"__name__":"up","job":"node"},"values":[[1502749390,"1"],[1502749391,"0"]]},
+		{"metric":{},"values":[[1502749390.0,"NaN"]],"histograms":[]}
+	]}}`
+	var results []Result
+	var status apiStatus
+	assert.NoError(t, decodeMatrix(strings.NewReader(body), &status, func(r Result) error {
+		results = append(results, r)
+		return nil
+	}))
+	assert.Equal(t, apiStatus{Status: "success", Warnings: []string{"partial"}}, status)
+	assert.Len(t, results, 2)
+	assert.Equal(t, Result{
+		Metric: `up{job="node"}`,
+		Labels: map[string]string{"__name__": "up", "job": "node"},
+		Times:  []int64{1502749390, 1502749391},
+		Values: []float64{1, 0},
+	}, results[0])
+	assert.Equal(t, "{}", results[1].Metric)
+	assert.Equal(t, map[string]string{}, results[1].Labels)
+	assert.Equal(t, []int64{1502749390}, results[1].Times)
+	assert.Equal(t, []string{"NaN"}, formatted(results[1].Values))
+
+	// Errors of fn are returned as they are.
+	stop := errors.New("stop")
+	calls := 0
+	assert.Equal(t, stop, decodeMatrix(strings.NewReader(body), &apiStatus{}, func(Result) error {
+		calls++
+		return stop
+	}))
+	assert.Equal(t, 1, calls)
+
+	err := decodeMatrix(strings.NewReader(`{"data":{"resultType":"vector","result":[{"metric":{},"value":[1,"1"]}]}}`), &apiStatus{}, nil)
+	assert.True(t, errors.Is(err, ErrNotMatrix), err)
+	assert.NoError(t, decodeMatrix(strings.NewReader(`{"data":{"resultType":"matrix","result":null}}`), &apiStatus{}, nil))
+
+	// Errors don't have a result type.
+	status = apiStatus{}
+	assert.NoError(t, decodeMatrix(strings.NewReader(`{"status":"error","errorType":"execution","error":"too many samples"}`), &status, nil))
+	assert.Equal(t, apiStatus{Status: "error", Type: "execution", Message: "too many samples"}, status)
+
+	for _, invalid := range []string{
+		``,
+		`[]`,
+		`{"data":{"resultType":"matrix","result":[{"values":[[1502749390,1]]}]}}`,
+		`{"data":{"resultType":"matrix","result":[{"values":[[1502749390,"1"]`,
+		`{"data":{"resultType":"matrix","result":{}}}`,
+	} {
+		var de decodeErr
+		err := decodeMatrix(strings.NewReader(invalid), &apiStatus{}, func(Result) error { return nil })
+		assert.True(t, errors.As(err, &de), "%s: %v", invalid, err)
+	}
+}
+
+func TestQueryStream(t *testing.T) {
+	var starts []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		starts = append(starts, r.URL.Query().Get("start"))
+		if r.URL.Query().Get("query") == "absent" {
+			w.Write([]byte(`{"status":"success","data":{"resultType":"matrix","result":[]}}`))
+			return
+		}
+		w.Write([]byte(`{"status":"success","data":{"resultType":"matrix","result":[` +
+			`{"metric":{"job":"a"},"values":[[` + r.URL.Query().Get("start") + `,"1"]]},` +
+			`{"metric":{"job":"b"},"values":[[` + r.URL.Query().Get("end") + `,"2"]]}]}}`))
+	}))
+	defer ts.Close()
+
+	start := time.Unix(1502749390, 0)
+	var jobs []string
+	err := QueryStream(ts.URL, start, start.Add(time.Hour), "up", Options{Step: 60}, func(r Result) error {
+		jobs = append(jobs, r.Labels["job"])
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a", "b"}, jobs)
+
+	// More than MaxPoints steps are streamed chunk by chunk.
+	starts, jobs = nil, nil
+	err = QueryStream(ts.URL, start, start.Add(2*MaxPoints*time.Second), "up", Options{Step: 1}, func(r Result) error {
+		jobs = append(jobs, r.Labels["job"])
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Len(t, starts, 3)
+	assert.Equal(t, []string{"a", "b", "a", "b", "a", "b"}, jobs)
+
+	err = QueryStream(ts.URL, start, start.Add(time.Hour), "absent", Options{Step: 60}, func(Result) error { return nil })
+	assert.Equal(t, ErrNoTimeseries, err)
+}
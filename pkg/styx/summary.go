@@ -0,0 +1,122 @@
+package styx
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+)
+
+// Summary holds the statistics of the values of a series, special float
+// values aren't counted. Without any values the statistics are NaN.
+type Summary struct {
+	Metric string
+	Count  int
+	Min    float64
+	Max    float64
+	Mean   float64
+	// Stddev is the population standard deviation like stddev_over_time.
+	Stddev float64
+	// Percentiles are the values at the percentiles given to Summarize.
+	Percentiles []float64
+}
+
+// Summarize returns the statistics of every result with the values at the
+// percentiles, which are between 0 and 100. Percentiles are interpolated
+// linearly between the closest values, like quantile_over_time does.
+func Summarize(results []Result, percentiles []float64) ([]Summary, error) {
+	for _, p := range percentiles {
+		if p < 0 || p > 100 || math.IsNaN(p) {
+			return nil, fmt.Errorf("percentile needs to be between 0 and 100: %g", p)
+		}
+	}
+
+	return summarize(results, percentiles), nil
+}
+
+// summarize returns the statistics of every result.
+func summarize(results []Result, percentiles []float64) []Summary {
+	summaries := make([]Summary, len(results))
+	for i, result := range results {
+		var values []float64
+		for _, v := range result.Values {
+			if !math.IsNaN(v) && !math.IsInf(v, 0) {
+				values = append(values, v)
+			}
+		}
+		sort.Float64s(values)
+
+		s := Summary{Metric: result.Metric, Count: len(values), Percentiles: make([]float64, len(percentiles))}
+		if len(values) == 0 {
+			s.Min, s.Max, s.Mean, s.Stddev = math.NaN(), math.NaN(), math.NaN(), math.NaN()
+			for j := range s.Percentiles {
+				s.Percentiles[j] = math.NaN()
+			}
+			summaries[i] = s
+			continue
+		}
+
+		s.Min, s.Max = values[0], values[len(values)-1]
+		var sum float64
+		for _, v := range values {
+			sum += v
+		}
+		s.Mean = sum / float64(len(values))
+		var squares float64
+		for _, v := range values {
+			squares += (v - s.Mean) * (v - s.Mean)
+		}
+		s.Stddev = math.Sqrt(squares / float64(len(values)))
+		for j, p := range percentiles {
+			s.Percentiles[j] = percentile(values, p)
+		}
+
+		summaries[i] = s
+	}
+
+	return summaries
+}
+
+// percentile returns the p-th percentile of the sorted values.
+func percentile(sorted []float64, p float64) float64 {
+	rank := p / 100 * float64(len(sorted)-1)
+	lower := int(math.Floor(rank))
+	upper := int(math.Ceil(rank))
+	weight := rank - float64(lower)
+	return sorted[lower]*(1-weight) + sorted[upper]*weight
+}
+
+// WriteSummary writes a row with the statistics of every series, with a
+// column per percentile named like p95.
+func (c CSV) WriteSummary(w io.Writer, summaries []Summary, percentiles []float64, header bool) error {
+	cw := c.writer(w)
+
+	if header {
+		row := []string{"Series", "Count", "Min", "Max", "Mean", "Stddev"}
+		for _, p := range percentiles {
+			row = append(row, "p"+strconv.FormatFloat(p, 'f', -1, 64))
+		}
+		if err := cw.Write(row); err != nil {
+			return err
+		}
+	}
+
+	for _, s := range summaries {
+		row := []string{s.Metric, strconv.Itoa(s.Count), formatStat(s.Min), formatStat(s.Max), formatStat(s.Mean), formatStat(s.Stddev)}
+		for _, p := range s.Percentiles {
+			row = append(row, formatStat(p))
+		}
+		if err := cw.Write(row); err != nil {
+			return err
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+// formatStat formats a statistic like Prometheus formats values.
+func formatStat(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
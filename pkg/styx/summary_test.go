@@ -0,0 +1,48 @@
+package styx
+
+import (
+	"bytes"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSummarize(t *testing.T) {
+	results := []Result{
+		{Metric: `up{job="a"}`, Times: []int64{1, 2, 3, 4, 5, 6}, Values: []float64{4, 1, 3, 2, math.Inf(1), Missing}},
+		{Metric: `up{job="b"}`, Times: []int64{1}, Values: []float64{math.NaN()}},
+	}
+
+	summaries, err := Summarize(results, []float64{0, 50, 95, 100})
+	assert.NoError(t, err)
+	assert.Len(t, summaries, 2)
+
+	s := summaries[0]
+	assert.Equal(t, 4, s.Count)
+	assert.Equal(t, 1.0, s.Min)
+	assert.Equal(t, 4.0, s.Max)
+	assert.Equal(t, 2.5, s.Mean)
+	assert.InDelta(t, math.Sqrt(1.25), s.Stddev, 1e-9)
+	assert.InDeltaSlice(t, []float64{1, 2.5, 3.85, 4}, s.Percentiles, 1e-9)
+
+	assert.Equal(t, 0, summaries[1].Count)
+	assert.True(t, math.IsNaN(summaries[1].Mean))
+	assert.True(t, math.IsNaN(summaries[1].Percentiles[1]))
+
+	_, err = Summarize(results, []float64{101})
+	assert.Error(t, err)
+}
+
+func TestWriteSummary(t *testing.T) {
+	summaries := []Summary{
+		{Metric: `up{job="a"}`, Count: 2, Min: 0, Max: 1, Mean: 0.5, Stddev: 0.5, Percentiles: []float64{0.95}},
+		{Metric: "sum(up)", Min: math.NaN(), Max: math.NaN(), Mean: math.NaN(), Stddev: math.NaN(), Percentiles: []float64{math.NaN()}},
+	}
+
+	buf := &bytes.Buffer{}
+	assert.NoError(t, CSV{Delimiter: ';'}.WriteSummary(buf, summaries, []float64{95}, true))
+	assert.Equal(t, "Series;Count;Min;Max;Mean;Stddev;p95\n"+
+		"\"up{job=\"\"a\"\"}\";2;0;1;0.5;0.5;0.95\n"+
+		"sum(up);0;NaN;NaN;NaN;NaN;NaN\n", buf.String())
+}
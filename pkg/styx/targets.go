@@ -0,0 +1,97 @@
+package styx
+
+import (
+	"encoding/json"
+	"net/url"
+	"sort"
+	"time"
+)
+
+// Target is an active scrape target of Prometheus.
+type Target struct {
+	Labels     map[string]string `json:"labels"`
+	ScrapePool string            `json:"scrapePool"`
+	ScrapeURL  string            `json:"scrapeUrl"`
+	// Health is up, down or unknown if it wasn't scraped yet.
+	Health     string    `json:"health"`
+	LastError  string    `json:"lastError"`
+	LastScrape time.Time `json:"lastScrape"`
+	// LastScrapeDuration is how long the last scrape took.
+	LastScrapeDuration time.Duration `json:"lastScrapeDuration"`
+	ScrapeInterval     string        `json:"scrapeInterval"`
+	ScrapeTimeout      string        `json:"scrapeTimeout"`
+}
+
+// Targets returns the active targets, sorted by job and instance. Enforced
+// labels only keep the targets having them.
+func Targets(host string, opts Options) (targets []Target, err error) {
+	ctx, span := opts.span("styx.Targets")
+	span.SetAttribute("styx.host", host)
+	defer func() {
+		if err != nil {
+			span.RecordError(err)
+		}
+		span.SetAttribute("styx.results", len(targets))
+		span.End()
+	}()
+
+	u, err := apiURL(host, "targets", url.Values{"state": []string{"active"}}, opts)
+	if err != nil {
+		return nil, err
+	}
+	var resp struct {
+		Data struct {
+			ActiveTargets []apiTarget `json:"activeTargets"`
+		} `json:"data"`
+	}
+	if _, err := fetch(ctx, host, u, "", opts, &resp); err != nil {
+		return nil, err
+	}
+
+	for _, t := range resp.Data.ActiveTargets {
+		if !hasLabels(t.Labels, opts.EnforceLabels) {
+			continue
+		}
+		targets = append(targets, Target{
+			Labels:             t.Labels,
+			ScrapePool:         t.ScrapePool,
+			ScrapeURL:          t.ScrapeURL,
+			Health:             t.Health,
+			LastError:          t.LastError,
+			LastScrape:         t.LastScrape,
+			LastScrapeDuration: seconds(t.LastScrapeDuration),
+			ScrapeInterval:     t.ScrapeInterval,
+			ScrapeTimeout:      t.ScrapeTimeout,
+		})
+	}
+	sort.SliceStable(targets, func(i, j int) bool {
+		a, b := targets[i].Labels, targets[j].Labels
+		if a["job"] != b["job"] {
+			return a["job"] < b["job"]
+		}
+		return a["instance"] < b["instance"]
+	})
+	return targets, nil
+}
+
+// apiTarget is a target as the API returns it, with durations in seconds.
+type apiTarget struct {
+	Labels             map[string]string `json:"labels"`
+	ScrapePool         string            `json:"scrapePool"`
+	ScrapeURL          string            `json:"scrapeUrl"`
+	Health             string            `json:"health"`
+	LastError          string            `json:"lastError"`
+	LastScrape         time.Time         `json:"lastScrape"`
+	LastScrapeDuration float64           `json:"lastScrapeDuration"`
+	ScrapeInterval     string            `json:"scrapeInterval"`
+	ScrapeTimeout      string            `json:"scrapeTimeout"`
+}
+
+// MarshalJSON encodes the duration in seconds, like the API does.
+func (t Target) MarshalJSON() ([]byte, error) {
+	type target Target
+	return json.Marshal(struct {
+		target
+		LastScrapeDuration float64 `json:"lastScrapeDuration"`
+	}{target(t), t.LastScrapeDuration.Seconds()})
+}
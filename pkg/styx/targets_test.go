@@ -0,0 +1,43 @@
+package styx
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTargets(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/api/v1/targets", r.URL.Path)
+		assert.Equal(t, "active", r.URL.Query().Get("state"))
+		fmt.Fprint(w, `{"status":"success","data":{"activeTargets":[
+			{"labels":{"job":"node","instance":"node2:9100","namespace":"b"},"scrapePool":"node","scrapeUrl":"http://node2:9100/metrics","health":"down","lastError":"connection refused","lastScrape":"2017-08-14T21:10:00Z","lastScrapeDuration":0.0015,"scrapeInterval":"15s","scrapeTimeout":"10s"},
+			{"labels":{"job":"node","instance":"node1:9100","namespace":"a"},"scrapePool":"node","scrapeUrl":"http://node1:9100/metrics","health":"up","lastError":"","lastScrape":"2017-08-14T21:10:01Z","lastScrapeDuration":0.25,"scrapeInterval":"15s","scrapeTimeout":"10s"},
+			{"labels":{"job":"api","instance":"api:8080","namespace":"a"},"scrapePool":"api","health":"unknown","lastScrape":"0001-01-01T00:00:00Z"}
+		],"droppedTargets":[]}}`)
+	}))
+	defer ts.Close()
+
+	targets, err := Targets(ts.URL, Options{})
+	assert.NoError(t, err)
+	assert.Len(t, targets, 3)
+	assert.Equal(t, "api", targets[0].Labels["job"])
+	assert.Equal(t, "node1:9100", targets[1].Labels["instance"])
+	assert.Equal(t, 250*time.Millisecond, targets[1].LastScrapeDuration)
+	assert.Equal(t, "connection refused", targets[2].LastError)
+	assert.True(t, targets[0].LastScrape.IsZero())
+
+	data, err := json.Marshal(targets[1])
+	assert.NoError(t, err)
+	assert.Contains(t, string(data), `"lastScrapeDuration":0.25`)
+
+	targets, err = Targets(ts.URL, Options{EnforceLabels: map[string]string{"namespace": "b"}})
+	assert.NoError(t, err)
+	assert.Len(t, targets, 1)
+	assert.Equal(t, "down", targets[0].Health)
+}
@@ -0,0 +1,252 @@
+package styx
+
+import (
+	"bufio"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/fatih/color"
+)
+
+// TermChart draws the results as a line chart of text with a legend, to
+// look at the data right in a terminal, e.g. over SSH. Lines are drawn
+// with braille characters, which have 2x4 dots per character, or with
+// ASCII characters for terminals and fonts without braille.
+type TermChart struct {
+	// Width and Height are the size of the chart with its axes in
+	// characters, without the legend. Defaults to 80x20.
+	Width  int
+	Height int
+	// ASCII draws the series with a marker per series instead of braille.
+	ASCII bool
+	// Color colors the series with ANSI escape codes.
+	Color bool
+	// Location is the time zone of the time axis, UTC if it's not set.
+	Location *time.Location
+}
+
+// termColors are the colors of the series, repeating after twelve of them.
+var termColors = []color.Attribute{
+	color.FgBlue, color.FgYellow, color.FgRed, color.FgCyan, color.FgGreen, color.FgMagenta,
+	color.FgHiBlue, color.FgHiYellow, color.FgHiRed, color.FgHiCyan, color.FgHiGreen, color.FgHiMagenta,
+}
+
+// termMarkers tell the series apart in ASCII charts.
+const termMarkers = "*+o#x%@=&$"
+
+// brailleDots are the bits of the dots in a braille character, by column
+// and row.
+var brailleDots = [2][4]rune{{0x01, 0x02, 0x04, 0x40}, {0x08, 0x10, 0x20, 0x80}}
+
+// Write writes the chart of the results. Special float values and missing
+// points are gaps in the lines.
+func (c TermChart) Write(w io.Writer, results []Result) error {
+	width, height := c.Width, c.Height
+	if width <= 0 {
+		width = 80
+	}
+	if height <= 0 {
+		height = 20
+	}
+	loc := c.Location
+	if loc == nil {
+		loc = time.UTC
+	}
+
+	_, times, values, minY, maxY := chartValues(results)
+
+	// A tick about every fifth line.
+	n := height / 5
+	if n < 2 {
+		n = 2
+	}
+	yTicks, minY, maxY := niceTicks(minY, maxY, n)
+	labels := make([]string, len(yTicks))
+	labelWidth := 0
+	for i, v := range yTicks {
+		labels[i] = strconv.FormatFloat(v, 'g', 6, 64)
+		if n := utf8.RuneCountInString(labels[i]); n > labelWidth {
+			labelWidth = n
+		}
+	}
+
+	// Every cell has dotsX x dotsY dots, rows are the lines of the plot
+	// above the time axis.
+	dotsX, dotsY := 2, 4
+	if c.ASCII {
+		dotsX, dotsY = 1, 1
+	}
+	rows := height - 2
+	cols := width - labelWidth - 2
+	if rows < 2 {
+		rows = 2
+	}
+	if cols < 10 {
+		cols = 10
+	}
+	w2, h2 := cols*dotsX, rows*dotsY
+
+	minX, maxX := 0.0, 1.0
+	if len(times) > 0 {
+		minX, maxX = times[0], times[len(times)-1]
+	}
+	if minX == maxX {
+		minX, maxX = minX-30, maxX+30
+	}
+	x := func(t float64) int {
+		return int(math.Round((t - minX) / (maxX - minX) * float64(w2-1)))
+	}
+	y := func(v float64) int {
+		return int(math.Round((maxY - v) / (maxY - minY) * float64(h2-1)))
+	}
+
+	// dots are the braille bits of every cell, or the marker drawn there,
+	// owner the series drawn last in a cell to color it.
+	dots := make([][]rune, rows)
+	owner := make([][]int, rows)
+	for i := range dots {
+		dots[i] = make([]rune, cols)
+		owner[i] = make([]int, cols)
+	}
+	set := func(s, px, py int) {
+		cx, cy := px/dotsX, py/dotsY
+		if cx < 0 || cx >= cols || cy < 0 || cy >= rows {
+			return
+		}
+		if c.ASCII {
+			dots[cy][cx] = rune(termMarkers[s%len(termMarkers)])
+		} else {
+			dots[cy][cx] |= brailleDots[px%dotsX][py%dotsY]
+		}
+		owner[cy][cx] = s
+	}
+
+	for s := range results {
+		prevX, prevY, prev := 0, 0, false
+		for j, v := range values[s] {
+			if math.IsNaN(v) {
+				prev = false
+				continue
+			}
+			px, py := x(times[j]), y(v)
+			if prev {
+				termLine(prevX, prevY, px, py, func(lx, ly int) { set(s, lx, ly) })
+			} else {
+				set(s, px, py)
+			}
+			prevX, prevY, prev = px, py, true
+		}
+	}
+
+	// The rows the y ticks are labeled at.
+	tickRows := make(map[int]string)
+	for i, v := range yTicks {
+		tickRows[y(v)/dotsY] = labels[i]
+	}
+
+	bw := bufio.NewWriter(w)
+	for r := 0; r < rows; r++ {
+		label, ok := tickRows[r]
+		axis := "│"
+		if ok {
+			axis = "┤"
+		}
+		bw.WriteString(strings.Repeat(" ", labelWidth-utf8.RuneCountInString(label)) + label + " " + axis)
+		for col := 0; col < cols; col++ {
+			bw.WriteString(c.cell(dots[r][col], owner[r][col]))
+		}
+		bw.WriteString("\n")
+	}
+
+	// The time axis with the labels centered below their ticks.
+	axis := []rune(strings.Repeat("─", cols))
+	under := []rune(strings.Repeat(" ", cols))
+	end := -1
+	for _, tick := range timeTicks(minX, maxX, cols/12, loc) {
+		col := x(tick.Pos) / dotsX
+		if col < 0 || col >= cols {
+			continue
+		}
+		axis[col] = '┬'
+		start := col - len(tick.Label)/2
+		if start <= end || start < 0 || start+len(tick.Label) > cols {
+			continue
+		}
+		copy(under[start:], []rune(tick.Label))
+		end = start + len(tick.Label)
+	}
+	bw.WriteString(strings.Repeat(" ", labelWidth+1) + "└" + string(axis) + "\n")
+	bw.WriteString(strings.Repeat(" ", labelWidth+2) + strings.TrimRight(string(under), " ") + "\n")
+
+	for s, result := range results {
+		marker := "⣿"
+		if c.ASCII {
+			marker = string(termMarkers[s%len(termMarkers)])
+		}
+		bw.WriteString(c.paint(marker, s) + " " + result.Metric + "\n")
+	}
+
+	return bw.Flush()
+}
+
+// cell returns the character of a cell with the dots, colored after the
+// series s.
+func (c TermChart) cell(dots rune, s int) string {
+	if dots == 0 {
+		return " "
+	}
+	char := string(dots)
+	if !c.ASCII {
+		char = string(0x2800 + dots)
+	}
+	return c.paint(char, s)
+}
+
+// paint colors text in the color of the series s, if colors are enabled.
+func (c TermChart) paint(text string, s int) string {
+	if !c.Color {
+		return text
+	}
+	col := color.New(termColors[s%len(termColors)])
+	col.EnableColor()
+	return col.SprintFunc()(text)
+}
+
+// termLine calls set for every dot on the line from x0, y0 to x1, y1.
+func termLine(x0, y0, x1, y1 int, set func(x, y int)) {
+	dx, dy := abs(x1-x0), -abs(y1-y0)
+	sx, sy := 1, 1
+	if x0 > x1 {
+		sx = -1
+	}
+	if y0 > y1 {
+		sy = -1
+	}
+	e := dx + dy
+	for {
+		set(x0, y0)
+		if x0 == x1 && y0 == y1 {
+			return
+		}
+		e2 := 2 * e
+		if e2 >= dy {
+			e += dy
+			x0 += sx
+		}
+		if e2 <= dx {
+			e += dx
+			y0 += sy
+		}
+	}
+}
+
+func abs(i int) int {
+	if i < 0 {
+		return -i
+	}
+	return i
+}
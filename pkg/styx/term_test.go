@@ -0,0 +1,58 @@
+package styx
+
+import (
+	"bytes"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTermChart(t *testing.T) {
+	results := []Result{
+		{Metric: `up{job="a"}`, Times: []int64{1502749200, 1502749260, 1502749320, 1502749380}, Values: []float64{0, 1, math.NaN(), 1}},
+		{Metric: `up{job="b"}`, Times: []int64{1502749200}, Values: []float64{1}},
+	}
+
+	buf := &bytes.Buffer{}
+	assert.NoError(t, TermChart{Width: 20, Height: 6, ASCII: true}.Write(buf, results))
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+
+	assert.Equal(t, []string{
+		"  1 ┤+    *        *",
+		"    │   **          ",
+		"0.5 ┤ **            ",
+		"  0 ┤*              ",
+		"    └┬──────────────",
+		"* up{job=\"a\"}",
+		"+ up{job=\"b\"}",
+	}, append(lines[:5], lines[6:]...))
+}
+
+func TestTermChartBraille(t *testing.T) {
+	results := []Result{{Metric: "up", Times: []int64{1502749200, 1502749260}, Values: []float64{0, 1}}}
+
+	buf := &bytes.Buffer{}
+	assert.NoError(t, TermChart{Width: 14, Height: 4}.Write(buf, results))
+	lines := strings.Split(buf.String(), "\n")
+
+	// Four dots per character up, two across, the 0 tick shares its line
+	assert.Equal(t, "  1 ┤     ⣀⡠⠔⠒⠉", lines[0])
+	assert.Equal(t, "0.5 ┤⣀⠤⠔⠊⠉     ", lines[1])
+	assert.Equal(t, "⣿ up", lines[4])
+}
+
+func TestTermChartColor(t *testing.T) {
+	results := []Result{{Metric: "up", Times: []int64{1502749200}, Values: []float64{1}}}
+
+	buf := &bytes.Buffer{}
+	assert.NoError(t, TermChart{Color: true}.Write(buf, results))
+	assert.Contains(t, buf.String(), "\x1b[34m⣿\x1b[0m up")
+}
+
+func TestTermLine(t *testing.T) {
+	var dots [][2]int
+	termLine(0, 0, 3, 1, func(x, y int) { dots = append(dots, [2]int{x, y}) })
+	assert.Equal(t, [][2]int{{0, 0}, {1, 0}, {2, 1}, {3, 1}}, dots)
+}
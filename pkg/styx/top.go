@@ -0,0 +1,108 @@
+package styx
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// The rankings of Top.
+const (
+	TopAvg  = "avg"
+	TopMax  = "max"
+	TopLast = "last"
+)
+
+// Others is the name of the series Top sums the rest of the results in.
+const Others = "others"
+
+// Top returns the n results with the highest average, maximum or last
+// value, ranked by by, in their original order. Special float values don't
+// count and results without values rank last. With others the rest of the
+// results are summed up into an additional result named Others, if there
+// are any.
+func Top(results []Result, n int, by string, others bool) ([]Result, error) {
+	if n <= 0 {
+		return nil, fmt.Errorf("the number of series to keep needs to be positive: %d", n)
+	}
+	switch by {
+	case TopAvg, TopMax, TopLast:
+	default:
+		return nil, fmt.Errorf("unknown ranking: %s", by)
+	}
+	if len(results) <= n {
+		return results, nil
+	}
+
+	summaries := summarize(results, nil)
+	scores := make([]float64, len(results))
+	for i, s := range summaries {
+		switch by {
+		case TopAvg:
+			scores[i] = s.Mean
+		case TopMax:
+			scores[i] = s.Max
+		case TopLast:
+			scores[i] = lastNumber(results[i].Values)
+		}
+	}
+
+	ranked := make([]int, len(results))
+	for i := range ranked {
+		ranked[i] = i
+	}
+	sort.SliceStable(ranked, func(a, b int) bool {
+		sa, sb := scores[ranked[a]], scores[ranked[b]]
+		return sa > sb || !math.IsNaN(sa) && math.IsNaN(sb)
+	})
+
+	keep := make([]bool, len(results))
+	for _, i := range ranked[:n] {
+		keep[i] = true
+	}
+
+	var top, rest []Result
+	for i, result := range results {
+		if keep[i] {
+			top = append(top, result)
+		} else {
+			rest = append(rest, result)
+		}
+	}
+	if !others {
+		return top, nil
+	}
+
+	return append(top, sumResults(rest)), nil
+}
+
+// lastNumber returns the latest of the values that isn't missing or a
+// special float value, NaN if there is none.
+func lastNumber(values []float64) float64 {
+	for j := len(values) - 1; j >= 0; j-- {
+		if v := values[j]; !math.IsNaN(v) && !math.IsInf(v, 0) {
+			return v
+		}
+	}
+	return math.NaN()
+}
+
+// sumResults returns the result named Others with the sum of the values
+// of the results at every time any of them has a value at.
+func sumResults(results []Result) Result {
+	columns := NewColumns(results)
+	sum := Result{Metric: Others, Labels: map[string]string{}}
+	for j, ts := range columns.Times {
+		total, found := 0.0, false
+		for _, s := range columns.Series {
+			if v := s.Values[j]; !IsMissing(v) {
+				total += v
+				found = true
+			}
+		}
+		if found {
+			sum.Add(ts, total)
+		}
+	}
+	return sum
+}
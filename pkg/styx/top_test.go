@@ -0,0 +1,59 @@
+package styx
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTop(t *testing.T) {
+	res := []Result{
+		{Metric: "a", Times: []int64{1, 2}, Values: []float64{1, 9}},
+		{Metric: "b", Times: []int64{1, 2}, Values: []float64{6, 5}},
+		{Metric: "c", Times: []int64{1}, Values: []float64{math.NaN()}},
+		{Metric: "d", Times: []int64{1, 2, 3}, Values: []float64{3, 2, math.Inf(1)}},
+	}
+	names := func(results []Result) []string {
+		var names []string
+		for _, r := range results {
+			names = append(names, r.Metric)
+		}
+		return names
+	}
+
+	for by, expected := range map[string][]string{
+		TopAvg:  {"a", "b"},
+		TopMax:  {"a", "b"},
+		TopLast: {"a", "b"},
+	} {
+		top, err := Top(res, 2, by, false)
+		assert.NoError(t, err, by)
+		assert.Equal(t, expected, names(top), by)
+	}
+
+	top, err := Top(res, 1, TopAvg, false)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"b"}, names(top))
+
+	// Results without values rank last.
+	top, err = Top(res, 3, TopMax, false)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a", "b", "d"}, names(top))
+
+	top, err = Top(res, 2, TopLast, true)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a", "b", Others}, names(top))
+	assert.Equal(t, []int64{1, 2, 3}, top[2].Times)
+	assert.Equal(t, []string{"NaN", "2", "+Inf"}, formatted(top[2].Values))
+
+	// Keeping all of them leaves the results as they are.
+	top, err = Top(res, 4, TopAvg, true)
+	assert.NoError(t, err)
+	assert.Equal(t, res, top)
+
+	_, err = Top(res, 0, TopAvg, false)
+	assert.Error(t, err)
+	_, err = Top(res, 1, "min", false)
+	assert.Error(t, err)
+}
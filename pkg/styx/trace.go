@@ -0,0 +1,29 @@
+package styx
+
+import "context"
+
+// Tracer creates a span for every query. It's shaped after OpenTelemetry's
+// trace.Tracer so an adapter is a few lines, without styx depending on it.
+type Tracer interface {
+	Start(ctx context.Context, name string) (context.Context, Span)
+}
+
+// Span is the part of OpenTelemetry's trace.Span that Query uses.
+type Span interface {
+	SetAttribute(key string, value interface{})
+	RecordError(err error)
+	End()
+}
+
+// noopTracer is used if no Tracer is configured.
+type noopTracer struct{}
+
+func (noopTracer) Start(ctx context.Context, name string) (context.Context, Span) {
+	return ctx, noopSpan{}
+}
+
+type noopSpan struct{}
+
+func (noopSpan) SetAttribute(key string, value interface{}) {}
+func (noopSpan) RecordError(err error)                      {}
+func (noopSpan) End()                                       {}
@@ -0,0 +1,63 @@
+package styx
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testTracer struct {
+	spans []*testSpan
+}
+
+func (t *testTracer) Start(ctx context.Context, name string) (context.Context, Span) {
+	span := &testSpan{name: name, attributes: make(map[string]interface{})}
+	t.spans = append(t.spans, span)
+	return ctx, span
+}
+
+type testSpan struct {
+	name       string
+	attributes map[string]interface{}
+	err        error
+	ended      bool
+}
+
+func (s *testSpan) SetAttribute(key string, value interface{}) { s.attributes[key] = value }
+func (s *testSpan) RecordError(err error)                      { s.err = err }
+func (s *testSpan) End()                                       { s.ended = true }
+
+func TestQueryTracing(t *testing.T) {
+	tracer := &testTracer{}
+	opts := Options{
+		Transport: ReplayTransport{Path: "testdata/query_range.json"},
+		Tracer:    tracer,
+	}
+
+	_, err := Query("http://prometheus.invalid", time.Now().Add(-time.Hour), time.Now(), "go_goroutines", opts)
+	assert.NoError(t, err)
+
+	assert.Len(t, tracer.spans, 1)
+	span := tracer.spans[0]
+	assert.Equal(t, "styx.Query", span.name)
+	assert.True(t, span.ended)
+	assert.NoError(t, span.err)
+	assert.Equal(t, map[string]interface{}{
+		"styx.host":    "http://prometheus.invalid",
+		"styx.query":   "go_goroutines",
+		"styx.step":    14,
+		"styx.results": 2,
+	}, span.attributes)
+
+	// Errors are recorded on the span
+	opts.Transport = ReplayTransport{Path: "testdata/missing.json"}
+	_, err = Query("http://prometheus.invalid", time.Now().Add(-time.Hour), time.Now(), "go_goroutines", opts)
+	assert.Error(t, err)
+
+	assert.Len(t, tracer.spans, 2)
+	assert.Error(t, tracer.spans[1].err)
+	assert.Equal(t, 0, tracer.spans[1].attributes["styx.results"])
+	assert.True(t, tracer.spans[1].ended)
+}
@@ -0,0 +1,201 @@
+package styx
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"time"
+)
+
+// FillGaps returns copies of the results where every timestamp any result
+// has a sample for is present, missing points are set to the gap value.
+func FillGaps(results []Result, gap float64) []Result {
+	return fillTimes(results, sortedTimes(results), gap)
+}
+
+// FillGrid returns copies of the results holding every timestamp of the
+// step grid between start and end, which are the timestamps Prometheus
+// evaluates a range query at. Missing points are set to the gap value.
+func FillGrid(results []Result, start, end time.Time, step int, gap float64) []Result {
+	if step <= 0 {
+		return results
+	}
+
+	var grid []int64
+	for ts := start.Unix(); ts <= end.Unix(); ts += int64(step) {
+		grid = append(grid, ts)
+	}
+
+	return fillTimes(results, grid, gap)
+}
+
+func fillTimes(results []Result, times []int64, gap float64) []Result {
+	// The results share the times, adding to one of them must copy them.
+	times = times[:len(times):len(times)]
+	filled := make([]Result, len(results))
+	for i, result := range results {
+		values := make([]float64, len(times))
+		for j, ts := range times {
+			if val, ok := result.At(ts); ok && !IsMissing(val) {
+				values[j] = val
+			} else {
+				values[j] = gap
+			}
+		}
+		filled[i] = Result{Metric: result.Metric, Labels: result.Labels, Times: times, Values: values}
+	}
+
+	return filled
+}
+
+// The policies of Fill for missing points.
+const (
+	FillNull     = "null"
+	FillZero     = "zero"
+	FillPrevious = "previous"
+	FillLinear   = "linear"
+)
+
+// Fill returns copies of the results where the points missing at the
+// timestamps of any result are filled by the policy. Null leaves them
+// missing, zero sets them to 0, previous repeats the value before them and
+// linear interpolates between the values around them by time. With previous
+// and linear the points before the first value stay missing, with linear
+// also the ones after the last value and next to special float values.
+// Policies that are numbers, like NaN or -1, set the points to them.
+func Fill(results []Result, policy string) ([]Result, error) {
+	switch policy {
+	case FillNull:
+		return results, nil
+	case FillZero:
+		return FillGaps(results, 0), nil
+	case FillPrevious, FillLinear:
+	default:
+		gap, err := strconv.ParseFloat(policy, 64)
+		if err != nil {
+			return nil, fmt.Errorf("unknown fill policy: %s", policy)
+		}
+		return FillGaps(results, gap), nil
+	}
+
+	filled := FillGaps(results, Missing)
+	for i := range filled {
+		values := filled[i].Values
+		last := -1
+		for j, val := range values {
+			if !IsMissing(val) {
+				if policy == FillLinear && last >= 0 && last < j-1 {
+					interpolate(filled[i].Times[last:j+1], values[last:j+1])
+				}
+				last = j
+				continue
+			}
+			// Points that can't be filled stay missing, like with FillGaps.
+			if policy == FillPrevious && last >= 0 {
+				values[j] = values[last]
+			}
+		}
+	}
+
+	return filled, nil
+}
+
+// interpolate sets the values between the first and last one on the line
+// between them by time.
+func interpolate(times []int64, values []float64) {
+	x0, x1 := float64(times[0]), float64(times[len(times)-1])
+	y0, y1 := values[0], values[len(values)-1]
+	if math.IsNaN(y0) || math.IsInf(y0, 0) || math.IsNaN(y1) || math.IsInf(y1, 0) {
+		return
+	}
+
+	for j := 1; j < len(times)-1; j++ {
+		values[j] = y0 + (y1-y0)*(float64(times[j])-x0)/(x1-x0)
+	}
+}
+
+// Rate returns the per-second rate between consecutive samples of every
+// result at the time of the later sample, a counter reset counts the new
+// value as increase. The increase is rounded to a float64 before it's
+// divided, exact computes with math/big and rounds only the rate instead,
+// which is considerably slower. It can't restore the precision counters
+// beyond 2^53 lost as float64 samples.
+func Rate(results []Result, exact bool) []Result {
+	rated := make([]Result, len(results))
+	for i, result := range results {
+		rated[i] = Result{Metric: result.Metric, Labels: result.Labels}
+
+		for j := 1; j < len(result.Times); j++ {
+			prev, cur := result.Values[j-1], result.Values[j]
+			if IsMissing(prev) || IsMissing(cur) {
+				continue
+			}
+
+			seconds := result.Times[j] - result.Times[j-1]
+			if exact {
+				rated[i].Add(result.Times[j], bigRate(prev, cur, seconds))
+			} else {
+				rated[i].Add(result.Times[j], floatRate(prev, cur, seconds))
+			}
+		}
+	}
+
+	return rated
+}
+
+// Delta returns the difference between consecutive samples of every
+// result at the time of the later sample. Unlike Rate it doesn't divide
+// by the time in between, it's the increase per step. With clamp a
+// negative difference, e.g. from a counter reset, becomes 0.
+func Delta(results []Result, clamp bool) []Result {
+	deltas := make([]Result, len(results))
+	for i, result := range results {
+		deltas[i] = Result{Metric: result.Metric, Labels: result.Labels}
+
+		for j := 1; j < len(result.Times); j++ {
+			prev, cur := result.Values[j-1], result.Values[j]
+			if IsMissing(prev) || IsMissing(cur) {
+				continue
+			}
+
+			d := cur - prev
+			if clamp && d < 0 {
+				d = 0
+			}
+			deltas[i].Add(result.Times[j], d)
+		}
+	}
+
+	return deltas
+}
+
+func floatRate(prev, cur float64, seconds int64) float64 {
+	increase := cur - prev
+	if increase < 0 {
+		increase = cur
+	}
+
+	return increase / float64(seconds)
+}
+
+// bigPrecision is the mantissa precision in bits for exact computations.
+const bigPrecision = 256
+
+func bigRate(prev, cur float64, seconds int64) float64 {
+	// big.Float has no NaN and panics on operations resulting in one.
+	if math.IsNaN(prev) || math.IsInf(prev, 0) || math.IsNaN(cur) || math.IsInf(cur, 0) {
+		return floatRate(prev, cur, seconds)
+	}
+
+	p := new(big.Float).SetPrec(bigPrecision).SetFloat64(prev)
+	c := new(big.Float).SetPrec(bigPrecision).SetFloat64(cur)
+
+	increase := new(big.Float).SetPrec(bigPrecision).Sub(c, p)
+	if increase.Sign() < 0 {
+		increase = c
+	}
+
+	rate, _ := increase.Quo(increase, big.NewFloat(float64(seconds))).Float64()
+	return rate
+}
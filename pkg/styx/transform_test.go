@@ -0,0 +1,161 @@
+package styx
+
+import (
+	"bytes"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFillGaps(t *testing.T) {
+	// No results
+	assert.Len(t, FillGaps(nil, 0), 0)
+
+	res := []Result{{
+		Metric: "foobar",
+		Times:  []int64{1502749390, 1502749394},
+		Values: []float64{0, 4},
+	}, {
+		Metric: "foobaz",
+		Times:  []int64{1502749392},
+		Values: []float64{2},
+	}}
+
+	expected := "1502749390,0,0\n1502749392,0,2\n1502749394,4,0\n"
+	buf := bytes.NewBuffer(nil)
+	assert.NoError(t, CSVWriter(buf, FillGaps(res, 0)))
+	assert.Equal(t, expected, buf.String())
+}
+
+func TestFillGrid(t *testing.T) {
+	start := time.Unix(1502749390, 0)
+	end := time.Unix(1502749400, 0)
+
+	// No results
+	assert.Len(t, FillGrid(nil, start, end, 2, Missing), 0)
+
+	res := []Result{{
+		Metric: "foobar",
+		Times:  []int64{1502749390, 1502749394},
+		Values: []float64{0, 4},
+	}, {
+		Metric: "foobaz",
+		Times:  []int64{1502749392},
+		Values: []float64{2},
+	}}
+
+	filled := FillGrid(res, start, end, 2, Missing)
+	assert.Equal(t, []int64{1502749390, 1502749392, 1502749394, 1502749396, 1502749398, 1502749400}, filled[0].Times)
+	assert.Equal(t, []string{"0", "", "4", "", "", ""}, formatted(filled[0].Values))
+
+	// The input is left untouched
+	assert.Len(t, res[0].Values, 2)
+
+	// Rows for every step even if all results miss them
+	expected := "1502749390,0,NaN\n" +
+		"1502749392,NaN,2\n" +
+		"1502749394,4,NaN\n" +
+		"1502749396,NaN,NaN\n" +
+		"1502749398,NaN,NaN\n" +
+		"1502749400,NaN,NaN\n"
+	buf := bytes.NewBuffer(nil)
+	assert.NoError(t, CSVWriter(buf, FillGrid(res, start, end, 2, math.NaN())))
+	assert.Equal(t, expected, buf.String())
+
+	// The end isn't part of the grid if it's not on a step
+	filled = FillGrid(res, start, end.Add(-time.Second), 2, Missing)
+	assert.Len(t, filled[0].Values, 5)
+}
+
+func TestFill(t *testing.T) {
+	res := []Result{{
+		Metric: "foobar",
+		Times:  []int64{1502749390, 1502749394, 1502749396, 1502749400},
+		Values: []float64{0, 4, math.NaN(), Missing},
+	}, {
+		Metric: "foobaz",
+		Times:  []int64{1502749392, 1502749398},
+		Values: []float64{2, 1},
+	}}
+
+	for policy, expected := range map[string]string{
+		FillNull:     "1502749390,0,\n1502749392,,2\n1502749394,4,\n1502749396,NaN,\n1502749398,,1\n1502749400,,\n",
+		FillZero:     "1502749390,0,0\n1502749392,0,2\n1502749394,4,0\n1502749396,NaN,0\n1502749398,0,1\n1502749400,0,0\n",
+		FillPrevious: "1502749390,0,\n1502749392,0,2\n1502749394,4,2\n1502749396,NaN,2\n1502749398,NaN,1\n1502749400,NaN,1\n",
+		FillLinear:   "1502749390,0,\n1502749392,2,2\n1502749394,4,1.6666666666666667\n1502749396,NaN,1.3333333333333335\n1502749398,,1\n1502749400,,\n",
+		"-1":         "1502749390,0,-1\n1502749392,-1,2\n1502749394,4,-1\n1502749396,NaN,-1\n1502749398,-1,1\n1502749400,-1,-1\n",
+	} {
+		filled, err := Fill(res, policy)
+		assert.NoError(t, err, policy)
+		buf := bytes.NewBuffer(nil)
+		assert.NoError(t, CSVWriter(buf, filled))
+		assert.Equal(t, expected, buf.String(), policy)
+	}
+
+	_, err := Fill(res, "mean")
+	assert.Error(t, err)
+}
+
+func TestRate(t *testing.T) {
+	// No results
+	assert.Len(t, Rate(nil, false), 0)
+
+	res := []Result{{
+		Metric: "http_requests_total",
+		Times:  []int64{1502749390, 1502749392, 1502749394, 1502749396, 1502749400, 1502749402},
+		Values: []float64{
+			10,
+			20,
+			25,
+			4,       // counter reset
+			Missing, // gap
+			10,
+		},
+	}}
+
+	for _, exact := range []bool{false, true} {
+		rated := Rate(res, exact)
+		assert.Equal(t, []int64{1502749392, 1502749394, 1502749396}, rated[0].Times)
+		assert.Equal(t, []float64{5, 2.5, 2}, rated[0].Values)
+	}
+}
+
+func TestDelta(t *testing.T) {
+	// No results
+	assert.Len(t, Delta(nil, false), 0)
+
+	res := []Result{{
+		Metric: "http_requests_total",
+		Times:  []int64{1502749390, 1502749392, 1502749394, 1502749396, 1502749400, 1502749402},
+		Values: []float64{
+			10,
+			20,
+			25.5,
+			4,       // counter reset
+			Missing, // gap
+			10,
+		},
+	}}
+
+	deltas := Delta(res, false)
+	assert.Equal(t, []int64{1502749392, 1502749394, 1502749396}, deltas[0].Times)
+	assert.Equal(t, []float64{10, 5.5, -21.5}, deltas[0].Values)
+
+	deltas = Delta(res, true)
+	assert.Equal(t, []float64{10, 5.5, 0}, deltas[0].Values)
+}
+
+func TestRatePrecision(t *testing.T) {
+	// Beyond 2^53 float64 can't represent every integer anymore, the
+	// increase of 2^53+1 is rounded to 2^53 before it's divided.
+	res := []Result{{
+		Metric: "bytes_total",
+		Times:  []int64{1502749390, 1502749393},
+		Values: []float64{1, 9007199254740994},
+	}}
+
+	assert.Equal(t, []string{"3002399751580330.5"}, formatted(Rate(res, false)[0].Values))
+	assert.Equal(t, []string{"3002399751580331"}, formatted(Rate(res, true)[0].Values))
+}
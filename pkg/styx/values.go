@@ -0,0 +1,54 @@
+package styx
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// The tokens Prometheus renders special float values as.
+const (
+	posInf = "+Inf"
+	negInf = "-Inf"
+	nan    = "NaN"
+)
+
+// SpecialValues are the placeholders text backends write instead of the
+// special float tokens, numeric backends use IEEE infinities and NaN.
+type SpecialValues struct {
+	PosInf string
+	NegInf string
+	NaN    string
+}
+
+// RawSpecialValues keeps the tokens as Prometheus returned them.
+var RawSpecialValues = SpecialValues{PosInf: posInf, NegInf: negInf, NaN: nan}
+
+// ParseSpecialValues parses placeholders given either as one for all
+// special values or as three comma separated ones for +Inf, -Inf and NaN.
+func ParseSpecialValues(s string) (SpecialValues, error) {
+	parts := strings.Split(s, ",")
+	switch len(parts) {
+	case 1:
+		return SpecialValues{PosInf: s, NegInf: s, NaN: s}, nil
+	case 3:
+		return SpecialValues{PosInf: parts[0], NegInf: parts[1], NaN: parts[2]}, nil
+	}
+	return SpecialValues{}, fmt.Errorf("placeholders need to be given as one for all or as +Inf,-Inf,NaN: %s", s)
+}
+
+// format formats a value like Prometheus does, with the placeholders for
+// the special float values. Missing values are empty.
+func (s SpecialValues) format(v float64) string {
+	switch {
+	case IsMissing(v):
+		return ""
+	case math.IsInf(v, 1):
+		return s.PosInf
+	case math.IsInf(v, -1):
+		return s.NegInf
+	case math.IsNaN(v):
+		return s.NaN
+	}
+	return formatStat(v)
+}
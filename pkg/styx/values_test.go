@@ -0,0 +1,93 @@
+package styx
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var specialResults = []Result{{
+	Metric: "foobar",
+	Times:  []int64{1502749390, 1502749391, 1502749392, 1502749393},
+	Values: []float64{math.Inf(1), math.Inf(-1), math.NaN(), 1},
+}}
+
+func TestSpecialValuesCSV(t *testing.T) {
+	// Passed through as is by default
+	buf := bytes.NewBuffer(nil)
+	assert.NoError(t, CSVWriter(buf, specialResults))
+	assert.Equal(t, "1502749390,+Inf\n1502749391,-Inf\n1502749392,NaN\n1502749393,1\n", buf.String())
+
+	placeholders := SpecialValues{PosInf: "1e308", NegInf: "-1e308", NaN: ""}
+	buf = bytes.NewBuffer(nil)
+	assert.NoError(t, CSV{Special: &placeholders}.Write(buf, specialResults))
+	assert.Equal(t, "1502749390,1e308\n1502749391,-1e308\n1502749392,\n1502749393,1\n", buf.String())
+}
+
+func TestParseSpecialValues(t *testing.T) {
+	s, err := ParseSpecialValues("")
+	assert.NoError(t, err)
+	assert.Equal(t, SpecialValues{}, s)
+
+	s, err = ParseSpecialValues("NA")
+	assert.NoError(t, err)
+	assert.Equal(t, SpecialValues{PosInf: "NA", NegInf: "NA", NaN: "NA"}, s)
+
+	s, err = ParseSpecialValues("1e308,-1e308,")
+	assert.NoError(t, err)
+	assert.Equal(t, SpecialValues{PosInf: "1e308", NegInf: "-1e308", NaN: ""}, s)
+
+	_, err = ParseSpecialValues("1e308,-1e308")
+	assert.Error(t, err)
+
+	// Empty cells for all of them keep spreadsheets happy
+	buf := bytes.NewBuffer(nil)
+	assert.NoError(t, CSV{Special: &SpecialValues{}}.Write(buf, specialResults))
+	assert.Equal(t, "1502749390,\n1502749391,\n1502749392,\n1502749393,1\n", buf.String())
+}
+
+func TestSpecialValuesJSON(t *testing.T) {
+	// JSON has no representation, the points are skipped
+	buf := bytes.NewBuffer(nil)
+	assert.NoError(t, DatadogWriter(buf, specialResults, "styx", 0, DatadogLabels))
+	assert.Equal(t, `{"series":[{"metric":"styx","points":[[1502749393,1]],"type":"gauge"}]}`+"\n", buf.String())
+}
+
+func TestSpecialValuesMatplotlib(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	assert.NoError(t, MatplotlibWriter(buf, specialResults, false))
+	assert.Equal(t, "t = [1502749390, 1502749391, 1502749392, 1502749393]\n"+
+		"s0 = [float('inf'), float('-inf'), float('nan'), 1]\n"+
+		"plot.plot(t, s0)\n", buf.String())
+}
+
+func TestSpecialValuesNpy(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	assert.NoError(t, NPYWriter(buf, specialResults))
+
+	out := buf.Bytes()
+	assert.Equal(t, "\x93NUMPY\x01\x00", string(out[:8]))
+
+	headerLen := int(binary.LittleEndian.Uint16(out[8:10]))
+	assert.Equal(t, 0, (10+headerLen)%64)
+	assert.Contains(t, string(out[10:10+headerLen]), "'shape': (4, 2)")
+
+	data := make([]float64, 8)
+	assert.NoError(t, binary.Read(bytes.NewReader(out[10+headerLen:]), binary.LittleEndian, data))
+	assert.Equal(t, 1502749390.0, data[0])
+	assert.True(t, math.IsInf(data[1], 1))
+	assert.True(t, math.IsInf(data[3], -1))
+	assert.True(t, math.IsNaN(data[5]))
+	assert.Equal(t, []float64{1502749393, 1}, data[6:])
+}
+
+func TestSpecialValuesRate(t *testing.T) {
+	for _, exact := range []bool{false, true} {
+		rated := Rate(specialResults, exact)
+		assert.Equal(t, []int64{1502749391, 1502749392, 1502749393}, rated[0].Times)
+		assert.Equal(t, []string{"-Inf", "NaN", "NaN"}, formatted(rated[0].Values))
+	}
+}
@@ -0,0 +1,151 @@
+package styx
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// VMExportURL returns the URL of VictoriaMetrics' export API dumping the
+// raw samples of the series matching the selector between start and end,
+// with the enforced labels injected into the selector.
+func VMExportURL(host string, start, end time.Time, selector string, opts Options) (*url.URL, error) {
+	start, end = opts.window(start, end, time.Now())
+
+	selector, err := injectMatchers(selector, opts.EnforceLabels)
+	if err != nil {
+		return nil, fmt.Errorf("can't enforce labels: %v", err)
+	}
+
+	return apiURL(host, "export", url.Values{
+		"match[]": []string{selector},
+		"start":   []string{fmt.Sprintf("%d", start.Unix())},
+		"end":     []string{fmt.Sprintf("%d", end.Unix())},
+	}, opts)
+}
+
+// VMExport dumps the raw samples of the series matching the selector from
+// VictoriaMetrics, which is much faster than range queries for bulk
+// extraction and isn't limited to MaxPoints samples per series. Only
+// series selectors like up{job="node"} can be exported, not expressions,
+// and the step of the options is ignored. The timestamps are rounded to
+// whole seconds like the ones of queries.
+func VMExport(host string, start, end time.Time, selector string, opts Options) ([]Result, error) {
+	var results []Result
+	index := make(map[string]int)
+	err := VMExportStream(host, start, end, selector, opts, func(r Result) error {
+		// Long series are exported in several lines.
+		id := SeriesID(r)
+		if i, ok := index[id]; ok {
+			results[i].merge(r)
+			return nil
+		}
+		index[id] = len(results)
+		results = append(results, r)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// VMExportStream dumps the raw samples like VMExport, but passes every line
+// of the export to fn as soon as it's decoded. A series may be passed more
+// than once, once per line VictoriaMetrics splits it into. Errors of fn
+// stop the export and are returned as they are.
+func VMExportStream(host string, start, end time.Time, selector string, opts Options, fn func(Result) error) (err error) {
+	ctx, span := opts.span("styx.VMExport")
+	span.SetAttribute("styx.host", host)
+	span.SetAttribute("styx.query", selector)
+	lines := 0
+	defer func() {
+		if err != nil {
+			span.RecordError(err)
+		}
+		span.SetAttribute("styx.results", lines)
+		span.End()
+	}()
+
+	u, err := VMExportURL(host, start, end, selector, opts)
+	if err != nil {
+		return err
+	}
+
+	_, err = fetchStream(ctx, host, opts.QueryMethod(u), u, selector, opts, func(body io.Reader, _ *apiStatus) error {
+		return decodeExport(body, func(r Result) error {
+			lines++
+			return fn(r)
+		})
+	})
+	if err != nil {
+		return err
+	}
+	if lines == 0 {
+		return ErrNoTimeseries
+	}
+	return nil
+}
+
+// vmLine is a line of the JSON export, timestamps are in milliseconds.
+type vmLine struct {
+	Metric     map[string]string `json:"metric"`
+	Values     []interface{}     `json:"values"`
+	Timestamps []int64           `json:"timestamps"`
+}
+
+// decodeExport decodes the JSON lines of an export and passes each to fn.
+func decodeExport(r io.Reader, fn func(Result) error) error {
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+	for {
+		var line vmLine
+		if err := dec.Decode(&line); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return decodeErr{err}
+		}
+		if len(line.Values) != len(line.Timestamps) {
+			return decodeErr{fmt.Errorf("%d values but %d timestamps", len(line.Values), len(line.Timestamps))}
+		}
+
+		labels := line.Metric
+		if labels == nil {
+			labels = map[string]string{}
+		}
+		r := Result{Metric: metricName(labels), Labels: labels}
+		for i, v := range line.Values {
+			value, err := vmValue(v)
+			if err != nil {
+				return decodeErr{err}
+			}
+			r.Add(int64(math.Round(float64(line.Timestamps[i])/1000)), value)
+		}
+		if err := fn(r); err != nil {
+			return err
+		}
+	}
+}
+
+// vmValue parses a value of the export. They're numbers, special values
+// may be strings like "NaN".
+func vmValue(v interface{}) (float64, error) {
+	var s string
+	switch v := v.(type) {
+	case json.Number:
+		s = v.String()
+	case string:
+		s = v
+	default:
+		return 0, fmt.Errorf("value isn't a number: %v", v)
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, fmt.Errorf("value isn't a number: %s", s)
+	}
+	return f, nil
+}
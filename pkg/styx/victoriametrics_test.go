@@ -0,0 +1,65 @@
+package styx
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVMExport(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/api/v1/export", r.URL.Path)
+		assert.Equal(t, "1502745790", r.URL.Query().Get("start"))
+		assert.Equal(t, "1502749390", r.URL.Query().Get("end"))
+		switch r.URL.Query().Get("match[]") {
+		case `up{job="node"}`:
+			fmt.Fprintln(w, `{"metric":{"__name__":"up","job":"node","instance":"a"},"values":[1,0],"timestamps":[1502749380000,1502749390000]}`)
+			fmt.Fprintln(w, `{"metric":{"__name__":"up","job":"node","instance":"b"},"values":[0.5,"NaN"],"timestamps":[1502749380000,1502749390000]}`)
+			fmt.Fprintln(w, `{"metric":{"instance":"a","job":"node","__name__":"up"},"values":[1e6],"timestamps":[1502749400000]}`)
+		case "invalid":
+			fmt.Fprintln(w, `{"metric":{},"values":[1,2],"timestamps":[1502749380000]}`)
+		}
+	}))
+	defer ts.Close()
+
+	start, end := time.Unix(1502745790, 0), time.Unix(1502749390, 0)
+	results, err := VMExport(ts.URL, start, end, "up", Options{EnforceLabels: map[string]string{"job": "node"}})
+	assert.NoError(t, err)
+	assert.Len(t, results, 2)
+	assert.Equal(t, Result{
+		Metric: `up{instance="a",job="node"}`,
+		Labels: map[string]string{"__name__": "up", "job": "node", "instance": "a"},
+		Times:  []int64{1502749380, 1502749390, 1502749400},
+		Values: []float64{1, 0, 1000000},
+	}, results[0])
+	assert.Equal(t, `up{instance="b",job="node"}`, results[1].Metric)
+	assert.Equal(t, map[string]string{"__name__": "up", "job": "node", "instance": "b"}, results[1].Labels)
+	assert.Equal(t, []int64{1502749380, 1502749390}, results[1].Times)
+	assert.Equal(t, []string{"0.5", "NaN"}, formatted(results[1].Values))
+
+	// Streaming passes every line.
+	lines := 0
+	assert.NoError(t, VMExportStream(ts.URL, start, end, `up{job="node"}`, Options{}, func(Result) error {
+		lines++
+		return nil
+	}))
+	assert.Equal(t, 3, lines)
+
+	_, err = VMExport(ts.URL, start, end, "none", Options{})
+	assert.Equal(t, ErrNoTimeseries, err)
+
+	var de *DecodeError
+	_, err = VMExport(ts.URL, start, end, "invalid", Options{})
+	assert.True(t, errors.As(err, &de), err)
+}
+
+func TestVMExportURL(t *testing.T) {
+	u, err := VMExportURL("http://vm:8428/select/0/prometheus", time.Unix(1502745790, 0), time.Unix(1502749390, 0), "up", Options{})
+	assert.NoError(t, err)
+	assert.Equal(t, "http://vm:8428/select/0/prometheus/api/v1/export?end=1502749390&match%5B%5D=up&start=1502745790", u.String())
+}
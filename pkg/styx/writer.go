@@ -0,0 +1,419 @@
+package styx
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// CSV writes results as RFC 4180 csv, quoting fields like metrics that
+// contain the delimiter or quotes.
+type CSV struct {
+	// Delimiter separates the fields, a comma if it's not set.
+	Delimiter rune
+	// Time is the format of the times, unix timestamps by default.
+	Time TimeFormat
+	// Labels are the label columns of WriteTidy, in order. All labels of
+	// the results are written if it's empty.
+	Labels []string
+	// Special are the placeholders of special float values, the tokens of
+	// Prometheus if it's nil.
+	Special *SpecialValues
+}
+
+// format formats a value with the placeholders of the special values.
+func (c CSV) format(v float64) string {
+	if c.Special == nil {
+		return formatValue(v)
+	}
+	return c.Special.format(v)
+}
+
+func (c CSV) writer(w io.Writer) *csv.Writer {
+	cw := csv.NewWriter(w)
+	if c.Delimiter != 0 {
+		cw.Comma = c.Delimiter
+	}
+	return cw
+}
+
+// CSVWriter writes the values of all results as rows of a CSV, one per timestamp.
+func CSVWriter(w io.Writer, results []Result) error {
+	return CSV{}.Write(w, results)
+}
+
+// Write writes the values of all results as rows, one per timestamp.
+func (c CSV) Write(w io.Writer, results []Result) error {
+	if len(results) == 0 {
+		return nil
+	}
+
+	cw := c.writer(w)
+	row := make([]string, len(results)+1)
+
+	columns := NewColumns(results)
+	for j, time := range columns.Times {
+		row[0] = c.Time.format(time)
+		for i, series := range columns.Series {
+			row[i+1] = c.format(series.Values[j])
+		}
+		if err := cw.Write(row); err != nil {
+			return err
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+// CSVHeaderWriter writes the header row matching CSVWriter.
+func CSVHeaderWriter(w io.Writer, results []Result) error {
+	return CSV{}.WriteHeader(w, results)
+}
+
+// WriteHeader writes the header row matching Write.
+func (c CSV) WriteHeader(w io.Writer, results []Result) error {
+	if len(results) == 0 {
+		return nil
+	}
+
+	header := []string{"Time"}
+	for _, result := range results {
+		header = append(header, result.Metric)
+	}
+
+	cw := c.writer(w)
+	if err := cw.Write(header); err != nil {
+		return err
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// TidyCSVWriter writes one row per sample with the time, a column per
+// label and the value, which is the long format pandas and R prefer.
+// Labels a result doesn't have are left empty.
+func TidyCSVWriter(w io.Writer, results []Result, header bool) error {
+	return CSV{}.WriteTidy(w, results, header)
+}
+
+// WriteTidy writes the rows of TidyCSVWriter.
+func (c CSV) WriteTidy(w io.Writer, results []Result, header bool) error {
+	if len(results) == 0 {
+		return nil
+	}
+
+	keys := c.Labels
+	if len(keys) == 0 {
+		keys = labelKeys(results)
+	}
+	cw := c.writer(w)
+
+	if header {
+		if err := cw.Write(append(append([]string{"Time"}, keys...), "Value")); err != nil {
+			return err
+		}
+	}
+
+	for _, time := range sortedTimes(results) {
+		for _, result := range results {
+			value, ok := result.At(time)
+			if !ok {
+				continue
+			}
+
+			row := []string{c.Time.format(time)}
+			for _, key := range keys {
+				row = append(row, result.Labels[key])
+			}
+			if err := cw.Write(append(row, c.format(value))); err != nil {
+				return err
+			}
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+// LongCSVWriter writes one row per sample with the time, the metric name,
+// the other labels as a single {name="value",...} string and the value.
+// Unlike TidyCSVWriter the columns don't depend on the labels of the results.
+func LongCSVWriter(w io.Writer, results []Result, header bool) error {
+	return CSV{}.WriteLong(w, results, header)
+}
+
+// WriteLong writes the rows of LongCSVWriter.
+func (c CSV) WriteLong(w io.Writer, results []Result, header bool) error {
+	if len(results) == 0 {
+		return nil
+	}
+
+	cw := c.writer(w)
+	if header {
+		if err := cw.Write([]string{"Time", "Metric", "Labels", "Value"}); err != nil {
+			return err
+		}
+	}
+
+	metrics := make([]string, len(results))
+	labels := make([]string, len(results))
+	for i, result := range results {
+		metrics[i], labels[i] = longLabels(result)
+	}
+
+	for _, time := range sortedTimes(results) {
+		for i, result := range results {
+			value, ok := result.At(time)
+			if !ok {
+				continue
+			}
+			if err := cw.Write([]string{c.Time.format(time), metrics[i], labels[i], c.format(value)}); err != nil {
+				return err
+			}
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+// longLabels returns the metric name and the other labels of a result,
+// results without labels are named by their metric.
+func longLabels(result Result) (string, string) {
+	if len(result.Labels) == 0 {
+		return result.Metric, "{}"
+	}
+
+	var names []string
+	for name := range result.Labels {
+		if name != "__name__" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	pairs := make([]string, len(names))
+	for i, name := range names {
+		pairs[i] = name + "=" + strconv.Quote(result.Labels[name])
+	}
+	return result.Labels["__name__"], "{" + strings.Join(pairs, ",") + "}"
+}
+
+// ValuesWriter writes the values of every result on a line, without times,
+// for simple numeric tools. The values are in order of the times of all
+// results, so columns line up, missing ones are set to gap or NaN.
+func ValuesWriter(w io.Writer, results []Result, sep, gap string) error {
+	if gap == "" {
+		gap = nan
+	}
+
+	for _, series := range NewColumns(results).Series {
+		vals := make([]string, len(series.Values))
+		for i, v := range series.Values {
+			vals[i] = formatValue(v)
+			if IsMissing(v) {
+				vals[i] = gap
+			}
+		}
+		if _, err := fmt.Fprintln(w, strings.Join(vals, sep)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// MatplotlibWriter plots every result, with comments each series is preceded
+// by a comment naming its metric so the script is readable without legend.
+func MatplotlibWriter(w io.Writer, results []Result, comments bool) error {
+	if len(results) == 0 {
+		return nil
+	}
+
+	columns := NewColumns(results)
+
+	fmt.Fprintf(w, "t = [%s]\n", matplotlibTimes(columns.Times))
+
+	for i, result := range results {
+		if comments {
+			fmt.Fprintf(w, "# s%d = %s\n", i, result.Metric)
+		}
+		fmt.Fprintf(w, "s%d = [%s]\n", i, strings.Join(matplotlibValues(columns.Series[i].Values), ", "))
+		fmt.Fprintf(w, "plot.plot(t, s%d)\n", i)
+	}
+
+	return nil
+}
+
+// matplotlibTimes returns the times as a Python list's elements.
+func matplotlibTimes(times []int64) string {
+	strs := make([]string, len(times))
+	for i, time := range times {
+		strs[i] = strconv.FormatInt(time, 10)
+	}
+	return strings.Join(strs, ", ")
+}
+
+// matplotlibValues returns the values of a column as Python floats,
+// missing ones are None.
+func matplotlibValues(values []float64) []string {
+	vals := make([]string, len(values))
+	for i, v := range values {
+		vals[i] = pythonSpecialValues.format(v)
+		if IsMissing(v) {
+			vals[i] = "None"
+		}
+	}
+	return vals
+}
+
+// pythonSpecialValues are the special float values in Python.
+var pythonSpecialValues = SpecialValues{
+	PosInf: "float('inf')",
+	NegInf: "float('-inf')",
+	NaN:    "float('nan')",
+}
+
+// MatplotlibLegendWriter writes the legend with the metric of every result.
+func MatplotlibLegendWriter(w io.Writer, results []Result) error {
+	labels := []string{}
+	for _, result := range results {
+		labels = append(labels, fmt.Sprintf("'%s'", result.Metric))
+	}
+
+	fmt.Fprintf(w, "plot.legend([%s], loc='upper left')\n", strings.Join(labels, ", "))
+
+	return nil
+}
+
+// MatplotlibPlotWriter plots all results and writes the matching legend,
+// so callers can't forget the legend or get it out of order.
+func MatplotlibPlotWriter(w io.Writer, results []Result, comments bool) error {
+	if len(results) == 0 {
+		return nil
+	}
+
+	if err := MatplotlibWriter(w, results, comments); err != nil {
+		return err
+	}
+	return MatplotlibLegendWriter(w, results)
+}
+
+// MatplotlibMarkWriter marks the points of the outliers with a cross in the
+// color of their result. The times have to be the ones of the plotted results.
+func MatplotlibMarkWriter(w io.Writer, results []Result, outliers []Result) error {
+	times := sortedTimes(results)
+
+	for i, outlier := range outliers {
+		if len(outlier.Values) == 0 {
+			continue
+		}
+		// The outliers are lined up on the times of the results.
+		marks := fillTimes([]Result{outlier}, times, Missing)[0]
+		fmt.Fprintf(w, "m%d = [%s]\n", i, strings.Join(matplotlibValues(marks.Values), ", "))
+		fmt.Fprintf(w, "plot.plot(t, m%d, 'x', color='C%d')\n", i, i%10)
+	}
+
+	return nil
+}
+
+// MatplotlibStackWriter stacks the results on top of each other with
+// stackplot and writes the legend. Missing points count as 0, so the
+// results should be on the full step grid to stack meaningfully.
+func MatplotlibStackWriter(w io.Writer, results []Result, comments bool) error {
+	if len(results) == 0 {
+		return nil
+	}
+
+	columns := NewColumns(results)
+	fmt.Fprintf(w, "t = [%s]\n", matplotlibTimes(columns.Times))
+
+	var series, labels []string
+	for i, result := range results {
+		var vals []string
+		for _, val := range matplotlibValues(columns.Series[i].Values) {
+			if val == "None" {
+				val = "0"
+			}
+			vals = append(vals, val)
+		}
+
+		if comments {
+			fmt.Fprintf(w, "# s%d = %s\n", i, result.Metric)
+		}
+		fmt.Fprintf(w, "s%d = [%s]\n", i, strings.Join(vals, ", "))
+
+		series = append(series, fmt.Sprintf("s%d", i))
+		labels = append(labels, fmt.Sprintf("'%s'", result.Metric))
+	}
+
+	fmt.Fprintf(w, "plot.stackplot(t, %s, labels=[%s])\n", strings.Join(series, ", "), strings.Join(labels, ", "))
+	fmt.Fprintln(w, "plot.legend(loc='upper left')")
+
+	return nil
+}
+
+// MatplotlibDualAxisWriter plots the results where secondary is true onto a
+// second y-axis sharing the x-axis. It writes the legend for both axes itself.
+func MatplotlibDualAxisWriter(w io.Writer, results []Result, secondary []bool, comments bool) error {
+	if len(results) == 0 {
+		return nil
+	}
+
+	columns := NewColumns(results)
+
+	fmt.Fprintln(w, "fig, ax = plot.subplots()")
+	fmt.Fprintln(w, "ax2 = ax.twinx()")
+	fmt.Fprintf(w, "t = [%s]\n", matplotlibTimes(columns.Times))
+
+	var lines, labels []string
+	for i, result := range results {
+		axis := "ax"
+		if secondary[i] {
+			axis = "ax2"
+		}
+
+		if comments {
+			fmt.Fprintf(w, "# s%d = %s\n", i, result.Metric)
+		}
+		// Every axis has its own color cycle, set the colors so lines don't look alike.
+		fmt.Fprintf(w, "s%d = [%s]\n", i, strings.Join(matplotlibValues(columns.Series[i].Values), ", "))
+		fmt.Fprintf(w, "l%d, = %s.plot(t, s%d, color='C%d')\n", i, axis, i, i%10)
+
+		lines = append(lines, fmt.Sprintf("l%d", i))
+		labels = append(labels, fmt.Sprintf("'%s'", result.Metric))
+	}
+
+	fmt.Fprintf(w, "ax.legend([%s], [%s], loc='upper left')\n", strings.Join(lines, ", "), strings.Join(labels, ", "))
+
+	return nil
+}
+
+// TableWriter writes the latest value of every result as a table.
+func TableWriter(w io.Writer, results []Result, nf NumberFormat) error {
+	if len(results) == 0 {
+		return nil
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "METRIC\tVALUE")
+	for _, result := range results {
+		fmt.Fprintf(tw, "%s\t%s\n", result.Metric, nf.format(latestValue(result)))
+	}
+
+	return tw.Flush()
+}
+
+// latestValue returns the value with the most recent timestamp, Missing if
+// there is none.
+func latestValue(result Result) float64 {
+	if len(result.Values) == 0 {
+		return Missing
+	}
+	return result.Values[len(result.Values)-1]
+}
@@ -0,0 +1,491 @@
+package styx
+
+import (
+	"bytes"
+	"encoding/csv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSortedTimes(t *testing.T) {
+	results := []Result{
+		{Times: []int64{999999999, 1000000000}, Values: []float64{1, 2}},
+		{Times: []int64{99, 1000000000}, Values: []float64{3, 4}},
+	}
+	assert.Equal(t, []int64{99, 999999999, 1000000000}, sortedTimes(results))
+}
+
+func TestCSVWriter(t *testing.T) {
+	// No results
+	buf := bytes.NewBuffer(nil)
+	assert.NoError(t, CSVWriter(buf, nil))
+	assert.Equal(t, "", buf.String())
+
+	// Result with one entry
+	res := []Result{{
+		Metric: "foobar",
+		Times:  []int64{1502749393},
+		Values: []float64{42},
+	}}
+	buf = bytes.NewBuffer(nil)
+	assert.NoError(t, CSVWriter(buf, res))
+	assert.Equal(t, "1502749393,42\n", buf.String())
+
+	// One result with multiple time series
+	res = []Result{{
+		Metric: "foobar",
+		Times:  []int64{1502749391, 1502749392, 1502749393, 1502749394, 1502749395},
+		Values: []float64{1, 2, 3, 4, 5},
+	}}
+	expected := "1502749391,1\n1502749392,2\n1502749393,3\n1502749394,4\n1502749395,5\n"
+	buf = bytes.NewBuffer(nil)
+	assert.NoError(t, CSVWriter(buf, res))
+	assert.Equal(t, expected, buf.String())
+
+	// Two results with multiple time series
+	res = []Result{{
+		Metric: "foobar",
+		Times:  []int64{1502749390, 1502749391, 1502749392, 1502749393, 1502749394},
+		Values: []float64{0, 1, 2, 3, 4},
+	}, {
+		Metric: "foobaz",
+		Times:  []int64{1502749390, 1502749391, 1502749392, 1502749393, 1502749394},
+		Values: []float64{5, 6, 7, 8, 9},
+	}}
+	expected = "1502749390,0,5\n1502749391,1,6\n1502749392,2,7\n1502749393,3,8\n1502749394,4,9\n"
+	buf = bytes.NewBuffer(nil)
+	assert.NoError(t, CSVWriter(buf, res))
+	assert.Equal(t, expected, buf.String())
+
+	// Two results with multiple time series
+	res = []Result{{
+		Metric: "foobar",
+		Times:  []int64{1502749390, 1502749392, 1502749393, 1502749394, 1502749396},
+		Values: []float64{0, 2, 3, 4, 10},
+	}, {
+		Metric: "foobaz",
+		Times:  []int64{1502749390, 1502749391, 1502749392, 1502749393, 1502749394},
+		Values: []float64{5, 6, 7, 8, 9},
+	}}
+	expected = "1502749390,0,5\n1502749391,,6\n1502749392,2,7\n1502749393,3,8\n1502749394,4,9\n1502749396,10,\n"
+	buf = bytes.NewBuffer(nil)
+	assert.NoError(t, CSVWriter(buf, res))
+	assert.Equal(t, expected, buf.String())
+}
+
+func TestCSVHeaderWriter(t *testing.T) {
+	// No results
+	buf := bytes.NewBuffer(nil)
+	assert.NoError(t, CSVHeaderWriter(buf, nil))
+	assert.Equal(t, "", buf.String())
+
+	// Result with one entry
+	res := []Result{{
+		Metric: "foobar",
+		Times:  []int64{1502749393},
+		Values: []float64{42},
+	}}
+	buf = bytes.NewBuffer(nil)
+	assert.NoError(t, CSVHeaderWriter(buf, res))
+	assert.Equal(t, "Time,foobar\n", buf.String())
+
+	// Two results with multiple time series
+	res = []Result{{
+		Metric: "foobar",
+		Times:  []int64{1502749390},
+		Values: []float64{0},
+	}, {
+		Metric: "foobaz",
+		Times:  []int64{1502749390},
+		Values: []float64{5},
+	}}
+	expected := "Time,foobar,foobaz\n"
+	buf = bytes.NewBuffer(nil)
+	assert.NoError(t, CSVHeaderWriter(buf, res))
+	assert.Equal(t, expected, buf.String())
+
+	// Metrics with commas and quotes are quoted
+	res = []Result{{
+		Metric: `up{job="a",ns="b"}`,
+		Times:  []int64{1502749390},
+		Values: []float64{1},
+	}}
+	buf = bytes.NewBuffer(nil)
+	assert.NoError(t, CSVHeaderWriter(buf, res))
+	assert.Equal(t, "Time,\"up{job=\"\"a\"\",ns=\"\"b\"\"}\"\n", buf.String())
+}
+
+func TestCSVDelimiter(t *testing.T) {
+	res := []Result{{
+		Metric: `up{job="a",ns="b"}`,
+		Labels: map[string]string{"job": "a", "ns": "b"},
+		Times:  []int64{1502749390},
+		Values: []float64{1},
+	}, {
+		Metric: `up{job="a;b"}`,
+		Labels: map[string]string{"job": "a;b"},
+		Times:  []int64{1502749390},
+		Values: []float64{0.5},
+	}}
+
+	c := CSV{Delimiter: ';'}
+	buf := bytes.NewBuffer(nil)
+	assert.NoError(t, c.WriteHeader(buf, res))
+	assert.NoError(t, c.Write(buf, res))
+	assert.Equal(t, "Time;\"up{job=\"\"a\"\",ns=\"\"b\"\"}\";\"up{job=\"\"a;b\"\"}\"\n1502749390;1;0.5\n", buf.String())
+
+	buf = bytes.NewBuffer(nil)
+	assert.NoError(t, CSV{Delimiter: '\t'}.WriteTidy(buf, res, true))
+	assert.Equal(t, "Time\tjob\tns\tValue\n1502749390\ta\tb\t1\n1502749390\ta;b\t\t0.5\n", buf.String())
+}
+
+func TestTidyCSVWriter(t *testing.T) {
+	// No results
+	buf := bytes.NewBuffer(nil)
+	assert.NoError(t, TidyCSVWriter(buf, nil, true))
+	assert.Equal(t, "", buf.String())
+
+	res := []Result{{
+		Metric: `up{instance="localhost:9090",job="prometheus"}`,
+		Labels: map[string]string{"__name__": "up", "instance": "localhost:9090", "job": "prometheus"},
+		Times:  []int64{1502749390, 1502749391},
+		Values: []float64{1, 0},
+	}, {
+		Metric: `up{job="node",path="/a,b"}`,
+		Labels: map[string]string{"__name__": "up", "job": "node", "path": "/a,b"},
+		Times:  []int64{1502749391},
+		Values: []float64{1},
+	}}
+	expected := "Time,__name__,instance,job,path,Value\n" +
+		"1502749390,up,localhost:9090,prometheus,,1\n" +
+		"1502749391,up,localhost:9090,prometheus,,0\n" +
+		"1502749391,up,,node,\"/a,b\",1\n"
+	buf = bytes.NewBuffer(nil)
+	assert.NoError(t, TidyCSVWriter(buf, res, true))
+	assert.Equal(t, expected, buf.String())
+
+	// Both formats hold the same samples, the wide one has a row per time
+	// and a column per result, the tidy one a row per sample.
+	wide := bytes.NewBuffer(nil)
+	assert.NoError(t, CSVWriter(wide, res))
+	assert.Equal(t, "1502749390,1,\n1502749391,0,1\n", wide.String())
+
+	tidy := bytes.NewBuffer(nil)
+	assert.NoError(t, TidyCSVWriter(tidy, res, false))
+	assert.Equal(t, expected[strings.Index(expected, "\n")+1:], tidy.String())
+
+	// Only the selected label columns, in their order.
+	buf = bytes.NewBuffer(nil)
+	assert.NoError(t, CSV{Labels: []string{"job", "instance"}}.WriteTidy(buf, res, true))
+	assert.Equal(t, "Time,job,instance,Value\n"+
+		"1502749390,prometheus,localhost:9090,1\n"+
+		"1502749391,prometheus,localhost:9090,0\n"+
+		"1502749391,node,,1\n", buf.String())
+}
+
+func TestLongCSVWriter(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	assert.NoError(t, LongCSVWriter(buf, nil, true))
+	assert.Equal(t, "", buf.String())
+
+	res := []Result{{
+		Metric: `up{instance="localhost:9090",job="prometheus"}`,
+		Labels: map[string]string{"__name__": "up", "instance": "localhost:9090", "job": "prometheus"},
+		Times:  []int64{1502749390, 1502749391},
+		Values: []float64{1, 0},
+	}, {
+		Metric: `up{job="node",path="/a,b"}`,
+		Labels: map[string]string{"__name__": "up", "job": "node", "path": "/a,b"},
+		Times:  []int64{1502749391},
+		Values: []float64{1},
+	}, {
+		Metric: "sum(up)",
+		Times:  []int64{1502749391},
+		Values: []float64{2},
+	}}
+	expected := "Time,Metric,Labels,Value\n" +
+		"1502749390,up,\"{instance=\"\"localhost:9090\"\",job=\"\"prometheus\"\"}\",1\n" +
+		"1502749391,up,\"{instance=\"\"localhost:9090\"\",job=\"\"prometheus\"\"}\",0\n" +
+		"1502749391,up,\"{job=\"\"node\"\",path=\"\"/a,b\"\"}\",1\n" +
+		"1502749391,sum(up),{},2\n"
+	assert.NoError(t, LongCSVWriter(buf, res, true))
+	assert.Equal(t, expected, buf.String())
+
+	// The labels survive a round trip through a csv reader
+	records, err := csv.NewReader(strings.NewReader(expected)).ReadAll()
+	assert.NoError(t, err)
+	assert.Equal(t, `{job="node",path="/a,b"}`, records[3][2])
+}
+
+func TestValuesWriter(t *testing.T) {
+	// No results
+	buf := bytes.NewBuffer(nil)
+	assert.NoError(t, ValuesWriter(buf, nil, " ", ""))
+	assert.Equal(t, "", buf.String())
+
+	res := []Result{{
+		Metric: "foobar",
+		Times:  []int64{1502749390, 1502749391, 1502749392},
+		Values: []float64{1, 2, Missing},
+	}, {
+		Metric: "foobaz",
+		Times:  []int64{1502749391},
+		Values: []float64{3},
+	}}
+
+	buf = bytes.NewBuffer(nil)
+	assert.NoError(t, ValuesWriter(buf, res, " ", ""))
+	assert.Equal(t, "1 2 NaN\nNaN 3 NaN\n", buf.String())
+
+	buf = bytes.NewBuffer(nil)
+	assert.NoError(t, ValuesWriter(buf, res, ",", "0"))
+	assert.Equal(t, "1,2,0\n0,3,0\n", buf.String())
+}
+
+func TestMatplotlibWriter(t *testing.T) {
+	// No results
+	buf := bytes.NewBuffer(nil)
+	assert.NoError(t, MatplotlibWriter(buf, nil, false))
+	assert.Equal(t, "", buf.String())
+
+	// Result with one entry
+	res := []Result{{
+		Metric: "foobar",
+		Times:  []int64{1502749393},
+		Values: []float64{42},
+	}}
+	expected := "t = [1502749393]\ns0 = [42]\nplot.plot(t, s0)\n"
+	buf = bytes.NewBuffer(nil)
+	assert.NoError(t, MatplotlibWriter(buf, res, false))
+	assert.Equal(t, expected, buf.String())
+
+	// One result with multiple time series
+	res = []Result{{
+		Metric: "foobar",
+		Times:  []int64{1502749391, 1502749392, 1502749393, 1502749394, 1502749395},
+		Values: []float64{1, 2, 3, 4, 5},
+	}}
+	expected = "t = [1502749391, 1502749392, 1502749393, 1502749394, 1502749395]\n" +
+		"s0 = [1, 2, 3, 4, 5]\n" +
+		"plot.plot(t, s0)\n"
+	buf = bytes.NewBuffer(nil)
+	assert.NoError(t, MatplotlibWriter(buf, res, false))
+	assert.Equal(t, expected, buf.String())
+
+	// Two results with multiple time series
+	res = []Result{{
+		Metric: "foobar",
+		Times:  []int64{1502749390, 1502749391, 1502749392, 1502749393, 1502749394},
+		Values: []float64{0, 1, 2, 3, 4},
+	}, {
+		Metric: "foobaz",
+		Times:  []int64{1502749390, 1502749391, 1502749392, 1502749393, 1502749394},
+		Values: []float64{5, 6, 7, 8, 9},
+	}}
+	expected = "t = [1502749390, 1502749391, 1502749392, 1502749393, 1502749394]\n" +
+		"s0 = [0, 1, 2, 3, 4]\n" +
+		"plot.plot(t, s0)\n" +
+		"s1 = [5, 6, 7, 8, 9]\n" +
+		"plot.plot(t, s1)\n"
+	buf = bytes.NewBuffer(nil)
+	assert.NoError(t, MatplotlibWriter(buf, res, false))
+	assert.Equal(t, expected, buf.String())
+
+	// Two results with multiple time series
+	res = []Result{{
+		Metric: "foobar",
+		Times:  []int64{1502749390, 1502749392, 1502749393, 1502749394, 1502749396},
+		Values: []float64{0, 2, 3, 4, 10},
+	}, {
+		Metric: "foobaz",
+		Times:  []int64{1502749390, 1502749391, 1502749392, 1502749393, 1502749394},
+		Values: []float64{5, 6, 7, 8, 9},
+	}}
+	expected = "t = [1502749390, 1502749391, 1502749392, 1502749393, 1502749394, 1502749396]\n" +
+		"s0 = [0, None, 2, 3, 4, 10]\n" +
+		"plot.plot(t, s0)\n" +
+		"s1 = [5, 6, 7, 8, 9, None]\n" +
+		"plot.plot(t, s1)\n"
+	buf = bytes.NewBuffer(nil)
+	assert.NoError(t, MatplotlibWriter(buf, res, false))
+	assert.Equal(t, expected, buf.String())
+}
+
+func TestMatplotlibWriterComments(t *testing.T) {
+	res := []Result{{
+		Metric: `http_requests_total{code="200"}`,
+		Times:  []int64{1502749390},
+		Values: []float64{1},
+	}, {
+		Metric: `http_requests_total{code="500"}`,
+		Times:  []int64{1502749390},
+		Values: []float64{2},
+	}}
+	expected := "t = [1502749390]\n" +
+		"# s0 = http_requests_total{code=\"200\"}\n" +
+		"s0 = [1]\n" +
+		"plot.plot(t, s0)\n" +
+		"# s1 = http_requests_total{code=\"500\"}\n" +
+		"s1 = [2]\n" +
+		"plot.plot(t, s1)\n"
+	buf := bytes.NewBuffer(nil)
+	assert.NoError(t, MatplotlibWriter(buf, res, true))
+	assert.Equal(t, expected, buf.String())
+
+	expected = "fig, ax = plot.subplots()\n" +
+		"ax2 = ax.twinx()\n" +
+		"t = [1502749390]\n" +
+		"# s0 = http_requests_total{code=\"200\"}\n" +
+		"s0 = [1]\n" +
+		"l0, = ax.plot(t, s0, color='C0')\n" +
+		"# s1 = http_requests_total{code=\"500\"}\n" +
+		"s1 = [2]\n" +
+		"l1, = ax2.plot(t, s1, color='C1')\n" +
+		"ax.legend([l0, l1], ['http_requests_total{code=\"200\"}', 'http_requests_total{code=\"500\"}'], loc='upper left')\n"
+	buf = bytes.NewBuffer(nil)
+	assert.NoError(t, MatplotlibDualAxisWriter(buf, res, []bool{false, true}, true))
+	assert.Equal(t, expected, buf.String())
+}
+
+func TestMatplotlibPlotWriter(t *testing.T) {
+	// No results
+	buf := bytes.NewBuffer(nil)
+	assert.NoError(t, MatplotlibPlotWriter(buf, nil, false))
+	assert.Equal(t, "", buf.String())
+
+	res := []Result{{
+		Metric: "foobar",
+		Times:  []int64{1502749390},
+		Values: []float64{0},
+	}, {
+		Metric: "foobaz",
+		Times:  []int64{1502749390},
+		Values: []float64{5},
+	}}
+	expected := "t = [1502749390]\n" +
+		"s0 = [0]\n" +
+		"plot.plot(t, s0)\n" +
+		"s1 = [5]\n" +
+		"plot.plot(t, s1)\n" +
+		"plot.legend(['foobar', 'foobaz'], loc='upper left')\n"
+	buf = bytes.NewBuffer(nil)
+	assert.NoError(t, MatplotlibPlotWriter(buf, res, false))
+	assert.Equal(t, expected, buf.String())
+}
+
+func TestMatplotlibMarkWriter(t *testing.T) {
+	res := []Result{{
+		Metric: "foobar",
+		Times:  []int64{1502749390, 1502749391},
+		Values: []float64{1, 9},
+	}, {
+		Metric: "foobaz",
+		Times:  []int64{1502749391},
+		Values: []float64{2},
+	}}
+	outliers := []Result{{
+		Metric: "foobar",
+		Times:  []int64{1502749391},
+		Values: []float64{1000},
+	}, {
+		Metric: "foobaz",
+		Times:  []int64{},
+		Values: []float64{},
+	}}
+
+	buf := bytes.NewBuffer(nil)
+	assert.NoError(t, MatplotlibMarkWriter(buf, res, outliers))
+	assert.Equal(t, "m0 = [None, 1000]\nplot.plot(t, m0, 'x', color='C0')\n", buf.String())
+}
+
+func TestMatplotlibStackWriter(t *testing.T) {
+	// No results
+	buf := bytes.NewBuffer(nil)
+	assert.NoError(t, MatplotlibStackWriter(buf, nil, false))
+	assert.Equal(t, "", buf.String())
+
+	res := []Result{{
+		Metric: `node_cpu{mode="user"}`,
+		Times:  []int64{1502749390, 1502749391},
+		Values: []float64{0.5, 0.25},
+	}, {
+		Metric: `node_cpu{mode="system"}`,
+		Times:  []int64{1502749391},
+		Values: []float64{0.5},
+	}}
+	expected := "t = [1502749390, 1502749391]\n" +
+		"s0 = [0.5, 0.25]\n" +
+		"s1 = [0, 0.5]\n" +
+		"plot.stackplot(t, s0, s1, labels=['node_cpu{mode=\"user\"}', 'node_cpu{mode=\"system\"}'])\n" +
+		"plot.legend(loc='upper left')\n"
+	buf = bytes.NewBuffer(nil)
+	assert.NoError(t, MatplotlibStackWriter(buf, res, false))
+	assert.Equal(t, expected, buf.String())
+	assert.Contains(t, buf.String(), "plot.stackplot(")
+	assert.NotContains(t, buf.String(), "plot.plot(")
+}
+
+func TestMatplotlibDualAxisWriter(t *testing.T) {
+	// No results
+	buf := bytes.NewBuffer(nil)
+	assert.NoError(t, MatplotlibDualAxisWriter(buf, nil, nil, false))
+	assert.Equal(t, "", buf.String())
+
+	res := []Result{{
+		Metric: "requests",
+		Times:  []int64{1502749390, 1502749391},
+		Values: []float64{100, 120},
+	}, {
+		Metric: "latency",
+		Times:  []int64{1502749391},
+		Values: []float64{0.25},
+	}}
+	expected := "fig, ax = plot.subplots()\n" +
+		"ax2 = ax.twinx()\n" +
+		"t = [1502749390, 1502749391]\n" +
+		"s0 = [100, 120]\n" +
+		"l0, = ax.plot(t, s0, color='C0')\n" +
+		"s1 = [None, 0.25]\n" +
+		"l1, = ax2.plot(t, s1, color='C1')\n" +
+		"ax.legend([l0, l1], ['requests', 'latency'], loc='upper left')\n"
+	buf = bytes.NewBuffer(nil)
+	assert.NoError(t, MatplotlibDualAxisWriter(buf, res, []bool{false, true}, false))
+	assert.Equal(t, expected, buf.String())
+}
+
+func TestTableWriter(t *testing.T) {
+	// No results
+	buf := bytes.NewBuffer(nil)
+	assert.NoError(t, TableWriter(buf, nil, RawFormat))
+	assert.Equal(t, "", buf.String())
+
+	// Only the latest value of every result is shown
+	res := []Result{{
+		Metric: `go_goroutines{job="prometheus"}`,
+		Times:  []int64{1502749390, 1502749391},
+		Values: []float64{40, 42},
+	}, {
+		Metric: "up",
+		Times:  []int64{1502749390},
+		Values: []float64{1},
+	}}
+	expected := "METRIC                           VALUE\n" +
+		"go_goroutines{job=\"prometheus\"}  42\n" +
+		"up                               1\n"
+	buf = bytes.NewBuffer(nil)
+	assert.NoError(t, TableWriter(buf, res, RawFormat))
+	assert.Equal(t, expected, buf.String())
+
+	// Values are formatted for display
+	res = []Result{{
+		Metric: "bytes",
+		Times:  []int64{1502749390},
+		Values: []float64{1234567.891},
+	}}
+	expected = "METRIC  VALUE\nbytes   1,234,567.89\n"
+	buf = bytes.NewBuffer(nil)
+	assert.NoError(t, TableWriter(buf, res, NumberFormat{Thousands: ",", Precision: 2}))
+	assert.Equal(t, expected, buf.String())
+}
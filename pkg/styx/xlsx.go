@@ -0,0 +1,173 @@
+package styx
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+)
+
+// Sheet is a worksheet of the workbooks XLSXWriter writes.
+type Sheet struct {
+	// Name is shown on the sheet's tab, Excel limits it to 31 characters.
+	Name    string
+	Results []Result
+}
+
+const (
+	xlsxMain          = "http://schemas.openxmlformats.org/spreadsheetml/2006/main"
+	xlsxRelationships = "http://schemas.openxmlformats.org/officeDocument/2006/relationships"
+	xlsxPackageRels   = "http://schemas.openxmlformats.org/package/2006/relationships"
+	xlsxContentTypes  = "http://schemas.openxmlformats.org/package/2006/content-types"
+	xlsxHeader        = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` + "\n"
+)
+
+// xlsxStyles has the default cell format and a date time format at index 1.
+const xlsxStyles = xlsxHeader + `<styleSheet xmlns="` + xlsxMain + `">` +
+	`<fonts count="1"><font><sz val="11"/><name val="Calibri"/></font></fonts>` +
+	`<fills count="2"><fill><patternFill patternType="none"/></fill><fill><patternFill patternType="gray125"/></fill></fills>` +
+	`<borders count="1"><border/></borders>` +
+	`<cellStyleXfs count="1"><xf numFmtId="0" fontId="0" fillId="0" borderId="0"/></cellStyleXfs>` +
+	`<cellXfs count="2"><xf numFmtId="0" fontId="0" fillId="0" borderId="0" xfId="0"/>` +
+	`<xf numFmtId="22" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/></cellXfs>` +
+	`</styleSheet>`
+
+// XLSXWriter writes the sheets as an Excel workbook. Every sheet has the
+// time in the first column and one column per result, like the csv.
+// Times are dates in UTC and values numbers, so Excel can compute with
+// them. Special float tokens are kept as text, missing points are empty.
+func XLSXWriter(w io.Writer, sheets []Sheet) error {
+	z := zip.NewWriter(w)
+
+	files := []xlsxFile{
+		{"[Content_Types].xml", func(w io.Writer) error { return xlsxContentTypesWriter(w, len(sheets)) }},
+		{"_rels/.rels", func(w io.Writer) error {
+			_, err := fmt.Fprintf(w, `%s<Relationships xmlns="%s"><Relationship Id="rId1" Type="%s/officeDocument" Target="xl/workbook.xml"/></Relationships>`,
+				xlsxHeader, xlsxPackageRels, xlsxRelationships)
+			return err
+		}},
+		{"xl/workbook.xml", func(w io.Writer) error { return xlsxWorkbookWriter(w, sheets) }},
+		{"xl/_rels/workbook.xml.rels", func(w io.Writer) error { return xlsxWorkbookRelsWriter(w, len(sheets)) }},
+		{"xl/styles.xml", func(w io.Writer) error {
+			_, err := io.WriteString(w, xlsxStyles)
+			return err
+		}},
+	}
+	for i, sheet := range sheets {
+		results := sheet.Results
+		files = append(files, xlsxFile{fmt.Sprintf("xl/worksheets/sheet%d.xml", i+1), func(w io.Writer) error {
+			return xlsxSheetWriter(w, results)
+		}})
+	}
+
+	for _, file := range files {
+		f, err := z.Create(file.name)
+		if err != nil {
+			return err
+		}
+		if err := file.write(f); err != nil {
+			return err
+		}
+	}
+
+	return z.Close()
+}
+
+// xlsxFile is a part of the zipped workbook.
+type xlsxFile struct {
+	name  string
+	write func(io.Writer) error
+}
+
+func xlsxContentTypesWriter(w io.Writer, sheets int) error {
+	fmt.Fprintf(w, `%s<Types xmlns="%s">`, xlsxHeader, xlsxContentTypes)
+	fmt.Fprint(w, `<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>`)
+	fmt.Fprint(w, `<Default Extension="xml" ContentType="application/xml"/>`)
+	fmt.Fprint(w, `<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>`)
+	fmt.Fprint(w, `<Override PartName="/xl/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.styles+xml"/>`)
+	for i := 1; i <= sheets; i++ {
+		fmt.Fprintf(w, `<Override PartName="/xl/worksheets/sheet%d.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>`, i)
+	}
+	_, err := fmt.Fprint(w, `</Types>`)
+	return err
+}
+
+func xlsxWorkbookWriter(w io.Writer, sheets []Sheet) error {
+	fmt.Fprintf(w, `%s<workbook xmlns="%s" xmlns:r="%s"><sheets>`, xlsxHeader, xlsxMain, xlsxRelationships)
+	for i, sheet := range sheets {
+		fmt.Fprintf(w, `<sheet name="%s" sheetId="%d" r:id="rId%d"/>`, xmlEscape(sheet.Name), i+1, i+1)
+	}
+	_, err := fmt.Fprint(w, `</sheets></workbook>`)
+	return err
+}
+
+func xlsxWorkbookRelsWriter(w io.Writer, sheets int) error {
+	fmt.Fprintf(w, `%s<Relationships xmlns="%s">`, xlsxHeader, xlsxPackageRels)
+	for i := 1; i <= sheets; i++ {
+		fmt.Fprintf(w, `<Relationship Id="rId%d" Type="%s/worksheet" Target="worksheets/sheet%d.xml"/>`, i, xlsxRelationships, i)
+	}
+	fmt.Fprintf(w, `<Relationship Id="rId%d" Type="%s/styles" Target="styles.xml"/>`, sheets+1, xlsxRelationships)
+	_, err := fmt.Fprint(w, `</Relationships>`)
+	return err
+}
+
+func xlsxSheetWriter(w io.Writer, results []Result) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, `%s<worksheet xmlns="%s"><sheetData>`, xlsxHeader, xlsxMain)
+
+	fmt.Fprint(bw, `<row r="1">`)
+	xlsxStringCell(bw, 0, 1, "Time")
+	for i, result := range results {
+		xlsxStringCell(bw, i+1, 1, result.Metric)
+	}
+	fmt.Fprint(bw, `</row>`)
+
+	columns := NewColumns(results)
+	for i, time := range columns.Times {
+		row := i + 2
+
+		fmt.Fprintf(bw, `<row r="%d">`, row)
+		// Excel counts days since 1899-12-30, the unix epoch is day 25569.
+		days := float64(time)/86400 + 25569
+		fmt.Fprintf(bw, `<c r="%s" s="1"><v>%s</v></c>`, xlsxCell(0, row), strconv.FormatFloat(days, 'f', -1, 64))
+
+		for j, series := range columns.Series {
+			v := series.Values[i]
+			switch {
+			case IsMissing(v):
+			case math.IsInf(v, 0) || math.IsNaN(v):
+				xlsxStringCell(bw, j+1, row, formatValue(v))
+			default:
+				fmt.Fprintf(bw, `<c r="%s"><v>%s</v></c>`, xlsxCell(j+1, row), strconv.FormatFloat(v, 'g', -1, 64))
+			}
+		}
+		fmt.Fprint(bw, `</row>`)
+	}
+
+	fmt.Fprint(bw, `</sheetData></worksheet>`)
+	return bw.Flush()
+}
+
+func xlsxStringCell(w io.Writer, col, row int, s string) {
+	fmt.Fprintf(w, `<c r="%s" t="inlineStr"><is><t>%s</t></is></c>`, xlsxCell(col, row), xmlEscape(s))
+}
+
+// xlsxCell returns the reference of a cell, the column is counted from 0
+// and the row from 1, e.g. A1 or AB12.
+func xlsxCell(col, row int) string {
+	name := ""
+	for col++; col > 0; col = (col - 1) / 26 {
+		name = string(rune('A'+(col-1)%26)) + name
+	}
+	return name + strconv.Itoa(row)
+}
+
+func xmlEscape(s string) string {
+	var buf bytes.Buffer
+	xml.EscapeText(&buf, []byte(s))
+	return buf.String()
+}
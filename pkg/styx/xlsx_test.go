@@ -0,0 +1,54 @@
+package styx
+
+import (
+	"archive/zip"
+	"bytes"
+	"io/ioutil"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestXLSXWriter(t *testing.T) {
+	results := []Result{
+		{Metric: `up{job="a&b"}`, Times: []int64{1502745790, 1502745850}, Values: []float64{1, math.Inf(1)}},
+		{Metric: "go_goroutines", Times: []int64{1502745850}, Values: []float64{42.5}},
+	}
+
+	var buf bytes.Buffer
+	assert.NoError(t, XLSXWriter(&buf, []Sheet{{Name: "data", Results: results}, {Name: "Query 1", Results: results[:1]}}))
+
+	r, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	assert.NoError(t, err)
+
+	files := map[string]string{}
+	for _, f := range r.File {
+		rc, err := f.Open()
+		assert.NoError(t, err)
+		b, err := ioutil.ReadAll(rc)
+		assert.NoError(t, err)
+		files[f.Name] = string(b)
+	}
+
+	assert.Contains(t, files, "[Content_Types].xml")
+	assert.Contains(t, files, "_rels/.rels")
+	assert.Contains(t, files, "xl/styles.xml")
+	assert.Contains(t, files["xl/_rels/workbook.xml.rels"], `Target="worksheets/sheet2.xml"`)
+	assert.Contains(t, files["xl/workbook.xml"], `<sheet name="data" sheetId="1" r:id="rId1"/><sheet name="Query 1" sheetId="2" r:id="rId2"/>`)
+
+	sheet := files["xl/worksheets/sheet1.xml"]
+	assert.Contains(t, sheet, `<c r="B1" t="inlineStr"><is><t>up{job=&#34;a&amp;b&#34;}</t></is></c>`)
+	// 2017-08-14T21:23:10Z as days since 1899-12-30
+	assert.Contains(t, sheet, `<c r="A2" s="1"><v>42961.89108796296</v></c><c r="B2"><v>1</v></c></row>`)
+	assert.Contains(t, sheet, `<c r="B3" t="inlineStr"><is><t>+Inf</t></is></c><c r="C3"><v>42.5</v></c>`)
+	assert.NotContains(t, files["xl/worksheets/sheet2.xml"], "go_goroutines")
+}
+
+func TestXLSXCell(t *testing.T) {
+	assert.Equal(t, "A1", xlsxCell(0, 1))
+	assert.Equal(t, "Z2", xlsxCell(25, 2))
+	assert.Equal(t, "AA3", xlsxCell(26, 3))
+	assert.Equal(t, "AB12", xlsxCell(27, 12))
+	assert.Equal(t, "BA1", xlsxCell(52, 1))
+}
@@ -0,0 +1,918 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/go-pluto/styx/pkg/styx"
+	"github.com/urfave/cli"
+)
+
+// queryFlags are the flags shared by every command running queries.
+type queryFlags struct {
+	Headers    cli.StringSlice
+	Cookies    cli.StringSlice
+	CookieFile string
+	Record     string
+	Replay     string
+	Points     int
+	MaxPoints  int
+	Step       string
+	ParamNames cli.StringSlice
+	Params     cli.StringSlice
+	Coarsen    int
+	Retries    int
+	Backoff    time.Duration
+	Parallel   int
+	Accept     string
+	Enforce    cli.StringSlice
+	APIVersion string
+	Method     string
+	Backend    string
+	Instant    bool
+	CACert     string
+	Insecure   bool
+	ClientCert string
+	ClientKey  string
+	Timeout    time.Duration
+	Connect    time.Duration
+	Response   time.Duration
+	Proxy      string
+	Token      string
+	TokenFile  string
+	Auth       string
+	Region     string
+	Project    string
+
+	OAuth2TokenURL   string
+	OAuth2ClientID   string
+	OAuth2Secret     string
+	OAuth2SecretFile string
+	OAuth2Scopes     cli.StringSlice
+
+	ICPURL    string
+	ICPAPIKey string
+
+	Username     string
+	Password     string
+	PasswordFile string
+
+	Profile string
+	Config  string
+
+	OrgID           string
+	Dedup           bool
+	PartialResponse bool
+}
+
+func (f *queryFlags) flags() []cli.Flag {
+	return []cli.Flag{
+		cli.StringSliceFlag{
+			Name:  "http-header",
+			Usage: "Send a header with every request, e.g. 'X-Grafana-Org-Id: 1'",
+			Value: &f.Headers,
+		},
+		cli.StringSliceFlag{
+			Name:  "cookie",
+			Usage: "Send a cookie with every request, e.g. 'grafana_session=abc'",
+			Value: &f.Cookies,
+		},
+		cli.StringFlag{
+			Name:        "cookie-file",
+			Usage:       "Send the cookies of a Netscape cookies.txt or name=value file",
+			Destination: &f.CookieFile,
+		},
+		cli.StringFlag{
+			Name:        "record",
+			Usage:       "Record the response from Prometheus into a file",
+			Destination: &f.Record,
+		},
+		cli.StringFlag{
+			Name:        "replay",
+			Usage:       "Replay a recorded response from a file instead of querying Prometheus",
+			Destination: &f.Replay,
+		},
+		cli.IntFlag{
+			Name:        "points",
+			Usage:       "Choose the step to get this many points across the duration",
+			Destination: &f.Points,
+		},
+		cli.IntFlag{
+			Name:        "max-points",
+			Usage:       "Choose a step like 15s or 5m to get at most this many points, as Grafana does",
+			Destination: &f.MaxPoints,
+		},
+		cli.StringFlag{
+			Name:        "step",
+			Usage:       "The resolution of the query, e.g. 30s, 5m or 1h, a number is in seconds",
+			Destination: &f.Step,
+		},
+		cli.StringSliceFlag{
+			Name:  "param-name",
+			Usage: "Rename a query parameter for non-standard backends, e.g. query=expr",
+			Value: &f.ParamNames,
+		},
+		cli.StringSliceFlag{
+			Name:  "param",
+			Usage: "Send an additional query parameter, e.g. dedup=true",
+			Value: &f.Params,
+		},
+		cli.StringFlag{
+			Name:        "org-id",
+			Usage:       "Query this tenant of Cortex, Mimir or Loki, sent as X-Scope-OrgID",
+			EnvVar:      "STYX_ORG_ID",
+			Destination: &f.OrgID,
+		},
+		cli.BoolFlag{
+			Name:        "dedup",
+			Usage:       "Deduplicate the series of HA replicas in Thanos Query",
+			Destination: &f.Dedup,
+		},
+		cli.BoolFlag{
+			Name:        "partial-response",
+			Usage:       "Let Thanos Query return results even if some stores failed",
+			Destination: &f.PartialResponse,
+		},
+		cli.IntFlag{
+			Name:        "coarsen",
+			Usage:       "Retry this many times with twice the step if the query times out, not with --chunk",
+			Destination: &f.Coarsen,
+		},
+		cli.IntFlag{
+			Name:        "retries",
+			Usage:       "Retry this many times if the request is rate limited (429), fails with 5xx or the connection fails",
+			Value:       2,
+			Destination: &f.Retries,
+		},
+		cli.DurationFlag{
+			Name:        "retry-backoff",
+			Usage:       "Wait this long before the first retry, doubled for every further one",
+			Value:       time.Second,
+			Destination: &f.Backoff,
+		},
+		cli.IntFlag{
+			Name:        "parallelism",
+			Usage:       "Run up to this many queries, or chunks of a long range, at once",
+			Value:       1,
+			Destination: &f.Parallel,
+		},
+		cli.StringFlag{
+			Name:        "accept",
+			Usage:       "The response format to ask for, only JSON can be decoded",
+			Value:       styx.DefaultAccept,
+			Destination: &f.Accept,
+		},
+		cli.StringSliceFlag{
+			Name:  "enforce-label",
+			Usage: "Add a label matcher to every selector of the query, e.g. namespace=team-a",
+			Value: &f.Enforce,
+		},
+		cli.StringFlag{
+			Name:        "api-version",
+			Usage:       "The version in the API's path, /api/<version>/query_range",
+			Value:       styx.DefaultAPIVersion,
+			Destination: &f.APIVersion,
+		},
+		cli.StringFlag{
+			Name:        "method",
+			Usage:       "Send queries with GET or POST, by default POST only if the URL is too long for proxies",
+			Destination: &f.Method,
+		},
+		cli.StringFlag{
+			Name:        "backend",
+			Usage:       "Query with prometheus' query_range, metric queries of LogQL with loki's, or dump the raw samples of a series selector with victoriametrics' export API",
+			Value:       backendPrometheus,
+			Destination: &f.Backend,
+		},
+		cli.BoolFlag{
+			Name:        "instant",
+			Usage:       "Evaluate the query only at the end of the duration, a snapshot",
+			Destination: &f.Instant,
+		},
+		cli.StringFlag{
+			Name:        "ca-cert",
+			Usage:       "Trust the CA certificates of this PEM file for https hosts",
+			Destination: &f.CACert,
+		},
+		cli.BoolFlag{
+			Name:        "insecure-skip-verify",
+			Usage:       "Don't verify the certificate of https hosts, e.g. a self-signed one of a lab cluster",
+			Destination: &f.Insecure,
+		},
+		cli.StringFlag{
+			Name:        "client-cert",
+			Usage:       "Authenticate at https hosts with the client certificate of this PEM file",
+			Destination: &f.ClientCert,
+		},
+		cli.StringFlag{
+			Name:        "client-key",
+			Usage:       "The PEM file with the private key of --client-cert",
+			Destination: &f.ClientKey,
+		},
+		cli.StringFlag{
+			Name:        "proxy-url",
+			Usage:       "Send requests through this proxy, e.g. http://proxy:3128, instead of the one of HTTPS_PROXY or HTTP_PROXY",
+			Destination: &f.Proxy,
+		},
+		cli.StringFlag{
+			Name:        "token",
+			Usage:       "Send this bearer token in the Authorization header",
+			EnvVar:      "STYX_TOKEN",
+			Destination: &f.Token,
+		},
+		cli.StringFlag{
+			Name:        "token-file",
+			Usage:       "Send the bearer token in this file, it's kept out of shell history and process listings",
+			Destination: &f.TokenFile,
+		},
+		cli.StringFlag{
+			Name:        "auth",
+			Usage:       "Authenticate with sigv4, signing requests with the AWS credentials, e.g. for Amazon Managed Prometheus, google with the application default credentials, azure with Azure AD tokens of the service principal or managed identity or icp logging in to IBM Cloud Private",
+			Destination: &f.Auth,
+		},
+		cli.StringFlag{
+			Name:        "region",
+			Usage:       "The AWS region of --auth sigv4",
+			EnvVar:      "AWS_REGION,AWS_DEFAULT_REGION",
+			Destination: &f.Region,
+		},
+		cli.StringFlag{
+			Name:        "google-project",
+			Usage:       "Query Google Cloud Managed Service for Prometheus of this project, with --auth google",
+			Destination: &f.Project,
+		},
+		cli.StringFlag{
+			Name:        "oauth2-token-url",
+			Usage:       "Get access tokens from this token endpoint with the OAuth2 client credentials, refreshing them before they expire",
+			Destination: &f.OAuth2TokenURL,
+		},
+		cli.StringFlag{
+			Name:        "oauth2-client-id",
+			Usage:       "The client ID of --oauth2-token-url",
+			EnvVar:      "STYX_OAUTH2_CLIENT_ID",
+			Destination: &f.OAuth2ClientID,
+		},
+		cli.StringFlag{
+			Name:        "oauth2-client-secret",
+			Usage:       "The client secret of --oauth2-token-url",
+			EnvVar:      "STYX_OAUTH2_CLIENT_SECRET",
+			Destination: &f.OAuth2Secret,
+		},
+		cli.StringFlag{
+			Name:        "oauth2-client-secret-file",
+			Usage:       "Read the client secret of --oauth2-token-url from this file",
+			Destination: &f.OAuth2SecretFile,
+		},
+		cli.StringSliceFlag{
+			Name:  "oauth2-scope",
+			Usage: "Ask --oauth2-token-url for this scope, can be given several times",
+			Value: &f.OAuth2Scopes,
+		},
+		cli.StringFlag{
+			Name:        "icp-url",
+			Usage:       "Log in to the IAM of IBM Cloud Private at this URL with --auth icp, port 8443 of the --prometheus host if empty",
+			Destination: &f.ICPURL,
+		},
+		cli.StringFlag{
+			Name:        "icp-api-key",
+			Usage:       "Log in to IBM Cloud Private with this API key instead of --username and --password",
+			EnvVar:      "STYX_ICP_API_KEY",
+			Destination: &f.ICPAPIKey,
+		},
+		cli.StringFlag{
+			Name:        "username",
+			Usage:       "Authenticate with basic auth or log in to IBM Cloud Private as this user",
+			EnvVar:      "STYX_USERNAME",
+			Destination: &f.Username,
+		},
+		cli.StringFlag{
+			Name:        "password",
+			Usage:       "The password for basic auth",
+			EnvVar:      "STYX_PASSWORD",
+			Destination: &f.Password,
+		},
+		cli.StringFlag{
+			Name:        "password-file",
+			Usage:       "Read the password for basic auth from this file",
+			Destination: &f.PasswordFile,
+		},
+		cli.StringFlag{
+			Name:        "profile",
+			Usage:       "Use the flags of this profile of the config file, e.g. prod",
+			EnvVar:      "STYX_PROFILE",
+			Destination: &f.Profile,
+		},
+		cli.StringFlag{
+			Name:        "config",
+			Usage:       "The config file with the profiles (default: " + defaultConfig + ")",
+			EnvVar:      "STYX_CONFIG",
+			Destination: &f.Config,
+		},
+		cli.DurationFlag{
+			Name:        "timeout",
+			Usage:       "Cancel the requests if they don't finish within this, e.g. 10m",
+			Destination: &f.Timeout,
+		},
+		cli.DurationFlag{
+			Name:        "connect-timeout",
+			Usage:       "Give up connecting to Prometheus after this, e.g. 10s",
+			Destination: &f.Connect,
+		},
+		cli.DurationFlag{
+			Name:        "response-timeout",
+			Usage:       "Give up on a request if Prometheus doesn't start responding within this, e.g. 5m",
+			Destination: &f.Response,
+		},
+	}
+}
+
+// context returns the context of a command's requests. It's canceled on
+// SIGINT and SIGTERM, so a long export doesn't keep running after Ctrl-C,
+// and after --timeout if that's set.
+func (f *queryFlags) context() (context.Context, context.CancelFunc) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	if f.Timeout <= 0 {
+		return ctx, stop
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, f.Timeout)
+	return ctx, func() {
+		cancel()
+		stop()
+	}
+}
+
+// options returns the Options for querying the Prometheus at host over dur.
+func (f *queryFlags) options(host string, dur time.Duration) (styx.Options, error) {
+	opts := styx.Options{Header: make(http.Header), Retries: f.Retries, RetryBackoff: f.Backoff, Accept: f.Accept, APIVersion: f.APIVersion, Parallelism: f.Parallel}
+	opts.OnWarning = printWarning
+	opts.OnRetry = printRetry
+
+	if f.Points < 0 || f.MaxPoints < 0 {
+		return opts, errors.New("the number of points can't be negative")
+	}
+	if f.Retries < 0 {
+		return opts, errors.New("the number of retries can't be negative")
+	}
+	if f.Backoff < 0 {
+		return opts, errors.New("the retry backoff can't be negative")
+	}
+	if f.Parallel < 0 {
+		return opts, errors.New("the parallelism can't be negative")
+	}
+	switch f.Backend {
+	case "", backendPrometheus:
+	case backendLoki:
+		opts.APIPrefix = lokiAPIPrefix
+	case backendVictoriaMetrics:
+		if f.Instant || f.Coarsen > 0 {
+			return opts, errors.New("the victoriametrics backend exports raw samples, it can't be combined with --instant or --coarsen")
+		}
+	default:
+		return opts, fmt.Errorf("unknown backend %s, only %s, %s and %s are supported", f.Backend, backendPrometheus, backendLoki, backendVictoriaMetrics)
+	}
+	switch opts.Method = strings.ToUpper(f.Method); opts.Method {
+	case "", http.MethodGet, http.MethodPost:
+	default:
+		return opts, fmt.Errorf("the method needs to be GET or POST: %s", f.Method)
+	}
+	given := 0
+	for _, set := range []bool{f.Points > 0, f.MaxPoints > 0, f.Step != ""} {
+		if set {
+			given++
+		}
+	}
+	if given > 1 {
+		return opts, errors.New("only one of --step, --points and --max-points can be given")
+	}
+	switch {
+	case f.Points > 0:
+		opts.Step = styx.PointSteps(dur, f.Points)
+	case f.MaxPoints > 0:
+		opts.Step = styx.MaxPointsStep(dur, f.MaxPoints)
+	case f.Step != "":
+		step, err := parseStep(f.Step)
+		if err != nil {
+			return opts, err
+		}
+		opts.Step = step
+	}
+
+	for _, header := range f.Headers {
+		name, value, err := parseHeader(header)
+		if err != nil {
+			return opts, err
+		}
+		opts.Header.Add(name, value)
+	}
+	if f.OrgID != "" {
+		opts.Header.Set("X-Scope-OrgID", f.OrgID)
+	}
+
+	token := f.Token
+	if f.TokenFile != "" {
+		var err error
+		token, err = readSecret(f.TokenFile)
+		if err != nil {
+			return opts, err
+		}
+	}
+	if token != "" {
+		opts.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	if f.Username != "" && f.Auth != authICP {
+		if token != "" {
+			return opts, errors.New("can't authenticate with a token and basic auth at the same time")
+		}
+		password, err := f.password()
+		if err != nil {
+			return opts, err
+		}
+		auth := base64.StdEncoding.EncodeToString([]byte(f.Username + ":" + password))
+		opts.Header.Set("Authorization", "Basic "+auth)
+	}
+
+	var cookies []*http.Cookie
+	for _, cookie := range f.Cookies {
+		cookies = append(cookies, parseCookies(cookie)...)
+	}
+	if f.CookieFile != "" {
+		fileCookies, err := readCookieFile(f.CookieFile)
+		if err != nil {
+			return opts, err
+		}
+		cookies = append(cookies, fileCookies...)
+	}
+
+	if len(cookies) > 0 {
+		u, err := url.Parse(host)
+		if err != nil {
+			return opts, err
+		}
+
+		jar, err := cookiejar.New(nil)
+		if err != nil {
+			return opts, err
+		}
+		jar.SetCookies(u, cookies)
+		opts.Jar = jar
+	}
+
+	for _, rename := range f.ParamNames {
+		standard, name, err := parseKeyValue(rename)
+		if err != nil {
+			return opts, err
+		}
+		switch standard {
+		case "query":
+			opts.Dialect.QueryParam = name
+		case "start":
+			opts.Dialect.StartParam = name
+		case "end":
+			opts.Dialect.EndParam = name
+		case "step":
+			opts.Dialect.StepParam = name
+		default:
+			return opts, fmt.Errorf("only query, start, end and step can be renamed, not %s", standard)
+		}
+	}
+
+	opts.Dialect.Params = make(url.Values)
+	for _, param := range f.Params {
+		name, value, err := parseKeyValue(param)
+		if err != nil {
+			return opts, err
+		}
+		opts.Dialect.Params.Add(name, value)
+	}
+	if f.Dedup {
+		opts.Dialect.Params.Set("dedup", "true")
+	}
+	if f.PartialResponse {
+		opts.Dialect.Params.Set("partial_response", "true")
+	}
+
+	if len(f.Enforce) > 0 {
+		opts.EnforceLabels = make(map[string]string)
+		for _, label := range f.Enforce {
+			name, value, err := parseKeyValue(label)
+			if err != nil {
+				return opts, err
+			}
+			opts.EnforceLabels[name] = value
+		}
+	}
+
+	transport, err := f.transport(host)
+	if err != nil {
+		return opts, err
+	}
+	opts.Transport = transport
+	if opts.Transport, err = f.authTransport(opts.Transport, host, token); err != nil {
+		return opts, err
+	}
+
+	if f.Record != "" && f.Replay != "" {
+		return opts, errors.New("can't record and replay at the same time")
+	}
+	if f.Record != "" {
+		opts.Transport = styx.RecordTransport{Path: f.Record, Next: opts.Transport}
+	}
+	if f.Replay != "" {
+		opts.Transport = styx.ReplayTransport{Path: f.Replay}
+	}
+
+	return opts, nil
+}
+
+// The authentications --auth selects besides tokens and basic auth.
+const (
+	authSigV4  = "sigv4"
+	authGoogle = "google"
+	authAzure  = "azure"
+	authICP    = "icp"
+)
+
+// gmpScope is the OAuth2 scope of querying Google Cloud Managed Service
+// for Prometheus.
+const gmpScope = "https://www.googleapis.com/auth/monitoring.read"
+
+// gmpURL returns the URL of the Prometheus API of Google Cloud Managed
+// Service for Prometheus of the project.
+func gmpURL(project string) string {
+	return "https://monitoring.googleapis.com/v1/projects/" + url.PathEscape(project) + "/location/global/prometheus"
+}
+
+// authTransport returns the transport authenticating the requests sent
+// with next to host the way --auth asks for, next itself without it.
+func (f *queryFlags) authTransport(next http.RoundTripper, host, token string) (http.RoundTripper, error) {
+	if f.Auth != "" && (token != "" || (f.Username != "" && f.Auth != authICP)) {
+		return nil, fmt.Errorf("--auth %s can't be combined with a token or basic auth", f.Auth)
+	}
+	if f.Project != "" && f.Auth != authGoogle {
+		return nil, errors.New("--google-project needs --auth google")
+	}
+	if f.OAuth2TokenURL != "" {
+		if f.Auth != "" || token != "" || f.Username != "" {
+			return nil, errors.New("--oauth2-token-url can't be combined with --auth, a token or basic auth")
+		}
+		return f.oauth2Transport(next)
+	}
+
+	switch f.Auth {
+	case "":
+		return next, nil
+	case authGoogle:
+		client := &http.Client{Transport: next}
+		cache := sharedTokenCache(authGoogle, next, func(now time.Time) (accessToken, error) {
+			return googleAccessToken(client, gmpScope, now)
+		})
+		return &bearerTransport{Next: next, Token: cache.get, Refresh: cache.reset}, nil
+	case authAzure:
+		client := &http.Client{Transport: next}
+		cache := sharedTokenCache(authAzure, next, func(now time.Time) (accessToken, error) {
+			return azureAccessToken(client, azureMonitorResource, now)
+		})
+		return &bearerTransport{Next: next, Token: cache.get, Refresh: cache.reset}, nil
+	case authICP:
+		return f.icpTransport(next, host)
+	case authSigV4:
+		if f.Region == "" {
+			return nil, errors.New("--auth sigv4 needs the --region of the workspace")
+		}
+		return &sigV4Transport{Next: next, Region: f.Region, Service: ampService, Credentials: cachedAWSCredentials}, nil
+	}
+	return nil, fmt.Errorf("unknown authentication %s, only %s, %s, %s and %s are supported", f.Auth, authSigV4, authGoogle, authAzure, authICP)
+}
+
+// oauth2Transport returns the transport sending the tokens of the OAuth2
+// client credentials of the flags with the requests sent with next. The
+// tokens are fetched with the transport of the flags for the token URL, so
+// its proxy, CA and client certificate apply as well.
+func (f *queryFlags) oauth2Transport(next http.RoundTripper) (http.RoundTripper, error) {
+	if f.OAuth2ClientID == "" {
+		return nil, errors.New("--oauth2-token-url needs the --oauth2-client-id")
+	}
+	secret := f.OAuth2Secret
+	if f.OAuth2SecretFile != "" {
+		var err error
+		if secret, err = readSecret(f.OAuth2SecretFile); err != nil {
+			return nil, err
+		}
+	}
+
+	tokenURL, clientID, scopes := f.OAuth2TokenURL, f.OAuth2ClientID, []string(f.OAuth2Scopes)
+	transport, err := f.transport(tokenURL)
+	if err != nil {
+		return nil, err
+	}
+	client := &http.Client{Transport: transport}
+	key := strings.Join(append([]string{tokenURL, clientID}, scopes...), " ")
+	cache := sharedTokenCache(key, transport, func(now time.Time) (accessToken, error) {
+		return oauth2ClientToken(client, tokenURL, clientID, secret, scopes, now)
+	})
+	return &bearerTransport{Next: next, Token: cache.get, Refresh: cache.reset}, nil
+}
+
+// printedWarnings are the warnings already printed, chunks of a long range
+// tend to return the same ones.
+var printedWarnings = struct {
+	sync.Mutex
+	seen map[styx.Warning]bool
+}{seen: make(map[styx.Warning]bool)}
+
+// printWarning prints a warning of a response to stderr once, as the
+// results may be partial.
+func printWarning(w styx.Warning) {
+	printedWarnings.Lock()
+	defer printedWarnings.Unlock()
+	if printedWarnings.seen[w] {
+		return
+	}
+	printedWarnings.seen[w] = true
+	fmt.Fprintln(os.Stderr, color.YellowString("warning: %s", w))
+}
+
+// printRetry tells on stderr that a request is retried, so a long wait for
+// a rate limit isn't taken for a hang.
+func printRetry(wait time.Duration, reason string) {
+	fmt.Fprintln(os.Stderr, color.YellowString("warning: %s, retrying in %s", reason, wait))
+}
+
+// The backends --backend selects.
+const (
+	backendPrometheus      = "prometheus"
+	backendLoki            = "loki"
+	backendVictoriaMetrics = "victoriametrics"
+)
+
+// lokiAPIPrefix is the path of Loki's API, which answers metric queries
+// of LogQL like Prometheus' does PromQL.
+const lokiAPIPrefix = "/loki/api"
+
+// query runs the query, retrying with a coarser step on timeouts if configured,
+// or as instant query at the end. The victoriametrics backend exports the
+// raw samples of the query's series instead.
+// If the step had to be changed, the one used is reported and set in opts.
+func (f *queryFlags) query(host string, start, end time.Time, query string, opts *styx.Options) ([]styx.Result, error) {
+	if f.Backend == backendVictoriaMetrics {
+		return styx.VMExport(host, start, end, query, *opts)
+	}
+	if f.Instant {
+		return styx.QueryInstant(host, end, query, *opts)
+	}
+	if f.Coarsen <= 0 {
+		return styx.Query(host, start, end, query, *opts)
+	}
+
+	step := opts.StepFor(end.Sub(start))
+	results, used, err := styx.QueryCoarsening(host, start, end, query, *opts, f.Coarsen)
+	if used != step {
+		fmt.Fprintln(os.Stderr, color.YellowString("query timed out with a step of %ds, used %ds", step, used))
+		opts.Step = used
+	}
+
+	return results, err
+}
+
+// queryEach runs every query with run, up to opts.Parallelism of them at
+// once, and returns their results in the order of the queries. Queries run
+// in parallel query the chunks of long ranges one after another, so no more
+// than opts.Parallelism requests are made at once. Queries without
+// timeseries have no results, other errors stop further queries from
+// starting and the one of the first query failing is returned. If run
+// changes the step, like query does on timeouts, the coarsest is set in
+// opts.
+func queryEach(queries []string, opts *styx.Options, run func(query string, opts *styx.Options) ([]styx.Result, error)) ([][]styx.Result, error) {
+	each := *opts
+	if len(queries) > 1 {
+		each.Parallelism = 1
+	}
+
+	sets := make([][]styx.Result, len(queries))
+	steps := make([]int, len(queries))
+	err := styx.Parallel(len(queries), opts.Parallelism, func(i int) error {
+		o := each
+		results, err := run(queries[i], &o)
+		if err != nil && err != styx.ErrNoTimeseries {
+			return err
+		}
+		sets[i], steps[i] = results, o.Step
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, step := range steps {
+		if step > opts.Step {
+			opts.Step = step
+		}
+	}
+	return sets, nil
+}
+
+// transports are the transports created by queryFlags.transport, so all
+// requests with the same settings share their connections. Commands like
+// serve get their options again for every request.
+var transports = struct {
+	sync.Mutex
+	m map[transportKey]*http.Transport
+}{m: make(map[transportKey]*http.Transport)}
+
+// transportKey are the settings a transport is created with.
+type transportKey struct {
+	tls                   bool
+	caCert                string
+	insecure              bool
+	clientCert, clientKey string
+	timeouts              styx.Timeouts
+	proxy                 string
+}
+
+// transport returns the transport of all requests to host with the TLS
+// settings, timeouts and proxy of the flags, it's created and the CA file
+// read only the first time.
+func (f *queryFlags) transport(host string) (*http.Transport, error) {
+	key := transportKey{
+		timeouts: styx.Timeouts{Connect: f.Connect, ResponseHeader: f.Response},
+		proxy:    f.Proxy,
+	}
+	// Plain http hosts don't need any TLS setup.
+	if strings.HasPrefix(host, "https://") {
+		key.tls, key.caCert, key.insecure, key.clientCert, key.clientKey = true, f.CACert, f.Insecure, f.ClientCert, f.ClientKey
+	}
+
+	transports.Lock()
+	defer transports.Unlock()
+	if t, ok := transports.m[key]; ok {
+		return t, nil
+	}
+
+	var config *tls.Config
+	if key.tls {
+		var err error
+		config, err = f.tlsConfig()
+		if err != nil {
+			return nil, err
+		}
+	}
+	t := styx.NewTransport(config, key.timeouts)
+	if key.proxy != "" {
+		proxy, err := styx.ParseProxy(key.proxy)
+		if err != nil {
+			return nil, err
+		}
+		t.Proxy = http.ProxyURL(proxy)
+	}
+	transports.m[key] = t
+	return t, nil
+}
+
+// tlsConfig returns the TLS settings of the flags for https hosts,
+// nil if the defaults are fine.
+func (f *queryFlags) tlsConfig() (*tls.Config, error) {
+	if f.CACert == "" && !f.Insecure && f.ClientCert == "" && f.ClientKey == "" {
+		return nil, nil
+	}
+
+	config := &tls.Config{InsecureSkipVerify: f.Insecure}
+	if f.CACert != "" {
+		pool, err := caPool(f.CACert)
+		if err != nil {
+			return nil, err
+		}
+		config.RootCAs = pool
+	}
+
+	if f.ClientCert != "" || f.ClientKey != "" {
+		if f.ClientCert == "" || f.ClientKey == "" {
+			return nil, errors.New("a client certificate needs both --client-cert and --client-key")
+		}
+		cert, err := tls.LoadX509KeyPair(f.ClientCert, f.ClientKey)
+		if err != nil {
+			return nil, err
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	return config, nil
+}
+
+// caPool returns the system's certificate pool with the CA certificates
+// of the PEM file added.
+func caPool(path string) (*x509.CertPool, error) {
+	pem, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no PEM encoded certificates in %s", path)
+	}
+	return pool, nil
+}
+
+// readSecret returns the content of a file holding a token or password,
+// without the trailing newline editors tend to add.
+func readSecret(path string) (string, error) {
+	secret, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(secret), "\r\n"), nil
+}
+
+// password returns the password for basic auth or the ICP login.
+func (f *queryFlags) password() (string, error) {
+	if f.PasswordFile != "" {
+		return readSecret(f.PasswordFile)
+	}
+	return f.Password, nil
+}
+
+// parseHeader splits a header given as 'Name: value'.
+func parseHeader(header string) (string, string, error) {
+	parts := strings.SplitN(header, ":", 2)
+	if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" {
+		return "", "", fmt.Errorf("header needs to be given as 'Name: value': %s", header)
+	}
+
+	return strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1]), nil
+}
+
+// parseKeyValue splits a parameter given as key=value.
+func parseKeyValue(kv string) (string, string, error) {
+	parts := strings.SplitN(kv, "=", 2)
+	if len(parts) != 2 || parts[0] == "" {
+		return "", "", fmt.Errorf("needs to be given as key=value: %s", kv)
+	}
+	return parts[0], parts[1], nil
+}
+
+// parseCookies parses cookies given as 'name=value; name2=value2'.
+func parseCookies(line string) []*http.Cookie {
+	var cookies []*http.Cookie
+	for _, pair := range strings.Split(line, ";") {
+		parts := strings.SplitN(strings.TrimSpace(pair), "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			continue
+		}
+		cookies = append(cookies, &http.Cookie{Name: parts[0], Value: parts[1]})
+	}
+	return cookies
+}
+
+// readCookieFile reads the cookies from a file in the Netscape cookies.txt
+// format written by curl and browser extensions, or from name=value lines.
+func readCookieFile(path string) ([]*http.Cookie, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var cookies []*http.Cookie
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+
+		// curl marks HttpOnly cookies with a prefix looking like a comment.
+		line = strings.TrimPrefix(line, "#HttpOnly_")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		// domain, include subdomains, path, secure, expiry, name, value
+		if fields := strings.Split(line, "\t"); len(fields) == 7 {
+			cookies = append(cookies, &http.Cookie{Name: fields[5], Value: fields[6]})
+			continue
+		}
+
+		cookies = append(cookies, parseCookies(line)...)
+	}
+
+	return cookies, scanner.Err()
+}
@@ -0,0 +1,686 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-pluto/styx/pkg/styx"
+	"github.com/stretchr/testify/assert"
+	"github.com/urfave/cli"
+)
+
+func TestParseHeader(t *testing.T) {
+	name, value, err := parseHeader("X-Grafana-Org-Id: 1")
+	assert.NoError(t, err)
+	assert.Equal(t, "X-Grafana-Org-Id", name)
+	assert.Equal(t, "1", value)
+
+	name, value, err = parseHeader("Authorization:Bearer a:b")
+	assert.NoError(t, err)
+	assert.Equal(t, "Authorization", name)
+	assert.Equal(t, "Bearer a:b", value)
+
+	_, _, err = parseHeader("X-Grafana-Org-Id")
+	assert.Error(t, err)
+	_, _, err = parseHeader(": 1")
+	assert.Error(t, err)
+}
+
+func TestReadCookieFile(t *testing.T) {
+	f, err := ioutil.TempFile("", "styx-cookies")
+	assert.NoError(t, err)
+	defer os.Remove(f.Name())
+
+	content := "# Netscape HTTP Cookie File\n" +
+		"\n" +
+		"grafana.example.com\tFALSE\t/\tTRUE\t0\tgrafana_session\tabc\n" +
+		"#HttpOnly_grafana.example.com\tFALSE\t/\tTRUE\t0\tgrafana_session_expiry\t123\n" +
+		"foo=bar; baz=qux\n"
+	_, err = f.WriteString(content)
+	assert.NoError(t, err)
+	assert.NoError(t, f.Close())
+
+	cookies, err := readCookieFile(f.Name())
+	assert.NoError(t, err)
+	assert.Equal(t, []*http.Cookie{
+		{Name: "grafana_session", Value: "abc"},
+		{Name: "grafana_session_expiry", Value: "123"},
+		{Name: "foo", Value: "bar"},
+		{Name: "baz", Value: "qux"},
+	}, cookies)
+
+	_, err = readCookieFile(f.Name() + "-missing")
+	assert.Error(t, err)
+}
+
+func TestCACert(t *testing.T) {
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeFile(w, r, "pkg/styx/testdata/query_range.json")
+	}))
+	ts.Config.ErrorLog = log.New(ioutil.Discard, "", 0)
+	ts.StartTLS()
+	defer ts.Close()
+
+	f, err := ioutil.TempFile("", "styx-ca")
+	assert.NoError(t, err)
+	defer os.Remove(f.Name())
+	pem.Encode(f, &pem.Block{Type: "CERTIFICATE", Bytes: ts.Certificate().Raw})
+	f.Close()
+
+	flags := queryFlags{CACert: f.Name()}
+	opts, err := flags.options(ts.URL, time.Hour)
+	assert.NoError(t, err)
+
+	results, err := styx.Query(ts.URL, time.Now().Add(-time.Hour), time.Now(), "go_goroutines", opts)
+	assert.NoError(t, err)
+	assert.Len(t, results, 2)
+
+	// The transport is created once and shared by later requests
+	again, err := flags.options(ts.URL, time.Hour)
+	assert.NoError(t, err)
+	assert.True(t, opts.Transport == again.Transport)
+
+	// Plain http hosts skip the TLS setup
+	opts, err = flags.options("http://localhost:9090", time.Hour)
+	assert.NoError(t, err)
+	assert.Nil(t, opts.Transport.(*http.Transport).TLSClientConfig)
+
+	// Files without certificates are an error
+	flags = queryFlags{CACert: "pkg/styx/testdata/query_range.json"}
+	_, err = flags.options(ts.URL, time.Hour)
+	assert.Error(t, err)
+}
+
+func TestQueryHeadersAndCookies(t *testing.T) {
+	var header http.Header
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"status":"success","data":{"resultType":"matrix","result":[]}}`)
+	}))
+	defer ts.Close()
+
+	flags := queryFlags{
+		Headers: cli.StringSlice{"X-Grafana-Org-Id: 2"},
+		Cookies: cli.StringSlice{"grafana_session=abc"},
+	}
+	opts, err := flags.options(ts.URL, time.Hour)
+	assert.NoError(t, err)
+
+	_, err = styx.Query(ts.URL, time.Now().Add(-time.Hour), time.Now(), "up", opts)
+	assert.Equal(t, styx.ErrNoTimeseries, err)
+	assert.Equal(t, "2", header.Get("X-Grafana-Org-Id"))
+	assert.Equal(t, "grafana_session=abc", header.Get("Cookie"))
+}
+
+func TestQueryEnforceLabels(t *testing.T) {
+	var query string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query = r.URL.Query().Get("query")
+		http.ServeFile(w, r, "pkg/styx/testdata/query_range.json")
+	}))
+	defer ts.Close()
+
+	flags := queryFlags{Enforce: cli.StringSlice{"namespace=team-a"}}
+	opts, err := flags.options(ts.URL, time.Hour)
+	assert.NoError(t, err)
+
+	_, err = styx.Query(ts.URL, time.Now().Add(-time.Hour), time.Now(), `sum(rate(http_requests_total{code="500"}[5m]))`, opts)
+	assert.NoError(t, err)
+	assert.Equal(t, `sum(rate(http_requests_total{code="500",namespace="team-a"}[5m]))`, query)
+
+	// Queries that can't be rewritten aren't sent
+	query = ""
+	_, err = styx.Query(ts.URL, time.Now().Add(-time.Hour), time.Now(), `sum(up`, opts)
+	assert.Error(t, err)
+	assert.Equal(t, "", query)
+}
+
+func TestQueryStep(t *testing.T) {
+	opts, err := (&queryFlags{Step: "5m"}).options("http://localhost:9090", time.Hour)
+	assert.NoError(t, err)
+	assert.Equal(t, 300, opts.Step)
+
+	opts, err = (&queryFlags{MaxPoints: 100}).options("http://localhost:9090", 24*time.Hour)
+	assert.NoError(t, err)
+	assert.Equal(t, 900, opts.Step)
+
+	_, err = (&queryFlags{Step: "5m", Points: 100}).options("http://localhost:9090", time.Hour)
+	assert.Error(t, err)
+	_, err = (&queryFlags{Step: "500ms"}).options("http://localhost:9090", time.Hour)
+	assert.Error(t, err)
+}
+
+func TestQueryMethod(t *testing.T) {
+	opts, err := (&queryFlags{Method: "post"}).options("http://localhost:9090", time.Hour)
+	assert.NoError(t, err)
+	assert.Equal(t, http.MethodPost, opts.Method)
+
+	_, err = (&queryFlags{Method: "put"}).options("http://localhost:9090", time.Hour)
+	assert.Error(t, err)
+}
+
+func TestQueryTenant(t *testing.T) {
+	var org string
+	var params url.Values
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		org = r.Header.Get("X-Scope-OrgID")
+		params = r.URL.Query()
+		http.ServeFile(w, r, "pkg/styx/testdata/query_range.json")
+	}))
+	defer ts.Close()
+
+	flags := queryFlags{OrgID: "team-a", Dedup: true, PartialResponse: true}
+	opts, err := flags.options(ts.URL, time.Hour)
+	assert.NoError(t, err)
+
+	_, err = styx.Query(ts.URL, time.Now().Add(-time.Hour), time.Now(), "up", opts)
+	assert.NoError(t, err)
+	assert.Equal(t, "team-a", org)
+	assert.Equal(t, "true", params.Get("dedup"))
+	assert.Equal(t, "true", params.Get("partial_response"))
+}
+
+func TestQueryParamNames(t *testing.T) {
+	flags := queryFlags{
+		ParamNames: cli.StringSlice{"query=expr", "step=resolution"},
+		Params:     cli.StringSlice{"dedup=true"},
+	}
+	opts, err := flags.options("http://localhost:9090", time.Hour)
+	assert.NoError(t, err)
+	assert.Equal(t, styx.Dialect{
+		QueryParam: "expr",
+		StepParam:  "resolution",
+		Params:     url.Values{"dedup": {"true"}},
+	}, opts.Dialect)
+
+	flags = queryFlags{ParamNames: cli.StringSlice{"timeout=t"}}
+	_, err = flags.options("http://localhost:9090", time.Hour)
+	assert.Error(t, err)
+}
+
+func TestQueryContext(t *testing.T) {
+	ctx, cancel := (&queryFlags{}).context()
+	assert.NoError(t, ctx.Err())
+	cancel()
+	assert.Equal(t, context.Canceled, ctx.Err())
+
+	ctx, cancel = (&queryFlags{Timeout: 10 * time.Millisecond}).context()
+	defer cancel()
+	select {
+	case <-ctx.Done():
+	case <-time.After(time.Second):
+	}
+	assert.Equal(t, context.DeadlineExceeded, ctx.Err())
+}
+
+func TestQueryToken(t *testing.T) {
+	opts, err := (&queryFlags{Token: "abc"}).options("http://localhost:9090", time.Hour)
+	assert.NoError(t, err)
+	assert.Equal(t, "Bearer abc", opts.Header.Get("Authorization"))
+
+	file, err := ioutil.TempFile("", "token")
+	assert.NoError(t, err)
+	defer os.Remove(file.Name())
+	file.WriteString("def\n")
+	file.Close()
+
+	// The file wins over the flag or STYX_TOKEN
+	opts, err = (&queryFlags{Token: "abc", TokenFile: file.Name()}).options("http://localhost:9090", time.Hour)
+	assert.NoError(t, err)
+	assert.Equal(t, "Bearer def", opts.Header.Get("Authorization"))
+
+	_, err = (&queryFlags{TokenFile: file.Name() + ".missing"}).options("http://localhost:9090", time.Hour)
+	assert.Error(t, err)
+}
+
+func TestQueryBasicAuth(t *testing.T) {
+	var user, password string
+	var ok bool
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, password, ok = r.BasicAuth()
+		http.ServeFile(w, r, "pkg/styx/testdata/query_range.json")
+	}))
+	defer ts.Close()
+
+	file, err := ioutil.TempFile("", "password")
+	assert.NoError(t, err)
+	defer os.Remove(file.Name())
+	file.WriteString("s3cr:t\n")
+	file.Close()
+
+	flags := queryFlags{Username: "admin", Password: "ignored", PasswordFile: file.Name()}
+	opts, err := flags.options(ts.URL, time.Hour)
+	assert.NoError(t, err)
+
+	_, err = styx.Query(ts.URL, time.Now().Add(-time.Hour), time.Now(), "go_goroutines", opts)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, "admin", user)
+	assert.Equal(t, "s3cr:t", password)
+
+	_, err = (&queryFlags{Username: "admin", Token: "abc"}).options(ts.URL, time.Hour)
+	assert.Error(t, err)
+}
+
+func TestInsecureSkipVerify(t *testing.T) {
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeFile(w, r, "pkg/styx/testdata/query_range.json")
+	}))
+	ts.Config.ErrorLog = log.New(ioutil.Discard, "", 0)
+	ts.StartTLS()
+	defer ts.Close()
+
+	opts, err := (&queryFlags{}).options(ts.URL, time.Hour)
+	assert.NoError(t, err)
+	_, err = styx.Query(ts.URL, time.Now().Add(-time.Hour), time.Now(), "go_goroutines", opts)
+	assert.Error(t, err)
+
+	opts, err = (&queryFlags{Insecure: true}).options(ts.URL, time.Hour)
+	assert.NoError(t, err)
+	results, err := styx.Query(ts.URL, time.Now().Add(-time.Hour), time.Now(), "go_goroutines", opts)
+	assert.NoError(t, err)
+	assert.Len(t, results, 2)
+}
+
+func TestClientCert(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "styx"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	assert.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	assert.NoError(t, err)
+
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeFile(w, r, "pkg/styx/testdata/query_range.json")
+	}))
+	ts.Config.ErrorLog = log.New(ioutil.Discard, "", 0)
+	ts.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: x509.NewCertPool()}
+	ts.TLS.ClientCAs.AddCert(cert)
+	ts.StartTLS()
+	defer ts.Close()
+
+	dir, err := ioutil.TempDir("", "styx-client-cert")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	certFile, keyFile := filepath.Join(dir, "client.pem"), filepath.Join(dir, "client-key.pem")
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	assert.NoError(t, err)
+	assert.NoError(t, ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+	assert.NoError(t, ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600))
+
+	// Without the certificate the handshake fails
+	opts, err := (&queryFlags{Insecure: true}).options(ts.URL, time.Hour)
+	assert.NoError(t, err)
+	_, err = styx.Query(ts.URL, time.Now().Add(-time.Hour), time.Now(), "go_goroutines", opts)
+	assert.Error(t, err)
+
+	opts, err = (&queryFlags{Insecure: true, ClientCert: certFile, ClientKey: keyFile}).options(ts.URL, time.Hour)
+	assert.NoError(t, err)
+	results, err := styx.Query(ts.URL, time.Now().Add(-time.Hour), time.Now(), "go_goroutines", opts)
+	assert.NoError(t, err)
+	assert.Len(t, results, 2)
+
+	_, err = (&queryFlags{ClientCert: certFile}).options(ts.URL, time.Hour)
+	assert.Error(t, err)
+}
+
+func TestQueryEach(t *testing.T) {
+	queries := []string{"a", "b", "none", "c"}
+	opts := styx.Options{Parallelism: 3, Step: 15}
+	sets, err := queryEach(queries, &opts, func(query string, o *styx.Options) ([]styx.Result, error) {
+		// Queries finishing in another order don't change the order of the results.
+		time.Sleep(time.Duration(4-len(query)) * 10 * time.Millisecond)
+		assert.Equal(t, 1, o.Parallelism)
+		switch query {
+		case "none":
+			return nil, styx.ErrNoTimeseries
+		case "b":
+			o.Step = 60
+		}
+		return []styx.Result{{Metric: query}}, nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, [][]styx.Result{{{Metric: "a"}}, {{Metric: "b"}}, nil, {{Metric: "c"}}}, sets)
+	assert.Equal(t, 60, opts.Step)
+
+	// A single query queries its chunks in parallel instead.
+	_, err = queryEach([]string{"a"}, &opts, func(query string, o *styx.Options) ([]styx.Result, error) {
+		assert.Equal(t, 3, o.Parallelism)
+		return nil, fmt.Errorf("failed")
+	})
+	assert.EqualError(t, err, "failed")
+}
+
+func TestTransportTimeouts(t *testing.T) {
+	opts, err := (&queryFlags{Connect: 5 * time.Second, Response: time.Minute}).options("http://localhost:9090", time.Hour)
+	assert.NoError(t, err)
+	transport := opts.Transport.(*http.Transport)
+	assert.Equal(t, 5*time.Second, transport.TLSHandshakeTimeout)
+	assert.Equal(t, time.Minute, transport.ResponseHeaderTimeout)
+
+	// Other timeouts get a transport of their own.
+	other, err := (&queryFlags{}).options("http://localhost:9090", time.Hour)
+	assert.NoError(t, err)
+	assert.False(t, opts.Transport == other.Transport)
+	assert.Zero(t, other.Transport.(*http.Transport).ResponseHeaderTimeout)
+}
+
+func TestQueryProxy(t *testing.T) {
+	var host string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host = r.URL.Host
+		fmt.Fprint(w, `{"status":"success","data":{"resultType":"matrix","result":[{"metric":{"job":"a"},"values":[[1502749390,"1"]]}]}}`)
+	}))
+	defer proxy.Close()
+
+	f := &queryFlags{Proxy: proxy.URL}
+	opts, err := f.options("http://prometheus.invalid:9090", time.Hour)
+	assert.NoError(t, err)
+	results, err := styx.Query("http://prometheus.invalid:9090", time.Time{}, time.Time{}, "up", opts)
+	assert.NoError(t, err)
+	assert.Len(t, results, 1)
+	assert.Equal(t, "prometheus.invalid:9090", host)
+
+	// Without the flag the proxy of the environment is kept.
+	opts, err = (&queryFlags{}).options("http://prometheus.invalid:9090", time.Hour)
+	assert.NoError(t, err)
+	assert.NotNil(t, opts.Transport.(*http.Transport).Proxy)
+
+	_, err = (&queryFlags{Proxy: "proxy:3128"}).options("http://prometheus.invalid:9090", time.Hour)
+	assert.Error(t, err)
+}
+
+func TestQueryBackend(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/api/v1/export", r.URL.Path)
+		assert.Equal(t, "up", r.URL.Query().Get("match[]"))
+		fmt.Fprintln(w, `{"metric":{"__name__":"up","job":"a"},"values":[1,1],"timestamps":[1502749380000,1502749390000]}`)
+	}))
+	defer ts.Close()
+
+	f := &queryFlags{Backend: backendVictoriaMetrics}
+	opts, err := f.options(ts.URL, time.Hour)
+	assert.NoError(t, err)
+	results, err := f.query(ts.URL, time.Unix(1502745790, 0), time.Unix(1502749390, 0), "up", &opts)
+	assert.NoError(t, err)
+	assert.Len(t, results, 1)
+	assert.Len(t, results[0].Values, 2)
+
+	loki := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/loki/api/v1/query_range", r.URL.Path)
+		fmt.Fprint(w, `{"status":"success","data":{"resultType":"matrix","result":[`+
+			`{"metric":{"app":"api"},"values":[[1502749390,"0.5"]]}],"stats":{}}}`)
+	}))
+	defer loki.Close()
+
+	f = &queryFlags{Backend: backendLoki}
+	opts, err = f.options(loki.URL, time.Hour)
+	assert.NoError(t, err)
+	results, err = f.query(loki.URL, time.Unix(1502745790, 0), time.Unix(1502749390, 0), `sum by (app) (rate({app="api"}[5m]))`, &opts)
+	assert.NoError(t, err)
+	assert.Equal(t, `{app="api"}`, results[0].Metric)
+
+	_, err = (&queryFlags{Backend: backendVictoriaMetrics, Instant: true}).options(ts.URL, time.Hour)
+	assert.Error(t, err)
+	_, err = (&queryFlags{Backend: "influxdb"}).options(ts.URL, time.Hour)
+	assert.Error(t, err)
+}
+
+func TestQueryAuth(t *testing.T) {
+	opts, err := (&queryFlags{Auth: "sigv4", Region: "eu-west-1"}).options("https://aps-workspaces.eu-west-1.amazonaws.com/workspaces/ws-1", time.Hour)
+	assert.NoError(t, err)
+	transport, ok := opts.Transport.(*sigV4Transport)
+	assert.True(t, ok)
+	assert.Equal(t, "eu-west-1", transport.Region)
+	assert.Equal(t, "aps", transport.Service)
+
+	_, err = (&queryFlags{Auth: "sigv4"}).options("http://localhost:9090", time.Hour)
+	assert.Error(t, err)
+	_, err = (&queryFlags{Auth: "sigv4", Region: "eu-west-1", Token: "token"}).options("http://localhost:9090", time.Hour)
+	assert.Error(t, err)
+	_, err = (&queryFlags{Auth: "kerberos"}).options("http://localhost:9090", time.Hour)
+	assert.Error(t, err)
+}
+
+func TestQueryAuthGoogle(t *testing.T) {
+	var auth string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/computeMetadata/v1/instance/service-accounts/default/token":
+			assert.Equal(t, gmpScope, r.URL.Query().Get("scopes"))
+			fmt.Fprint(w, `{"access_token":"ya29.gmp","expires_in":3599}`)
+		default:
+			auth = r.Header.Get("Authorization")
+			fmt.Fprint(w, `{"status":"success","data":{"resultType":"matrix","result":[{"metric":{"job":"a"},"values":[[1502749390,"1"]]}]}}`)
+		}
+	}))
+	defer ts.Close()
+
+	t.Setenv("GOOGLE_APPLICATION_CREDENTIALS", "")
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("GCE_METADATA_HOST", strings.TrimPrefix(ts.URL, "http://"))
+
+	f := &queryFlags{Auth: "google", Project: "metrics-1234"}
+	opts, err := f.options(ts.URL, time.Hour)
+	assert.NoError(t, err)
+	_, err = styx.Query(ts.URL, time.Time{}, time.Time{}, "up", opts)
+	assert.NoError(t, err)
+	assert.Equal(t, "Bearer ya29.gmp", auth)
+
+	_, err = (&queryFlags{Project: "metrics-1234"}).options(ts.URL, time.Hour)
+	assert.Error(t, err)
+}
+
+func TestQueryAuthGoogleCACert(t *testing.T) {
+	var auth string
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/token" {
+			fmt.Fprint(w, `{"access_token":"ya29.sa","expires_in":3599}`)
+			return
+		}
+		auth = r.Header.Get("Authorization")
+		fmt.Fprint(w, `{"status":"success","data":{"resultType":"matrix","result":[{"metric":{"job":"a"},"values":[[1502749390,"1"]]}]}}`)
+	}))
+	ts.Config.ErrorLog = log.New(ioutil.Discard, "", 0)
+	ts.StartTLS()
+	defer ts.Close()
+
+	dir := t.TempDir()
+	ca := filepath.Join(dir, "ca.pem")
+	assert.NoError(t, ioutil.WriteFile(ca, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ts.Certificate().Raw}), 0600))
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	assert.NoError(t, err)
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	assert.NoError(t, err)
+	creds, _ := json.Marshal(googleCredentials{
+		Type:        "service_account",
+		ClientEmail: "styx@project.iam.gserviceaccount.com",
+		PrivateKey:  string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})),
+		TokenURI:    ts.URL + "/token",
+	})
+	path := filepath.Join(dir, "credentials.json")
+	assert.NoError(t, ioutil.WriteFile(path, creds, 0600))
+	t.Setenv("GOOGLE_APPLICATION_CREDENTIALS", path)
+
+	// The token endpoint is trusted with the --ca-cert like Prometheus
+	f := &queryFlags{Auth: "google", CACert: ca}
+	opts, err := f.options(ts.URL, time.Hour)
+	assert.NoError(t, err)
+	_, err = styx.Query(ts.URL, time.Time{}, time.Time{}, "up", opts)
+	assert.NoError(t, err)
+	assert.Equal(t, "Bearer ya29.sa", auth)
+}
+
+func TestQueryAuthAzureCACert(t *testing.T) {
+	var auth string
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/tenant-1/oauth2/v2.0/token" {
+			fmt.Fprint(w, `{"access_token":"eyJ0.azure","expires_in":3599}`)
+			return
+		}
+		auth = r.Header.Get("Authorization")
+		fmt.Fprint(w, `{"status":"success","data":{"resultType":"matrix","result":[{"metric":{"job":"a"},"values":[[1502749390,"1"]]}]}}`)
+	}))
+	ts.Config.ErrorLog = log.New(ioutil.Discard, "", 0)
+	ts.StartTLS()
+	defer ts.Close()
+
+	ca := filepath.Join(t.TempDir(), "ca.pem")
+	assert.NoError(t, ioutil.WriteFile(ca, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ts.Certificate().Raw}), 0600))
+	t.Setenv("AZURE_AUTHORITY_HOST", ts.URL)
+	t.Setenv("AZURE_TENANT_ID", "tenant-1")
+	t.Setenv("AZURE_CLIENT_ID", "client-1")
+	t.Setenv("AZURE_CLIENT_SECRET", "secret")
+
+	// The authority is trusted with the --ca-cert like Prometheus
+	f := &queryFlags{Auth: "azure", CACert: ca}
+	opts, err := f.options(ts.URL, time.Hour)
+	assert.NoError(t, err)
+	_, err = styx.Query(ts.URL, time.Time{}, time.Time{}, "up", opts)
+	assert.NoError(t, err)
+	assert.Equal(t, "Bearer eyJ0.azure", auth)
+}
+
+func TestQueryOAuth2(t *testing.T) {
+	var auth string
+	var form url.Values
+	fetched := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/token" {
+			r.ParseForm()
+			form = r.PostForm
+			fetched++
+			fmt.Fprintf(w, `{"access_token":"token-%d","expires_in":300,"token_type":"Bearer"}`, fetched)
+			return
+		}
+		auth = r.Header.Get("Authorization")
+		fmt.Fprint(w, `{"status":"success","data":{"resultType":"matrix","result":[{"metric":{"job":"a"},"values":[[1502749390,"1"]]}]}}`)
+	}))
+	defer ts.Close()
+
+	secretFile := filepath.Join(t.TempDir(), "secret")
+	assert.NoError(t, ioutil.WriteFile(secretFile, []byte("s3cret\n"), 0600))
+	f := &queryFlags{OAuth2TokenURL: ts.URL + "/token", OAuth2ClientID: "styx", OAuth2SecretFile: secretFile, OAuth2Scopes: cli.StringSlice{"metrics"}}
+	for i := 0; i < 2; i++ {
+		opts, err := f.options(ts.URL, time.Hour)
+		assert.NoError(t, err)
+		_, err = styx.Query(ts.URL, time.Time{}, time.Time{}, "up", opts)
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, "Bearer token-1", auth)
+	assert.Equal(t, 1, fetched)
+	assert.Equal(t, "client_credentials", form.Get("grant_type"))
+	assert.Equal(t, "s3cret", form.Get("client_secret"))
+	assert.Equal(t, "metrics", form.Get("scope"))
+
+	_, err := (&queryFlags{OAuth2TokenURL: ts.URL + "/token"}).options(ts.URL, time.Hour)
+	assert.Error(t, err)
+	_, err = (&queryFlags{OAuth2TokenURL: ts.URL + "/token", OAuth2ClientID: "styx", Token: "token"}).options(ts.URL, time.Hour)
+	assert.Error(t, err)
+}
+
+func TestQueryOAuth2CACert(t *testing.T) {
+	sso := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"access_token":"token","expires_in":300,"token_type":"Bearer"}`)
+	}))
+	sso.Config.ErrorLog = log.New(ioutil.Discard, "", 0)
+	sso.StartTLS()
+	defer sso.Close()
+
+	var auth string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth = r.Header.Get("Authorization")
+		fmt.Fprint(w, `{"status":"success","data":{"resultType":"matrix","result":[{"metric":{"job":"a"},"values":[[1502749390,"1"]]}]}}`)
+	}))
+	defer ts.Close()
+
+	ca := filepath.Join(t.TempDir(), "ca.pem")
+	assert.NoError(t, ioutil.WriteFile(ca, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: sso.Certificate().Raw}), 0600))
+
+	// The token endpoint's certificate isn't trusted without the CA
+	f := &queryFlags{OAuth2TokenURL: sso.URL + "/token", OAuth2ClientID: "untrusted"}
+	opts, err := f.options(ts.URL, time.Hour)
+	assert.NoError(t, err)
+	_, err = styx.Query(ts.URL, time.Time{}, time.Time{}, "up", opts)
+	assert.Error(t, err)
+
+	f = &queryFlags{OAuth2TokenURL: sso.URL + "/token", OAuth2ClientID: "styx", CACert: ca}
+	opts, err = f.options(ts.URL, time.Hour)
+	assert.NoError(t, err)
+	_, err = styx.Query(ts.URL, time.Time{}, time.Time{}, "up", opts)
+	assert.NoError(t, err)
+	assert.Equal(t, "Bearer token", auth)
+}
+func TestQueryICP(t *testing.T) {
+	var form url.Values
+	logins, queries := 0, 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/idprovider/v1/auth/identitytoken" {
+			r.ParseForm()
+			form = r.PostForm
+			logins++
+			fmt.Fprintf(w, `{"access_token":"token-%d","expires_in":43200,"token_type":"Bearer"}`, logins)
+			return
+		}
+		queries++
+		// The first token is revoked, like after a restart of the IAM
+		if r.Header.Get("Authorization") != fmt.Sprintf("Bearer token-%d", logins) || logins == 1 {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		fmt.Fprint(w, `{"status":"success","data":{"resultType":"matrix","result":[{"metric":{"job":"a"},"values":[[1502749390,"1"]]}]}}`)
+	}))
+	defer ts.Close()
+
+	f := &queryFlags{Auth: "icp", ICPURL: ts.URL, Username: "admin", Password: "secret"}
+	opts, err := f.options(ts.URL+"/prometheus", time.Hour)
+	assert.NoError(t, err)
+	assert.Empty(t, opts.Header.Get("Authorization"))
+	_, err = styx.Query(ts.URL+"/prometheus", time.Time{}, time.Time{}, "up", opts)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, logins)
+	assert.Equal(t, 2, queries)
+	assert.Equal(t, "password", form.Get("grant_type"))
+	assert.Equal(t, "admin", form.Get("username"))
+	assert.Equal(t, "secret", form.Get("password"))
+
+	f = &queryFlags{Auth: "icp", ICPURL: ts.URL, ICPAPIKey: "key"}
+	opts, err = f.options(ts.URL+"/prometheus", time.Hour)
+	assert.NoError(t, err)
+	_, err = styx.Query(ts.URL+"/prometheus", time.Time{}, time.Time{}, "up", opts)
+	assert.NoError(t, err)
+	assert.Equal(t, "urn:ibm:params:oauth:grant-type:apikey", form.Get("grant_type"))
+	assert.Equal(t, "key", form.Get("apikey"))
+
+	_, err = (&queryFlags{Auth: "icp"}).options(ts.URL, time.Hour)
+	assert.Error(t, err)
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/go-pluto/styx/pkg/styx"
+	"github.com/urfave/cli"
+)
+
+// remoteWriteFlags are the flags of pushing the results to a remote write
+// endpoint instead of writing them.
+type remoteWriteFlags struct {
+	URL        string
+	Headers    cli.StringSlice
+	Metric     string
+	MaxSamples int
+}
+
+func (f *remoteWriteFlags) flags() []cli.Flag {
+	return []cli.Flag{
+		cli.StringFlag{
+			Name:        "remote-write",
+			Usage:       "Push the results to this Prometheus remote write endpoint instead, e.g. http://mimir/api/v1/push",
+			Destination: &f.URL,
+		},
+		cli.StringSliceFlag{
+			Name:  "remote-write-header",
+			Usage: "A header to send to the --remote-write endpoint, e.g. 'X-Scope-OrgID: tenant', can be repeated",
+			Value: &f.Headers,
+		},
+		cli.StringFlag{
+			Name:        "remote-write-metric",
+			Usage:       "The metric name of timeseries without a name, when pushed or written as openmetrics",
+			Value:       "query_result",
+			Destination: &f.Metric,
+		},
+		cli.IntFlag{
+			Name:        "remote-write-max-samples",
+			Usage:       "The maximum number of samples per remote write request",
+			Value:       styx.RemoteWriteMaxSamples,
+			Destination: &f.MaxSamples,
+		},
+	}
+}
+
+// remoteWrite returns the endpoint to push to with the labels mapped by
+// mapping, and retrying like the queries of opts.
+func (f *remoteWriteFlags) remoteWrite(mapping styx.LabelMapping, opts styx.Options) (styx.RemoteWrite, error) {
+	rw := styx.RemoteWrite{
+		URL:          f.URL,
+		Header:       make(http.Header),
+		Name:         f.Metric,
+		Labels:       mapping,
+		MaxSamples:   f.MaxSamples,
+		Retries:      opts.Retries,
+		RetryBackoff: opts.RetryBackoff,
+		OnRetry:      opts.OnRetry,
+		Context:      opts.Context,
+	}
+	for _, header := range f.Headers {
+		name, value, err := parseHeader(header)
+		if err != nil {
+			return rw, err
+		}
+		rw.Header.Add(name, value)
+	}
+	return rw, nil
+}
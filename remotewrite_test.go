@@ -0,0 +1,24 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/go-pluto/styx/pkg/styx"
+	"github.com/stretchr/testify/assert"
+	"github.com/urfave/cli"
+)
+
+func TestRemoteWriteFlags(t *testing.T) {
+	f := remoteWriteFlags{URL: "http://localhost/api/v1/write", Headers: cli.StringSlice{"X-Scope-OrgID: tenant"}, Metric: "m", MaxSamples: 10}
+	rw, err := f.remoteWrite(styx.LabelMapping{Drop: []string{"job"}}, styx.Options{Retries: 2})
+	assert.NoError(t, err)
+	assert.Equal(t, "tenant", rw.Header.Get("X-Scope-OrgID"))
+	assert.Equal(t, "m", rw.Name)
+	assert.Equal(t, 10, rw.MaxSamples)
+	assert.Equal(t, 2, rw.Retries)
+	assert.Equal(t, []string{"job"}, rw.Labels.Drop)
+
+	f.Headers = cli.StringSlice{"X-Scope-OrgID"}
+	_, err = f.remoteWrite(styx.LabelMapping{}, styx.Options{})
+	assert.Error(t, err)
+}
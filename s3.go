@@ -0,0 +1,317 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// isS3URL reports whether path is an S3 object like s3://bucket/key.
+func isS3URL(path string) bool {
+	return strings.HasPrefix(path, "s3://")
+}
+
+// s3Object is an object in a bucket of S3 or a compatible object storage.
+type s3Object struct {
+	Bucket string
+	Key    string
+}
+
+func parseS3URL(raw string) (s3Object, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return s3Object{}, err
+	}
+	key := strings.TrimPrefix(u.Path, "/")
+	if u.Scheme != "s3" || u.Host == "" || key == "" {
+		return s3Object{}, fmt.Errorf("S3 objects need to be given as s3://bucket/key: %s", raw)
+	}
+	return s3Object{Bucket: u.Host, Key: key}, nil
+}
+
+type awsCredentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+	// Expires is when temporary credentials of a role expire, zero if
+	// they don't.
+	Expires time.Time
+}
+
+// s3Config is where and as whom objects are uploaded.
+type s3Config struct {
+	// Endpoint of an S3 compatible storage, objects are addressed by path.
+	// If empty AWS is used with virtual-hosted buckets.
+	Endpoint    string
+	Region      string
+	Credentials awsCredentials
+}
+
+// s3ConfigFromEnv reads the config the way the AWS SDKs do: the credentials
+// with awsCredentialsFromEnv, the region from AWS_REGION or
+// AWS_DEFAULT_REGION and the endpoint from AWS_ENDPOINT_URL_S3 or AWS_ENDPOINT_URL.
+func s3ConfigFromEnv() (s3Config, error) {
+	cfg := s3Config{
+		Endpoint: firstEnv("AWS_ENDPOINT_URL_S3", "AWS_ENDPOINT_URL"),
+		Region:   firstEnv("AWS_REGION", "AWS_DEFAULT_REGION"),
+	}
+	if cfg.Region == "" {
+		cfg.Region = "us-east-1"
+	}
+
+	var err error
+	cfg.Credentials, err = awsCredentialsFromEnv()
+	return cfg, err
+}
+
+// awsCredentialsFromEnv finds the credentials the way the AWS SDKs do: in
+// AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY, the profile AWS_PROFILE of
+// the shared credentials file, or else the role of the container or of
+// the instance from its metadata.
+func awsCredentialsFromEnv() (awsCredentials, error) {
+	creds := awsCredentials{
+		AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+	}
+	if creds.AccessKeyID != "" {
+		return creds, nil
+	}
+
+	path := os.Getenv("AWS_SHARED_CREDENTIALS_FILE")
+	if path == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return creds, err
+		}
+		path = filepath.Join(home, ".aws", "credentials")
+	}
+	profile := os.Getenv("AWS_PROFILE")
+	if profile == "" {
+		profile = "default"
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		role, roleErr := awsRoleCredentials(metadataClient)
+		if roleErr != nil {
+			return creds, fmt.Errorf("no AWS credentials in the environment, %s or the metadata of a role: %v", path, roleErr)
+		}
+		return role, nil
+	}
+	defer f.Close()
+
+	return parseAWSCredentials(f, profile)
+}
+
+func firstEnv(names ...string) string {
+	for _, name := range names {
+		if value := os.Getenv(name); value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// parseAWSCredentials reads the credentials of profile from an ini file
+// like ~/.aws/credentials.
+func parseAWSCredentials(r io.Reader, profile string) (awsCredentials, error) {
+	var creds awsCredentials
+	section := ""
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' || line[0] == ';' {
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			section = strings.TrimSpace(line[1 : len(line)-1])
+			continue
+		}
+		if section != profile {
+			continue
+		}
+
+		parts := strings.SplitN(line, "=", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		value := strings.TrimSpace(parts[1])
+		switch strings.TrimSpace(parts[0]) {
+		case "aws_access_key_id":
+			creds.AccessKeyID = value
+		case "aws_secret_access_key":
+			creds.SecretAccessKey = value
+		case "aws_session_token":
+			creds.SessionToken = value
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return creds, err
+	}
+
+	if creds.AccessKeyID == "" || creds.SecretAccessKey == "" {
+		return creds, fmt.Errorf("no AWS credentials for the profile %s", profile)
+	}
+	return creds, nil
+}
+
+// s3Put uploads body as the object.
+func s3Put(cfg s3Config, obj s3Object, body []byte, now time.Time) error {
+	var u *url.URL
+	if cfg.Endpoint != "" {
+		endpoint, err := url.Parse(cfg.Endpoint)
+		if err != nil {
+			return err
+		}
+		u = endpoint
+		u.Path = strings.TrimSuffix(u.Path, "/") + "/" + obj.Bucket + "/" + obj.Key
+	} else {
+		u = &url.URL{
+			Scheme: "https",
+			Host:   fmt.Sprintf("%s.s3.%s.amazonaws.com", obj.Bucket, cfg.Region),
+			Path:   "/" + obj.Key,
+		}
+	}
+
+	req, err := http.NewRequest(http.MethodPut, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	if cfg.Credentials.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", cfg.Credentials.SessionToken)
+	}
+	signV4(req, body, cfg.Credentials, cfg.Region, "s3", now)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		snippet, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 256))
+		return fmt.Errorf("uploading s3://%s/%s failed with %s: %s", obj.Bucket, obj.Key, resp.Status, snippet)
+	}
+	return nil
+}
+
+// uploadS3 uploads body to the S3 URL with the config from the environment.
+func uploadS3(rawURL string, body []byte) error {
+	obj, err := parseS3URL(rawURL)
+	if err != nil {
+		return err
+	}
+	cfg, err := s3ConfigFromEnv()
+	if err != nil {
+		return err
+	}
+	return s3Put(cfg, obj, body, time.Now())
+}
+
+// signV4 signs req with AWS Signature Version 4, signing the host and
+// all headers already set.
+func signV4(req *http.Request, body []byte, creds awsCredentials, region, service string, now time.Time) {
+	now = now.UTC()
+	date := now.Format("20060102")
+	payload := sha256Hex(body)
+
+	req.Header.Set("X-Amz-Date", now.Format("20060102T150405Z"))
+	req.Header.Set("X-Amz-Content-Sha256", payload)
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+	var names []string
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		awsURIEncode(req.URL.Path, false),
+		canonicalQuery(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payload,
+	}, "\n")
+
+	scope := date + "/" + region + "/" + service + "/aws4_request"
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		now.Format("20060102T150405Z"),
+		scope,
+		sha256Hex([]byte(canonicalRequest)),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+creds.SecretAccessKey), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, service)
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		creds.AccessKeyID, scope, signedHeaders, signature))
+}
+
+func canonicalQuery(query url.Values) string {
+	var params []string
+	for name, values := range query {
+		for _, value := range values {
+			params = append(params, awsURIEncode(name, true)+"="+awsURIEncode(value, true))
+		}
+	}
+	sort.Strings(params)
+	return strings.Join(params, "&")
+}
+
+// awsURIEncode percent-encodes everything but unreserved characters,
+// and slashes unless encodeSlash is true.
+func awsURIEncode(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c >= 'A' && c <= 'Z', c >= 'a' && c <= 'z', c >= '0' && c <= '9',
+			c == '-', c == '_', c == '.', c == '~':
+			b.WriteByte(c)
+		case c == '/' && !encodeSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/go-pluto/styx/pkg/styx"
+	"github.com/urfave/cli"
+)
+
+type serveFlags struct {
+	queryFlags
+
+	Listen     string
+	Duration   time.Duration
+	Prometheus string
+}
+
+var serveFlag serveFlags
+
+// serveContentTypes are the formats served with their content type.
+var serveContentTypes = map[string]string{
+	"csv":         "text/csv; charset=utf-8",
+	"tidy":        "text/csv; charset=utf-8",
+	"json":        "application/json",
+	"matrix":      "application/json",
+	"openmetrics": "application/openmetrics-text; version=1.0.0; charset=utf-8",
+	"xlsx":        "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+	"parquet":     "application/vnd.apache.parquet",
+}
+
+func serveAction(c *cli.Context) error {
+	// Fail on invalid query flags before listening.
+	if _, err := serveFlag.options(serveFlag.Prometheus, serveFlag.Duration); err != nil {
+		return err
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/export", serveExport)
+
+	log.Printf("serving exports of %s on %s", serveFlag.Prometheus, serveFlag.Listen)
+	return http.ListenAndServe(serveFlag.Listen, mux)
+}
+
+// serveExport runs the queries of the request and writes the results.
+// The range is given like to the export with start, end and last, the
+// resolution with step and the format with format, csv by default.
+func serveExport(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	queries := params["query"]
+	if len(queries) == 0 {
+		http.Error(w, "need a query to run", http.StatusBadRequest)
+		return
+	}
+
+	format := params.Get("format")
+	if format == "" {
+		format = "csv"
+	}
+	contentType, ok := serveContentTypes[format]
+	if !ok {
+		http.Error(w, fmt.Sprintf("unknown format: %s", format), http.StatusBadRequest)
+		return
+	}
+
+	rng := rangeFlags{Last: params.Get("last"), Start: params.Get("start"), End: params.Get("end")}
+	start, end, err := rng.timeRange(time.Now(), serveFlag.Duration)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	opts, err := serveFlag.options(serveFlag.Prometheus, end.Sub(start))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	opts.Context = r.Context()
+	if step := params.Get("step"); step != "" {
+		opts.Step, err = parseStep(step)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	sets, err := queryEach(queries, &opts, func(query string, opts *styx.Options) ([]styx.Result, error) {
+		return serveFlag.query(serveFlag.Prometheus, start, end, query, opts)
+	})
+	if err != nil {
+		http.Error(w, err.Error(), serveStatus(err))
+		return
+	}
+	var results []styx.Result
+	for i, queried := range sets {
+		if len(queries) > 1 {
+			queried = nameUnlabeled(queried, queries[i])
+		}
+		results = append(results, queried...)
+	}
+	if len(results) == 0 {
+		http.Error(w, styx.ErrNoTimeseries.Error(), http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	if format == "xlsx" || format == "parquet" {
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="export.%s"`, format))
+	}
+	if err := serveWrite(w, format, results); err != nil {
+		// The status is sent already, all that's left is to log it.
+		log.Printf("writing the export of %q failed: %v", queries, err)
+	}
+}
+
+// serveWrite writes the results in the format, the csv with a header.
+func serveWrite(w io.Writer, format string, results []styx.Result) error {
+	switch format {
+	case "tidy":
+		return styx.TidyCSVWriter(w, results, true)
+	case "json":
+		return styx.JSONWriter(w, results)
+	case "matrix":
+		return styx.MatrixWriter(w, results)
+	case "openmetrics":
+		return styx.OpenMetricsWriter(w, results, "query_result")
+	case "xlsx":
+		return styx.XLSXWriter(w, []styx.Sheet{{Name: "data", Results: results}})
+	case "parquet":
+		return styx.ParquetWriter(w, results)
+	}
+
+	if err := styx.CSVHeaderWriter(w, results); err != nil {
+		return err
+	}
+	return styx.CSVWriter(w, results)
+}
+
+// serveStatus returns the status to answer a failed query with: 404 if it
+// returned no timeseries, 400 if Prometheus rejected it, 502 if it failed
+// otherwise, 504 if it timed out and 500 for anything else.
+func serveStatus(err error) int {
+	var apiErr *styx.APIError
+	var decodeErr *styx.DecodeError
+	switch {
+	case errors.Is(err, styx.ErrNoTimeseries):
+		return http.StatusNotFound
+	case errors.As(err, &apiErr) && apiErr.Type == "bad_data":
+		return http.StatusBadRequest
+	case errors.Is(err, styx.ErrBadStatus), errors.Is(err, styx.ErrNotMatrix), errors.Is(err, styx.ErrNotVector), errors.As(err, &decodeErr):
+		return http.StatusBadGateway
+	case errors.Is(err, context.DeadlineExceeded):
+		return http.StatusGatewayTimeout
+	}
+	return http.StatusInternalServerError
+}
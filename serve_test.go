@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServeExport(t *testing.T) {
+	var steps []string
+	prom := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		steps = append(steps, r.URL.Query().Get("step"))
+		switch r.URL.Query().Get("query") {
+		case "up":
+			fmt.Fprint(w, `{"status":"success","data":{"resultType":"matrix","result":[{"metric":{"__name__":"up","job":"a"},"values":[[1502749200,"1"]]}]}}`)
+		case "none":
+			fmt.Fprint(w, `{"status":"success","data":{"resultType":"matrix","result":[]}}`)
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `{"status":"error","errorType":"bad_data","error":"parse error"}`)
+		}
+	}))
+	defer prom.Close()
+
+	serveFlag = serveFlags{Prometheus: prom.URL, Duration: time.Hour}
+
+	rec := httptest.NewRecorder()
+	serveExport(rec, httptest.NewRequest(http.MethodGet, "/export?query=up&start=1502749200&end=1502752800&step=1m", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "text/csv; charset=utf-8", rec.Header().Get("Content-Type"))
+	assert.Equal(t, "Time,\"up{job=\"\"a\"\"}\"\n1502749200,1\n", rec.Body.String())
+	assert.Equal(t, []string{"60"}, steps)
+
+	rec = httptest.NewRecorder()
+	serveExport(rec, httptest.NewRequest(http.MethodGet, "/export?query=up&query=none&format=openmetrics", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "# TYPE up unknown\nup{job=\"a\"} 1 1502749200\n# EOF\n", rec.Body.String())
+
+	for url, code := range map[string]int{
+		"/export":                         http.StatusBadRequest,
+		"/export?query=up&format=pdf":     http.StatusBadRequest,
+		"/export?query=up&start=tomorrow": http.StatusBadRequest,
+		"/export?query=up&step=0":         http.StatusBadRequest,
+		"/export?query=none":              http.StatusNotFound,
+		"/export?query=up{":               http.StatusBadRequest,
+	} {
+		rec = httptest.NewRecorder()
+		serveExport(rec, httptest.NewRequest(http.MethodGet, url, nil))
+		assert.Equal(t, code, rec.Code, url)
+	}
+	// The body is plain text, without the colors of the CLI.
+	rec = httptest.NewRecorder()
+	serveExport(rec, httptest.NewRequest(http.MethodGet, "/export?query=none", nil))
+	assert.Equal(t, "no timeseries found\n", rec.Body.String())
+}
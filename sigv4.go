@@ -0,0 +1,223 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ampService is the service Amazon Managed Prometheus signs requests for.
+const ampService = "aps"
+
+// metadataClient fetches credentials from metadata endpoints, which answer
+// right away if they're there at all.
+var metadataClient = &http.Client{Timeout: 2 * time.Second}
+
+// awsRoleCredentials returns the temporary credentials of the role of the
+// container, from AWS_CONTAINER_CREDENTIALS_RELATIVE_URI or _FULL_URI like
+// on ECS or with EKS Pod Identity, or else of the instance from IMDSv2.
+// AWS_EC2_METADATA_DISABLED turns off asking the instance.
+func awsRoleCredentials(client *http.Client) (awsCredentials, error) {
+	if uri := os.Getenv("AWS_CONTAINER_CREDENTIALS_RELATIVE_URI"); uri != "" {
+		return awsContainerCredentials(client, "http://169.254.170.2"+uri)
+	}
+	if uri := os.Getenv("AWS_CONTAINER_CREDENTIALS_FULL_URI"); uri != "" {
+		return awsContainerCredentials(client, uri)
+	}
+	if strings.EqualFold(os.Getenv("AWS_EC2_METADATA_DISABLED"), "true") {
+		return awsCredentials{}, errors.New("the instance metadata is disabled")
+	}
+	return awsInstanceCredentials(client)
+}
+
+// awsContainerCredentials returns the credentials of the container
+// credentials endpoint u, authorized with AWS_CONTAINER_AUTHORIZATION_TOKEN
+// or the token in AWS_CONTAINER_AUTHORIZATION_TOKEN_FILE.
+func awsContainerCredentials(client *http.Client, u string) (awsCredentials, error) {
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return awsCredentials{}, err
+	}
+	token := os.Getenv("AWS_CONTAINER_AUTHORIZATION_TOKEN")
+	if path := os.Getenv("AWS_CONTAINER_AUTHORIZATION_TOKEN_FILE"); path != "" {
+		if token, err = readSecret(path); err != nil {
+			return awsCredentials{}, err
+		}
+	}
+	if token != "" {
+		req.Header.Set("Authorization", token)
+	}
+	return decodeRoleCredentials(client, req)
+}
+
+// awsInstanceCredentials returns the credentials of the role of the EC2
+// instance from IMDSv2, AWS_EC2_METADATA_SERVICE_ENDPOINT overrides its
+// address.
+func awsInstanceCredentials(client *http.Client) (awsCredentials, error) {
+	endpoint := os.Getenv("AWS_EC2_METADATA_SERVICE_ENDPOINT")
+	if endpoint == "" {
+		endpoint = "http://169.254.169.254"
+	}
+	endpoint = strings.TrimSuffix(endpoint, "/")
+
+	req, err := http.NewRequest(http.MethodPut, endpoint+"/latest/api/token", nil)
+	if err != nil {
+		return awsCredentials{}, err
+	}
+	req.Header.Set("X-Aws-Ec2-Metadata-Token-Ttl-Seconds", "21600")
+	token, err := metadataText(client, req)
+	if err != nil {
+		return awsCredentials{}, err
+	}
+
+	credentialsURL := endpoint + "/latest/meta-data/iam/security-credentials/"
+	req, err = http.NewRequest(http.MethodGet, credentialsURL, nil)
+	if err != nil {
+		return awsCredentials{}, err
+	}
+	req.Header.Set("X-Aws-Ec2-Metadata-Token", token)
+	roles, err := metadataText(client, req)
+	if err != nil {
+		return awsCredentials{}, err
+	}
+	role := strings.TrimSpace(strings.SplitN(roles, "\n", 2)[0])
+	if role == "" {
+		return awsCredentials{}, errors.New("the instance has no role")
+	}
+
+	req, err = http.NewRequest(http.MethodGet, credentialsURL+role, nil)
+	if err != nil {
+		return awsCredentials{}, err
+	}
+	req.Header.Set("X-Aws-Ec2-Metadata-Token", token)
+	return decodeRoleCredentials(client, req)
+}
+
+// metadataText returns the body of the response of a metadata endpoint.
+func metadataText(client *http.Client, req *http.Request) (string, error) {
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode/100 != 2 {
+		return "", fmt.Errorf("%s returned %s: %s", req.URL, resp.Status, strings.TrimSpace(string(body)))
+	}
+	return string(body), nil
+}
+
+// decodeRoleCredentials decodes the credentials the container and instance
+// metadata endpoints return.
+func decodeRoleCredentials(client *http.Client, req *http.Request) (awsCredentials, error) {
+	body, err := metadataText(client, req)
+	if err != nil {
+		return awsCredentials{}, err
+	}
+
+	var role struct {
+		AccessKeyID     string `json:"AccessKeyId"`
+		SecretAccessKey string
+		Token           string
+		Expiration      time.Time
+	}
+	if err := json.Unmarshal([]byte(body), &role); err != nil {
+		return awsCredentials{}, fmt.Errorf("invalid credentials of %s: %v", req.URL, err)
+	}
+	if role.AccessKeyID == "" || role.SecretAccessKey == "" {
+		return awsCredentials{}, fmt.Errorf("%s returned no credentials", req.URL)
+	}
+	return awsCredentials{
+		AccessKeyID:     role.AccessKeyID,
+		SecretAccessKey: role.SecretAccessKey,
+		SessionToken:    role.Token,
+		Expires:         role.Expiration,
+	}, nil
+}
+
+// awsCredentialCache keeps the credentials found by awsCredentialsFromEnv,
+// so not every request asks the metadata again.
+var awsCredentialCache struct {
+	sync.Mutex
+	creds awsCredentials
+}
+
+// cachedAWSCredentials returns the cached credentials, they're found again
+// if they're about to expire.
+func cachedAWSCredentials() (awsCredentials, error) {
+	awsCredentialCache.Lock()
+	defer awsCredentialCache.Unlock()
+
+	creds := awsCredentialCache.creds
+	if creds.AccessKeyID != "" && (creds.Expires.IsZero() || time.Until(creds.Expires) > 5*time.Minute) {
+		return creds, nil
+	}
+	creds, err := awsCredentialsFromEnv()
+	if err != nil {
+		return creds, err
+	}
+	awsCredentialCache.creds = creds
+	return creds, nil
+}
+
+// sigV4Transport signs every request with AWS Signature Version 4, e.g. for
+// the query API of Amazon Managed Prometheus.
+type sigV4Transport struct {
+	Next    http.RoundTripper
+	Region  string
+	Service string
+	// Credentials returns the credentials to sign with.
+	Credentials func() (awsCredentials, error)
+	// now is the time of the signature, time.Now if it's nil.
+	now func() time.Time
+}
+
+func (t *sigV4Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	creds, err := t.Credentials()
+	if err != nil {
+		return nil, err
+	}
+
+	// The signature covers the body, which is read from a copy.
+	req = req.Clone(req.Context())
+	var body []byte
+	if req.Body != nil && req.GetBody != nil {
+		r, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		body, err = ioutil.ReadAll(r)
+		r.Close()
+		if err != nil {
+			return nil, err
+		}
+		req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
+
+	if creds.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", creds.SessionToken)
+	}
+	now := time.Now
+	if t.now != nil {
+		now = t.now
+	}
+	signV4(req, body, creds, t.Region, t.Service, now())
+
+	next := t.Next
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return next.RoundTrip(req)
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSigV4Transport(t *testing.T) {
+	var auth, token, payload, body string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth, token, payload = r.Header.Get("Authorization"), r.Header.Get("X-Amz-Security-Token"), r.Header.Get("X-Amz-Content-Sha256")
+		data, _ := ioutil.ReadAll(r.Body)
+		body = string(data)
+	}))
+	defer ts.Close()
+
+	transport := &sigV4Transport{
+		Region:  "us-east-1",
+		Service: ampService,
+		Credentials: func() (awsCredentials, error) {
+			return awsCredentials{AccessKeyID: "AKID", SecretAccessKey: "secret", SessionToken: "session"}, nil
+		},
+		now: func() time.Time { return time.Date(2013, 5, 24, 0, 0, 0, 0, time.UTC) },
+	}
+	client := &http.Client{Transport: transport}
+
+	req, _ := http.NewRequest(http.MethodPost, ts.URL+"/api/v1/query_range", strings.NewReader("query=up"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := client.Do(req)
+	assert.NoError(t, err)
+	resp.Body.Close()
+
+	assert.True(t, strings.HasPrefix(auth, "AWS4-HMAC-SHA256 Credential=AKID/20130524/us-east-1/aps/aws4_request, "+
+		"SignedHeaders=content-type;host;x-amz-content-sha256;x-amz-date;x-amz-security-token, Signature="), auth)
+	assert.Equal(t, "session", token)
+	assert.Equal(t, sha256Hex([]byte("query=up")), payload)
+	assert.Equal(t, "query=up", body)
+	// The request itself isn't changed.
+	assert.Empty(t, req.Header.Get("Authorization"))
+
+	transport.Credentials = func() (awsCredentials, error) { return awsCredentials{}, fmt.Errorf("no credentials") }
+	_, err = client.Get(ts.URL)
+	assert.Error(t, err)
+}
+
+func TestAWSRoleCredentials(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v2/credentials/pod":
+			if r.Header.Get("Authorization") != "pod-token" {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			fmt.Fprint(w, `{"AccessKeyId":"AKIDPOD","SecretAccessKey":"pod","Token":"session","Expiration":"2030-01-01T00:00:00Z"}`)
+		case "/latest/api/token":
+			assert.Equal(t, http.MethodPut, r.Method)
+			fmt.Fprint(w, "imds-token")
+		case "/latest/meta-data/iam/security-credentials/":
+			assert.Equal(t, "imds-token", r.Header.Get("X-Aws-Ec2-Metadata-Token"))
+			fmt.Fprint(w, "exporter\n")
+		case "/latest/meta-data/iam/security-credentials/exporter":
+			assert.Equal(t, "imds-token", r.Header.Get("X-Aws-Ec2-Metadata-Token"))
+			fmt.Fprint(w, `{"Code":"Success","AccessKeyId":"AKIDEC2","SecretAccessKey":"ec2","Token":"session","Expiration":"2030-01-01T00:00:00Z"}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	t.Setenv("AWS_EC2_METADATA_SERVICE_ENDPOINT", ts.URL)
+	creds, err := awsRoleCredentials(http.DefaultClient)
+	assert.NoError(t, err)
+	assert.Equal(t, awsCredentials{AccessKeyID: "AKIDEC2", SecretAccessKey: "ec2", SessionToken: "session",
+		Expires: time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)}, creds)
+
+	t.Setenv("AWS_CONTAINER_CREDENTIALS_FULL_URI", ts.URL+"/v2/credentials/pod")
+	_, err = awsRoleCredentials(http.DefaultClient)
+	assert.Error(t, err)
+	t.Setenv("AWS_CONTAINER_AUTHORIZATION_TOKEN", "pod-token")
+	creds, err = awsRoleCredentials(http.DefaultClient)
+	assert.NoError(t, err)
+	assert.Equal(t, "AKIDPOD", creds.AccessKeyID)
+
+	// Without static credentials the role is used.
+	t.Setenv("AWS_ACCESS_KEY_ID", "")
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", filepath.Join(t.TempDir(), "missing"))
+	creds, err = awsCredentialsFromEnv()
+	assert.NoError(t, err)
+	assert.Equal(t, "AKIDPOD", creds.AccessKeyID)
+
+	t.Setenv("AWS_CONTAINER_CREDENTIALS_FULL_URI", "")
+	t.Setenv("AWS_EC2_METADATA_DISABLED", "true")
+	_, err = awsCredentialsFromEnv()
+	assert.Error(t, err)
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/go-pluto/styx/pkg/styx"
+)
+
+// exportState records how far an appending export got, so the next run
+// only queries the samples after the last exported one and appends them.
+type exportState struct {
+	path   string
+	resume bool
+
+	Queries []string `json:"queries"`
+	Step    int      `json:"step"`
+	// Last is the unix time of the last exported sample.
+	Last float64 `json:"last"`
+	// Series are the exported series in the order of their columns.
+	Series []stateSeries `json:"series"`
+}
+
+type stateSeries struct {
+	Metric string            `json:"metric"`
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+// openState loads the state at path to continue an export of the queries,
+// if there is none the export starts from scratch.
+func openState(path string, queries []string) (*exportState, error) {
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return &exportState{path: path, Queries: queries}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	state := &exportState{path: path, resume: true}
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, fmt.Errorf("can't read state %s: %v", path, err)
+	}
+	if strings.Join(state.Queries, "\n") != strings.Join(queries, "\n") {
+		return nil, fmt.Errorf("state %s belongs to other queries: %s", path, strings.Join(state.Queries, ", "))
+	}
+
+	return state, nil
+}
+
+// next returns the time of the first sample after the exported ones.
+func (s *exportState) next() time.Time {
+	sec := int64(s.Last)
+	last := time.Unix(sec, int64((s.Last-float64(sec))*1e9))
+	return last.Add(time.Duration(s.Step) * time.Second)
+}
+
+// series returns the exported series without values, see alignSeries.
+func (s *exportState) series() []styx.Result {
+	results := make([]styx.Result, len(s.Series))
+	for i, series := range s.Series {
+		results[i] = styx.Result{Metric: series.Metric, Labels: series.Labels}
+	}
+	return results
+}
+
+// save records the results as exported, the first results define the series.
+func (s *exportState) save(results []styx.Result) error {
+	last := lastTime(results)
+	if last.IsZero() {
+		return nil
+	}
+	s.Last = float64(last.UnixNano()) / 1e9
+
+	if s.Series == nil {
+		s.Series = make([]stateSeries, len(results))
+		for i, result := range results {
+			s.Series[i] = stateSeries{Metric: result.Metric, Labels: result.Labels}
+		}
+	}
+
+	data, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+
+	// Write into a temporary file first, so a crash can't leave a corrupt state.
+	tmp := s.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
+
+// appendResultsFile appends the rows of the results to the file at path,
+// which has to exist as it got the header with the first rows.
+func appendResultsFile(path string, results []styx.Result) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+
+	header := flag.Header
+	flag.Header = false
+	defer func() { flag.Header = header }()
+
+	if err := writeResults(f, results); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-pluto/styx/pkg/styx"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExportState(t *testing.T) {
+	dir, err := ioutil.TempDir("", "styx-state")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "export.state")
+
+	state, err := openState(path, []string{"up"})
+	assert.NoError(t, err)
+	assert.False(t, state.resume)
+
+	state.Step = 15
+	results := []styx.Result{
+		{Metric: `up{job="a"}`, Labels: map[string]string{"job": "a"}, Times: []int64{1502791200, 1502791215}, Values: []float64{1, 1}},
+		{Metric: `up{job="b"}`, Labels: map[string]string{"job": "b"}, Times: []int64{1502791200}, Values: []float64{0}},
+	}
+	assert.NoError(t, state.save(results))
+
+	state, err = openState(path, []string{"up"})
+	assert.NoError(t, err)
+	assert.True(t, state.resume)
+	assert.Equal(t, time.Unix(1502791230, 0), state.next())
+	assert.Equal(t, []styx.Result{
+		{Metric: `up{job="a"}`, Labels: map[string]string{"job": "a"}},
+		{Metric: `up{job="b"}`, Labels: map[string]string{"job": "b"}},
+	}, state.series())
+
+	// Nothing new keeps the last sample
+	assert.NoError(t, state.save(alignSeries(state.series(), nil)))
+	state, err = openState(path, []string{"up"})
+	assert.NoError(t, err)
+	assert.Equal(t, time.Unix(1502791230, 0), state.next())
+
+	_, err = openState(path, []string{"up", "down"})
+	assert.Error(t, err)
+}
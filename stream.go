@@ -0,0 +1,69 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"time"
+
+	"github.com/go-pluto/styx/pkg/styx"
+)
+
+// checkStream returns an error if the export can't be written series by
+// series: the columns have to be known before the first series is, and
+// nothing may need all series or samples at once.
+func (f flags) checkStream() error {
+	long := f.Format == "csv" && f.Layout == "long"
+	labeled := (f.Format == "csv" || f.Format == "tidy") && len(f.csv.Labels) > 0
+	switch {
+	case !long && !labeled:
+		return errors.New("--stream needs --layout long or --label-columns, the columns can't depend on the series")
+	case f.Instant:
+		return errors.New("--stream needs a range query, not an --instant one")
+	case f.Summary || f.Rate || f.Delta || f.Grid || f.Gap != "" || f.Fill.Policy != styx.FillNull || f.Downsample.Spec != "" || f.Top.N > 0:
+		return errors.New("--stream writes the samples as they are, without --summary, --rate, --delta, --grid, --gap, --fill, --downsample or --top")
+	case f.SplitByDay || f.Chunk > 0 || f.Checkpoint != "" || f.Coarsen > 0 || f.Watch > 0 || f.StateFile != "" || f.Remote.URL != "":
+		return errors.New("--stream can't be combined with --split-by-day, --chunk, --checkpoint, --coarsen, --watch, --state-file or --remote-write")
+	}
+	return nil
+}
+
+// streamResults runs the queries and writes the rows of every series to w
+// as soon as it's decoded. The rows are grouped by series instead of sorted
+// by time, and by chunk of MaxPoints steps for long ranges, or by line of
+// the export of the victoriametrics backend.
+func streamResults(w io.Writer, queries []string, start, end time.Time, opts styx.Options) error {
+	stream := styx.QueryStream
+	if flag.Backend == backendVictoriaMetrics {
+		stream = styx.VMExportStream
+	}
+
+	header := flag.Header
+	found := false
+	for _, query := range queries {
+		err := stream(flag.Prometheus, start, end, query, opts, func(r styx.Result) error {
+			results := []styx.Result{r}
+			if len(queries) > 1 {
+				results = nameUnlabeled(results, query)
+			}
+			results, err := relabelResults(results)
+			if err != nil {
+				return err
+			}
+
+			if flag.Layout == "long" {
+				err = flag.csv.WriteLong(w, results, header)
+			} else {
+				err = flag.csv.WriteTidy(w, results, header)
+			}
+			header, found = false, true
+			return err
+		})
+		if err != nil && err != styx.ErrNoTimeseries {
+			return err
+		}
+	}
+	if !found {
+		return styx.ErrNoTimeseries
+	}
+	return nil
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/go-pluto/styx/pkg/styx"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckStream(t *testing.T) {
+	long := flags{Format: "csv", Layout: "long", Fill: fillFlags{Policy: styx.FillNull}}
+	assert.NoError(t, long.checkStream())
+
+	labeled := flags{Format: "tidy", Layout: "wide", Fill: fillFlags{Policy: styx.FillNull}, csv: styx.CSV{Labels: []string{"job"}}}
+	assert.NoError(t, labeled.checkStream())
+
+	wide := long
+	wide.Layout = "wide"
+	assert.Error(t, wide.checkStream())
+
+	rate := long
+	rate.Rate = true
+	assert.Error(t, rate.checkStream())
+
+	filled := long
+	filled.Fill.Policy = styx.FillZero
+	assert.Error(t, filled.checkStream())
+
+	chunked := long
+	chunked.Chunk = time.Hour
+	assert.Error(t, chunked.checkStream())
+}
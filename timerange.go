@@ -0,0 +1,172 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/urfave/cli"
+)
+
+// rangeFlags are the flags of commands querying a range of time.
+type rangeFlags struct {
+	Last  string
+	Start string
+	End   string
+}
+
+func (f *rangeFlags) flags() []cli.Flag {
+	return []cli.Flag{
+		cli.StringFlag{
+			Name:        "last",
+			Usage:       "The duration to get timeseries from, like --duration but also in days or weeks, e.g. 7d",
+			Destination: &f.Last,
+		},
+		cli.StringFlag{
+			Name:        "start",
+			Usage:       "The start of the range, e.g. now-24h, 2017-08-15 or 2017-08-15T10:00:00Z",
+			Destination: &f.Start,
+		},
+		cli.StringFlag{
+			Name:        "end",
+			Usage:       "The end of the range, e.g. now-1h, 2017-08-16 or a unix timestamp",
+			Value:       "now",
+			Destination: &f.End,
+		},
+	}
+}
+
+// timeRange returns the range to query. It ends at --end and starts at
+// --start, or --last or the given duration before the end otherwise.
+func (f *rangeFlags) timeRange(now time.Time, duration time.Duration) (time.Time, time.Time, error) {
+	end := now
+	if f.End != "" {
+		t, err := parseTime(f.End, now)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("invalid end: %v", err)
+		}
+		end = t
+	}
+
+	if f.Last != "" {
+		if f.Start != "" {
+			return time.Time{}, time.Time{}, errors.New("can't give both a start and the last duration")
+		}
+		d, err := parseDuration(f.Last)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("invalid duration: %v", err)
+		}
+		duration = d
+	}
+
+	start := end.Add(-1 * duration)
+	if f.Start != "" {
+		t, err := parseTime(f.Start, now)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("invalid start: %v", err)
+		}
+		start = t
+	}
+
+	if !start.Before(end) {
+		return time.Time{}, time.Time{}, fmt.Errorf("the start %s isn't before the end %s", start.Format(time.RFC3339), end.Format(time.RFC3339))
+	}
+	return start, end, nil
+}
+
+// timeLayouts are the absolute times accepted besides unix timestamps,
+// times without a timezone are local.
+var timeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05",
+	"2006-01-02T15:04",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+}
+
+// parseTime parses now, a time relative to it like now-1h or now+30m, a
+// unix timestamp or a date and time like 2017-08-15T10:00:00Z.
+func parseTime(s string, now time.Time) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	if s == "now" {
+		return now, nil
+	}
+	if strings.HasPrefix(s, "now-") || strings.HasPrefix(s, "now+") {
+		d, err := parseDuration(s[4:])
+		if err != nil {
+			return time.Time{}, err
+		}
+		if s[3] == '-' {
+			d = -d
+		}
+		return now.Add(d), nil
+	}
+
+	if ts, err := strconv.ParseFloat(s, 64); err == nil {
+		sec := int64(ts)
+		return time.Unix(sec, int64((ts-float64(sec))*1e9)), nil
+	}
+
+	for _, layout := range timeLayouts {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("can't parse %s as a time, e.g. now-1h, 2017-08-15T10:00:00Z or 1502791200", s)
+}
+
+// durationDays matches whole numbers of days, weeks and years, fractions
+// like 1.5d are left for time.ParseDuration to reject.
+var durationDays = regexp.MustCompile(`(^|[^.\d])(\d+)([dwy])`)
+
+// parseDuration parses a duration like time.ParseDuration, but also in
+// days, weeks and years as Prometheus does, e.g. 7d or 1d12h.
+func parseDuration(s string) (time.Duration, error) {
+	hours := map[string]int{"d": 24, "w": 7 * 24, "y": 365 * 24}
+
+	var err error
+	s = durationDays.ReplaceAllStringFunc(s, func(m string) string {
+		parts := durationDays.FindStringSubmatch(m)
+		n, e := strconv.Atoi(parts[2])
+		if e != nil {
+			err = e
+		}
+		return parts[1] + strconv.Itoa(n*hours[parts[3]]) + "h"
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, err
+	}
+	if d <= 0 {
+		return 0, fmt.Errorf("the duration %s needs to be positive", s)
+	}
+	return d, nil
+}
+
+// parseStep parses the resolution of a query in whole seconds, either a
+// number of seconds or a duration like 30s or 5m.
+func parseStep(s string) (int, error) {
+	if n, err := strconv.Atoi(s); err == nil {
+		if n <= 0 {
+			return 0, fmt.Errorf("the step %s needs to be positive", s)
+		}
+		return n, nil
+	}
+
+	d, err := parseDuration(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid step: %v", err)
+	}
+	if d%time.Second != 0 {
+		return 0, fmt.Errorf("the step %s needs to be whole seconds", s)
+	}
+	return int(d / time.Second), nil
+}
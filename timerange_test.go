@@ -0,0 +1,103 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseTime(t *testing.T) {
+	now := time.Unix(1502791200, 0)
+
+	for s, want := range map[string]time.Time{
+		"now":                       now,
+		"now-1h":                    now.Add(-time.Hour),
+		"now+30m":                   now.Add(30 * time.Minute),
+		"now-7d":                    now.Add(-7 * 24 * time.Hour),
+		"1502791200":                now,
+		"1502791200.5":              now.Add(500 * time.Millisecond),
+		"2017-08-15T10:00:00Z":      now,
+		"2017-08-15T12:00:00+02:00": now,
+		"2017-08-15":                time.Date(2017, 8, 15, 0, 0, 0, 0, time.Local),
+		"2017-08-15 10:30":          time.Date(2017, 8, 15, 10, 30, 0, 0, time.Local),
+	} {
+		got, err := parseTime(s, now)
+		assert.NoError(t, err, s)
+		assert.True(t, want.Equal(got), "%s: %s", s, got)
+	}
+
+	for _, s := range []string{"", "yesterday", "now-", "now-1x", "2017-08-32"} {
+		_, err := parseTime(s, now)
+		assert.Error(t, err, s)
+	}
+}
+
+func TestParseDuration(t *testing.T) {
+	for s, want := range map[string]time.Duration{
+		"90s":    90 * time.Second,
+		"6h":     6 * time.Hour,
+		"1d12h":  36 * time.Hour,
+		"2w":     14 * 24 * time.Hour,
+		"1y":     365 * 24 * time.Hour,
+		"1.5h1d": 25*time.Hour + 30*time.Minute,
+	} {
+		d, err := parseDuration(s)
+		assert.NoError(t, err, s)
+		assert.Equal(t, want, d, s)
+	}
+
+	for _, s := range []string{"", "0s", "-1h", "1x", "1.5d", "0.5w", "1d0.5y"} {
+		_, err := parseDuration(s)
+		assert.Error(t, err, s)
+	}
+}
+
+func TestTimeRange(t *testing.T) {
+	now := time.Unix(1502791200, 0)
+
+	f := rangeFlags{End: "now"}
+	start, end, err := f.timeRange(now, time.Hour)
+	assert.NoError(t, err)
+	assert.Equal(t, now.Add(-time.Hour), start)
+	assert.Equal(t, now, end)
+
+	f = rangeFlags{Last: "7d", End: "now-1h"}
+	start, end, err = f.timeRange(now, time.Hour)
+	assert.NoError(t, err)
+	assert.Equal(t, now.Add(-time.Hour-7*24*time.Hour), start)
+	assert.Equal(t, now.Add(-time.Hour), end)
+
+	f = rangeFlags{Start: "now-24h", End: "now"}
+	start, end, err = f.timeRange(now, time.Hour)
+	assert.NoError(t, err)
+	assert.Equal(t, now.Add(-24*time.Hour), start)
+	assert.Equal(t, now, end)
+
+	f = rangeFlags{Start: "now-24h", Last: "6h", End: "now"}
+	_, _, err = f.timeRange(now, time.Hour)
+	assert.Error(t, err)
+
+	f = rangeFlags{Start: "now", End: "now-1h"}
+	_, _, err = f.timeRange(now, time.Hour)
+	assert.Error(t, err)
+}
+
+func TestParseStep(t *testing.T) {
+	for s, want := range map[string]int{
+		"30":  30,
+		"30s": 30,
+		"5m":  300,
+		"1h":  3600,
+		"1d":  86400,
+	} {
+		step, err := parseStep(s)
+		assert.NoError(t, err, s)
+		assert.Equal(t, want, step, s)
+	}
+
+	for _, s := range []string{"", "0", "-5", "500ms", "1.5s", "5x"} {
+		_, err := parseStep(s)
+		assert.Error(t, err, s)
+	}
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// accessToken is an OAuth2 access token, Expires is zero if the response
+// didn't tell when it expires.
+type accessToken struct {
+	Token   string
+	Expires time.Time
+}
+
+// oauth2ClientToken gets a token from the token endpoint with the client
+// credentials grant, sending the client's ID and secret in the form like
+// most identity providers accept.
+func oauth2ClientToken(client *http.Client, tokenURL, clientID, secret string, scopes []string, now time.Time) (accessToken, error) {
+	form := url.Values{}
+	form.Set("grant_type", "client_credentials")
+	form.Set("client_id", clientID)
+	form.Set("client_secret", secret)
+	if len(scopes) > 0 {
+		form.Set("scope", strings.Join(scopes, " "))
+	}
+
+	resp, err := client.PostForm(tokenURL, form)
+	if err != nil {
+		return accessToken{}, err
+	}
+	return decodeAccessToken(resp, now)
+}
+
+// tokenCache keeps an access token until shortly before it expires, so not
+// every request asks for a new one. Tokens without expiry aren't kept.
+type tokenCache struct {
+	mu    sync.Mutex
+	fetch func(now time.Time) (accessToken, error)
+	token accessToken
+}
+
+func (c *tokenCache) get() (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	if c.token.Token != "" && c.token.Expires.Sub(now) > time.Minute {
+		return c.token.Token, nil
+	}
+	token, err := c.fetch(now)
+	if err != nil {
+		return "", err
+	}
+	c.token = token
+	return token.Token, nil
+}
+
+// reset drops the token, the next get fetches a new one.
+func (c *tokenCache) reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.token = accessToken{}
+}
+
+// tokenCaches are the caches of the tokens --auth gets, by what they're
+// for and the transport they're fetched with. Commands like serve get their
+// options again for every request, which share the transport as long as
+// the flags are the same.
+var tokenCaches = struct {
+	sync.Mutex
+	m map[tokenCacheKey]*tokenCache
+}{m: make(map[tokenCacheKey]*tokenCache)}
+
+type tokenCacheKey struct {
+	key       string
+	transport http.RoundTripper
+}
+
+// sharedTokenCache returns the cache of the tokens for key fetched with
+// transport, it's created with fetch the first time.
+func sharedTokenCache(key string, transport http.RoundTripper, fetch func(now time.Time) (accessToken, error)) *tokenCache {
+	tokenCaches.Lock()
+	defer tokenCaches.Unlock()
+	k := tokenCacheKey{key: key, transport: transport}
+	if c, ok := tokenCaches.m[k]; ok {
+		return c
+	}
+	c := &tokenCache{fetch: fetch}
+	tokenCaches.m[k] = c
+	return c
+}
+
+// bearerTransport sends the token of every request in the Authorization
+// header. Requests answered with 401 are sent once more with a new token
+// if Refresh drops the old one, like tokens revoked before they expire.
+type bearerTransport struct {
+	Next    http.RoundTripper
+	Token   func() (string, error)
+	Refresh func()
+}
+
+func (t *bearerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	next := t.Next
+	if next == nil {
+		next = http.DefaultTransport
+	}
+
+	resp, err := t.send(next, req)
+	if err != nil || resp.StatusCode != http.StatusUnauthorized || t.Refresh == nil {
+		return resp, err
+	}
+	if req.Body != nil && req.GetBody == nil {
+		// The body is gone
+		return resp, nil
+	}
+	io.Copy(ioutil.Discard, resp.Body)
+	resp.Body.Close()
+
+	t.Refresh()
+	retry := req.Clone(req.Context())
+	if req.GetBody != nil {
+		if retry.Body, err = req.GetBody(); err != nil {
+			return nil, err
+		}
+	}
+	return t.send(next, retry)
+}
+
+// send sends a clone of req with the token.
+func (t *bearerTransport) send(next http.RoundTripper, req *http.Request) (*http.Response, error) {
+	token, err := t.Token()
+	if err != nil {
+		return nil, err
+	}
+	req = req.Clone(req.Context())
+	req.Header.Set("Authorization", "Bearer "+token)
+	return next.RoundTrip(req)
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTokenCache(t *testing.T) {
+	fetched := 0
+	expires := time.Hour
+	c := &tokenCache{fetch: func(now time.Time) (accessToken, error) {
+		fetched++
+		return accessToken{Token: "token", Expires: now.Add(expires)}, nil
+	}}
+
+	for i := 0; i < 3; i++ {
+		token, err := c.get()
+		assert.NoError(t, err)
+		assert.Equal(t, "token", token)
+	}
+	assert.Equal(t, 1, fetched)
+
+	// Tokens about to expire are fetched again.
+	c.token.Expires = time.Now().Add(30 * time.Second)
+	_, err := c.get()
+	assert.NoError(t, err)
+	assert.Equal(t, 2, fetched)
+
+	c.token = accessToken{}
+	c.fetch = func(time.Time) (accessToken, error) { return accessToken{}, errors.New("no credentials") }
+	_, err = c.get()
+	assert.Error(t, err)
+
+	assert.True(t, sharedTokenCache("test", nil, nil) == sharedTokenCache("test", nil, nil))
+	assert.False(t, sharedTokenCache("test", nil, nil) == sharedTokenCache("test", &http.Transport{}, nil))
+}
+
+func TestBearerTransport(t *testing.T) {
+	var auth string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth = r.Header.Get("Authorization")
+	}))
+	defer ts.Close()
+
+	client := &http.Client{Transport: &bearerTransport{Token: func() (string, error) { return "ya29.token", nil }}}
+	req, _ := http.NewRequest(http.MethodGet, ts.URL, nil)
+	resp, err := client.Do(req)
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, "Bearer ya29.token", auth)
+	assert.Empty(t, req.Header.Get("Authorization"))
+
+	client.Transport = &bearerTransport{Token: func() (string, error) { return "", errors.New("no credentials") }}
+	_, err = client.Get(ts.URL)
+	assert.Error(t, err)
+}
+
+func TestBearerTransportRefresh(t *testing.T) {
+	var bodies []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		bodies = append(bodies, string(body))
+		if r.Header.Get("Authorization") != "Bearer new" {
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+	defer ts.Close()
+
+	token := "revoked"
+	client := &http.Client{Transport: &bearerTransport{
+		Token:   func() (string, error) { return token, nil },
+		Refresh: func() { token = "new" },
+	}}
+	resp, err := client.Post(ts.URL, "application/x-www-form-urlencoded", strings.NewReader("query=up"))
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, []string{"query=up", "query=up"}, bodies)
+
+	// Only retried once
+	token, bodies = "revoked", nil
+	client.Transport.(*bearerTransport).Refresh = func() {}
+	resp, err = client.Get(ts.URL)
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	assert.Len(t, bodies, 2)
+}
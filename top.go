@@ -0,0 +1,48 @@
+package main
+
+import (
+	"errors"
+
+	"github.com/go-pluto/styx/pkg/styx"
+	"github.com/urfave/cli"
+)
+
+// topFlags are the flags of commands keeping only the top series.
+type topFlags struct {
+	N      int
+	By     string
+	Others bool
+}
+
+func (f *topFlags) flags() []cli.Flag {
+	return []cli.Flag{
+		cli.IntFlag{
+			Name:        "top",
+			Usage:       "Keep only this many series, the ones with the highest value --by",
+			Destination: &f.N,
+		},
+		cli.StringFlag{
+			Name:        "by",
+			Usage:       "Rank the series of --top by their avg, max or last value",
+			Value:       styx.TopAvg,
+			Destination: &f.By,
+		},
+		cli.BoolFlag{
+			Name:        "others",
+			Usage:       "Sum up the series not in the --top into an others series",
+			Destination: &f.Others,
+		},
+	}
+}
+
+// top applies the flags to the results, see styx.Top. Without --top all
+// results are kept.
+func (f *topFlags) top(results []styx.Result) ([]styx.Result, error) {
+	if f.N == 0 && f.Others {
+		return nil, errors.New("--others needs --top")
+	}
+	if f.N == 0 {
+		return results, nil
+	}
+	return styx.Top(results, f.N, f.By, f.Others)
+}
@@ -0,0 +1,23 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/go-pluto/styx/pkg/styx"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTopFlags(t *testing.T) {
+	results := []styx.Result{{Metric: "a"}, {Metric: "b"}}
+
+	top, err := (&topFlags{By: styx.TopAvg}).top(results)
+	assert.NoError(t, err)
+	assert.Equal(t, results, top)
+
+	_, err = (&topFlags{N: -1, By: styx.TopAvg}).top(results)
+	assert.Error(t, err)
+	_, err = (&topFlags{By: styx.TopAvg, Others: true}).top(results)
+	assert.Error(t, err)
+	_, err = (&topFlags{N: 1, By: "min"}).top(nil)
+	assert.Error(t, err)
+}
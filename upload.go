@@ -0,0 +1,18 @@
+package main
+
+// isUploadURL reports whether path is an object of a cloud storage, like
+// s3://bucket/key, gs://bucket/name or az://container/name.
+func isUploadURL(path string) bool {
+	return isS3URL(path) || isGCSURL(path) || isAzureURL(path)
+}
+
+// upload uploads body to the object of the storage path points into.
+func upload(path string, body []byte) error {
+	switch {
+	case isGCSURL(path):
+		return uploadGCS(path, body)
+	case isAzureURL(path):
+		return uploadAzure(path, body)
+	}
+	return uploadS3(path, body)
+}
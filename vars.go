@@ -0,0 +1,109 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/urfave/cli"
+)
+
+// varFlags are the flags of commands with variables in their queries.
+type varFlags struct {
+	Vars   cli.StringSlice
+	Expand cli.StringSlice
+}
+
+func (f *varFlags) flags() []cli.Flag {
+	return []cli.Flag{
+		cli.StringSliceFlag{
+			Name:  "var",
+			Usage: "Replace $name, ${name} or [[name]] in the queries, e.g. namespace=prod, given again for several values",
+			Value: &f.Vars,
+		},
+		cli.StringSliceFlag{
+			Name:  "expand",
+			Usage: "Run the queries once for every value of this --var, instead of matching them all with a regexp",
+			Value: &f.Expand,
+		},
+	}
+}
+
+// expand replaces the variables in the queries like Grafana does. A
+// variable given several times matches all of its values as a regexp
+// alternation, unless it's expanded: then every query is run once per
+// value, for several expanded variables once per combination. The range's
+// built-in variables like $__interval and $__range are always replaced.
+func (f *varFlags) expand(queries []string, builtins map[string]string) ([]string, error) {
+	var names []string
+	values := make(map[string][]string)
+	for _, v := range f.Vars {
+		name, value, err := parseKeyValue(v)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := values[name]; !ok {
+			names = append(names, name)
+		}
+		values[name] = append(values[name], value)
+	}
+
+	expanded := make(map[string]bool)
+	for _, name := range f.Expand {
+		if _, ok := values[name]; !ok {
+			return nil, fmt.Errorf("can't expand %s, it isn't given with --var", name)
+		}
+		expanded[name] = true
+	}
+
+	vars := make(map[string]string, len(builtins)+len(names))
+	for name, value := range builtins {
+		vars[name] = value
+	}
+	for _, name := range names {
+		if !expanded[name] {
+			vars[name] = varValue(values[name], "")
+		}
+	}
+
+	// Every query with every combination of the expanded variables, the
+	// last one given varying fastest.
+	combinations := []map[string]string{{}}
+	for _, name := range f.Expand {
+		var next []map[string]string
+		for _, c := range combinations {
+			for _, value := range values[name] {
+				combination := map[string]string{name: value}
+				for n, v := range c {
+					combination[n] = v
+				}
+				next = append(next, combination)
+			}
+		}
+		combinations = next
+	}
+
+	var result []string
+	for _, query := range queries {
+		for _, c := range combinations {
+			for name, value := range c {
+				vars[name] = value
+			}
+			result = append(result, expandVars(query, vars))
+		}
+	}
+	return result, nil
+}
+
+// rangeVars returns Grafana's built-in variables of the range from start
+// to end queried at a step of seconds.
+func rangeVars(start, end time.Time, step int) map[string]string {
+	interval := time.Duration(step) * time.Second
+	return map[string]string{
+		"__interval":      promDuration(interval),
+		"__rate_interval": promDuration(rateInterval(interval)),
+		"__range":         promDuration(end.Sub(start)),
+		"__range_s":       strconv.FormatInt(int64(end.Sub(start).Seconds()), 10),
+		"__range_ms":      strconv.FormatInt(int64(end.Sub(start)/time.Millisecond), 10),
+	}
+}
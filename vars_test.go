@@ -0,0 +1,62 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/urfave/cli"
+)
+
+func TestVarFlagsExpand(t *testing.T) {
+	f := varFlags{Vars: cli.StringSlice{"namespace=prod", "pod=.*api.*"}}
+	queries, err := f.expand([]string{`rate(requests{namespace="$namespace",pod=~"${pod}"}[$__rate_interval])`}, map[string]string{"__rate_interval": "1m"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{`rate(requests{namespace="prod",pod=~".*api.*"}[1m])`}, queries)
+
+	// Several values are a regexp alternation, unless they're expanded.
+	f = varFlags{Vars: cli.StringSlice{"namespace=prod", "namespace=staging", "job=a", "job=b"}}
+	queries, err = f.expand([]string{`up{namespace=~"$namespace",job="$job"}`}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{`up{namespace=~"(prod|staging)",job="(a|b)"}`}, queries)
+
+	f.Expand = cli.StringSlice{"namespace", "job"}
+	queries, err = f.expand([]string{`up{namespace="$namespace",job="$job"}`, `count(up{namespace="$namespace"})`}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		`up{namespace="prod",job="a"}`,
+		`up{namespace="prod",job="b"}`,
+		`up{namespace="staging",job="a"}`,
+		`up{namespace="staging",job="b"}`,
+		`count(up{namespace="prod"})`,
+		`count(up{namespace="prod"})`,
+		`count(up{namespace="staging"})`,
+		`count(up{namespace="staging"})`,
+	}, queries)
+
+	// A variable doesn't replace the start of longer names.
+	f = varFlags{Vars: cli.StringSlice{"job=x"}}
+	queries, err = f.expand([]string{`up{job="$job",jobs="$jobs",name="$job_name"}`}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{`up{job="x",jobs="$jobs",name="$job_name"}`}, queries)
+
+	// Replacements like $1 of label_replace aren't variables.
+	queries, err = (&varFlags{}).expand([]string{`label_replace(up, "host", "$1", "instance", "(.*):.*")`}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{`label_replace(up, "host", "$1", "instance", "(.*):.*")`}, queries)
+
+	_, err = (&varFlags{Expand: cli.StringSlice{"pod"}}).expand([]string{"up"}, nil)
+	assert.Error(t, err)
+	_, err = (&varFlags{Vars: cli.StringSlice{"pod"}}).expand([]string{"up"}, nil)
+	assert.Error(t, err)
+}
+
+func TestRangeVars(t *testing.T) {
+	start := time.Unix(1500000000, 0)
+	vars := rangeVars(start, start.Add(6*time.Hour), 30)
+	assert.Equal(t, "30s", vars["__interval"])
+	assert.Equal(t, "60s", vars["__rate_interval"])
+	assert.Equal(t, "21600s", vars["__range"])
+	assert.Equal(t, "21600", vars["__range_s"])
+	assert.Equal(t, "21600000", vars["__range_ms"])
+}
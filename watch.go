@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/go-pluto/styx/pkg/styx"
+)
+
+// checkAppend returns why the export can't be appended to by the option,
+// if it can't. Only rows of csv can be added to an output already written.
+func checkAppend(option string) error {
+	switch {
+	case flag.Format != "csv" && flag.Format != "tidy":
+		return fmt.Errorf("%s only appends to the csv and tidy formats", option)
+	case flag.Summary:
+		return fmt.Errorf("%s can't append to a --summary", option)
+	case flag.Instant:
+		return fmt.Errorf("%s needs a range query, not an --instant one", option)
+	case flag.Rate || flag.Delta:
+		return fmt.Errorf("%s can't be combined with --rate or --delta", option)
+	case flag.SplitByDay || flag.Checkpoint != "":
+		return fmt.Errorf("%s can't be combined with --split-by-day or --checkpoint", option)
+	case flag.compression(flag.Output) != "" || isUploadURL(flag.Output):
+		return fmt.Errorf("%s can't append to compressed or uploaded outputs", option)
+	}
+	return nil
+}
+
+// watch queries the samples after the exported ones every --watch interval
+// and appends their rows to the output, until Ctrl-C or the --timeout.
+// The series keep the columns of the first export, new ones are skipped.
+// With a state it's saved after every append, so a rerun continues there.
+func watch(ctx context.Context, queries []string, series []styx.Result, end time.Time, opts styx.Options, state *exportState) error {
+	last := lastTime(series)
+	if last.IsZero() {
+		last = end
+	}
+
+	var out io.Writer = os.Stdout
+	if flag.Output != "" {
+		f, err := os.OpenFile(flag.Output, os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		out = f
+	}
+	// The header was written with the first rows.
+	flag.Header = false
+
+	ticker := time.NewTicker(flag.Watch)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+
+		// Continue on the grid of the first export, so the steps line up.
+		start := last.Add(time.Duration(opts.Step) * time.Second)
+		end = time.Now()
+		if end.Before(start) {
+			continue
+		}
+
+		results, err := watchQuery(queries, start, end, opts)
+		if err != nil {
+			// The next poll might succeed, e.g. once Prometheus is back.
+			fmt.Fprintln(os.Stderr, color.RedString(err.Error()))
+			continue
+		}
+		results = alignSeries(series, results)
+
+		t := lastTime(results)
+		if t.IsZero() {
+			continue
+		}
+		last = t
+
+		if flag.Grid {
+			results = styx.FillGrid(results, start, end, opts.Step, styx.Missing)
+		}
+		results, err = flag.Fill.fill(results)
+		if err != nil {
+			return err
+		}
+		if err := writeResults(out, results); err != nil {
+			return err
+		}
+		if state != nil {
+			if err := state.save(results); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// watchQuery runs all queries between start and end, queries without
+// timeseries are fine as their series may come back.
+func watchQuery(queries []string, start, end time.Time, opts styx.Options) ([]styx.Result, error) {
+	sets, err := queryEach(queries, &opts, func(query string, opts *styx.Options) ([]styx.Result, error) {
+		return styx.Query(flag.Prometheus, start, end, query, *opts)
+	})
+	if err != nil {
+		return nil, err
+	}
+	var results []styx.Result
+	for i, queried := range sets {
+		if len(queries) > 1 {
+			queried = nameUnlabeled(queried, queries[i])
+		}
+		results = append(results, queried...)
+	}
+	return results, nil
+}
+
+// alignSeries returns the results in the order of series, with empty ones
+// for series that have no new samples, so every row has the same columns.
+func alignSeries(series, results []styx.Result) []styx.Result {
+	byID := make(map[string]styx.Result, len(results))
+	for _, result := range results {
+		byID[styx.SeriesID(result)] = result
+	}
+
+	aligned := make([]styx.Result, len(series))
+	for i, s := range series {
+		result, ok := byID[styx.SeriesID(s)]
+		if !ok {
+			result = styx.Result{Metric: s.Metric, Labels: s.Labels}
+		}
+		aligned[i] = result
+	}
+	return aligned
+}
+
+// lastTime returns the time of the latest sample of the results, zero if
+// there is none.
+func lastTime(results []styx.Result) time.Time {
+	var last int64
+	for _, result := range results {
+		if n := len(result.Times); n > 0 && result.Times[n-1] > last {
+			last = result.Times[n-1]
+		}
+	}
+	if last == 0 {
+		return time.Time{}
+	}
+	return time.Unix(last, 0)
+}
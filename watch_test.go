@@ -0,0 +1,39 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/go-pluto/styx/pkg/styx"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAlignSeries(t *testing.T) {
+	series := []styx.Result{
+		{Metric: `up{job="a"}`, Labels: map[string]string{"job": "a"}, Times: []int64{1502791200}, Values: []float64{1}},
+		{Metric: `up{job="b"}`, Labels: map[string]string{"job": "b"}, Times: []int64{1502791200}, Values: []float64{1}},
+	}
+	results := []styx.Result{
+		{Metric: `up{job="c"}`, Labels: map[string]string{"job": "c"}, Times: []int64{1502791215}, Values: []float64{1}},
+		{Metric: `up{job="b"}`, Labels: map[string]string{"job": "b"}, Times: []int64{1502791215}, Values: []float64{0}},
+	}
+
+	aligned := alignSeries(series, results)
+	assert.Len(t, aligned, 2)
+	assert.Equal(t, `up{job="a"}`, aligned[0].Metric)
+	assert.Empty(t, aligned[0].Values)
+	assert.Equal(t, `up{job="b"}`, aligned[1].Metric)
+	assert.Equal(t, []int64{1502791215}, aligned[1].Times)
+	assert.Equal(t, []float64{0}, aligned[1].Values)
+}
+
+func TestLastTime(t *testing.T) {
+	last := lastTime([]styx.Result{
+		{Times: []int64{1502791200, 1502791215}, Values: []float64{1, 1}},
+		{Times: []int64{1502791230}, Values: []float64{1}},
+	})
+	assert.Equal(t, time.Unix(1502791230, 0), last)
+
+	last = lastTime([]styx.Result{{}})
+	assert.True(t, last.IsZero())
+}
@@ -0,0 +1,731 @@
+package main
+
+import (
+	"encoding/binary"
+	"io"
+	"math"
+	"math/bits"
+	"sort"
+	"strings"
+)
+
+// zstdWriter compresses what's written into a Zstandard frame (RFC 8878).
+// It's a small encoder finding matches greedily within blocks of 128 KiB,
+// encoding them with the predefined FSE tables and the literals with a
+// Huffman code. That's not the ratio of zstd itself but about the one of
+// gzip, at the speed and with the tooling of zstd.
+type zstdWriter struct {
+	w       io.Writer
+	block   []byte
+	started bool
+	err     error
+	rep     [3]uint32
+
+	table [1 << zstdHashLog]int32
+}
+
+const (
+	zstdMagic      = 0xFD2FB528
+	zstdBlockSize  = 128 << 10
+	zstdHashLog    = 15
+	zstdMinMatch   = 4
+	zstdBlockRaw   = 0
+	zstdBlockCompr = 2
+)
+
+// isZstd reports whether path names a zstd compressed file.
+func isZstd(path string) bool {
+	return strings.HasSuffix(path, ".zst")
+}
+
+func newZstdWriter(w io.Writer) *zstdWriter {
+	return &zstdWriter{w: w, block: make([]byte, 0, zstdBlockSize), rep: [3]uint32{1, 4, 8}}
+}
+
+// writeZstd compresses everything write writes to w. Like with gzip the
+// frame is closed even if write fails.
+func writeZstd(w io.Writer, write func(io.Writer) error) error {
+	zw := newZstdWriter(w)
+	if err := write(zw); err != nil {
+		zw.Close()
+		return err
+	}
+	return zw.Close()
+}
+
+func (z *zstdWriter) Write(p []byte) (int, error) {
+	if z.err != nil {
+		return 0, z.err
+	}
+	n := len(p)
+	for len(p) > 0 {
+		if len(z.block) == zstdBlockSize {
+			z.flush(false)
+			if z.err != nil {
+				return n - len(p), z.err
+			}
+		}
+		free := zstdBlockSize - len(z.block)
+		if free > len(p) {
+			free = len(p)
+		}
+		z.block = append(z.block, p[:free]...)
+		p = p[free:]
+	}
+	return n, nil
+}
+
+// Close writes the last block, the writer to w isn't closed.
+func (z *zstdWriter) Close() error {
+	if z.err == nil {
+		z.flush(true)
+	}
+	return z.err
+}
+
+// flush writes the buffered block, the frame header in front of the first.
+func (z *zstdWriter) flush(last bool) {
+	var out []byte
+	if !z.started {
+		z.started = true
+		out = binary.LittleEndian.AppendUint32(out, zstdMagic)
+		// No content size, dictionary or checksum; a window of 128 KiB
+		// (exponent 7 over 1 KiB) as matches don't leave their block.
+		out = append(out, 0x00, 7<<3)
+	}
+
+	rep := z.rep
+	compressed := zstdCompressBlock(z.block, z.table[:], &rep)
+	blockType, body := zstdBlockCompr, compressed
+	if compressed == nil || len(compressed) >= len(z.block) {
+		blockType, body = zstdBlockRaw, z.block
+	} else {
+		// Only compressed blocks move the repeated offsets on.
+		z.rep = rep
+	}
+	header := uint32(len(body))<<3 | uint32(blockType)<<1
+	if last {
+		header |= 1
+	}
+	out = append(out, byte(header), byte(header>>8), byte(header>>16))
+	out = append(out, body...)
+
+	_, z.err = z.w.Write(out)
+	z.block = z.block[:0]
+}
+
+// zstdSequence is a run of literals followed by a match, its offset as
+// coded: 1 repeats the last offset, others are the offset plus 3.
+type zstdSequence struct {
+	litLen, matchLen, offset uint32
+}
+
+// zstdCompressBlock returns the compressed block of src, or nil if it
+// isn't worth it. rep are the last offsets of the frame, which matches
+// check first as rows of a CSV tend to repeat them.
+func zstdCompressBlock(src []byte, table []int32, rep *[3]uint32) []byte {
+	if len(src) < 64 {
+		return nil
+	}
+	for i := range table {
+		table[i] = -1
+	}
+
+	var seqs []zstdSequence
+	var literals []byte
+	anchor := 0
+	for i := 0; i+zstdMinMatch+4 <= len(src); {
+		cur := binary.LittleEndian.Uint32(src[i:])
+		h := zstdHash(cur)
+		candidate := int(table[h])
+		table[h] = int32(i)
+
+		repeat := i > anchor && i >= int(rep[0]) && binary.LittleEndian.Uint32(src[i-int(rep[0]):]) == cur
+		if repeat {
+			candidate = i - int(rep[0])
+		} else if candidate < 0 || binary.LittleEndian.Uint32(src[candidate:]) != cur {
+			i++
+			continue
+		}
+
+		// Extend the match forward and back over pending literals.
+		end := i + zstdMinMatch
+		for end < len(src) && src[end] == src[end-i+candidate] {
+			end++
+		}
+		if !repeat {
+			// Short matches far away cost more bits than their literals.
+			if 4*(end-i) < 12+bits.Len(uint(i-candidate)) {
+				i++
+				continue
+			}
+			for i > anchor && candidate > 0 && src[i-1] == src[candidate-1] {
+				i--
+				candidate--
+			}
+		}
+
+		seq := zstdSequence{litLen: uint32(i - anchor), matchLen: uint32(end - i), offset: 1}
+		if offset := uint32(i - candidate); !repeat || seq.litLen == 0 {
+			seq.offset = offset + 3
+			rep[0], rep[1], rep[2] = offset, rep[0], rep[1]
+		}
+		literals = append(literals, src[anchor:i]...)
+		seqs = append(seqs, seq)
+
+		// Index some positions of the match for the next ones.
+		for j := i + 1; j < end && j+4 <= len(src); j += 3 {
+			table[zstdHash(binary.LittleEndian.Uint32(src[j:]))] = int32(j)
+		}
+		i, anchor = end, end
+	}
+	if len(seqs) == 0 {
+		return nil
+	}
+	literals = append(literals, src[anchor:]...)
+
+	out := zstdHuffmanLiterals(literals)
+	if out == nil {
+		switch n := len(literals); {
+		case n < 32:
+			out = append(out, byte(n<<3))
+		case n < 4096:
+			out = append(out, byte(1<<2|(n&0xF)<<4), byte(n>>4))
+		default:
+			out = append(out, byte(3<<2|(n&0xF)<<4), byte(n>>4), byte(n>>12))
+		}
+		out = append(out, literals...)
+	}
+
+	// Sequences section with the predefined tables.
+	switch n := len(seqs); {
+	case n < 128:
+		out = append(out, byte(n))
+	case n < 0x7F00:
+		out = append(out, byte(n>>8+128), byte(n))
+	default:
+		n -= 0x7F00
+		out = append(out, 0xFF, byte(n), byte(n>>8))
+	}
+	return append(out, zstdEncodeSequences(seqs)...)
+}
+
+// zstdHuffmanLiterals returns the literals section with the literals in
+// four Huffman coded streams, or nil if they are stored better raw. The
+// weights of the code are written directly, which takes symbols up to 128
+// as in text.
+func zstdHuffmanLiterals(literals []byte) []byte {
+	n := len(literals)
+	if n < 256 || n >= 1<<18 {
+		return nil
+	}
+	freq := make([]int, 256)
+	last := 0
+	for _, c := range literals {
+		freq[c]++
+		if int(c) > last {
+			last = int(c)
+		}
+	}
+	if last > 128 {
+		return nil
+	}
+	lengths := huffmanLengths(freq[:last+1], zstdHuffmanMaxBits)
+	if lengths == nil {
+		return nil
+	}
+
+	maxBits := uint8(0)
+	for _, l := range lengths {
+		if l > maxBits {
+			maxBits = l
+		}
+	}
+	weights := make([]uint8, last+1)
+	for s, l := range lengths {
+		if l > 0 {
+			weights[s] = maxBits + 1 - l
+		}
+	}
+
+	// Codes are assigned by increasing weight, then symbol.
+	codes := make([]uint16, last+1)
+	pos := 0
+	for w := uint8(1); w <= maxBits; w++ {
+		for s := range weights {
+			if weights[s] == w {
+				codes[s] = uint16(pos >> (w - 1))
+				pos += 1 << (w - 1)
+			}
+		}
+	}
+
+	// The weight of the last symbol is implied.
+	tree := []byte{byte(127 + last)}
+	for s := 0; s < last; s += 2 {
+		b := weights[s] << 4
+		if s+1 < last {
+			b |= weights[s+1]
+		}
+		tree = append(tree, b)
+	}
+
+	segment := (n + 3) / 4
+	var streams [4][]byte
+	for i := range streams {
+		start, end := i*segment, (i+1)*segment
+		if end > n || i == 3 {
+			end = n
+		}
+		var bw zstdBitWriter
+		for j := end - 1; j >= start; j-- {
+			c := literals[j]
+			bw.add(uint32(codes[c]), lengths[c])
+		}
+		streams[i] = bw.close()
+	}
+
+	size := len(tree) + 6
+	for _, stream := range streams {
+		size += len(stream)
+	}
+	if size >= n {
+		return nil
+	}
+
+	var out []byte
+	switch {
+	case n < 1<<10 && size < 1<<10:
+		h := uint32(2) | 1<<2 | uint32(n)<<4 | uint32(size)<<14
+		out = append(out, byte(h), byte(h>>8), byte(h>>16))
+	case n < 1<<14 && size < 1<<14:
+		h := uint32(2) | 2<<2 | uint32(n)<<4 | uint32(size)<<18
+		out = append(out, byte(h), byte(h>>8), byte(h>>16), byte(h>>24))
+	default:
+		h := uint64(2) | 3<<2 | uint64(n)<<4 | uint64(size)<<22
+		out = append(out, byte(h), byte(h>>8), byte(h>>16), byte(h>>24), byte(h>>32))
+	}
+	out = append(out, tree...)
+	for _, stream := range streams[:3] {
+		out = append(out, byte(len(stream)), byte(len(stream)>>8))
+	}
+	for _, stream := range streams {
+		out = append(out, stream...)
+	}
+	return out
+}
+
+const zstdHuffmanMaxBits = 11
+
+// huffmanLengths returns the lengths of a Huffman code of the frequencies
+// of no more than maxBits, nil if fewer than two symbols occur. Codes that
+// get too long are shortened by flattening the frequencies.
+func huffmanLengths(freq []int, maxBits uint8) []uint8 {
+	type node struct {
+		weight      int
+		symbol      int
+		left, right *node
+	}
+	for {
+		var nodes []*node
+		for s, f := range freq {
+			if f > 0 {
+				nodes = append(nodes, &node{weight: f, symbol: s})
+			}
+		}
+		if len(nodes) < 2 {
+			return nil
+		}
+		sort.Slice(nodes, func(i, j int) bool { return nodes[i].weight < nodes[j].weight })
+
+		// Two queues: the leaves and the merged nodes, both ascending.
+		var merged []*node
+		pop := func() *node {
+			if len(merged) == 0 || (len(nodes) > 0 && nodes[0].weight <= merged[0].weight) {
+				n := nodes[0]
+				nodes = nodes[1:]
+				return n
+			}
+			n := merged[0]
+			merged = merged[1:]
+			return n
+		}
+		for len(nodes)+len(merged) > 1 {
+			a, b := pop(), pop()
+			merged = append(merged, &node{weight: a.weight + b.weight, symbol: -1, left: a, right: b})
+		}
+
+		lengths := make([]uint8, len(freq))
+		tooLong := false
+		var walk func(n *node, depth uint8)
+		walk = func(n *node, depth uint8) {
+			if n.symbol >= 0 {
+				lengths[n.symbol] = depth
+				tooLong = tooLong || depth > maxBits
+				return
+			}
+			walk(n.left, depth+1)
+			walk(n.right, depth+1)
+		}
+		walk(merged[0], 0)
+		if !tooLong {
+			return lengths
+		}
+
+		flattened := make([]int, len(freq))
+		for s, f := range freq {
+			if f > 0 {
+				flattened[s] = f/2 + 1
+			}
+		}
+		freq = flattened
+	}
+}
+
+func zstdHash(u uint32) uint32 {
+	return (u * 2654435761) >> (32 - zstdHashLog)
+}
+
+// zstdEncodeSequences writes the compression modes and the bitstream of
+// the sequences, which is read backwards, so the last sequence is written
+// first.
+func zstdEncodeSequences(seqs []zstdSequence) []byte {
+	n := len(seqs)
+	llCodes, mlCodes, ofCodes := make([]uint8, n), make([]uint8, n), make([]uint8, n)
+	for i, seq := range seqs {
+		llCodes[i] = zstdLitLenCode(seq.litLen)
+		mlCodes[i] = zstdMatchLenCode(seq.matchLen)
+		ofCodes[i] = uint8(bits.Len32(seq.offset) - 1)
+	}
+
+	llTable, llMode, llDesc := zstdFitTable(llCodes, zstdLitLenTable, 9)
+	ofTable, ofMode, ofDesc := zstdFitTable(ofCodes, zstdOffsetTable, 8)
+	mlTable, mlMode, mlDesc := zstdFitTable(mlCodes, zstdMatchLenTable, 9)
+	out := []byte{llMode<<6 | ofMode<<4 | mlMode<<2}
+	out = append(append(append(out, llDesc...), ofDesc...), mlDesc...)
+
+	var bw zstdBitWriter
+	ll := llTable.stateFor(llCodes[n-1])
+	ml := mlTable.stateFor(mlCodes[n-1])
+	of := ofTable.stateFor(ofCodes[n-1])
+	for i := n - 1; i >= 0; i-- {
+		if i < n-1 {
+			of = ofTable.encode(&bw, ofCodes[i], of)
+			ml = mlTable.encode(&bw, mlCodes[i], ml)
+			ll = llTable.encode(&bw, llCodes[i], ll)
+		}
+		seq := seqs[i]
+		llCode, mlCode, ofCode := llCodes[i], mlCodes[i], ofCodes[i]
+		bw.add(seq.litLen-zstdLitLenBase[llCode], zstdLitLenBits[llCode])
+		bw.add(seq.matchLen-zstdMatchLenBase[mlCode], zstdMatchLenBits[mlCode])
+		bw.add(seq.offset-1<<ofCode, ofCode)
+	}
+	bw.add(uint32(ml), mlTable.log)
+	bw.add(uint32(of), ofTable.log)
+	bw.add(uint32(ll), llTable.log)
+	return append(out, bw.close()...)
+}
+
+// Compression modes of the codes of sequences.
+const (
+	zstdModePredefined = 0
+	zstdModeRLE        = 1
+	zstdModeCompressed = 2
+)
+
+// zstdFitTable returns the table to encode the codes with, its mode and
+// description: a single code is repeated, otherwise a table normalized to
+// the counts of the codes is used if it's smaller than the predefined one.
+func zstdFitTable(codes []uint8, predefined *zstdFSETable, maxLog uint8) (*zstdFSETable, byte, []byte) {
+	counts := make([]int, len(predefined.states))
+	distinct, last := 0, 0
+	for _, c := range codes {
+		if counts[c] == 0 {
+			distinct++
+		}
+		counts[c]++
+		if int(c) > last {
+			last = int(c)
+		}
+	}
+	if distinct == 1 {
+		dist := make([]int16, last+1)
+		dist[last] = 1
+		return newZstdFSETable(0, dist), zstdModeRLE, []byte{byte(last)}
+	}
+
+	log := uint8(bits.Len(uint(len(codes))) - 2)
+	if log > maxLog {
+		log = maxLog
+	}
+	if min := uint8(bits.Len(uint(distinct))); log < min {
+		log = min
+	}
+	if log < 5 {
+		log = 5
+	}
+	dist := zstdNormalize(counts[:last+1], log)
+	if dist == nil {
+		return predefined, zstdModePredefined, nil
+	}
+	desc := zstdWriteDistribution(dist, log)
+
+	// Compare the bits to code with either table.
+	custom, pre := float64(8*len(desc)), 0.0
+	preSize := float64(int(1) << predefined.log)
+	for c, count := range counts[:last+1] {
+		if count == 0 {
+			continue
+		}
+		custom -= float64(count) * math.Log2(float64(dist[c])/float64(int(1)<<log))
+		p := float64(predefined.dist[c])
+		if p <= 0 {
+			p = 1
+		}
+		pre -= float64(count) * math.Log2(p/preSize)
+	}
+	if custom >= pre {
+		return predefined, zstdModePredefined, nil
+	}
+	return newZstdFSETable(log, dist), zstdModeCompressed, desc
+}
+
+// zstdNormalize scales the counts to probabilities summing up to 1<<log,
+// at least 1 for every code that occurs. It returns nil if they don't fit.
+func zstdNormalize(counts []int, log uint8) []int16 {
+	total := 0
+	for _, count := range counts {
+		total += count
+	}
+	size := 1 << log
+	dist := make([]int16, len(counts))
+	sum, largest := 0, 0
+	for c, count := range counts {
+		if count == 0 {
+			continue
+		}
+		p := (count*size + total/2) / total
+		if p < 1 {
+			p = 1
+		}
+		dist[c] = int16(p)
+		sum += p
+		if p > int(dist[largest]) {
+			largest = c
+		}
+	}
+	// The largest probability takes up what's left over or missing.
+	p := int(dist[largest]) + size - sum
+	if p < 1 {
+		return nil
+	}
+	dist[largest] = int16(p)
+	return dist
+}
+
+// zstdWriteDistribution writes the description of the distribution, read
+// forwards: its accuracy and the probabilities in as few bits as their
+// remaining total allows, with runs of zeros after a zero.
+func zstdWriteDistribution(dist []int16, log uint8) []byte {
+	var bw zstdBitWriter
+	bw.add(uint32(log-5), 4)
+
+	size := 1 << log
+	remaining, threshold, nbBits := size+1, size, log+1
+	for s := 0; s < len(dist) && remaining > 1; {
+		count := int(dist[s])
+		s++
+		max := 2*threshold - 1 - remaining
+		remaining -= count
+		value := count + 1
+		if value >= threshold {
+			value += max
+		}
+		if value < max {
+			bw.add(uint32(value), nbBits-1)
+		} else {
+			bw.add(uint32(value), nbBits)
+		}
+		for remaining < threshold {
+			nbBits--
+			threshold >>= 1
+		}
+
+		if count == 0 {
+			start := s
+			for s < len(dist) && dist[s] == 0 {
+				s++
+			}
+			for ; s >= start+24; start += 24 {
+				bw.add(0xFFFF, 16)
+			}
+			for ; s >= start+3; start += 3 {
+				bw.add(3, 2)
+			}
+			bw.add(uint32(s-start), 2)
+		}
+	}
+	if bw.nbits > 0 {
+		bw.out = append(bw.out, byte(bw.acc))
+	}
+	return bw.out
+}
+
+// zstdBitWriter writes bits from the least significant on.
+type zstdBitWriter struct {
+	out   []byte
+	acc   uint64
+	nbits uint8
+}
+
+func (b *zstdBitWriter) add(value uint32, n uint8) {
+	b.acc |= uint64(value&(1<<n-1)) << b.nbits
+	b.nbits += n
+	for b.nbits >= 8 {
+		b.out = append(b.out, byte(b.acc))
+		b.acc >>= 8
+		b.nbits -= 8
+	}
+}
+
+// close ends the stream with a 1 bit marking where it starts when read
+// backwards.
+func (b *zstdBitWriter) close() []byte {
+	b.add(1, 1)
+	if b.nbits > 0 {
+		b.out = append(b.out, byte(b.acc))
+	}
+	return b.out
+}
+
+// zstdFSETable is an FSE table built from a distribution, with the
+// decoder's transitions inverted for encoding.
+type zstdFSETable struct {
+	log    uint8
+	dist   []int16
+	symbol []uint8
+	nbBits []uint8
+	base   []uint16
+	// states[s][next] is the state for the symbol s whose transition
+	// leads to the state next.
+	states [][]uint16
+}
+
+func newZstdFSETable(log uint8, dist []int16) *zstdFSETable {
+	size := 1 << log
+	t := &zstdFSETable{
+		log:    log,
+		dist:   dist,
+		symbol: make([]uint8, size),
+		nbBits: make([]uint8, size),
+		base:   make([]uint16, size),
+		states: make([][]uint16, len(dist)),
+	}
+
+	high := size - 1
+	next := make([]int, len(dist))
+	for s, p := range dist {
+		if p == -1 {
+			t.symbol[high] = uint8(s)
+			high--
+			next[s] = 1
+		} else {
+			next[s] = int(p)
+		}
+	}
+	pos, step := 0, size>>1+size>>3+3
+	for s, p := range dist {
+		for i := 0; i < int(p); i++ {
+			t.symbol[pos] = uint8(s)
+			for pos = (pos + step) & (size - 1); pos > high; pos = (pos + step) & (size - 1) {
+			}
+		}
+	}
+
+	for s := range dist {
+		t.states[s] = make([]uint16, size)
+	}
+	for u := 0; u < size; u++ {
+		s := t.symbol[u]
+		x := next[s]
+		next[s]++
+		t.nbBits[u] = log - uint8(bits.Len(uint(x))-1)
+		t.base[u] = uint16(x<<t.nbBits[u] - size)
+		for v := int(t.base[u]); v < int(t.base[u])+1<<t.nbBits[u]; v++ {
+			t.states[s][v] = uint16(u)
+		}
+	}
+	return t
+}
+
+// stateFor returns a state decoding to s, the one of the last symbol.
+func (t *zstdFSETable) stateFor(s uint8) uint16 {
+	return t.states[s][0]
+}
+
+// encode writes the bits moving from the state of s to next and returns
+// that state.
+func (t *zstdFSETable) encode(bw *zstdBitWriter, s uint8, next uint16) uint16 {
+	state := t.states[s][next]
+	bw.add(uint32(next-t.base[state]), t.nbBits[state])
+	return state
+}
+
+var (
+	zstdLitLenTable = newZstdFSETable(6, []int16{
+		4, 3, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 1, 1, 1,
+		2, 2, 2, 2, 2, 2, 2, 2, 2, 3, 2, 1, 1, 1, 1, 1,
+		-1, -1, -1, -1,
+	})
+	zstdMatchLenTable = newZstdFSETable(6, []int16{
+		1, 4, 3, 2, 2, 2, 2, 2, 2, 1, 1, 1, 1, 1, 1, 1,
+		1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1,
+		1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, -1, -1,
+		-1, -1, -1, -1, -1,
+	})
+	zstdOffsetTable = newZstdFSETable(5, []int16{
+		1, 1, 1, 1, 1, 1, 2, 2, 2, 1, 1, 1, 1, 1, 1, 1,
+		1, 1, 1, 1, 1, 1, 1, 1, -1, -1, -1, -1, -1,
+	})
+
+	zstdLitLenBase = []uint32{
+		0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15,
+		16, 18, 20, 22, 24, 28, 32, 40, 48, 64, 128, 256, 512, 1024, 2048, 4096,
+		8192, 16384, 32768, 65536,
+	}
+	zstdLitLenBits = []uint8{
+		0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+		1, 1, 1, 1, 2, 2, 3, 3, 4, 6, 7, 8, 9, 10, 11, 12,
+		13, 14, 15, 16,
+	}
+	zstdMatchLenBase = []uint32{
+		3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17, 18,
+		19, 20, 21, 22, 23, 24, 25, 26, 27, 28, 29, 30, 31, 32, 33, 34,
+		35, 37, 39, 41, 43, 47, 51, 59, 67, 83, 99, 131, 259, 515, 1027, 2051,
+		4099, 8195, 16387, 32771, 65539,
+	}
+	zstdMatchLenBits = []uint8{
+		0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+		0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+		1, 1, 1, 1, 2, 2, 3, 3, 4, 4, 5, 7, 8, 9, 10, 11,
+		12, 13, 14, 15, 16,
+	}
+)
+
+// zstdLitLenCode returns the code of a literal length.
+func zstdLitLenCode(n uint32) uint8 {
+	for code := len(zstdLitLenBase) - 1; ; code-- {
+		if zstdLitLenBase[code] <= n {
+			return uint8(code)
+		}
+	}
+}
+
+// zstdMatchLenCode returns the code of a match length.
+func zstdMatchLenCode(n uint32) uint8 {
+	for code := len(zstdMatchLenBase) - 1; ; code-- {
+		if zstdMatchLenBase[code] <= n {
+			return uint8(code)
+		}
+	}
+}
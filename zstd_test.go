@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// zstdFrame returns the blocks of a frame written by zstdWriter.
+func zstdFrame(t *testing.T, frame []byte) (types []int, sizes []int) {
+	assert.Equal(t, []byte{0x28, 0xB5, 0x2F, 0xFD, 0x00, 7 << 3}, frame[:6])
+	frame = frame[6:]
+	for len(frame) > 0 {
+		header := int(frame[0]) | int(frame[1])<<8 | int(frame[2])<<16
+		size := header >> 3
+		types, sizes = append(types, header>>1&3), append(sizes, size)
+		frame = frame[3+size:]
+		if header&1 == 1 {
+			assert.Empty(t, frame)
+			break
+		}
+	}
+	return types, sizes
+}
+
+func TestZstdWriter(t *testing.T) {
+	// An empty frame still has a last block.
+	buf := bytes.NewBuffer(nil)
+	assert.NoError(t, writeZstd(buf, func(w io.Writer) error { return nil }))
+	types, sizes := zstdFrame(t, buf.Bytes())
+	assert.Equal(t, []int{zstdBlockRaw}, types)
+	assert.Equal(t, []int{0}, sizes)
+
+	var csv strings.Builder
+	csv.WriteString("Time,up{job=\"node\"},up{job=\"prometheus\"}\n")
+	for i := 0; i < 15000; i++ {
+		csv.WriteString("15027493" + strings.Repeat(string(rune('0'+i%10)), 2) + ",1,0\n")
+	}
+
+	buf = bytes.NewBuffer(nil)
+	assert.NoError(t, writeZstd(buf, func(w io.Writer) error {
+		_, err := io.WriteString(w, csv.String())
+		return err
+	}))
+	types, sizes = zstdFrame(t, buf.Bytes())
+	assert.Equal(t, []int{zstdBlockCompr, zstdBlockCompr}, types)
+	assert.True(t, sizes[0]+sizes[1] < csv.Len()/20, sizes)
+
+	// What was written before an error is still a complete frame.
+	buf = bytes.NewBuffer(nil)
+	failed := errors.New("failed")
+	assert.Equal(t, failed, writeZstd(buf, func(w io.Writer) error {
+		w.Write([]byte("partial"))
+		return failed
+	}))
+	assert.Equal(t, "partial", string(buf.Bytes()[9:]))
+}
+
+func TestZstdFSETable(t *testing.T) {
+	// Every state of a symbol's transitions leads somewhere, so the
+	// encoder finds a state for any next one.
+	for _, table := range []*zstdFSETable{zstdLitLenTable, zstdMatchLenTable, zstdOffsetTable} {
+		for s, p := range table.dist {
+			if p == 0 {
+				continue
+			}
+			covered := 0
+			for u, symbol := range table.symbol {
+				if int(symbol) == s {
+					covered += 1 << table.nbBits[u]
+				}
+			}
+			assert.Equal(t, 1<<table.log, covered, "symbol %d", s)
+		}
+	}
+}
+
+func TestZstdNormalize(t *testing.T) {
+	dist := zstdNormalize([]int{1000, 0, 10, 1}, 5)
+	assert.Equal(t, []int16{30, 0, 1, 1}, dist)
+	assert.Nil(t, zstdNormalize([]int{1, 1, 1, 1, 1, 1, 1, 1, 1}, 3))
+}
+
+func TestHuffmanLengths(t *testing.T) {
+	assert.Nil(t, huffmanLengths([]int{0, 5, 0}, 11))
+	assert.Equal(t, []uint8{1, 2, 3, 3}, huffmanLengths([]int{8, 4, 2, 1}, 11))
+
+	// Fibonacci frequencies make the code as deep as possible.
+	freq := []int{1, 1}
+	for len(freq) < 20 {
+		freq = append(freq, freq[len(freq)-1]+freq[len(freq)-2])
+	}
+	for _, l := range huffmanLengths(freq, 11) {
+		assert.True(t, l >= 1 && l <= 11)
+	}
+}
+
+func TestIsZstd(t *testing.T) {
+	assert.True(t, isZstd("out.csv.zst"))
+	assert.False(t, isZstd("out.csv"))
+	assert.False(t, isZstd("out.zstd"))
+}